@@ -1,13 +1,23 @@
 package activities
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/bardic/pub/models"
 )
 
 const (
-	FOLLOW = "Follow"
-	LIKE   = "Like"
-	UNDO   = "Undo"
+	ADD      = "Add"
+	ANNOUNCE = "Announce"
+	CREATE   = "Create"
+	FOLLOW   = "Follow"
+	LIKE     = "Like"
+	REMOVE   = "Remove"
+	UNDO     = "Undo"
+
+	// Public is the IRI of the special collection containing everyone.
+	Public = "https://www.w3.org/ns/activitystreams#Public"
 )
 
 func Follow(actor, object *models.Actor) map[string]any {
@@ -45,3 +55,199 @@ func Unlike(actor *models.Actor, object string) map[string]any {
 		"object":   Like(actor, object),
 	}
 }
+
+// Add returns an Add activity for object, which is added to the target collection.
+func Add(actor *models.Actor, object, target string) map[string]any {
+	return map[string]any{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"type":     ADD,
+		"actor":    actor.URI,
+		"object":   object,
+		"target":   target,
+	}
+}
+
+// Remove returns a Remove activity for object, which is removed from the target collection.
+func Remove(actor *models.Actor, object, target string) map[string]any {
+	return map[string]any{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"type":     REMOVE,
+		"actor":    actor.URI,
+		"object":   object,
+		"target":   target,
+	}
+}
+
+// Create returns the Create activity for a status, embedding the status' Note.
+// The status must be loaded as for Note.
+func Create(s *models.Status) map[string]any {
+	to, cc := Audience(s)
+	return map[string]any{
+		"id":        s.URI + "/activity",
+		"type":      CREATE,
+		"actor":     s.Actor.URI,
+		"published": s.ID.ToTime().UTC().Format(time.RFC3339),
+		"to":        to,
+		"cc":        cc,
+		"object":    Note(s),
+	}
+}
+
+// Announce returns the Announce activity for a reblog. The reblog's Actor, Reblog,
+// and Reblog.Actor must be loaded.
+func Announce(s *models.Status) map[string]any {
+	to, cc := Audience(s)
+	return map[string]any{
+		"id":        s.URI,
+		"type":      ANNOUNCE,
+		"actor":     s.Actor.URI,
+		"published": s.ID.ToTime().UTC().Format(time.RFC3339),
+		"to":        to,
+		"cc":        append(cc, s.Reblog.Actor.URI),
+		"object":    s.Reblog.URI,
+	}
+}
+
+// Note returns the ActivityStreams object for a status. The status' Actor,
+// Attachments, Mentions, Tags, Poll, and InReplyTo, if it is a reply, must be loaded.
+// Statuses with a poll are Questions.
+func Note(s *models.Status) map[string]any {
+	to, cc := Audience(s)
+	published := s.ID.ToTime().UTC()
+	typ := string(s.Type)
+	if typ == "" {
+		typ = "Note"
+	}
+	note := map[string]any{
+		"id":           s.URI,
+		"type":         typ,
+		"attributedTo": s.Actor.URI,
+		"published":    published.Format(time.RFC3339),
+		"to":           to,
+		"cc":           cc,
+		"sensitive":    s.Sensitive,
+		"content":      s.Note,
+		"attachment":   attachments(s),
+		"tag":          tags(s),
+	}
+	if s.UpdatedAt.After(published) {
+		note["updated"] = s.UpdatedAt.UTC().Format(time.RFC3339)
+	}
+	if s.SpoilerText != "" {
+		note["summary"] = s.SpoilerText
+	}
+	if s.Language != "" {
+		note["contentMap"] = map[string]any{s.Language: s.Note}
+	}
+	if s.InReplyTo != nil {
+		note["inReplyTo"] = s.InReplyTo.URI
+	}
+	if s.Title != "" {
+		note["name"] = s.Title
+	}
+	if s.URL != "" {
+		note["url"] = s.URL
+	}
+	if s.Poll != nil {
+		note["type"] = "Question"
+		note["endTime"] = s.Poll.ExpiresAt.UTC().Format(time.RFC3339)
+		if s.Poll.Multiple {
+			note["anyOf"] = options(s.Poll)
+		} else {
+			note["oneOf"] = options(s.Poll)
+		}
+	}
+	return note
+}
+
+// options returns the choices of a poll as Notes with the count of their votes.
+func options(poll *models.StatusPoll) []any {
+	opts := make([]any, 0, len(poll.Options))
+	for _, opt := range poll.Options {
+		opts = append(opts, map[string]any{
+			"type": "Note",
+			"name": opt.Title,
+			"replies": map[string]any{
+				"type":       "Collection",
+				"totalItems": opt.Count,
+			},
+		})
+	}
+	return opts
+}
+
+// Audience returns the to and cc addressing of a status according to its visibility.
+func Audience(s *models.Status) (to, cc []string) {
+	followers := Followers(s.Actor)
+	mentions := make([]string, 0, len(s.Mentions))
+	for _, m := range s.Mentions {
+		if m.Actor != nil {
+			mentions = append(mentions, m.Actor.URI)
+		}
+	}
+	switch s.Visibility {
+	case "public":
+		return []string{Public}, append([]string{followers}, mentions...)
+	case "unlisted":
+		return []string{followers}, append([]string{Public}, mentions...)
+	case "private":
+		return []string{followers}, mentions
+	default:
+		return mentions, []string{}
+	}
+}
+
+// Followers returns the IRI of actor's followers collection.
+func Followers(actor *models.Actor) string {
+	if actor.FollowersURL != "" {
+		return actor.FollowersURL
+	}
+	return actor.URI + "/followers"
+}
+
+// Hashtag returns the Hashtag object for tag; href is the URL of the tag's page.
+func Hashtag(tag *models.Tag, href string) map[string]any {
+	return map[string]any{
+		"type": "Hashtag",
+		"href": href,
+		"name": "#" + tag.Name,
+	}
+}
+
+func attachments(s *models.Status) []any {
+	atts := make([]any, 0, len(s.Attachments))
+	for _, att := range s.Attachments {
+		atts = append(atts, map[string]any{
+			"type":       "Document",
+			"mediaType":  att.MediaType,
+			"url":        att.URL,
+			"name":       att.Name,
+			"blurhash":   att.Blurhash,
+			"width":      att.Width,
+			"height":     att.Height,
+			"focalPoint": []float64{att.FocalPoint.X, att.FocalPoint.Y},
+		})
+	}
+	return atts
+}
+
+func tags(s *models.Status) []any {
+	tags := make([]any, 0, len(s.Mentions)+len(s.Tags))
+	for _, m := range s.Mentions {
+		if m.Actor == nil {
+			continue
+		}
+		tags = append(tags, map[string]any{
+			"type": "Mention",
+			"href": m.Actor.URI,
+			"name": fmt.Sprintf("@%s@%s", m.Actor.Name, m.Actor.Domain),
+		})
+	}
+	for _, t := range s.Tags {
+		if t.Tag == nil {
+			continue
+		}
+		tags = append(tags, Hashtag(t.Tag, fmt.Sprintf("https://%s/tags/%s", s.Actor.Domain, t.Tag.Name)))
+	}
+	return tags
+}
@@ -5,11 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"time"
 
 	"github.com/bardic/pub/activitypub/activities"
 	"github.com/bardic/pub/internal/algorithms"
 	"github.com/bardic/pub/internal/httpx"
+	"github.com/bardic/pub/internal/snowflake"
 	"github.com/bardic/pub/internal/streaming"
 	"github.com/bardic/pub/internal/to"
 	"github.com/bardic/pub/models"
@@ -23,50 +23,95 @@ type Env struct {
 	*gorm.DB
 	*streaming.Mux
 	Logger *slog.Logger
+	// Policies are applied to statuses fetched while handling a request.
+	Policies []Policy
 }
 
 func (e *Env) Log() *slog.Logger {
 	return e.Logger
 }
 
+// collectionPageSize is the number of items in a page of the followers and following collections.
+const collectionPageSize = 40
+
 func Followers(env *Env, w http.ResponseWriter, r *http.Request) error {
-	var followers []*models.Relationship
-	query := env.DB.Joins("JOIN actors ON actors.id = relationships.target_id and actors.name = ? and actors.domain = ?", chi.URLParam(r, "name"), r.Host)
-	if err := query.Model(&models.Relationship{}).Preload("Actor").Find(&followers, "following = true").Error; err != nil {
-		return err
-	}
-	return to.JSON(w, map[string]any{
-		"@context":   "https://www.w3.org/ns/activitystreams",
-		"id":         fmt.Sprintf("https://%s%s", r.Host, r.URL.Path),
-		"type":       "OrderedCollection",
-		"totalItems": len(followers),
-		"orderedItems": algorithms.Map(
-			followers,
-			func(r *models.Relationship) string {
-				return r.Actor.URI
-			},
-		),
-	})
+	return relationships(env, w, r, "target_id", "actor_id")
 }
 
 func Following(env *Env, w http.ResponseWriter, r *http.Request) error {
-	var following []*models.Relationship
-	query := env.DB.Joins("JOIN actors ON actors.id = relationships.actor_id and actors.name = ? and actors.domain = ?", chi.URLParam(r, "name"), r.Host)
-	if err := query.Model(&models.Relationship{}).Preload("Target").Find(&following, "following = true").Error; err != nil {
+	return relationships(env, w, r, "actor_id", "target_id")
+}
+
+// relationships serves the followers or following collection of a local actor.
+// Relationships are selected where the actor is in the owner column, and the other
+// actor, the member of the collection, is in the member column. Pages are keyed by
+// the member's ID, in descending order.
+func relationships(env *Env, w http.ResponseWriter, r *http.Request, owner, member string) error {
+	var actor models.Actor
+	if err := env.DB.Take(&actor, "name = ? and domain = ?", chi.URLParam(r, "name"), r.Host).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.Error(http.StatusNotFound, err)
+		}
 		return err
 	}
-	return to.JSON(w, map[string]any{
-		"@context":   "https://www.w3.org/ns/activitystreams",
-		"id":         fmt.Sprintf("https://%s%s", r.Host, r.URL.Path),
-		"type":       "OrderedCollection",
-		"totalItems": len(following),
-		"orderedItems": algorithms.Map(
-			following,
-			func(r *models.Relationship) string {
-				return r.Target.URI
-			},
-		),
+	prefs, err := models.NewAccounts(env.DB).PreferencesForActor(&actor)
+	if err != nil {
+		return err
+	}
+
+	id := fmt.Sprintf("https://%s%s", r.Host, r.URL.Path)
+	query := env.DB.Model(&models.Relationship{}).Where(owner+" = ? and following = true", actor.ID)
+	if !parseBool(r, "page") {
+		resp := map[string]any{
+			"@context": "https://www.w3.org/ns/activitystreams",
+			"id":       id,
+			"type":     "OrderedCollection",
+		}
+		if !(prefs.HideCollections && prefs.HideCollectionsCount) {
+			var count int64
+			if err := query.Count(&count).Error; err != nil {
+				return err
+			}
+			resp["totalItems"] = count
+		}
+		if !prefs.HideCollections {
+			resp["first"] = id + "?page=true"
+		}
+		return to.JSON(w, resp)
+	}
+
+	if prefs.HideCollections {
+		return httpx.Error(http.StatusForbidden, errors.New("collection is hidden"))
+	}
+	if maxID, err := snowflake.Parse(r.URL.Query().Get("max_id")); err == nil {
+		query = query.Where(member+" < ?", maxID)
+	}
+	var rels []*models.Relationship
+	if err := query.Preload("Actor").Preload("Target").Order(member + " desc").Limit(collectionPageSize).Find(&rels).Error; err != nil {
+		return err
+	}
+	items := algorithms.Map(rels, func(rel *models.Relationship) string {
+		if member == "actor_id" {
+			return rel.Actor.URI
+		}
+		return rel.Target.URI
 	})
+	resp := map[string]any{
+		"@context":     "https://www.w3.org/ns/activitystreams",
+		"id":           fmt.Sprintf("https://%s%s", r.Host, r.URL.RequestURI()),
+		"type":         "OrderedCollectionPage",
+		"partOf":       id,
+		"orderedItems": items,
+	}
+	if len(rels) == collectionPageSize {
+		last := rels[len(rels)-1]
+		next := last.TargetID
+		if member == "actor_id" {
+			next = last.ActorID
+		}
+		resp["next"] = fmt.Sprintf("%s?page=true&max_id=%d", id, next)
+	}
+	return to.JSON(w, resp)
 }
 
 func CollectionsShow(env *Env, w http.ResponseWriter, r *http.Request) error {
@@ -78,61 +123,40 @@ func CollectionsShow(env *Env, w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
+	var items []any
+	switch chi.URLParam(r, "collection") {
+	case "featured":
+		var statuses []*models.Status
+		query := env.DB.Joins("JOIN reactions ON reactions.status_id = statuses.id AND reactions.actor_id = statuses.actor_id AND reactions.pinned = true")
+		query = query.Scopes(models.PreloadStatus).Preload("InReplyTo")
+		if err := query.Order("statuses.id desc").Find(&statuses, "statuses.actor_id = ? AND statuses.visibility IN ?", actor.ID, []string{"public", "unlisted"}).Error; err != nil {
+			return err
+		}
+		items = algorithms.Map(statuses, func(s *models.Status) any {
+			return activities.Note(s)
+		})
+	case "tags":
+		var tags []*models.FeaturedTag
+		if err := env.DB.Preload("Tag").Order("id").Find(&tags, "actor_id = ?", actor.ID).Error; err != nil {
+			return err
+		}
+		items = algorithms.Map(tags, func(t *models.FeaturedTag) any {
+			return activities.Hashtag(t.Tag, fmt.Sprintf("https://%s/tags/%s", r.Host, t.Tag.Name))
+		})
+	}
+	if items == nil {
+		items = []any{}
+	}
+
 	return to.JSON(w, map[string]any{
-		"@context":     "https://www.w3.org/ns/activitystreams",
+		"@context":     noteContext,
 		"id":           fmt.Sprintf("https://%s%s", r.Host, r.URL.Path),
 		"type":         "OrderedCollection",
-		"totalItems":   0,
-		"orderedItems": []any{},
+		"totalItems":   len(items),
+		"orderedItems": items,
 	})
 }
 
-func boolFromAny(v any) bool {
-	b, _ := v.(bool)
-	return b
-}
-
-func stringFromAny(v any) string {
-	s, _ := v.(string)
-	return s
-}
-
-func mapFromAny(v any) map[string]any {
-	m, _ := v.(map[string]any)
-	return m
-}
-
-func timeFromAny(v any) (time.Time, error) {
-	switch v := v.(type) {
-	case string:
-		return time.Parse(time.RFC3339, v)
-	case time.Time:
-		return v, nil
-	default:
-		return time.Time{}, errors.New("timeFromAny: invalid type")
-	}
-}
-
-func intFromAny(v any) int {
-	switch v := v.(type) {
-	case int:
-		return v
-	case float64:
-		// shakes fist at json number type
-		return int(v)
-	}
-	return 0
-}
-
-func anyToSlice(v any) []any {
-	switch v := v.(type) {
-	case []any:
-		return v
-	default:
-		return nil
-	}
-}
-
 // parseBool parses a boolean value from a request parameter.
 // If the parameter is not present, it returns false.
 // If the parameter is present but cannot be parsed, it returns false
@@ -196,3 +220,30 @@ func Unlike(ctx context.Context, liker *models.Account, target *models.Status) e
 	}
 	return c.Post(ctx, inbox, activities.Unlike(liker.Actor, target.URI))
 }
+
+// Pin sends an Add activity, adding the status to the featured collection of the
+// Account's Actor, to each of the inboxes.
+func Pin(ctx context.Context, pinner *models.Account, target *models.Status, inboxes []string) error {
+	return deliver(ctx, pinner, activities.Add(pinner.Actor, target.URI, pinner.Actor.URI+"/collections/featured"), inboxes)
+}
+
+// Unpin sends a Remove activity, removing the status from the featured collection of
+// the Account's Actor, to each of the inboxes.
+func Unpin(ctx context.Context, pinner *models.Account, target *models.Status, inboxes []string) error {
+	return deliver(ctx, pinner, activities.Remove(pinner.Actor, target.URI, pinner.Actor.URI+"/collections/featured"), inboxes)
+}
+
+// deliver posts the activity to each of the inboxes, signed by the Account.
+func deliver(ctx context.Context, from *models.Account, activity map[string]any, inboxes []string) error {
+	c, err := NewClient(from)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, inbox := range inboxes {
+		if err := c.Post(ctx, inbox, activity); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", inbox, err))
+		}
+	}
+	return errors.Join(errs...)
+}
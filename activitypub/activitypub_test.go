@@ -0,0 +1,158 @@
+package activitypub
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bardic/pub/internal/httpx"
+	"github.com/bardic/pub/internal/snowflake"
+	"github.com/bardic/pub/models"
+	"github.com/go-json-experiment/json"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestRelationships(t *testing.T) {
+	db := setupTestDB(t)
+
+	type collection struct {
+		ID           string   `json:"id"`
+		Type         string   `json:"type"`
+		TotalItems   *int     `json:"totalItems"`
+		First        string   `json:"first"`
+		Next         string   `json:"next"`
+		OrderedItems []string `json:"orderedItems"`
+	}
+
+	// setup creates the local account alice, followed by n remote actors, who follows
+	// the first of them.
+	setup := func(t *testing.T, tx *gorm.DB, n int) *models.Account {
+		t.Helper()
+		require := require.New(t)
+		instance, err := models.NewInstances(tx).Create("example.com", "Example", "Example instance", "admin@example.com")
+		require.NoError(err)
+		alice, err := models.NewAccounts(tx).Create(instance, "alice", "alice@example.com", "password")
+		require.NoError(err)
+		relationships := models.NewRelationships(tx)
+		for i := 0; i < n; i++ {
+			follower := &models.Actor{
+				ID:        snowflake.Now(),
+				URI:       fmt.Sprintf("https://remote.example/users/%d", i),
+				Name:      fmt.Sprint(i),
+				Domain:    "remote.example",
+				PublicKey: []byte("-----BEGIN PUBLIC KEY-----"),
+			}
+			require.NoError(tx.Create(follower).Error)
+			_, err := relationships.Follow(follower, alice.Actor)
+			require.NoError(err)
+			if i == 0 {
+				_, err := relationships.Follow(alice.Actor, follower)
+				require.NoError(err)
+			}
+		}
+		return alice
+	}
+
+	get := func(t *testing.T, tx *gorm.DB, fn func(*Env, http.ResponseWriter, *http.Request) error, uri string) (*collection, error) {
+		t.Helper()
+		r := withURLParams(httptest.NewRequest("GET", uri, nil), "name", "alice")
+		w := httptest.NewRecorder()
+		if err := fn(&Env{DB: tx}, w, r); err != nil {
+			return nil, err
+		}
+		var c collection
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &c))
+		return &c, nil
+	}
+
+	t.Run("followers are served a page at a time", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		setup(t, tx, collectionPageSize+5)
+		c, err := get(t, tx, Followers, "https://example.com/u/alice/followers")
+		require.NoError(err)
+		require.Equal("OrderedCollection", c.Type)
+		require.Equal(collectionPageSize+5, *c.TotalItems)
+		require.Equal("https://example.com/u/alice/followers?page=true", c.First)
+
+		first, err := get(t, tx, Followers, c.First)
+		require.NoError(err)
+		require.Len(first.OrderedItems, collectionPageSize)
+		require.NotEmpty(first.Next)
+
+		second, err := get(t, tx, Followers, first.Next)
+		require.NoError(err)
+		require.Len(second.OrderedItems, 5)
+		require.Empty(second.Next)
+
+		seen := make(map[string]bool)
+		for _, uri := range append(first.OrderedItems, second.OrderedItems...) {
+			require.False(seen[uri], uri)
+			seen[uri] = true
+		}
+	})
+
+	t.Run("following lists the actors alice follows", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		setup(t, tx, 2)
+		c, err := get(t, tx, Following, "https://example.com/u/alice/following")
+		require.NoError(err)
+		require.Equal(1, *c.TotalItems)
+
+		page, err := get(t, tx, Following, c.First)
+		require.NoError(err)
+		require.Equal([]string{"https://remote.example/users/0"}, page.OrderedItems)
+	})
+
+	t.Run("hidden collections show their size but not their members", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		alice := setup(t, tx, 2)
+		prefs, err := models.NewAccounts(tx).PreferencesForActor(alice.Actor)
+		require.NoError(err)
+		prefs.HideCollections = true
+		require.NoError(tx.Save(prefs).Error)
+
+		c, err := get(t, tx, Followers, "https://example.com/u/alice/followers")
+		require.NoError(err)
+		require.Equal(2, *c.TotalItems)
+		require.Empty(c.First)
+
+		_, err = get(t, tx, Followers, "https://example.com/u/alice/followers?page=true")
+		var se *httpx.StatusError
+		require.ErrorAs(err, &se)
+		require.Equal(http.StatusForbidden, se.Status())
+	})
+
+	t.Run("hidden collection counts are not shown", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		alice := setup(t, tx, 2)
+		prefs, err := models.NewAccounts(tx).PreferencesForActor(alice.Actor)
+		require.NoError(err)
+		prefs.HideCollections = true
+		prefs.HideCollectionsCount = true
+		require.NoError(tx.Save(prefs).Error)
+
+		c, err := get(t, tx, Followers, "https://example.com/u/alice/followers")
+		require.NoError(err)
+		require.Nil(c.TotalItems)
+		require.Empty(c.First)
+
+		c, err = get(t, tx, Following, "https://example.com/u/alice/following")
+		require.NoError(err)
+		require.Nil(c.TotalItems)
+		require.Empty(c.First)
+	})
+}
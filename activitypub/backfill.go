@@ -0,0 +1,373 @@
+package activitypub
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bardic/pub/activitypub/vocab"
+	"github.com/bardic/pub/internal/snowflake"
+	"github.com/bardic/pub/models"
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxBackfillDepth is the number of levels of replies below a status which are fetched.
+	maxBackfillDepth = 5
+	// maxBackfillStatuses is the number of replies a single backfill will fetch.
+	maxBackfillStatuses = 100
+	// maxOutboxStatuses is the number of items imported from an actor's outbox.
+	maxOutboxStatuses = 20
+	// maxFeaturedStatuses is the number of statuses read from an actor's featured collection.
+	maxFeaturedStatuses = 20
+	// maxBackfillPages is the number of pages of a replies collection which are fetched.
+	maxBackfillPages = 10
+	// backfillInterval is the minimum time between requests to remote servers.
+	backfillInterval = 500 * time.Millisecond
+)
+
+// Backfiller fetches the statuses which were not delivered to us; the parts
+// of a thread above and below a status, and the recent posts of an actor.
+type Backfiller struct {
+	db       *gorm.DB
+	client   *Client
+	statuses *RemoteStatusFetcher
+	// interval is the minimum time between requests to remote servers.
+	interval time.Duration
+
+	// last is the time of the last request to a remote server.
+	last time.Time
+	// fetched is the number of replies fetched so far.
+	fetched int
+}
+
+// NewBackfiller returns a Backfiller which signs its requests as signAs, and
+// applies policies, in order, to the statuses it fetches, logging each decision
+// to logger.
+func NewBackfiller(signAs *models.Account, db *gorm.DB, logger *slog.Logger, policies ...Policy) (*Backfiller, error) {
+	c, err := NewClient(signAs)
+	if err != nil {
+		return nil, err
+	}
+	return &Backfiller{
+		db:       db,
+		client:   c,
+		statuses: NewRemoteStatusFetcher(signAs, db, logger, policies...),
+		interval: backfillInterval,
+	}, nil
+}
+
+// Backfill fetches the missing ancestors of status, then walks its replies
+// collection, and the replies collections of those replies, adding any
+// replies not already known. Fetched statuses join the status' conversation.
+func (b *Backfiller) Backfill(ctx context.Context, status *models.Status) error {
+	b.fetched = 0
+	obj, err := b.fetch(ctx, status.URI)
+	if err != nil {
+		return err
+	}
+	if err := b.ancestors(ctx, status, obj); err != nil {
+		return err
+	}
+	return b.replies(ctx, obj, 0)
+}
+
+// ancestors links status to its parent if status is a reply to a status we did not
+// have when status was created. Ancestors are fetched one at a time, up to
+// maxBackfillDepth levels above status, stopping at the first known status; the
+// topmost fetched ancestor becomes the root of the conversation.
+func (b *Backfiller) ancestors(ctx context.Context, status *models.Status, obj *vocab.Object) error {
+	if status.InReplyToID != nil || obj.InReplyTo == nil || obj.InReplyTo.ID == "" {
+		return nil
+	}
+	statuses := models.NewStatuses(b.db)
+	var parent *models.Status
+	var chain []*vocab.Object // nearest ancestor first.
+	seen := map[string]bool{obj.ID: true}
+	for uri := obj.InReplyTo.ID; uri != "" && !seen[uri] && len(chain) < maxBackfillDepth; {
+		seen[uri] = true
+		known, err := statuses.FindByURI(uri)
+		if err == nil {
+			parent = known
+			break
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		ancestor, err := b.fetch(ctx, uri)
+		if err != nil {
+			return err
+		}
+		chain = append(chain, ancestor)
+		uri = ""
+		if ancestor.InReplyTo != nil {
+			uri = ancestor.InReplyTo.ID
+		}
+	}
+	if parent == nil && len(chain) > 0 {
+		// the top of the chain replies to a status beyond the depth cap, or to
+		// a status in the chain; do not follow it further.
+		top := *chain[len(chain)-1]
+		top.InReplyTo = nil
+		chain[len(chain)-1] = &top
+	}
+	// create the ancestors from the top down, so each finds its parent.
+	for j := len(chain) - 1; j >= 0; j-- {
+		ancestor := chain[j]
+		st, err := statuses.FindOrCreate(ancestor.ID, func(string) (*models.Status, error) {
+			return b.statuses.status(ancestor)
+		})
+		if errors.Is(err, errRejected) {
+			// leave status where it is rather than retrying a thread a policy refused.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		parent = st
+	}
+	if parent == nil {
+		return nil
+	}
+	return b.db.Transaction(func(tx *gorm.DB) error {
+		// status was the root of its conversation, move it, and its replies, into the parent's.
+		if err := tx.Model(&models.Status{}).Where("conversation_id = ?", status.ConversationID).UpdateColumn("conversation_id", parent.ConversationID).Error; err != nil {
+			return err
+		}
+		status.ConversationID = parent.ConversationID
+		status.InReplyToID = &parent.ID
+		status.InReplyToActorID = &parent.ActorID
+		return tx.Model(status).Select("in_reply_to_id", "in_reply_to_actor_id").Updates(status).Error
+	})
+}
+
+// replies fetches the replies to obj which are not known locally, then recurses into each reply.
+func (b *Backfiller) replies(ctx context.Context, obj *vocab.Object, depth int) error {
+	if depth >= maxBackfillDepth || obj.Replies == nil {
+		return nil
+	}
+	items, err := b.collection(ctx, obj.Replies, maxBackfillStatuses-b.fetched)
+	if err != nil {
+		return err
+	}
+	for _, id := range items.IDs() {
+		if b.fetched >= maxBackfillStatuses {
+			return nil
+		}
+		b.fetched++
+		reply, err := b.fetch(ctx, id)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			// the reply may have been deleted, or its server may be down; skip it.
+			continue
+		}
+		_, err = models.NewStatuses(b.db).FindByURI(reply.ID)
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			status, err := b.statuses.status(reply)
+			if err != nil {
+				// not a status we can represent.
+				continue
+			}
+			if err := b.db.Create(status).Error; err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		}
+		if err := b.replies(ctx, reply, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collection returns up to limit items of a collection, following its pages.
+func (b *Backfiller) collection(ctx context.Context, page *vocab.Object, limit int) (vocab.Objects, error) {
+	var items vocab.Objects
+	for pages := 0; page != nil && pages < maxBackfillPages && len(items) < limit; pages++ {
+		if page.IsLink() {
+			var err error
+			if page, err = b.fetch(ctx, page.ID); err != nil {
+				return nil, err
+			}
+		}
+		items = append(items, page.Items...)
+		items = append(items, page.OrderedItems...)
+		switch {
+		case page.First != nil:
+			page = page.First
+		case page.Next != nil:
+			page = page.Next
+		default:
+			page = nil
+		}
+	}
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items, nil
+}
+
+// Outbox imports the most recent Create and Announce activities in actor's outbox
+// as statuses. Activities which have already been imported are skipped.
+func (b *Backfiller) Outbox(ctx context.Context, actor *models.Actor) error {
+	if actor.OutboxURL == "" {
+		return nil
+	}
+	items, err := b.collection(ctx, &vocab.Object{ID: actor.OutboxURL}, maxOutboxStatuses)
+	if err != nil {
+		return err
+	}
+	for i := range items {
+		act := &items[i]
+		if act.IsLink() {
+			// Mastodon, and most others, embed the activities in the outbox.
+			continue
+		}
+		if act.Validate() != nil || act.Actor.ID != actor.URI || !sameOrigin(act.ID, actor.URI) {
+			continue
+		}
+		var err error
+		switch act.Type {
+		case "Create":
+			err = b.importCreate(ctx, actor, act.Object)
+		case "Announce":
+			err = b.importAnnounce(actor, act)
+		}
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// otherwise skip this item, the next may fare better.
+	}
+	return nil
+}
+
+// importCreate imports the object of a Create in actor's outbox. Embedded objects
+// are trusted only if they are hosted by actor's server; others are fetched from
+// their own server.
+func (b *Backfiller) importCreate(ctx context.Context, actor *models.Actor, obj *vocab.Object) error {
+	if obj.IsLink() || !sameOrigin(obj.ID, actor.URI) {
+		var err error
+		if obj, err = b.fetch(ctx, obj.ID); err != nil {
+			return err
+		}
+	}
+	if obj.AttributedToID() != actor.URI {
+		return errors.New("object is not attributed to the outbox's actor")
+	}
+	_, err := models.NewStatuses(b.db).FindOrCreate(obj.ID, func(string) (*models.Status, error) {
+		return b.statuses.status(obj)
+	})
+	return err
+}
+
+func (b *Backfiller) importAnnounce(actor *models.Actor, act *vocab.Object) error {
+	if _, err := models.NewStatuses(b.db).FindByURI(act.ID); err == nil {
+		return nil
+	}
+	original, err := models.NewStatuses(b.db).FindOrCreate(act.Object.ID, b.statuses.Fetch)
+	if err != nil {
+		return err
+	}
+	return b.db.Create(reblog(act, actor, original)).Error
+}
+
+// Featured fetches actor's featured collection and makes the statuses in it,
+// and only those statuses, pinned by actor. Statuses which are not known are fetched.
+func (b *Backfiller) Featured(ctx context.Context, actor *models.Actor) error {
+	if actor.FeaturedURL == "" {
+		return nil
+	}
+	items, err := b.collection(ctx, &vocab.Object{ID: actor.FeaturedURL}, maxFeaturedStatuses)
+	if err != nil {
+		return err
+	}
+	pinned := make(map[snowflake.ID]*models.Status)
+	for i := range items {
+		status, err := b.featured(ctx, actor, &items[i])
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			continue
+		}
+		pinned[status.ID] = status
+	}
+
+	var current []*models.Reaction
+	if err := b.db.Where("actor_id = ? AND pinned = true", actor.ID).Find(&current).Error; err != nil {
+		return err
+	}
+	reactions := models.NewReactions(b.db)
+	for _, r := range current {
+		if _, ok := pinned[r.StatusID]; ok {
+			delete(pinned, r.StatusID)
+			continue
+		}
+		if _, err := reactions.Unpin(&models.Status{ID: r.StatusID}, actor); err != nil {
+			return err
+		}
+	}
+	for _, status := range pinned {
+		if _, err := reactions.Pin(status, actor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// featured returns the status for an item of actor's featured collection. Like
+// importCreate, embedded items are trusted only if they are hosted by actor's
+// server; others are fetched from their own server.
+func (b *Backfiller) featured(ctx context.Context, actor *models.Actor, obj *vocab.Object) (*models.Status, error) {
+	if obj.IsLink() || !sameOrigin(obj.ID, actor.URI) {
+		if status, err := models.NewStatuses(b.db).FindByURI(obj.ID); err == nil {
+			return pinnable(actor, status)
+		}
+		var err error
+		if obj, err = b.fetch(ctx, obj.ID); err != nil {
+			return nil, err
+		}
+	} else if err := obj.Validate(); err != nil {
+		return nil, err
+	}
+	status, err := models.NewStatuses(b.db).FindOrCreate(obj.ID, func(string) (*models.Status, error) {
+		return b.statuses.status(obj)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pinnable(actor, status)
+}
+
+// pinnable returns status if actor may pin it; actors may only pin their own statuses.
+func pinnable(actor *models.Actor, status *models.Status) (*models.Status, error) {
+	if status.ActorID != actor.ID {
+		return nil, errors.New("actor is not the author of the status")
+	}
+	return status, nil
+}
+
+// fetch fetches the object at uri, waiting first if a request was made within b.interval.
+// Objects on suspended domains are not fetched.
+func (b *Backfiller) fetch(ctx context.Context, uri string) (*vocab.Object, error) {
+	if err := models.NewDomainBlocks(b.db).CheckURI(uri); err != nil {
+		return nil, err
+	}
+	if wait := time.Until(b.last.Add(b.interval)); wait > 0 {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	b.last = time.Now()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	return fetchObject(ctx, b.client, uri)
+}
@@ -0,0 +1,404 @@
+package activitypub
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bardic/pub/internal/snowflake"
+	"github.com/bardic/pub/models"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+)
+
+func TestBackfiller(t *testing.T) {
+	db := setupTestDB(t)
+	srv, docs := mockServer(t)
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	signAs := mockSignAs(t)
+
+	// published is the time of the n-th note, so each note gets a distinct ID.
+	published := func(n int) string {
+		return time.Date(2023, 1, 1, 0, 0, n, 0, time.UTC).Format(time.RFC3339)
+	}
+
+	// note serves a Note by alice at path which replies to inReplyTo, if set.
+	note := func(path, inReplyTo string, n int) map[string]any {
+		doc := map[string]any{
+			"id":           srv.URL + path,
+			"type":         "Note",
+			"attributedTo": srv.URL + "/users/alice",
+			"published":    published(n),
+			"content":      "hello",
+			"to":           "https://www.w3.org/ns/activitystreams#Public",
+		}
+		if inReplyTo != "" {
+			doc["inReplyTo"] = srv.URL + inReplyTo
+		}
+		docs[path] = doc
+		return doc
+	}
+
+	// setup creates alice, and the status at path which backfill starts from.
+	setup := func(t *testing.T, tx *gorm.DB, path string) (*Backfiller, *models.Status) {
+		t.Helper()
+		require := require.New(t)
+		alice := &models.Actor{
+			ID:        snowflake.Now(),
+			URI:       srv.URL + "/users/alice",
+			Name:      "alice",
+			Domain:    u.Host,
+			PublicKey: []byte("-----BEGIN PUBLIC KEY-----"),
+		}
+		require.NoError(tx.Create(alice).Error)
+		status := &models.Status{
+			ID:           snowflake.Now(),
+			URI:          srv.URL + path,
+			ActorID:      alice.ID,
+			Actor:        alice,
+			Visibility:   "public",
+			Conversation: &models.Conversation{Visibility: "public"},
+			Note:         "hello",
+		}
+		require.NoError(tx.Create(status).Error)
+		b, err := NewBackfiller(signAs, tx, slog.New(slog.NewTextHandler(io.Discard)))
+		require.NoError(err)
+		b.interval = 0
+		return b, status
+	}
+
+	t.Run("missing ancestors are fetched and the status joins their conversation", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		note("/notes/root", "", 1)
+		note("/notes/parent", "/notes/root", 2)
+		note("/notes/child", "/notes/parent", 3)
+		b, child := setup(t, tx, "/notes/child")
+		require.NoError(b.Backfill(context.Background(), child))
+
+		statuses := models.NewStatuses(tx)
+		root, err := statuses.FindByURI(srv.URL + "/notes/root")
+		require.NoError(err)
+		require.Nil(root.InReplyToID)
+		parent, err := statuses.FindByURI(srv.URL + "/notes/parent")
+		require.NoError(err)
+		require.Equal(root.ID, *parent.InReplyToID)
+		require.Equal(root.ConversationID, parent.ConversationID)
+
+		require.NoError(tx.First(child, child.ID).Error)
+		require.Equal(parent.ID, *child.InReplyToID)
+		require.Equal(root.ConversationID, child.ConversationID)
+	})
+
+	t.Run("the ancestor walk stops at the depth cap", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		// /deep/0 replies to /deep/1, which replies to /deep/2, and so on.
+		n := maxBackfillDepth + 3
+		for i := 0; i < n; i++ {
+			inReplyTo := ""
+			if i < n-1 {
+				inReplyTo = fmt.Sprintf("/deep/%d", i+1)
+			}
+			note(fmt.Sprintf("/deep/%d", i), inReplyTo, 10+n-i)
+		}
+		b, status := setup(t, tx, "/deep/0")
+		require.NoError(b.Backfill(context.Background(), status))
+
+		var count int64
+		require.NoError(tx.Model(&models.Status{}).Where("uri LIKE ?", srv.URL+"/deep/%").Count(&count).Error)
+		require.EqualValues(maxBackfillDepth+1, count)
+
+		top, err := models.NewStatuses(tx).FindByURI(fmt.Sprintf("%s/deep/%d", srv.URL, maxBackfillDepth))
+		require.NoError(err)
+		require.Nil(top.InReplyToID)
+	})
+
+	t.Run("an inReplyTo cycle ends the ancestor walk", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		note("/cycle/a", "/cycle/b", 30)
+		note("/cycle/b", "/cycle/a", 31)
+		note("/cycle/c", "/cycle/a", 32)
+		b, status := setup(t, tx, "/cycle/c")
+		require.NoError(b.Backfill(context.Background(), status))
+
+		statuses := models.NewStatuses(tx)
+		a, err := statuses.FindByURI(srv.URL + "/cycle/a")
+		require.NoError(err)
+		bb, err := statuses.FindByURI(srv.URL + "/cycle/b")
+		require.NoError(err)
+		require.Nil(bb.InReplyToID)
+		require.Equal(bb.ID, *a.InReplyToID)
+	})
+
+	t.Run("ancestors are fetched no faster than the interval", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		note("/slow/root", "", 40)
+		note("/slow/parent", "/slow/root", 41)
+		note("/slow/child", "/slow/parent", 42)
+		b, child := setup(t, tx, "/slow/child")
+		b.interval = 50 * time.Millisecond
+		start := time.Now()
+		require.NoError(b.Backfill(context.Background(), child))
+		// three fetches; the child, its parent, and the root.
+		require.GreaterOrEqual(time.Since(start), 2*b.interval)
+	})
+
+	t.Run("replies are fetched across pages", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		op := note("/paged/op", "", 50)
+		op["replies"] = map[string]any{
+			"id":   srv.URL + "/paged/op/replies",
+			"type": "Collection",
+			"first": map[string]any{
+				"type":  "CollectionPage",
+				"items": []any{srv.URL + "/paged/reply/1"},
+				"next":  srv.URL + "/paged/op/replies/2",
+			},
+		}
+		docs["/paged/op/replies/2"] = map[string]any{
+			"id":    srv.URL + "/paged/op/replies/2",
+			"type":  "CollectionPage",
+			"items": []any{srv.URL + "/paged/reply/2"},
+		}
+		note("/paged/reply/1", "/paged/op", 51)
+		note("/paged/reply/2", "/paged/op", 52)
+		b, status := setup(t, tx, "/paged/op")
+		require.NoError(b.Backfill(context.Background(), status))
+
+		var replies []*models.Status
+		require.NoError(tx.Where("in_reply_to_id = ?", status.ID).Order("uri").Find(&replies).Error)
+		require.Len(replies, 2)
+		require.Equal(srv.URL+"/paged/reply/1", replies[0].URI)
+		require.Equal(srv.URL+"/paged/reply/2", replies[1].URI)
+		require.Equal(status.ConversationID, replies[1].ConversationID)
+	})
+
+	t.Run("fetched replies pass through the policies", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		op := note("/policed/op", "", 400)
+		op["replies"] = map[string]any{
+			"id":    srv.URL + "/policed/op/replies",
+			"type":  "Collection",
+			"items": []any{srv.URL + "/policed/reply/1", srv.URL + "/policed/reply/2"},
+		}
+		note("/policed/reply/1", "/policed/op", 401)["content"] = "spoilers ahead"
+		note("/policed/reply/2", "/policed/op", 402)["tag"] = []any{
+			map[string]any{"type": "Mention", "href": srv.URL + "/users/alice"},
+		}
+		b, status := setup(t, tx, "/policed/op")
+		b.statuses.policies = []Policy{
+			&KeywordPolicy{Keywords: []string{"spoilers"}, SpoilerText: "spoilers"},
+			&MaxMentionsPolicy{Max: 0},
+		}
+		require.NoError(b.Backfill(context.Background(), status))
+
+		var replies []*models.Status
+		require.NoError(tx.Where("in_reply_to_id = ?", status.ID).Find(&replies).Error)
+		require.Len(replies, 1)
+		require.Equal(srv.URL+"/policed/reply/1", replies[0].URI)
+		require.True(replies[0].Sensitive)
+		require.Equal("spoilers", replies[0].SpoilerText)
+	})
+
+	t.Run("no more than maxBackfillStatuses replies are fetched", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		var items []any
+		for i := 0; i < maxBackfillStatuses+10; i++ {
+			path := fmt.Sprintf("/many/reply/%d", i)
+			note(path, "/many/op", 100+i)
+			items = append(items, srv.URL+path)
+		}
+		op := note("/many/op", "", 99)
+		op["replies"] = map[string]any{
+			"id":    srv.URL + "/many/op/replies",
+			"type":  "Collection",
+			"items": items,
+		}
+		b, status := setup(t, tx, "/many/op")
+		require.NoError(b.Backfill(context.Background(), status))
+
+		var count int64
+		require.NoError(tx.Model(&models.Status{}).Where("in_reply_to_id = ?", status.ID).Count(&count).Error)
+		require.EqualValues(maxBackfillStatuses, count)
+	})
+
+	t.Run("outbox Create and Announce activities by the actor are imported", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		b, status := setup(t, tx, "/outbox/pinned")
+		alice := status.Actor
+		alice.OutboxURL = srv.URL + "/users/alice/outbox"
+		embedded := note("/outbox/note/1", "", 60)
+		forged := note("/outbox/note/2", "", 61)
+		forged["id"] = "https://victim.example/notes/2"
+		note("/outbox/note/4", "", 63)
+		docs["/users/alice/outbox"] = map[string]any{
+			"id":   alice.OutboxURL,
+			"type": "OrderedCollection",
+			"orderedItems": []any{
+				map[string]any{
+					"id":     srv.URL + "/outbox/1",
+					"type":   "Create",
+					"actor":  alice.URI,
+					"object": embedded,
+				},
+				map[string]any{
+					"id":     srv.URL + "/outbox/2",
+					"type":   "Create",
+					"actor":  alice.URI,
+					"object": forged,
+				},
+				map[string]any{
+					"id":    srv.URL + "/outbox/3",
+					"type":  "Create",
+					"actor": srv.URL + "/users/bob",
+					"object": map[string]any{
+						"id":           srv.URL + "/outbox/note/3",
+						"type":         "Note",
+						"attributedTo": srv.URL + "/users/bob",
+						"published":    published(62),
+						"content":      "not alice's",
+					},
+				},
+				map[string]any{
+					"id":     srv.URL + "/outbox/4",
+					"type":   "Announce",
+					"actor":  alice.URI,
+					"object": srv.URL + "/outbox/note/4",
+					"to":     "https://www.w3.org/ns/activitystreams#Public",
+				},
+			},
+		}
+		require.NoError(b.Outbox(context.Background(), alice))
+
+		statuses := models.NewStatuses(tx)
+		created, err := statuses.FindByURI(srv.URL + "/outbox/note/1")
+		require.NoError(err)
+		require.Equal(alice.ID, created.ActorID)
+
+		_, err = statuses.FindByURI("https://victim.example/notes/2")
+		require.ErrorIs(err, gorm.ErrRecordNotFound)
+		_, err = statuses.FindByURI(srv.URL + "/outbox/note/3")
+		require.ErrorIs(err, gorm.ErrRecordNotFound)
+
+		original, err := statuses.FindByURI(srv.URL + "/outbox/note/4")
+		require.NoError(err)
+		reblog, err := statuses.FindByURI(srv.URL + "/outbox/4")
+		require.NoError(err)
+		require.Equal(original.ID, *reblog.ReblogID)
+		require.Equal(alice.ID, reblog.ActorID)
+	})
+
+	t.Run("an embedded outbox or featured object whose id is on another domain is not trusted", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		b, status := setup(t, tx, "/forged/pinned")
+		alice := status.Actor
+		obj := toObject(t, map[string]any{
+			"id":           "https://victim.example/notes/1",
+			"type":         "Note",
+			"attributedTo": alice.URI,
+			"published":    published(70),
+			"content":      "forged",
+		})
+		require.Error(b.importCreate(context.Background(), alice, obj))
+		_, err := b.featured(context.Background(), alice, obj)
+		require.Error(err)
+
+		_, err = models.NewStatuses(tx).FindByURI("https://victim.example/notes/1")
+		require.ErrorIs(err, gorm.ErrRecordNotFound)
+	})
+
+	t.Run("featured statuses are pinned and statuses no longer featured are unpinned", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		b, unfeatured := setup(t, tx, "/featured/1")
+		alice := unfeatured.Actor
+		alice.FeaturedURL = srv.URL + "/users/alice/featured"
+		reactions := models.NewReactions(tx)
+		_, err := reactions.Pin(unfeatured, alice)
+		require.NoError(err)
+
+		kept := &models.Status{
+			ID:           snowflake.Now(),
+			URI:          srv.URL + "/featured/2",
+			ActorID:      alice.ID,
+			Visibility:   "public",
+			Conversation: &models.Conversation{Visibility: "public"},
+			Note:         "kept",
+		}
+		require.NoError(tx.Create(kept).Error)
+		_, err = reactions.Pin(kept, alice)
+		require.NoError(err)
+
+		note("/featured/3", "", 80)
+
+		bob := &models.Actor{
+			ID:        snowflake.Now(),
+			URI:       srv.URL + "/users/bob",
+			Name:      "bob",
+			Domain:    u.Host,
+			PublicKey: []byte("-----BEGIN PUBLIC KEY-----"),
+		}
+		require.NoError(tx.Create(bob).Error)
+		bobs := &models.Status{
+			ID:           snowflake.Now(),
+			URI:          srv.URL + "/featured/4",
+			ActorID:      bob.ID,
+			Visibility:   "public",
+			Conversation: &models.Conversation{Visibility: "public"},
+			Note:         "bob's",
+		}
+		require.NoError(tx.Create(bobs).Error)
+
+		docs["/users/alice/featured"] = map[string]any{
+			"id":   alice.FeaturedURL,
+			"type": "OrderedCollection",
+			"orderedItems": []any{
+				srv.URL + "/featured/2",
+				srv.URL + "/featured/3",
+				srv.URL + "/featured/4",
+			},
+		}
+		require.NoError(b.Featured(context.Background(), alice))
+
+		var pinned []*models.Reaction
+		require.NoError(tx.Preload("Status").Where("actor_id = ? AND pinned = true", alice.ID).Find(&pinned).Error)
+		var uris []string
+		for _, r := range pinned {
+			uris = append(uris, r.Status.URI)
+		}
+		require.ElementsMatch([]string{srv.URL + "/featured/2", srv.URL + "/featured/3"}, uris)
+	})
+}
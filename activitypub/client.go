@@ -10,11 +10,16 @@ import (
 	"fmt"
 	"net/http"
 
-	"github.com/carlmjohnson/requests"
 	"github.com/bardic/pub/internal/httpsig"
+	"github.com/bardic/pub/internal/httpx"
 	"github.com/bardic/pub/models"
+	"github.com/carlmjohnson/requests"
 )
 
+// transport sends the requests of every Client once they are signed.
+// Tests replace it to reach servers on the loopback interface.
+var transport http.RoundTripper = httpx.DefaultTransport
+
 // Client is an ActivityPub client which can be used to fetch remote
 // ActivityPub resources.
 type Client struct {
@@ -52,6 +57,7 @@ func NewClient(signAs *models.Account) (*Client, error) {
 func (c *Client) Fetch(ctx context.Context, uri string, obj interface{}) error {
 	return requests.URL(uri).
 		Accept(`application/ld+json; profile="https://www.w3.org/ns/activitystreams"`).
+		Client(httpx.DefaultClient).
 		Transport(c).
 		CheckContentType("application/ld+json", "application/activity+json", "application/json").
 		CheckStatus(http.StatusOK).
@@ -63,7 +69,7 @@ func (c *Client) RoundTrip(req *http.Request) (*http.Response, error) {
 	if err := httpsig.Sign(req, c.keyID, c.privateKey, nil); err != nil {
 		return nil, fmt.Errorf("failed to sign request: %w", err)
 	}
-	return http.DefaultTransport.RoundTrip(req)
+	return transport.RoundTrip(req)
 }
 
 // Post posts the given ActivityPub object to the given URL.
@@ -71,6 +77,7 @@ func (c *Client) Post(ctx context.Context, url string, obj map[string]any) error
 	return requests.URL(url).
 		Header("Content-Type", `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`).
 		BodyJSON(obj).
+		Client(httpx.DefaultClient).
 		Transport(c).
 		CheckStatus(http.StatusOK, http.StatusCreated).
 		Fetch(ctx)
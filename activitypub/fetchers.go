@@ -2,14 +2,17 @@ package activitypub
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/url"
 	"strings"
 	"time"
 
+	"github.com/bardic/pub/activitypub/vocab"
 	"github.com/bardic/pub/internal/algorithms"
 	"github.com/bardic/pub/internal/snowflake"
 	"github.com/bardic/pub/models"
+	"golang.org/x/exp/slog"
 	"gorm.io/gorm"
 )
 
@@ -29,42 +32,16 @@ func (f *RemoteActorFetcher) Fetch(ctx context.Context, uri string) (*models.Act
 	if err != nil {
 		return nil, err
 	}
-	var actor struct {
-		Type string `json:"type"`
-		// The Actor's unique global identifier.
-		ID                string `json:"id"`
-		Inbox             string `json:"inbox"`
-		Outbox            string `json:"outbox"`
-		PreferredUsername string `json:"preferredUsername"`
-		Name              string `json:"name"`
-		Summary           string `json:"summary"`
-		Icon              struct {
-			Type      string `json:"type"`
-			MediaType string `json:"mediaType"`
-			URL       string `json:"url"`
-		} `json:"icon"`
-		Image struct {
-			Type      string `json:"type"`
-			MediaType string `json:"mediaType"`
-			URL       string `json:"url"`
-		} `json:"image"`
-		Endpoints struct {
-			SharedInbox string `json:"sharedInbox"`
-		} `json:"endpoints"`
-		ManuallyApprovesFollowers bool      `json:"manuallyApprovesFollowers"`
-		Published                 time.Time `json:"published"`
-		PublicKey                 struct {
-			ID           string `json:"id"`
-			Owner        string `json:"owner"`
-			PublicKeyPem string `json:"publicKeyPem"`
-		} `json:"publicKey"`
-		Attachments []Attachment `json:"attachment"`
-	}
-	if err := c.Fetch(ctx, uri, &actor); err != nil {
+	actor, err := fetchObject(ctx, c, uri)
+	if err != nil {
 		return nil, err
 	}
+	return objToActor(actor)
+}
 
-	published := actor.Published
+// objToActor converts an actor object to a models.Actor.
+func objToActor(actor *vocab.Object) (*models.Actor, error) {
+	published := actor.Published.Time
 	if published.IsZero() {
 		published = time.Now()
 	}
@@ -74,26 +51,36 @@ func (f *RemoteActorFetcher) Fetch(ctx context.Context, uri string) (*models.Act
 		return nil, err
 	}
 
+	var sharedInbox, publicKey string
+	if actor.Endpoints != nil {
+		sharedInbox = actor.Endpoints.SharedInbox
+	}
+	if actor.PublicKey != nil {
+		publicKey = actor.PublicKey.PublicKeyPem
+	}
+
 	return &models.Actor{
 		ID:             snowflake.TimeToID(published),
 		Type:           models.ActorType(actor.Type),
 		Name:           actor.PreferredUsername,
 		Domain:         u.Host,
 		URI:            actor.ID,
-		DisplayName:    actor.Name,
+		DisplayName:    actor.NameString(),
 		Locked:         actor.ManuallyApprovesFollowers,
-		Note:           actor.Summary,
-		Avatar:         actor.Icon.URL,
-		Header:         actor.Image.URL,
+		Note:           actor.SummaryString(),
+		Avatar:         imageURL(actor.Icon),
+		Header:         imageURL(actor.Image),
 		InboxURL:       actor.Inbox,
 		OutboxURL:      actor.Outbox,
-		SharedInboxURL: actor.Endpoints.SharedInbox,
-		PublicKey:      []byte(actor.PublicKey.PublicKeyPem),
-		Attributes:     attachmentsToActorAttributes(actor.Attachments),
+		SharedInboxURL: sharedInbox,
+		FollowersURL:   actor.Followers,
+		FeaturedURL:    actor.Featured,
+		PublicKey:      []byte(publicKey),
+		Attributes:     attachmentsToActorAttributes(actor.Attachment),
 	}, nil
 }
 
-func attachmentsToActorAttributes(attachments []Attachment) []*models.ActorAttribute {
+func attachmentsToActorAttributes(attachments vocab.Objects) []*models.ActorAttribute {
 	return algorithms.Map(
 		algorithms.Filter(
 			attachments,
@@ -103,28 +90,42 @@ func attachmentsToActorAttributes(attachments []Attachment) []*models.ActorAttri
 	)
 }
 
-func objToActorAttribute(a Attachment) *models.ActorAttribute {
+func objToActorAttribute(obj vocab.Object) *models.ActorAttribute {
 	return &models.ActorAttribute{
-		Name:  a.Name,
-		Value: a.Value,
+		Name:  obj.NameString(),
+		Value: obj.Value,
 	}
 }
 
-func propertyType(t string) func(Attachment) bool {
-	return func(a Attachment) bool {
-		return a.Type == t
+func propertyType(t string) func(vocab.Object) bool {
+	return func(obj vocab.Object) bool {
+		return obj.Type == t
 	}
 }
 
+// maxInReplyToDepth is the number of ancestors RemoteStatusFetcher fetches above
+// a status. Beyond it, or if the ancestors form a cycle, the topmost status fetched
+// becomes the root of its conversation.
+const maxInReplyToDepth = 5
+
 type RemoteStatusFetcher struct {
-	signAs *models.Account
-	db     *gorm.DB
+	signAs   *models.Account
+	db       *gorm.DB
+	logger   *slog.Logger
+	policies []Policy
+
+	// depth is the number of ancestors being fetched.
+	depth int
 }
 
-func NewRemoteStatusFetcher(signAs *models.Account, db *gorm.DB) *RemoteStatusFetcher {
+// NewRemoteStatusFetcher returns a RemoteStatusFetcher which applies policies,
+// in order, to every status it fetches, logging each decision to logger.
+func NewRemoteStatusFetcher(signAs *models.Account, db *gorm.DB, logger *slog.Logger, policies ...Policy) *RemoteStatusFetcher {
 	return &RemoteStatusFetcher{
-		signAs: signAs,
-		db:     db,
+		signAs:   signAs,
+		db:       db,
+		logger:   logger,
+		policies: policies,
 	}
 }
 
@@ -138,76 +139,76 @@ func (f *RemoteStatusFetcher) Fetch(uri string) (*models.Status, error) {
 	if err != nil {
 		return nil, err
 	}
-	var status Status
-	if err := c.Fetch(ctx, uri, &status); err != nil {
+	status, err := fetchObject(ctx, c, uri)
+	if err != nil {
 		return nil, err
 	}
+	return f.status(status)
+}
 
+// status converts a status object to a models.Status, creating its author and,
+// if it is a reply, the status it replies to if they are not already known.
+// The status is passed through f's policies once its author is known; if a
+// policy rejects it, or the status it replies to, an error wrapping errRejected
+// is returned.
+func (f *RemoteStatusFetcher) status(status *vocab.Object) (*models.Status, error) {
 	switch status.Type {
-	case "Note", "Question":
+	case "Note", "Question", "Article", "Page", "Video", "Audio", "Image", "Event":
 		// cool
 	default:
 		return nil, fmt.Errorf("unsupported type %q", status.Type)
 	}
 
-	var visibility string
-	for _, recipient := range status.To {
-		switch recipient {
-		case "https://www.w3.org/ns/activitystreams#Public":
-			visibility = "public"
-		case status.AttributedTo + "/followers":
-			visibility = "limited"
-		}
+	publishedAt, updatedAt, err := publishedAndUpdated(status)
+	if err != nil {
+		return nil, err
 	}
-	if visibility == "" {
-		for _, recipient := range status.CC {
-			switch recipient {
-			case "https://www.w3.org/ns/activitystreams#Public":
-				visibility = "public"
-			case status.AttributedTo + "/followers":
-				visibility = "limited"
-			}
-		}
+
+	actors := NewRemoteActorFetcher(f.signAs)
+	actor, err := models.NewActors(f.db).FindOrCreate(status.AttributedToID(), actors.Fetch)
+	if err != nil {
+		return nil, err
 	}
-	if visibility == "" {
-		return nil, fmt.Errorf("unsupported visibility %q: %v", visibility, status)
+	if err := f.applyPolicies(status); err != nil {
+		return nil, err
 	}
 
 	conv := &models.Conversation{
-		Visibility: models.Visibility(visibility),
+		Visibility: visibility(status, actor),
 	}
 	var inReplyTo *models.Status
-	if status.InReplyTo != "" {
-		inReplyTo, err = models.NewStatuses(f.db).FindOrCreate(status.InReplyTo, f.Fetch)
+	if status.InReplyTo != nil && status.InReplyTo.ID != "" && f.depth < maxInReplyToDepth {
+		f.depth++
+		inReplyTo, err = models.NewStatuses(f.db).FindOrCreate(status.InReplyTo.ID, f.Fetch)
+		f.depth--
 		if err != nil {
 			return nil, err
 		}
 		conv = inReplyTo.Conversation
 	}
 
-	actors := NewRemoteActorFetcher(f.signAs)
-	actor, err := models.NewActors(f.db).FindOrCreate(status.AttributedTo, actors.Fetch)
-	if err != nil {
-		return nil, err
-	}
-
+	note, spoilerText := noteAndSpoilerText(status)
 	st := &models.Status{
-		ID:               snowflake.TimeToID(status.Published),
-		UpdatedAt:        status.Updated,
+		ID:               snowflake.TimeToID(publishedAt),
+		UpdatedAt:        updatedAt,
 		ActorID:          actor.ID,
 		Actor:            actor,
 		Conversation:     conv,
 		InReplyToID:      inReplyToID(inReplyTo),
 		InReplyToActorID: inReplyToActorID(inReplyTo),
 		Sensitive:        status.Sensitive,
-		SpoilerText:      status.Summary,
+		SpoilerText:      spoilerText,
 		Visibility:       conv.Visibility,
 		URI:              status.ID,
-		Note:             status.Content,
-		Attachments:      attachmentsToStatusAttachments(status.Attachments),
+		Language:         language(status),
+		Note:             note,
+		Attachments:      attachmentsToStatusAttachments(status.Attachment),
+		Type:             models.StatusType(status.Type),
+		Title:            title(status),
+		URL:              canonicalURL(status),
 	}
 
-	for _, tag := range status.Tags {
+	for _, tag := range status.Tag {
 		switch tag.Type {
 		case "Mention":
 			mention, err := models.NewActors(f.db).FindOrCreate(tag.Href, actors.Fetch)
@@ -229,33 +230,137 @@ func (f *RemoteStatusFetcher) Fetch(uri string) (*models.Status, error) {
 		}
 	}
 
-	if len(status.OneOf) > 0 {
-		poll := &models.StatusPoll{
-			StatusID:  st.ID,
-			ExpiresAt: status.EndTime,
-			Multiple:  false,
-		}
-		for _, option := range status.OneOf {
-			if option.Type != "Note" {
-				return nil, fmt.Errorf("invalid poll option type: %q", option.Type)
-			}
-			poll.Options = append(poll.Options, models.StatusPollOption{
-				Title: option.Name,
-				Count: option.Replies.TotalItems,
-			})
+	if isPoll(status) {
+		st.Poll, err = objToStatusPoll(status)
+		if err != nil {
+			return nil, err
 		}
-		st.Poll = poll
+		st.Poll.StatusID = st.ID
 	}
 
 	return st, nil
 }
 
-func attachmentsToStatusAttachments(attachments []any) []*models.StatusAttachment {
-	return algorithms.Map(
-		algorithms.Map(
-			attachments,
-			mapFromAny,
-		),
-		objToStatusAttachment,
-	)
+// applyPolicies passes status, as a Create by its author, through each of f's
+// policies in turn, logging each decision. Policies may rewrite status in place.
+func (f *RemoteStatusFetcher) applyPolicies(status *vocab.Object) error {
+	act := &vocab.Object{
+		ID:     status.ID,
+		Type:   "Create",
+		Actor:  &vocab.Object{ID: status.AttributedToID()},
+		Object: status,
+	}
+	for _, p := range f.policies {
+		decision, err := p.Filter(f.db, act)
+		if err != nil {
+			return fmt.Errorf("policy %s: %w", p.Name(), err)
+		}
+		f.logger.Info("applyPolicies", "policy", p.Name(), "decision", decision, "id", status.ID)
+		if decision == Reject {
+			return fmt.Errorf("status %q: policy %s: %w", status.ID, p.Name(), errRejected)
+		}
+	}
+	return nil
+}
+
+// A Resolver finds the actor or status with a URI, fetching it if it is not known.
+type Resolver struct {
+	signAs   *models.Account
+	db       *gorm.DB
+	logger   *slog.Logger
+	policies []Policy
+}
+
+// NewResolver returns a Resolver which applies policies, in order, to the
+// statuses it fetches, logging each decision to logger.
+func NewResolver(signAs *models.Account, db *gorm.DB, logger *slog.Logger, policies ...Policy) *Resolver {
+	return &Resolver{
+		signAs:   signAs,
+		db:       db,
+		logger:   logger,
+		policies: policies,
+	}
+}
+
+// Resolve returns the actor or the status with uri; one of them is nil.
+func (r *Resolver) Resolve(ctx context.Context, uri string) (*models.Actor, *models.Status, error) {
+	actors := models.NewActors(r.db)
+	if actor, err := actors.FindByURI(uri); err == nil {
+		return actor, nil, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, err
+	}
+	statuses := models.NewStatuses(r.db)
+	if status, err := statuses.FindByURI(uri); err == nil {
+		return nil, status, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, err
+	}
+
+	if err := models.NewDomainBlocks(r.db).CheckURI(uri); err != nil {
+		return nil, nil, err
+	}
+	c, err := NewClient(r.signAs)
+	if err != nil {
+		return nil, nil, err
+	}
+	// fetchObject refuses objects which claim an id on another server than uri's,
+	// so obj.ID may be stored without being fetched again.
+	obj, err := fetchObject(ctx, c, uri)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch obj.Type {
+	case "Person", "Service", "Application", "Group", "Organization":
+		actor, err := actors.FindOrCreate(obj.ID, func(context.Context, string) (*models.Actor, error) {
+			return objToActor(obj)
+		})
+		return actor, nil, err
+	default:
+		fetcher := NewRemoteStatusFetcher(r.signAs, r.db, r.logger, r.policies...)
+		status, err := statuses.FindOrCreate(obj.ID, func(string) (*models.Status, error) {
+			return fetcher.status(obj)
+		})
+		return nil, status, err
+	}
+}
+
+// fetchObject fetches the object at uri, compacts and validates it.
+func fetchObject(ctx context.Context, c *Client, uri string) (*vocab.Object, error) {
+	var doc map[string]any
+	if err := c.Fetch(ctx, uri, &doc); err != nil {
+		return nil, err
+	}
+	var obj vocab.Object
+	if err := decode(doc, &obj); err != nil {
+		return nil, err
+	}
+	if err := obj.Validate(); err != nil {
+		return nil, err
+	}
+	// a server may only speak for the objects, and the actors, it hosts.
+	if !sameOrigin(obj.ID, uri) {
+		return nil, fmt.Errorf("object %q fetched from %q: origin mismatch", obj.ID, uri)
+	}
+	if attributedTo := obj.AttributedToID(); attributedTo != "" && !sameOrigin(attributedTo, obj.ID) {
+		return nil, fmt.Errorf("object %q attributed to %q: origin mismatch", obj.ID, attributedTo)
+	}
+	return &obj, nil
+}
+
+// sameOrigin reports whether the IRIs a and b have the same scheme and host.
+func sameOrigin(a, b string) bool {
+	u, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	v, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == v.Scheme && strings.EqualFold(u.Host, v.Host)
+}
+
+func attachmentsToStatusAttachments(attachments vocab.Objects) []*models.StatusAttachment {
+	return algorithms.Map(attachments, objToStatusAttachment)
 }
@@ -0,0 +1,206 @@
+package activitypub
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/bardic/pub/internal/snowflake"
+	"github.com/bardic/pub/models"
+	"github.com/go-json-experiment/json"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+)
+
+// mockServer serves the documents added to docs, keyed by path, as ActivityPub
+// objects. Requests made by Clients are sent to it for the duration of the test.
+func mockServer(t *testing.T) (srv *httptest.Server, docs map[string]map[string]any) {
+	t.Helper()
+	docs = make(map[string]map[string]any)
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		doc, ok := docs[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/activity+json")
+		json.MarshalFull(w, doc)
+	}))
+	t.Cleanup(srv.Close)
+	prev := transport
+	transport = srv.Client().Transport
+	t.Cleanup(func() { transport = prev })
+	return srv, docs
+}
+
+// mockSignAs returns an account, with a freshly generated key, to sign requests as.
+func mockSignAs(t *testing.T) *models.Account {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return &models.Account{
+		Actor: &models.Actor{
+			URI: "https://example.com/u/admin",
+		},
+		PrivateKey: pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+	}
+}
+
+func TestFetchObject(t *testing.T) {
+	srv, docs := mockServer(t)
+	docs["/notes/1"] = map[string]any{
+		"id":           srv.URL + "/notes/1",
+		"type":         "Note",
+		"attributedTo": srv.URL + "/users/alice",
+		"published":    "2023-01-01T00:00:00Z",
+		"content":      "hello",
+	}
+	docs["/notes/2"] = map[string]any{
+		"id":           "https://victim.example/notes/2",
+		"type":         "Note",
+		"attributedTo": "https://victim.example/users/bob",
+		"published":    "2023-01-01T00:00:00Z",
+		"content":      "forged",
+	}
+	docs["/notes/3"] = map[string]any{
+		"id":           srv.URL + "/notes/3",
+		"type":         "Note",
+		"attributedTo": "https://victim.example/users/bob",
+		"published":    "2023-01-01T00:00:00Z",
+		"content":      "forged",
+	}
+	c, err := NewClient(mockSignAs(t))
+	require.NoError(t, err)
+
+	t.Run("object from its own server", func(t *testing.T) {
+		require := require.New(t)
+		obj, err := fetchObject(context.Background(), c, srv.URL+"/notes/1")
+		require.NoError(err)
+		require.Equal(srv.URL+"/notes/1", obj.ID)
+	})
+	t.Run("object whose id is on another domain", func(t *testing.T) {
+		_, err := fetchObject(context.Background(), c, srv.URL+"/notes/2")
+		require.Error(t, err)
+	})
+	t.Run("object attributed to an actor on another domain", func(t *testing.T) {
+		_, err := fetchObject(context.Background(), c, srv.URL+"/notes/3")
+		require.Error(t, err)
+	})
+}
+
+func TestResolver(t *testing.T) {
+	db := setupTestDB(t)
+	srv, docs := mockServer(t)
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	signAs := mockSignAs(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard))
+
+	t.Run("statuses are fetched and stored", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		require.NoError(tx.Create(&models.Actor{
+			ID:        snowflake.Now(),
+			URI:       srv.URL + "/users/alice",
+			Name:      "alice",
+			Domain:    u.Host,
+			PublicKey: []byte("-----BEGIN PUBLIC KEY-----"),
+		}).Error)
+		docs["/notes/1"] = map[string]any{
+			"id":           srv.URL + "/notes/1",
+			"type":         "Note",
+			"attributedTo": srv.URL + "/users/alice",
+			"published":    "2023-01-01T00:00:00Z",
+			"content":      "hello",
+		}
+		actor, status, err := NewResolver(signAs, tx, logger).Resolve(context.Background(), srv.URL+"/notes/1")
+		require.NoError(err)
+		require.Nil(actor)
+		require.Equal(srv.URL+"/notes/1", status.URI)
+	})
+
+	t.Run("policies are applied to fetched statuses and their decisions logged", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		require.NoError(tx.Create(&models.Actor{
+			ID:        snowflake.Now(),
+			URI:       srv.URL + "/users/alice",
+			Name:      "alice",
+			Domain:    u.Host,
+			PublicKey: []byte("-----BEGIN PUBLIC KEY-----"),
+		}).Error)
+		docs["/notes/4"] = map[string]any{
+			"id":           srv.URL + "/notes/4",
+			"type":         "Note",
+			"attributedTo": srv.URL + "/users/alice",
+			"published":    "2023-01-01T00:00:00Z",
+			"content":      "spoilers ahead",
+		}
+		policy := &KeywordPolicy{Keywords: []string{"spoilers"}, SpoilerText: "spoilers"}
+		var buf bytes.Buffer
+		_, status, err := NewResolver(signAs, tx, slog.New(slog.NewTextHandler(&buf)), policy).Resolve(context.Background(), srv.URL+"/notes/4")
+		require.NoError(err)
+		require.True(status.Sensitive)
+		require.Equal("spoilers", status.SpoilerText)
+		require.Contains(buf.String(), "policy=keyword_cw decision=rewrite id="+srv.URL+"/notes/4")
+	})
+
+	t.Run("objects claiming an id on another domain are refused", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		docs["/users/mallory"] = map[string]any{
+			"id":                "https://victim.example/users/bob",
+			"type":              "Person",
+			"preferredUsername": "bob",
+		}
+		_, _, err := NewResolver(signAs, tx, logger).Resolve(context.Background(), srv.URL+"/users/mallory")
+		require.Error(err)
+
+		_, err = models.NewActors(tx).FindByURI("https://victim.example/users/bob")
+		require.ErrorIs(err, gorm.ErrRecordNotFound)
+	})
+
+	t.Run("objects on suspended domains are not requested", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		docs["/users/carol"] = map[string]any{
+			"id":                srv.URL + "/users/carol",
+			"type":              "Person",
+			"preferredUsername": "carol",
+		}
+		_, err := models.NewDomainBlocks(tx).Create(u.Hostname(), "suspend", "", "", false)
+		require.NoError(err)
+
+		prev := transport
+		defer func() { transport = prev }()
+		var requested bool
+		transport = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			requested = true
+			return prev.RoundTrip(r)
+		})
+		_, _, err = NewResolver(signAs, tx, logger).Resolve(context.Background(), srv.URL+"/users/carol")
+		require.ErrorIs(err, models.ErrSuspended)
+		require.False(requested)
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
@@ -10,24 +10,32 @@ import (
 	"strings"
 	"time"
 
+	"github.com/bardic/pub/activitypub/jsonld"
+	"github.com/bardic/pub/activitypub/vocab"
 	"github.com/bardic/pub/internal/httpx"
+	"github.com/bardic/pub/internal/lang"
 	"github.com/bardic/pub/internal/snowflake"
 	"github.com/bardic/pub/models"
 	"github.com/go-fed/httpsig"
 	"github.com/go-json-experiment/json"
 	"golang.org/x/exp/slog"
+	"golang.org/x/net/html"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
-func NewInbox(db *gorm.DB) *InboxController {
+// NewInbox returns an InboxController which applies policies, in order, to
+// every incoming activity before processing it.
+func NewInbox(db *gorm.DB, policies ...Policy) *InboxController {
 	return &InboxController{
-		db: db,
+		db:       db,
+		policies: policies,
 	}
 }
 
 type InboxController struct {
-	db *gorm.DB
+	db       *gorm.DB
+	policies []Policy
 }
 
 func (i *InboxController) Create(env *Env, w http.ResponseWriter, r *http.Request) error {
@@ -36,21 +44,38 @@ func (i *InboxController) Create(env *Env, w http.ResponseWriter, r *http.Reques
 		return err
 	}
 
-	var act Activity
-	if err := json.UnmarshalFull(r.Body, &act); err != nil {
+	var doc map[string]any
+	if err := json.UnmarshalFull(r.Body, &doc); err != nil {
 		return httpx.Error(http.StatusBadRequest, err)
 	}
+	var act vocab.Object
+	if err := decode(doc, &act); err != nil {
+		return httpx.Error(http.StatusBadRequest, err)
+	}
+	if err := act.Validate(); err != nil {
+		return httpx.Error(http.StatusBadRequest, err)
+	}
+	if err := checkSuspended(i.db, r, &act); err != nil {
+		return err
+	}
 
 	// if we need to make an activity pub request, we need to sign it with the
 	// instance's admin account.
 	processor := &inboxProcessor{
-		logger: env.Logger.With("instance", instance.Domain),
-		req:    r,
-		db:     i.db,
-		signAs: instance.Admin,
+		logger:   env.Logger.With("instance", instance.Domain),
+		req:      r,
+		db:       i.db,
+		signAs:   instance.Admin,
+		policies: i.policies,
 	}
 
-	if err := processor.processActivity(&act); err != nil {
+	err = processor.processActivity(&act)
+	if errors.Is(err, errRejected) {
+		// the activity refers to a status a policy rejected; drop it like a rejected activity.
+		processor.logger.Info("processActivity", "rejected", err)
+		err = nil
+	}
+	if err != nil {
 		return fmt.Errorf("processActivity failed: %s: %w ", act.ID, err)
 	}
 	w.WriteHeader(http.StatusAccepted)
@@ -58,8 +83,35 @@ func (i *InboxController) Create(env *Env, w http.ResponseWriter, r *http.Reques
 }
 
 func (i *InboxController) findInstance(domain string) (*models.Instance, error) {
+	return findInstance(i.db, domain)
+}
+
+// checkSuspended returns an error if the actor of act, or the actor whose key
+// signed r, belongs to a suspended domain.
+func checkSuspended(db *gorm.DB, r *http.Request, act *vocab.Object) error {
+	ids := []string{act.ID}
+	if act.Actor != nil {
+		ids[0] = act.Actor.ID
+	}
+	if verifier, err := httpsig.NewVerifier(r); err == nil {
+		ids = append(ids, verifier.KeyId())
+	}
+	blocks := models.NewDomainBlocks(db)
+	for _, id := range ids {
+		if err := blocks.CheckURI(id); err != nil {
+			if errors.Is(err, models.ErrSuspended) {
+				return httpx.Error(http.StatusForbidden, err)
+			}
+			return httpx.Error(http.StatusBadRequest, err)
+		}
+	}
+	return nil
+}
+
+// findInstance returns the local instance for domain, with its admin account and actor.
+func findInstance(db *gorm.DB, domain string) (*models.Instance, error) {
 	var instance models.Instance
-	if err := i.db.Joins("Admin").Preload("Admin.Actor").Take(&instance, "domain = ?", domain).Error; err != nil {
+	if err := db.Joins("Admin").Preload("Admin.Actor").Take(&instance, "domain = ?", domain).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, httpx.Error(http.StatusNotFound, err)
 		}
@@ -68,17 +120,27 @@ func (i *InboxController) findInstance(domain string) (*models.Instance, error)
 	return &instance, nil
 }
 
+// decode normalises doc against the bundled JSON-LD contexts and decodes it into obj.
+func decode(doc map[string]any, obj *vocab.Object) error {
+	b, err := json.Marshal(jsonld.Compact(doc))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, obj)
+}
+
 type inboxProcessor struct {
-	logger *slog.Logger
-	req    *http.Request
-	db     *gorm.DB
-	signAs *models.Account
+	logger   *slog.Logger
+	req      *http.Request
+	db       *gorm.DB
+	signAs   *models.Account
+	policies []Policy
 }
 
 // processActivity processes an activity. If the activity can be handled without
 // blocking, it is handled immediately. If the activity requires blocking, it is
 // queued for later processing.
-func (i *inboxProcessor) processActivity(act *Activity) error {
+func (i *inboxProcessor) processActivity(act *vocab.Object) error {
 	i.logger = i.logger.With("id", act.ID, "type", act.Type)
 	i.logger.Info("processActivity")
 	switch act.Type {
@@ -90,26 +152,33 @@ func (i *inboxProcessor) processActivity(act *Activity) error {
 		// validate the signature.
 		return i.processDelete(act)
 	default:
-		if err := i.validateSignature(); err != nil {
+		signer, err := i.validateSignature(act)
+		if err != nil {
 			return httpx.Error(http.StatusUnauthorized, err)
 		}
+		accepted, err := i.applyPolicies(act)
+		if err != nil {
+			return err
+		}
+		if !accepted {
+			// rejected activities are dropped, not reported to the sender as errors.
+			return nil
+		}
 		switch act.Type {
 		case "Create":
-			create := mapFromAny(act.Object)
-			return i.processCreate(create)
+			return i.processCreate(act.Object, signer)
 		case "Announce":
 			return i.processAnnounce(act)
 		case "Undo":
-			undo := mapFromAny(act.Object)
-			return i.processUndo(undo)
+			return i.processUndo(act.Object)
 		case "Update":
-			update := mapFromAny(act.Object)
-			return i.processUpdate(update)
+			return i.processUpdate(act, signer)
 		case "Follow":
 			return i.processFollow(act)
+		case "Like":
+			return i.processLike(act)
 		case "Accept":
-			accept := mapFromAny(act.Object)
-			return i.processAccept(accept)
+			return i.processAccept(act.Object)
 		case "Add":
 			return i.processAdd(act)
 		case "Remove":
@@ -120,21 +189,37 @@ func (i *inboxProcessor) processActivity(act *Activity) error {
 	}
 }
 
-func (i *inboxProcessor) processUndo(obj map[string]any) error {
-	typ := stringFromAny(obj["type"])
-	switch typ {
+// applyPolicies passes act through each policy in turn, logging each decision.
+// It returns false if a policy rejected act.
+func (i *inboxProcessor) applyPolicies(act *vocab.Object) (bool, error) {
+	for _, p := range i.policies {
+		decision, err := p.Filter(i.db, act)
+		if err != nil {
+			return false, fmt.Errorf("policy %s: %w", p.Name(), err)
+		}
+		i.logger.Info("applyPolicies", "policy", p.Name(), "decision", decision)
+		if decision == Reject {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (i *inboxProcessor) processUndo(obj *vocab.Object) error {
+	switch obj.Type {
 	case "Announce":
 		return i.processUndoAnnounce(obj)
 	case "Follow":
 		return i.processUndoFollow(obj)
+	case "Like":
+		return i.processUndoLike(obj)
 	default:
-		return fmt.Errorf("unknown undo object type: %q", typ)
+		return fmt.Errorf("unknown undo object type: %q", obj.Type)
 	}
 }
 
-func (i *inboxProcessor) processUndoAnnounce(obj map[string]any) error {
-	id := stringFromAny(obj["id"])
-	status, err := models.NewStatuses(i.db).FindByURI(id)
+func (i *inboxProcessor) processUndoAnnounce(obj *vocab.Object) error {
+	status, err := models.NewStatuses(i.db).FindByURI(obj.ID)
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		// already deleted
 		return nil
@@ -145,13 +230,13 @@ func (i *inboxProcessor) processUndoAnnounce(obj map[string]any) error {
 	return i.db.Delete(status).Error
 }
 
-func (i *inboxProcessor) processUndoFollow(body map[string]any) error {
+func (i *inboxProcessor) processUndoFollow(obj *vocab.Object) error {
 	actors := models.NewActors(i.db)
-	actor, err := actors.FindByURI(stringFromAny(body["actor"]))
+	actor, err := actors.FindByURI(obj.Actor.ID)
 	if err != nil {
 		return err
 	}
-	target, err := actors.FindByURI(stringFromAny(body["object"]))
+	target, err := actors.FindByURI(obj.Object.ID)
 	if err != nil {
 		return err
 	}
@@ -160,117 +245,153 @@ func (i *inboxProcessor) processUndoFollow(body map[string]any) error {
 	return err
 }
 
-func (i *inboxProcessor) processAnnounce(act *Activity) error {
-	target := stringFromAny(act.Object)
-	statusFetcher := NewRemoteStatusFetcher(i.signAs, i.db)
-	original, err := models.NewStatuses(i.db).FindOrCreate(target, statusFetcher.Fetch)
+// processLike records a favourite of a status we know about. Likes of other
+// statuses are ignored.
+func (i *inboxProcessor) processLike(act *vocab.Object) error {
+	status, err := models.NewStatuses(i.db).FindByURI(act.Object.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	actorFetcher := NewRemoteActorFetcher(i.signAs)
+	actor, err := models.NewActors(i.db).FindOrCreate(act.Actor.ID, actorFetcher.Fetch)
+	if err != nil {
+		return err
+	}
+	_, err = models.NewReactions(i.db).Favourite(status, actor)
+	return err
+}
+
+func (i *inboxProcessor) processUndoLike(obj *vocab.Object) error {
+	status, err := models.NewStatuses(i.db).FindByURI(obj.Object.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	actor, err := models.NewActors(i.db).FindByURI(obj.Actor.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = models.NewReactions(i.db).Unfavourite(status, actor)
+	return err
+}
+
+func (i *inboxProcessor) processAnnounce(act *vocab.Object) error {
+	statusFetcher := NewRemoteStatusFetcher(i.signAs, i.db, i.logger, i.policies...)
+	original, err := models.NewStatuses(i.db).FindOrCreate(act.Object.ID, statusFetcher.Fetch)
 	if err != nil {
 		return err
 	}
 
 	actorFetcher := NewRemoteActorFetcher(i.signAs)
-	actor, err := models.NewActors(i.db).FindOrCreate(stringFromAny(act.Actor), actorFetcher.Fetch)
+	actor, err := models.NewActors(i.db).FindOrCreate(act.Actor.ID, actorFetcher.Fetch)
 	if err != nil {
 		return err
 	}
 
-	publishedAt, updatedAt := act.Published, act.Updated
+	return i.db.Save(reblog(act, actor, original)).Error
+}
+
+// reblog returns the status for an Announce of original by actor.
+func reblog(act *vocab.Object, actor *models.Actor, original *models.Status) *models.Status {
+	publishedAt, updatedAt := act.Published.Time, act.Updated.Time
+	if publishedAt.IsZero() {
+		publishedAt = time.Now()
+	}
 	if updatedAt.IsZero() {
 		updatedAt = publishedAt
 	}
 
-	status := &models.Status{
+	vis := visibility(act, actor)
+	return &models.Status{
 		ID:        snowflake.TimeToID(publishedAt),
 		UpdatedAt: updatedAt,
 		ActorID:   actor.ID,
 		Actor:     actor,
 		Conversation: &models.Conversation{
-			Visibility: "public",
+			Visibility: vis,
 		},
 		URI:        act.ID,
-		Visibility: "public",
+		Visibility: vis,
 		ReblogID:   &original.ID,
 	}
-
-	return i.db.Save(status).Error
 }
 
-func (i *inboxProcessor) processAdd(act *Activity) error {
-	switch obj := act.Object.(type) {
-	case string:
+func (i *inboxProcessor) processAdd(act *vocab.Object) error {
+	switch act.Target.ID {
+	case act.Actor.ID + "/collections/featured":
 		return i.processAddPin(act)
 	default:
-		return fmt.Errorf("processAdd: unknown type: %T", obj)
+		return errors.New("processAdd: unknown target: " + act.Target.ID)
 	}
 }
 
-func (i *inboxProcessor) processAddPin(act *Activity) error {
-	actor := stringFromAny(act.Actor)
-	switch act.Target {
-	case actor + "/collections/featured":
-		status, err := models.NewStatuses(i.db).FindByURI(stringFromAny(act.Object))
-		if err != nil {
-			return err
-		}
-		actor, err := models.NewActors(i.db).FindByURI(actor)
-		if err != nil {
-			return err
-		}
-		if status.ActorID != actor.ID {
-			return errors.New("actor is not the author of the status")
-		}
-		_, err = models.NewReactions(i.db).Pin(status, actor)
+func (i *inboxProcessor) processAddPin(act *vocab.Object) error {
+	statusFetcher := NewRemoteStatusFetcher(i.signAs, i.db, i.logger, i.policies...)
+	status, err := models.NewStatuses(i.db).FindOrCreate(act.Object.ID, statusFetcher.Fetch)
+	if err != nil {
+		return err
+	}
+	actor, err := models.NewActors(i.db).FindByURI(act.Actor.ID)
+	if err != nil {
 		return err
-	default:
-		return errors.New("add pin: unknown target: " + act.Target)
 	}
+	if status.ActorID != actor.ID {
+		return errors.New("actor is not the author of the status")
+	}
+	_, err = models.NewReactions(i.db).Pin(status, actor)
+	return err
 }
 
-func (i *inboxProcessor) processRemove(act *Activity) error {
-	switch obj := act.Object.(type) {
-	case string:
+func (i *inboxProcessor) processRemove(act *vocab.Object) error {
+	switch act.Target.ID {
+	case act.Actor.ID + "/collections/featured":
 		return i.processRemovePin(act)
 	default:
-		return fmt.Errorf("processRemove: unknown type: %T", obj)
+		return errors.New("processRemove: unknown target: " + act.Target.ID)
 	}
 }
 
-func (i *inboxProcessor) processRemovePin(act *Activity) error {
-	actor := stringFromAny(act.Actor)
-	switch act.Target {
-	case actor + "/collections/featured":
-		status, err := models.NewStatuses(i.db).FindByURI(stringFromAny(act.Object))
-		if err != nil {
-			return err
-		}
-		actor, err := models.NewActors(i.db).FindByURI(actor)
-		if err != nil {
-			return err
-		}
-		if status.ActorID != actor.ID {
-			return errors.New("actor is not the author of the status")
-		}
-		reactions := models.NewReactions(i.db)
-		_, err = reactions.Unpin(status, actor)
+func (i *inboxProcessor) processRemovePin(act *vocab.Object) error {
+	status, err := models.NewStatuses(i.db).FindByURI(act.Object.ID)
+	if err != nil {
+		return err
+	}
+	actor, err := models.NewActors(i.db).FindByURI(act.Actor.ID)
+	if err != nil {
 		return err
-	default:
-		return errors.New("remove pin: unknown target: " + act.Target)
 	}
+	if status.ActorID != actor.ID {
+		return errors.New("actor is not the author of the status")
+	}
+	reactions := models.NewReactions(i.db)
+	_, err = reactions.Unpin(status, actor)
+	return err
 }
 
-func (i *inboxProcessor) processCreate(create map[string]any) error {
-	typ := stringFromAny(create["type"])
-	switch typ {
-	case "Note", "Question":
-		return i.processCreateNote(create)
+// processCreate creates the status obj. Actors may only create statuses
+// attributed to themselves.
+func (i *inboxProcessor) processCreate(obj *vocab.Object, signer *models.Actor) error {
+	switch obj.Type {
+	case "Note", "Question", "Article", "Page", "Video", "Audio", "Image", "Event":
+		if obj.AttributedToID() != signer.URI {
+			return httpx.Error(http.StatusForbidden, errors.New("actor is not the author of the status"))
+		}
+		return i.processCreateNote(obj)
 	default:
-		return fmt.Errorf("unknown create object type: %q", typ)
+		return fmt.Errorf("unknown create object type: %q", obj.Type)
 	}
 }
 
-func (i *inboxProcessor) processCreateNote(create map[string]any) error {
-	uri := stringFromAny(create["atomUri"])
-	_, err := models.NewStatuses(i.db).FindByURI(uri)
+func (i *inboxProcessor) processCreateNote(obj *vocab.Object) error {
+	_, err := models.NewStatuses(i.db).FindByURI(obj.ID)
 	switch err {
 	case nil:
 		// we already have this status
@@ -278,50 +399,53 @@ func (i *inboxProcessor) processCreateNote(create map[string]any) error {
 	case gorm.ErrRecordNotFound:
 		// we don't have this status
 		actors := NewRemoteActorFetcher(i.signAs)
-		actor, err := models.NewActors(i.db).FindOrCreate(stringFromAny(create["attributedTo"]), actors.Fetch)
+		actor, err := models.NewActors(i.db).FindOrCreate(obj.AttributedToID(), actors.Fetch)
 		if err != nil {
 			return err
 		}
 
-		publishedAt, updatedAt, err := publishedAndUpdated(create)
+		publishedAt, updatedAt, err := publishedAndUpdated(obj)
 		if err != nil {
 			return err
 		}
 
 		conv := &models.Conversation{
-			Visibility: models.Visibility(visiblity(create)),
+			Visibility: visibility(obj, actor),
 		}
 		var inReplyTo *models.Status
-		if inReplyToAtomUri, ok := create["inReplyTo"].(string); ok {
-			statuses := NewRemoteStatusFetcher(i.signAs, i.db)
-			inReplyTo, err = models.NewStatuses(i.db).FindOrCreate(inReplyToAtomUri, statuses.Fetch)
+		if obj.InReplyTo != nil && obj.InReplyTo.ID != "" {
+			statuses := NewRemoteStatusFetcher(i.signAs, i.db, i.logger, i.policies...)
+			inReplyTo, err = models.NewStatuses(i.db).FindOrCreate(obj.InReplyTo.ID, statuses.Fetch)
 			if err != nil {
 				return err
 			}
 			conv = inReplyTo.Conversation
 		}
 
+		note, spoilerText := noteAndSpoilerText(obj)
 		status := models.Status{
 			ID:               snowflake.TimeToID(publishedAt),
 			UpdatedAt:        updatedAt,
 			ActorID:          actor.ID,
 			Actor:            actor,
 			Conversation:     conv,
-			URI:              uri,
+			URI:              obj.ID,
 			InReplyToID:      inReplyToID(inReplyTo),
 			InReplyToActorID: inReplyToActorID(inReplyTo),
-			Sensitive:        boolFromAny(create["sensitive"]),
-			SpoilerText:      stringFromAny(create["summary"]),
+			Sensitive:        obj.Sensitive,
+			SpoilerText:      spoilerText,
 			Visibility:       conv.Visibility,
-			Language:         "en",
-			Note:             stringFromAny(create["content"]),
-			Attachments:      attachmentsToStatusAttachments(anyToSlice(create["attachment"])),
+			Language:         language(obj),
+			Note:             note,
+			Attachments:      attachmentsToStatusAttachments(obj.Attachment),
+			Type:             models.StatusType(obj.Type),
+			Title:            title(obj),
+			URL:              canonicalURL(obj),
 		}
-		for _, tag := range anyToSlice(create["tag"]) {
-			t := mapFromAny(tag)
-			switch t["type"] {
+		for _, tag := range obj.Tag {
+			switch tag.Type {
 			case "Mention":
-				mention, err := models.NewActors(i.db).FindOrCreate(stringFromAny(t["href"]), actors.Fetch)
+				mention, err := models.NewActors(i.db).FindOrCreate(tag.Href, actors.Fetch)
 				if err != nil {
 					return err
 				}
@@ -334,14 +458,14 @@ func (i *inboxProcessor) processCreateNote(create map[string]any) error {
 				status.Tags = append(status.Tags, models.StatusTag{
 					StatusID: status.ID,
 					Tag: &models.Tag{
-						Name: strings.TrimLeft(stringFromAny(t["name"]), "#"),
+						Name: strings.TrimLeft(tag.Name, "#"),
 					},
 				})
 			}
 		}
 
-		if _, ok := create["oneOf"]; ok {
-			status.Poll, err = objToStatusPoll(create)
+		if isPoll(obj) {
+			status.Poll, err = objToStatusPoll(obj)
 			if err != nil {
 				return err
 			}
@@ -357,13 +481,13 @@ func (i *inboxProcessor) processCreateNote(create map[string]any) error {
 // publishedAndUpdated returns the published and updated times for the given object.
 // If the object does not have a published time, an error is returned.
 // If the object does not have an updated time, updated at is set to published at.
-func publishedAndUpdated(obj map[string]any) (time.Time, time.Time, error) {
-	published, err := time.Parse(time.RFC3339, stringFromAny(obj["published"]))
-	if err != nil {
-		return time.Time{}, time.Time{}, err
+func publishedAndUpdated(obj *vocab.Object) (time.Time, time.Time, error) {
+	published := obj.Published.Time
+	if published.IsZero() {
+		return time.Time{}, time.Time{}, fmt.Errorf("%s: missing published time", obj.ID)
 	}
-	updated, err := time.Parse(time.RFC3339, stringFromAny(obj["updated"]))
-	if err != nil {
+	updated := obj.Updated.Time
+	if updated.IsZero() {
 		updated = published
 	}
 	return published, updated, nil
@@ -383,27 +507,25 @@ func inReplyToActorID(inReplyTo *models.Status) *snowflake.ID {
 	return nil
 }
 
-func objToStatusAttachment(obj map[string]any) *models.StatusAttachment {
+func objToStatusAttachment(obj vocab.Object) *models.StatusAttachment {
 	return &models.StatusAttachment{
 		Attachment: models.Attachment{
 			ID:         snowflake.Now(),
-			MediaType:  stringFromAny(obj["mediaType"]),
-			URL:        stringFromAny(obj["url"]),
-			Name:       stringFromAny(obj["name"]),
-			Width:      intFromAny(obj["width"]),
-			Height:     intFromAny(obj["height"]),
-			Blurhash:   stringFromAny(obj["blurhash"]),
+			MediaType:  obj.MediaType,
+			URL:        obj.URL.Href(),
+			Name:       obj.NameString(),
+			Width:      obj.Width,
+			Height:     obj.Height,
+			Blurhash:   obj.Blurhash,
 			FocalPoint: focalPoint(obj),
 		},
 	}
 }
 
-func focalPoint(obj map[string]any) models.FocalPoint {
-	focalPoint := anyToSlice(obj["focalPoint"])
+func focalPoint(obj vocab.Object) models.FocalPoint {
 	var x, y float64
-	if len(focalPoint) == 2 {
-		x, _ = focalPoint[0].(float64)
-		y, _ = focalPoint[1].(float64)
+	if len(obj.FocalPoint) == 2 {
+		x, y = obj.FocalPoint[0], obj.FocalPoint[1]
 	}
 	return models.FocalPoint{
 		X: x,
@@ -411,28 +533,27 @@ func focalPoint(obj map[string]any) models.FocalPoint {
 	}
 }
 
-func (i *inboxProcessor) processAccept(obj map[string]any) error {
-	typ := stringFromAny(obj["type"])
-	switch typ {
+func (i *inboxProcessor) processAccept(obj *vocab.Object) error {
+	switch obj.Type {
 	case "Follow":
 		return i.processAcceptFollow(obj)
 	default:
-		return fmt.Errorf("unknown accept object type: %q", typ)
+		return fmt.Errorf("unknown accept object type: %q", obj.Type)
 	}
 }
 
-func (i *inboxProcessor) processAcceptFollow(obj map[string]any) error {
+func (i *inboxProcessor) processAcceptFollow(obj *vocab.Object) error {
 	// consume
 	return nil
 }
 
-func (i *inboxProcessor) processFollow(act *Activity) error {
+func (i *inboxProcessor) processFollow(act *vocab.Object) error {
 	actors := models.NewActors(i.db)
-	actor, err := actors.FindByURI(stringFromAny(act.Actor))
+	actor, err := actors.FindByURI(act.Actor.ID)
 	if err != nil {
 		return err
 	}
-	target, err := actors.FindByURI(stringFromAny(act.Object))
+	target, err := actors.FindByURI(act.Object.ID)
 	if err != nil {
 		return err
 	}
@@ -441,113 +562,375 @@ func (i *inboxProcessor) processFollow(act *Activity) error {
 	return err
 }
 
-func (i *inboxProcessor) processUpdate(update map[string]any) error {
-	typ := stringFromAny(update["type"])
-	switch typ {
-	case "Note", "Question":
-		return i.processUpdateStatus(update)
-	case "Person":
-		return i.processUpdateActor(update)
+// processUpdate applies an Update signed by signer. Actors may only update
+// themselves and the statuses they authored.
+func (i *inboxProcessor) processUpdate(act *vocab.Object, signer *models.Actor) error {
+	obj := act.Object
+	switch obj.Type {
+	case "Note", "Question", "Article", "Page", "Video", "Audio", "Image", "Event":
+		return i.processUpdateStatus(signer.URI, obj)
+	case "Person", "Service", "Application", "Group", "Organization":
+		if obj.ID != signer.URI {
+			return httpx.Error(http.StatusForbidden, errors.New("actor may only update itself"))
+		}
+		return i.processUpdateActor(obj)
 	default:
-		return fmt.Errorf("unknown update object type: %q", typ)
+		return fmt.Errorf("unknown update object type: %q", obj.Type)
 	}
 }
 
-func (i *inboxProcessor) processUpdateStatus(update map[string]any) error {
-	id := stringFromAny(update["id"])
-	statusFetcher := NewRemoteStatusFetcher(i.signAs, i.db)
-	status, err := models.NewStatuses(i.db).FindOrCreate(id, statusFetcher.Fetch)
+// processUpdateStatus applies an Update to a status. The status' content,
+// attachments, mentions, tags, and poll are replaced with those of obj.
+func (i *inboxProcessor) processUpdateStatus(actorID string, obj *vocab.Object) error {
+	statusFetcher := NewRemoteStatusFetcher(i.signAs, i.db, i.logger, i.policies...)
+	status, err := models.NewStatuses(i.db).FindOrCreate(obj.ID, statusFetcher.Fetch)
 	if err != nil {
 		return err
 	}
-	_, updatedAt, err := publishedAndUpdated(update)
+	if status.Actor == nil || status.Actor.URI != actorID {
+		return httpx.Error(http.StatusForbidden, errors.New("actor is not the author of the status"))
+	}
+	_, updatedAt, err := publishedAndUpdated(obj)
+	if err != nil {
+		return err
+	}
+
+	mentions, err := i.statusMentions(status.ID, obj.Tag)
 	if err != nil {
 		return err
 	}
 
 	status.UpdatedAt = updatedAt
-	status.Note = stringFromAny(update["content"])
-	if status.Poll != nil {
-		if err := i.db.Delete(status.Poll).Error; err != nil {
+	status.Note, status.SpoilerText = noteAndSpoilerText(obj)
+	status.Sensitive = obj.Sensitive
+	status.Language = language(obj)
+	status.Title = title(obj)
+	status.URL = canonicalURL(obj)
+
+	return i.db.Transaction(func(tx *gorm.DB) error {
+		if err := updateStatusAttachments(tx, status, obj.Attachment); err != nil {
 			return err
 		}
-	}
+		if err := tx.Where("status_id = ?", status.ID).Delete(&models.StatusMention{}).Error; err != nil {
+			return err
+		}
+		for i := range mentions {
+			if err := tx.Omit("Actor").Create(&mentions[i]).Error; err != nil {
+				return err
+			}
+		}
+		if err := updateStatusTags(tx, status, obj.Tag); err != nil {
+			return err
+		}
+		if status.Poll != nil {
+			if err := tx.Delete(status.Poll).Error; err != nil {
+				return err
+			}
+			status.Poll = nil
+		}
+		if isPoll(obj) {
+			poll, err := objToStatusPoll(obj)
+			if err != nil {
+				return err
+			}
+			poll.StatusID = status.ID
+			if err := tx.Create(poll).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Omit(clause.Associations).Save(status).Error; err != nil {
+			return err
+		}
+		return models.NewNotifications(tx).Update(status)
+	})
+}
 
-	if _, ok := update["oneOf"]; ok {
-		status.Poll, err = objToStatusPoll(update)
+// statusMentions resolves the Mention tags of a status to StatusMentions.
+func (i *inboxProcessor) statusMentions(statusID snowflake.ID, tags vocab.Objects) ([]models.StatusMention, error) {
+	actors := NewRemoteActorFetcher(i.signAs)
+	var mentions []models.StatusMention
+	seen := make(map[snowflake.ID]bool)
+	for _, tag := range tags {
+		if tag.Type != "Mention" {
+			continue
+		}
+		mention, err := models.NewActors(i.db).FindOrCreate(tag.Href, actors.Fetch)
 		if err != nil {
+			return nil, err
+		}
+		if seen[mention.ID] {
+			continue
+		}
+		seen[mention.ID] = true
+		mentions = append(mentions, models.StatusMention{
+			StatusID: statusID,
+			ActorID:  mention.ID,
+			Actor:    mention,
+		})
+	}
+	return mentions, nil
+}
+
+// updateStatusAttachments reconciles the attachments of status with those of an
+// Update. Attachments are matched by URL; those which are unchanged keep their ID,
+// so clients which have cached them are not confused.
+func updateStatusAttachments(tx *gorm.DB, status *models.Status, attachments vocab.Objects) error {
+	existing := make(map[string]*models.StatusAttachment, len(status.Attachments))
+	for _, att := range status.Attachments {
+		existing[att.URL] = att
+	}
+	var updated []*models.StatusAttachment
+	for _, obj := range attachments {
+		att := objToStatusAttachment(obj)
+		if prev, ok := existing[att.URL]; ok {
+			delete(existing, att.URL)
+			// UpdateColumns skips the hooks, the media has already been fetched.
+			if err := tx.Model(prev).UpdateColumns(map[string]any{
+				"name":          att.Name,
+				"blurhash":      att.Blurhash,
+				"focal_point_x": att.FocalPoint.X,
+				"focal_point_y": att.FocalPoint.Y,
+			}).Error; err != nil {
+				return err
+			}
+			prev.Name = att.Name
+			prev.Blurhash = att.Blurhash
+			prev.FocalPoint = att.FocalPoint
+			updated = append(updated, prev)
+			continue
+		}
+		att.StatusID = status.ID
+		if err := tx.Create(att).Error; err != nil {
 			return err
 		}
-		status.Poll.StatusID = status.ID
+		updated = append(updated, att)
 	}
+	for _, att := range existing {
+		if err := tx.Delete(att).Error; err != nil {
+			return err
+		}
+	}
+	status.Attachments = updated
+	return nil
+}
 
-	// TODO handle attachments
-	upsert := clause.OnConflict{
-		UpdateAll: true,
+// updateStatusTags replaces the hashtags of status with the Hashtag tags of an Update.
+func updateStatusTags(tx *gorm.DB, status *models.Status, tags vocab.Objects) error {
+	if err := tx.Where("status_id = ?", status.ID).Delete(&models.StatusTag{}).Error; err != nil {
+		return err
+	}
+	status.Tags = nil
+	seen := make(map[string]bool)
+	for _, t := range tags {
+		if t.Type != "Hashtag" {
+			continue
+		}
+		name := strings.TrimLeft(t.Name, "#")
+		if name == "" || seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		var tag models.Tag
+		if err := tx.Where("name = ?", name).FirstOrCreate(&tag, models.Tag{Name: name}).Error; err != nil {
+			return err
+		}
+		st := models.StatusTag{
+			StatusID: status.ID,
+			TagID:    tag.ID,
+			Tag:      &tag,
+		}
+		if err := tx.Omit("Tag").Create(&st).Error; err != nil {
+			return err
+		}
+		status.Tags = append(status.Tags, st)
 	}
-	return i.db.Clauses(upsert).Save(&status).Error
+	return nil
 }
 
-func objToStatusPoll(obj map[string]any) (*models.StatusPoll, error) {
-	expiresAt, err := timeFromAny(obj["endTime"])
-	if err != nil {
-		return nil, err
+// maxInlineContent is the length above which the content of a long form object,
+// such as an Article, is replaced with its name, summary and a link to the original.
+const maxInlineContent = 500
+
+// noteAndSpoilerText returns the body and content warning of the status for obj.
+// Notes and Questions are stored as is. Other types use their summary as an
+// abstract, not a content warning, so are stored as their name, their summary or,
+// if it is short enough, their content, and a link to the canonical URL.
+func noteAndSpoilerText(obj *vocab.Object) (string, string) {
+	content := obj.ContentString()
+	switch obj.Type {
+	case "Note", "Question":
+		return content, obj.SummaryString()
+	}
+	name := obj.NameString()
+	if name == "" && len(content) <= maxInlineContent {
+		return content, ""
+	}
+	var sb strings.Builder
+	if name != "" {
+		fmt.Fprintf(&sb, "<p><strong>%s</strong></p>", html.EscapeString(name))
+	}
+	if summary := obj.SummaryString(); summary != "" {
+		sb.WriteString(summary)
+	} else if len(content) <= maxInlineContent {
+		sb.WriteString(content)
+	}
+	url := canonicalURL(obj)
+	if url == "" {
+		url = obj.ID
+	}
+	fmt.Fprintf(&sb, `<p><a href="%s">%s</a></p>`, html.EscapeString(url), html.EscapeString(url))
+	return sb.String(), ""
+}
+
+// title returns the name of long form objects, truncated to fit models.Status.Title.
+func title(obj *vocab.Object) string {
+	switch obj.Type {
+	case "Note", "Question":
+		return ""
+	}
+	name := []rune(obj.NameString())
+	if len(name) > 255 {
+		name = name[:255]
 	}
+	return string(name)
+}
+
+// canonicalURL returns the human readable URL of obj, if it differs from its ID.
+func canonicalURL(obj *vocab.Object) string {
+	if url := obj.URL.HTML(); url != obj.ID && len(url) <= 255 {
+		return url
+	}
+	return ""
+}
+
+// language returns the BCP 47 tag of the language obj is written in, taken from
+// contentMap if possible, otherwise detected from its content.
+func language(obj *vocab.Object) string {
+	if tag := obj.ContentLanguage(); tag != "" && tag != "und" && len(tag) <= 35 {
+		return tag
+	}
+	return lang.Detect(plainText(obj.ContentString()))
+}
+
+// plainText returns the text of an HTML fragment without its links, which are
+// usually mentions, hashtags or URLs, and say nothing about the language the
+// text is written in.
+func plainText(fragment string) string {
+	var sb strings.Builder
+	var inLink int
+	z := html.NewTokenizer(strings.NewReader(fragment))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return sb.String()
+		case html.StartTagToken:
+			if name, _ := z.TagName(); string(name) == "a" {
+				inLink++
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "a" && inLink > 0 {
+				inLink--
+			}
+		case html.TextToken:
+			if inLink == 0 {
+				sb.Write(z.Text())
+				sb.WriteByte(' ')
+			}
+		}
+	}
+}
 
+// isPoll reports whether the object is a Question with options.
+func isPoll(obj *vocab.Object) bool {
+	return len(obj.OneOf) > 0 || len(obj.AnyOf) > 0
+}
+
+func objToStatusPoll(obj *vocab.Object) (*models.StatusPoll, error) {
+	expiresAt := obj.EndTime.Time
+	if expiresAt.IsZero() {
+		expiresAt = obj.Closed.Time
+	}
+
+	options := obj.OneOf
+	if len(obj.AnyOf) > 0 {
+		options = obj.AnyOf
+	}
 	poll := &models.StatusPoll{
 		ExpiresAt: expiresAt,
-		Multiple:  false,
+		Multiple:  len(obj.AnyOf) > 0,
 	}
 
-	oneOf := anyToSlice(obj["oneOf"])
-	for _, o := range oneOf {
-		option := mapFromAny(o)
-		if option["type"] != "Note" {
-			return nil, fmt.Errorf("invalid poll option type: %q", option["type"])
+	for _, option := range options {
+		if option.Type != "Note" {
+			return nil, fmt.Errorf("invalid poll option type: %q", option.Type)
+		}
+		var count int
+		if option.Replies != nil {
+			count = option.Replies.TotalItems
 		}
-
 		poll.Options = append(poll.Options, models.StatusPollOption{
-			Title: stringFromAny(option["name"]),
-			Count: intFromAny(mapFromAny(option["replies"])["totalItems"]),
+			Title: option.NameString(),
+			Count: count,
 		})
 	}
 
 	return poll, nil
 }
 
-func (i *inboxProcessor) processUpdateActor(update map[string]any) error {
-	id := stringFromAny(update["id"])
+// processUpdateActor applies an Update to a remote actor, replacing its
+// profile, including its profile fields.
+func (i *inboxProcessor) processUpdateActor(obj *vocab.Object) error {
 	actorFetcher := NewRemoteActorFetcher(i.signAs)
-	actor, err := models.NewActors(i.db).FindOrCreate(id, actorFetcher.Fetch)
+	actor, err := models.NewActors(i.db).FindOrCreate(obj.ID, actorFetcher.Fetch)
 	if err != nil {
 		return err
 	}
-	actor.Name = stringFromAny(update["preferredUsername"])
-	actor.DisplayName = stringFromAny(update["name"])
-	actor.Locked = boolFromAny(update["manuallyApprovesFollowers"])
-	actor.Note = stringFromAny(update["summary"])
-	actor.Avatar = stringFromAny(mapFromAny(update["icon"])["url"])
-	actor.Header = stringFromAny(mapFromAny(update["image"])["url"])
-	actor.PublicKey = []byte(stringFromAny(mapFromAny(update["publicKey"])["publicKeyPem"]))
+	actor.Type = models.ActorType(obj.Type)
+	actor.Name = obj.PreferredUsername
+	actor.DisplayName = obj.NameString()
+	actor.Locked = obj.ManuallyApprovesFollowers
+	actor.Note = obj.SummaryString()
+	actor.Avatar = imageURL(obj.Icon)
+	actor.Header = imageURL(obj.Image)
+	actor.FollowersURL = obj.Followers
+	actor.FeaturedURL = obj.Featured
+	if obj.PublicKey != nil {
+		actor.PublicKey = []byte(obj.PublicKey.PublicKeyPem)
+	}
+	actor.Attributes = attachmentsToActorAttributes(obj.Attachment)
 
-	// todo update attributes
+	return i.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("actor_id = ?", actor.ID).Delete(&models.ActorAttribute{}).Error; err != nil {
+			return err
+		}
+		for _, attr := range actor.Attributes {
+			attr.ActorID = actor.ID
+			if err := tx.Create(attr).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Omit(clause.Associations).Save(actor).Error
+	})
+}
 
-	return i.db.Save(&actor).Error
+// imageURL returns the URL of an icon or image, or an empty string if img is nil.
+func imageURL(img *vocab.Object) string {
+	if img == nil {
+		return ""
+	}
+	return img.URL.Href()
 }
 
-func (i *inboxProcessor) processDelete(act *Activity) error {
-	switch obj := act.Object.(type) {
-	case map[string]any:
-		return i.processDeleteStatus(stringFromAny(obj["id"]))
-	case string:
-		return i.processDeleteActor(obj)
-	default:
-		return fmt.Errorf("unknown delete object type: %q: %v", obj, act)
+func (i *inboxProcessor) processDelete(act *vocab.Object) error {
+	if act.Object.IsLink() {
+		return i.processDeleteActor(act, act.Object.ID)
 	}
+	return i.processDeleteStatus(act, act.Object.ID)
 }
 
-func (i *inboxProcessor) processDeleteStatus(uri string) error {
-	if err := i.validateSignature(); err != nil {
+func (i *inboxProcessor) processDeleteStatus(act *vocab.Object, uri string) error {
+	signer, err := i.validateSignature(act)
+	if err != nil {
 		return httpx.Error(http.StatusUnauthorized, err)
 	}
 
@@ -560,10 +943,13 @@ func (i *inboxProcessor) processDeleteStatus(uri string) error {
 		}
 		return err
 	}
+	if status.ActorID != signer.ID {
+		return httpx.Error(http.StatusForbidden, errors.New("actor is not the author of the status"))
+	}
 	return i.db.Delete(&status).Error
 }
 
-func (i *inboxProcessor) processDeleteActor(uri string) error {
+func (i *inboxProcessor) processDeleteActor(act *vocab.Object, uri string) error {
 	// use this form to avoid firing gorm's ErrNotFound mechanism;
 	// most deletes we don't know about, and that's fine.
 	var actors []*models.Actor
@@ -575,57 +961,83 @@ func (i *inboxProcessor) processDeleteActor(uri string) error {
 		return nil
 	}
 	actor := actors[0]
-	if err := i.validateSignature(); err != nil {
+	signer, err := i.validateSignature(act)
+	if err != nil {
 		return httpx.Error(http.StatusUnauthorized, err)
 	}
+	if signer.ID != actor.ID {
+		return httpx.Error(http.StatusForbidden, errors.New("actor may only delete itself"))
+	}
 	return i.db.Delete(actor).Error
 }
 
-func (i *inboxProcessor) validateSignature() error {
-	verifier, err := httpsig.NewVerifier(i.req)
+// validateSignature verifies the HTTP signature of the request which delivered
+// act, and returns the signer. The signer must be the actor of act.
+func (i *inboxProcessor) validateSignature(act *vocab.Object) (*models.Actor, error) {
+	actor, err := signer(i.db, i.signAs, i.req)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	pubKey, err := i.getKey(verifier.KeyId())
-	if err != nil {
-		return err
+	if act.Actor == nil || act.Actor.ID != actor.URI {
+		return nil, fmt.Errorf("activity signed by %q, not its actor", actor.URI)
 	}
-	if err := verifier.Verify(pubKey, httpsig.RSA_SHA256); err != nil {
-		return err
+	// the signer's server has delivered an activity to us, so is our peer.
+	if err := models.NewPeers(i.db).Record(actor.Domain); err != nil {
+		return nil, err
 	}
-	return nil
+	return actor, nil
 }
 
-func (i *inboxProcessor) getKey(keyID string) (crypto.PublicKey, error) {
-	fetcher := NewRemoteActorFetcher(i.signAs)
-	actor, err := models.NewActors(i.db).FindOrCreate(trimKeyId(keyID), fetcher.Fetch)
+// signer verifies the HTTP signature of r and returns the actor which signed it.
+// Actors which are not known locally are fetched, signed as signAs.
+func signer(db *gorm.DB, signAs *models.Account, r *http.Request) (*models.Actor, error) {
+	verifier, err := httpsig.NewVerifier(r)
 	if err != nil {
 		return nil, err
 	}
-	return pemToPublicKey(actor.PublicKey)
+	fetcher := NewRemoteActorFetcher(signAs)
+	actor, err := models.NewActors(db).FindOrCreate(trimKeyId(verifier.KeyId()), fetcher.Fetch)
+	if err != nil {
+		return nil, err
+	}
+	pubKey, err := pemToPublicKey(actor.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifier.Verify(pubKey, httpsig.RSA_SHA256); err != nil {
+		return nil, err
+	}
+	return actor, nil
 }
 
-func visiblity(obj map[string]any) string {
-	actor := stringFromAny(obj["attributedTo"])
-	for _, recipient := range anyToSlice(obj["to"]) {
-		switch recipient {
-		case "https://www.w3.org/ns/activitystreams#Public":
-			return "public"
-		case actor + "/followers":
-			return "limited"
-		}
+// visibility returns the visibility of obj, determined by its audience.
+// Public in to is public, Public in cc is unlisted, and the author's followers
+// collection is followers only. Anything else is addressed only to the actors
+// it mentions, and so is direct.
+func visibility(obj *vocab.Object, author *models.Actor) models.Visibility {
+	switch {
+	case obj.To.Contains(vocab.Public):
+		return "public"
+	case obj.CC.Contains(vocab.Public):
+		return "unlisted"
 	}
-	for _, recipient := range anyToSlice(obj["cc"]) {
-		switch recipient {
-		case "https://www.w3.org/ns/activitystreams#Public":
-			return "public"
-		}
+	followers := author.FollowersURL
+	if followers == "" {
+		// we have not refreshed this actor since we started recording
+		// its followers collection; fall back to Mastodon's convention.
+		followers = author.URI + "/followers"
+	}
+	if obj.To.Contains(followers) || obj.CC.Contains(followers) {
+		return "private"
 	}
-	return "direct" // hack
+	return "direct"
 }
 
 func pemToPublicKey(key []byte) (crypto.PublicKey, error) {
 	block, _ := pem.Decode(key)
+	if block == nil {
+		return nil, errors.New("pemToPublicKey: no pem block found")
+	}
 	if block.Type != "PUBLIC KEY" {
 		return nil, fmt.Errorf("pemToPublicKey: invalid pem type: %s", block.Type)
 	}
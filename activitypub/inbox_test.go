@@ -1,12 +1,81 @@
 package activitypub
 
 import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/bardic/pub/activitypub/vocab"
+	"github.com/bardic/pub/internal/httpsig"
+	"github.com/bardic/pub/internal/httpx"
+	"github.com/bardic/pub/internal/snowflake"
+	"github.com/bardic/pub/models"
+	"github.com/go-json-experiment/json"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
+func setupTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	require := require.New(t)
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{
+		TranslateError: true,
+		Logger:         logger.Default.LogMode(logger.Warn),
+	})
+	require.NoError(err)
+	require.NoError(db.AutoMigrate(models.AllTables()...))
+	require.NoError(db.Exec("PRAGMA foreign_keys = ON").Error)
+	return db
+}
+
+// mockStatus creates a status by a new remote actor.
+func mockStatus(t *testing.T, tx *gorm.DB) *models.Status {
+	t.Helper()
+	require := require.New(t)
+	actor := &models.Actor{
+		ID:        snowflake.Now(),
+		URI:       "https://example.com/users/alice",
+		Name:      "alice",
+		Domain:    "example.com",
+		PublicKey: []byte("-----BEGIN PUBLIC KEY-----"),
+	}
+	require.NoError(tx.Create(actor).Error)
+	status := &models.Status{
+		ID:      snowflake.Now(),
+		URI:     "https://example.com/users/alice/statuses/1",
+		ActorID: actor.ID,
+		Conversation: &models.Conversation{
+			Visibility: "public",
+		},
+		Note: "hello",
+	}
+	require.NoError(tx.Create(status).Error)
+	return status
+}
+
+// toObject round trips obj through JSON to produce a vocab.Object.
+func toObject(t *testing.T, obj map[string]any) *vocab.Object {
+	t.Helper()
+	b, err := json.Marshal(obj)
+	require.NoError(t, err)
+	var o vocab.Object
+	require.NoError(t, json.Unmarshal(b, &o))
+	return &o
+}
+
 func TestPublishedAndUpdated(t *testing.T) {
 	t.Run("published and updated are the same when updated is missing ", func(t *testing.T) {
 		require := require.New(t)
@@ -14,7 +83,7 @@ func TestPublishedAndUpdated(t *testing.T) {
 		obj := map[string]any{
 			"published": time.Now().Format(time.RFC3339),
 		}
-		published, updated, err := publishedAndUpdated(obj)
+		published, updated, err := publishedAndUpdated(toObject(t, obj))
 		require.NoError(err)
 		require.Equal(published, updated)
 	})
@@ -25,7 +94,7 @@ func TestPublishedAndUpdated(t *testing.T) {
 			"published": time.Now().Format(time.RFC3339),
 			"updated":   "",
 		}
-		published, updated, err := publishedAndUpdated(obj)
+		published, updated, err := publishedAndUpdated(toObject(t, obj))
 		require.NoError(err)
 		require.Equal(published, updated)
 	})
@@ -36,7 +105,7 @@ func TestPublishedAndUpdated(t *testing.T) {
 			"published": time.Now().Format(time.RFC3339),
 			"updated":   "invalid",
 		}
-		published, updated, err := publishedAndUpdated(obj)
+		published, updated, err := publishedAndUpdated(toObject(t, obj))
 		require.NoError(err)
 		require.Equal(published, updated)
 	})
@@ -49,8 +118,391 @@ func TestPublishedAndUpdated(t *testing.T) {
 			"published": published.Format(time.RFC3339),
 			"updated":   updated.Format(time.RFC3339),
 		}
-		published, updated, err := publishedAndUpdated(obj)
+		published, updated, err := publishedAndUpdated(toObject(t, obj))
 		require.NoError(err)
 		require.True(published.Before(updated))
 	})
+	t.Run("missing published is an error", func(t *testing.T) {
+		require := require.New(t)
+
+		obj := map[string]any{
+			"updated": time.Now().Format(time.RFC3339),
+		}
+		_, _, err := publishedAndUpdated(toObject(t, obj))
+		require.Error(err)
+	})
+}
+
+func TestNoteAndSpoilerText(t *testing.T) {
+	t.Run("Note keeps its content and content warning", func(t *testing.T) {
+		require := require.New(t)
+
+		note, spoiler := noteAndSpoilerText(toObject(t, map[string]any{
+			"type":    "Note",
+			"summary": "cw",
+			"content": "<p>hello</p>",
+		}))
+		require.Equal("<p>hello</p>", note)
+		require.Equal("cw", spoiler)
+	})
+	t.Run("short Page without a name keeps its content", func(t *testing.T) {
+		require := require.New(t)
+
+		note, spoiler := noteAndSpoilerText(toObject(t, map[string]any{
+			"type":    "Page",
+			"content": "<p>hello</p>",
+		}))
+		require.Equal("<p>hello</p>", note)
+		require.Equal("", spoiler)
+	})
+	t.Run("Article uses name, summary and link", func(t *testing.T) {
+		require := require.New(t)
+
+		note, spoiler := noteAndSpoilerText(toObject(t, map[string]any{
+			"id":      "https://blog.example.org/ap/1",
+			"type":    "Article",
+			"name":    "Title & more",
+			"summary": "<p>abstract</p>",
+			"content": "<p>" + strings.Repeat("long ", 200) + "</p>",
+			"url":     "https://blog.example.org/title",
+		}))
+		require.Equal(`<p><strong>Title &amp; more</strong></p><p>abstract</p><p><a href="https://blog.example.org/title">https://blog.example.org/title</a></p>`, note)
+		require.Equal("", spoiler)
+	})
+	t.Run("long Article without a summary drops its content", func(t *testing.T) {
+		require := require.New(t)
+
+		note, _ := noteAndSpoilerText(toObject(t, map[string]any{
+			"id":      "https://blog.example.org/ap/1",
+			"type":    "Article",
+			"name":    "Title",
+			"content": "<p>" + strings.Repeat("long ", 200) + "</p>",
+		}))
+		require.Equal(`<p><strong>Title</strong></p><p><a href="https://blog.example.org/ap/1">https://blog.example.org/ap/1</a></p>`, note)
+	})
+}
+
+func TestVisibility(t *testing.T) {
+	author := &models.Actor{
+		URI:          "https://example.com/users/alice",
+		FollowersURL: "https://example.com/ap/users/1/followers",
+	}
+	tests := []struct {
+		name string
+		obj  map[string]any
+		want models.Visibility
+	}{{
+		name: "public in to",
+		obj:  map[string]any{"to": vocab.Public, "cc": []any{author.FollowersURL}},
+		want: "public",
+	}, {
+		name: "public in cc",
+		obj:  map[string]any{"to": []any{author.FollowersURL}, "cc": []any{vocab.Public}},
+		want: "unlisted",
+	}, {
+		name: "followers in to",
+		obj:  map[string]any{"to": []any{author.FollowersURL}, "cc": []any{"https://example.org/users/bob"}},
+		want: "private",
+	}, {
+		name: "followers as an embedded object",
+		obj:  map[string]any{"to": map[string]any{"id": author.FollowersURL, "type": "OrderedCollection"}},
+		want: "private",
+	}, {
+		name: "mentions only",
+		obj:  map[string]any{"to": []any{"https://example.org/users/bob"}},
+		want: "direct",
+	}, {
+		name: "guessed followers URL is not used when the real one is known",
+		obj:  map[string]any{"to": []any{author.URI + "/followers"}},
+		want: "direct",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, visibility(toObject(t, tt.obj), author))
+		})
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	t.Run("contentMap", func(t *testing.T) {
+		require := require.New(t)
+		obj := toObject(t, map[string]any{
+			"content":    "<p>olá</p>",
+			"contentMap": map[string]any{"pt-BR": "<p>olá</p>"},
+		})
+		require.Equal("pt-BR", language(obj))
+	})
+	t.Run("detected from content, ignoring mentions and links", func(t *testing.T) {
+		require := require.New(t)
+		obj := toObject(t, map[string]any{
+			"content": `<p><span class="h-card"><a href="https://example.com/@bob" class="u-url mention">@<span>bob</span></a></span> Wir haben gestern Abend den neuen Film gesehen und er war wirklich gut. <a href="https://example.com/the/quick/brown/fox">https://example.com/the/quick/brown/fox</a></p>`,
+		})
+		require.Equal("de", language(obj))
+	})
+	t.Run("too short to tell", func(t *testing.T) {
+		require := require.New(t)
+		require.Equal("", language(toObject(t, map[string]any{"content": "<p>ok</p>"})))
+	})
+}
+
+func TestUpdateStatusAttachments(t *testing.T) {
+	db := setupTestDB(t)
+
+	t.Run("attachments are matched by url", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		status := mockStatus(t, tx)
+		require.NoError(updateStatusAttachments(tx, status, vocab.Objects{
+			*toObject(t, map[string]any{"type": "Document", "mediaType": "image/png", "url": "https://example.com/a.png", "width": 1, "height": 1}),
+			*toObject(t, map[string]any{"type": "Document", "mediaType": "image/png", "url": "https://example.com/b.png", "width": 1, "height": 1}),
+		}))
+		require.Len(status.Attachments, 2)
+		kept := status.Attachments[1].ID
+
+		require.NoError(updateStatusAttachments(tx, status, vocab.Objects{
+			*toObject(t, map[string]any{"type": "Document", "mediaType": "image/png", "url": "https://example.com/b.png", "name": "a cat", "width": 1, "height": 1}),
+			*toObject(t, map[string]any{"type": "Document", "mediaType": "image/png", "url": "https://example.com/c.png", "width": 1, "height": 1}),
+		}))
+
+		var atts []models.StatusAttachment
+		require.NoError(tx.Where("status_id = ?", status.ID).Order("url").Find(&atts).Error)
+		require.Len(atts, 2)
+		require.Equal(kept, atts[0].ID)
+		require.Equal("a cat", atts[0].Name)
+		require.Equal("https://example.com/c.png", atts[1].URL)
+	})
+}
+
+func TestUpdateStatusTags(t *testing.T) {
+	db := setupTestDB(t)
+
+	t.Run("tags are replaced", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		status := mockStatus(t, tx)
+		require.NoError(updateStatusTags(tx, status, vocab.Objects{
+			*toObject(t, map[string]any{"type": "Hashtag", "name": "#cats"}),
+			*toObject(t, map[string]any{"type": "Hashtag", "name": "#dogs"}),
+		}))
+		require.NoError(updateStatusTags(tx, status, vocab.Objects{
+			*toObject(t, map[string]any{"type": "Hashtag", "name": "#dogs"}),
+			*toObject(t, map[string]any{"type": "Hashtag", "name": "#dogs"}),
+			*toObject(t, map[string]any{"type": "Mention", "name": "@bob", "href": "https://example.com/users/bob"}),
+		}))
+
+		var tags []models.StatusTag
+		require.NoError(tx.Preload("Tag").Where("status_id = ?", status.ID).Find(&tags).Error)
+		require.Len(tags, 1)
+		require.Equal("dogs", tags[0].Tag.Name)
+
+		var count int64
+		require.NoError(tx.Model(&models.Tag{}).Where("name = ?", "dogs").Count(&count).Error)
+		require.EqualValues(1, count)
+	})
+}
+
+// mockSigningActor creates a remote actor with uri and returns it with its private key.
+func mockSigningActor(t *testing.T, tx *gorm.DB, uri string) (*models.Actor, *rsa.PrivateKey) {
+	t.Helper()
+	require := require.New(t)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(err)
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(err)
+	u, err := url.Parse(uri)
+	require.NoError(err)
+	actor := &models.Actor{
+		ID:        snowflake.Now(),
+		URI:       uri,
+		Name:      path.Base(u.Path),
+		Domain:    u.Host,
+		PublicKey: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}),
+	}
+	require.NoError(tx.Create(actor).Error)
+	return actor, key
+}
+
+// signedInboxRequest returns a request delivering act to the shared inbox, signed by
+// the key of signer.
+func signedInboxRequest(t *testing.T, act map[string]any, signer *models.Actor, key *rsa.PrivateKey) *http.Request {
+	t.Helper()
+	body, err := json.Marshal(act)
+	require.NoError(t, err)
+	r := httptest.NewRequest("POST", "https://example.org/inbox", bytes.NewReader(body))
+	require.NoError(t, httpsig.Sign(r, signer.PublicKeyID(), key, body))
+	return r
+}
+
+func TestProcessUpdate(t *testing.T) {
+	db := setupTestDB(t)
+
+	process := func(tx *gorm.DB, act map[string]any, signer *models.Actor, key *rsa.PrivateKey) error {
+		i := &inboxProcessor{
+			logger: slog.New(slog.NewTextHandler(io.Discard)),
+			req:    signedInboxRequest(t, act, signer, key),
+			db:     tx,
+		}
+		return i.processActivity(toObject(t, act))
+	}
+
+	t.Run("an actor may update itself", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		alice, key := mockSigningActor(t, tx, "https://example.com/users/alice")
+		require.NoError(process(tx, map[string]any{
+			"id":     "https://example.com/users/alice#updates/1",
+			"type":   "Update",
+			"actor":  alice.URI,
+			"object": map[string]any{"id": alice.URI, "type": "Person", "preferredUsername": "alice", "name": "Alice"},
+		}, alice, key))
+
+		require.NoError(tx.First(alice, alice.ID).Error)
+		require.Equal("Alice", alice.DisplayName)
+	})
+
+	t.Run("an Update signed by one actor claiming to be another is rejected", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		mallory, key := mockSigningActor(t, tx, "https://example.com/users/mallory")
+		bob, _ := mockSigningActor(t, tx, "https://example.org/users/bob")
+		err := process(tx, map[string]any{
+			"id":     "https://example.org/users/bob#updates/1",
+			"type":   "Update",
+			"actor":  bob.URI,
+			"object": map[string]any{"id": bob.URI, "type": "Person", "preferredUsername": "bob", "name": "Mallory"},
+		}, mallory, key)
+		require.ErrorContains(err, "not its actor")
+
+		require.NoError(tx.First(bob, bob.ID).Error)
+		require.Equal("", bob.DisplayName)
+	})
+
+	t.Run("an actor may not update a status by another actor", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		status := mockStatus(t, tx)
+		mallory, key := mockSigningActor(t, tx, "https://example.org/users/mallory")
+		err := process(tx, map[string]any{
+			"id":    "https://example.org/users/mallory#updates/1",
+			"type":  "Update",
+			"actor": mallory.URI,
+			"object": map[string]any{
+				"id":           status.URI,
+				"type":         "Note",
+				"attributedTo": "https://example.com/users/alice",
+				"published":    "2023-01-01T00:00:00Z",
+				"content":      "forged",
+			},
+		}, mallory, key)
+		require.Error(err)
+
+		require.NoError(tx.First(status, status.ID).Error)
+		require.Equal("hello", status.Note)
+	})
+}
+
+func TestProcessCreate(t *testing.T) {
+	db := setupTestDB(t)
+
+	process := func(tx *gorm.DB, act map[string]any, signer *models.Actor, key *rsa.PrivateKey) error {
+		i := &inboxProcessor{
+			logger: slog.New(slog.NewTextHandler(io.Discard)),
+			req:    signedInboxRequest(t, act, signer, key),
+			db:     tx,
+		}
+		return i.processActivity(toObject(t, act))
+	}
+	note := func(id, attributedTo string) map[string]any {
+		return map[string]any{
+			"id":           id,
+			"type":         "Note",
+			"attributedTo": attributedTo,
+			"published":    "2023-01-01T00:00:00Z",
+			"content":      "hello",
+			"to":           "https://www.w3.org/ns/activitystreams#Public",
+		}
+	}
+
+	t.Run("an actor may create its own status", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		alice, key := mockSigningActor(t, tx, "https://example.com/users/alice")
+		require.NoError(process(tx, map[string]any{
+			"id":     "https://example.com/users/alice/statuses/1/activity",
+			"type":   "Create",
+			"actor":  alice.URI,
+			"object": note("https://example.com/users/alice/statuses/1", alice.URI),
+		}, alice, key))
+
+		status, err := models.NewStatuses(tx).FindByURI("https://example.com/users/alice/statuses/1")
+		require.NoError(err)
+		require.Equal(alice.ID, status.ActorID)
+	})
+
+	t.Run("a status attributed to another actor is rejected", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		mallory, key := mockSigningActor(t, tx, "https://example.com/users/mallory")
+		bob, _ := mockSigningActor(t, tx, "https://example.org/users/bob")
+		err := process(tx, map[string]any{
+			"id":     "https://example.com/users/mallory/statuses/1/activity",
+			"type":   "Create",
+			"actor":  mallory.URI,
+			"object": note("https://example.org/users/bob/statuses/1", bob.URI),
+		}, mallory, key)
+		var se *httpx.StatusError
+		require.ErrorAs(err, &se)
+		require.Equal(http.StatusForbidden, se.Status())
+
+		_, err = models.NewStatuses(tx).FindByURI("https://example.org/users/bob/statuses/1")
+		require.ErrorIs(err, gorm.ErrRecordNotFound)
+	})
+}
+
+func TestPemToPublicKey(t *testing.T) {
+	_, err := pemToPublicKey([]byte("not a pem"))
+	require.Error(t, err)
+}
+
+func TestCheckSuspended(t *testing.T) {
+	db := setupTestDB(t)
+
+	t.Run("activities signed by a key on a suspended domain are refused", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		mallory, key := mockSigningActor(t, tx, "https://suspended.example/users/mallory")
+		act := map[string]any{
+			"id":     "https://example.org/users/bob#follows/1",
+			"type":   "Follow",
+			"actor":  "https://example.org/users/bob",
+			"object": "https://example.com/users/alice",
+		}
+		r := signedInboxRequest(t, act, mallory, key)
+		_, err := models.NewDomainBlocks(tx).Create("suspended.example", "suspend", "", "", false)
+		require.NoError(err)
+
+		err = checkSuspended(tx, r, toObject(t, act))
+		var se *httpx.StatusError
+		require.ErrorAs(err, &se)
+		require.Equal(http.StatusForbidden, se.Status())
+
+		act["actor"] = "https://suspended.example/users/mallory"
+		require.Error(checkSuspended(tx, httptest.NewRequest("POST", "https://example.org/inbox", nil), toObject(t, act)))
+	})
 }
@@ -0,0 +1,426 @@
+// Package jsonld implements a lightweight form of JSON-LD compaction for
+// ActivityStreams documents.
+//
+// Remote servers are free to use any @context they like; prefixed terms
+// (as:content), aliases, and scoped contexts are all legal. Compact rewrites
+// a document so that its properties use the terms from the ActivityStreams,
+// security and Mastodon contexts, which is what the vocab package expects.
+//
+// Contexts are never fetched over the network. Only the contexts bundled
+// with this package, and contexts embedded in the document, are understood.
+// Terms which cannot be expanded are passed through untouched.
+package jsonld
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//go:embed contexts/*.jsonld
+var contextFiles embed.FS
+
+// bundled maps the IRIs of well known contexts to the bundled copy of that context.
+var bundled = map[string]string{
+	"https://www.w3.org/ns/activitystreams":        "contexts/activitystreams.jsonld",
+	"http://www.w3.org/ns/activitystreams":         "contexts/activitystreams.jsonld",
+	"https://www.w3.org/ns/activitystreams.jsonld": "contexts/activitystreams.jsonld",
+	"https://w3id.org/security/v1":                 "contexts/security-v1.jsonld",
+	"http://joinmastodon.org/ns":                   "contexts/toot.jsonld",
+}
+
+// Public is the expanded IRI of the Public collection.
+const Public = "https://www.w3.org/ns/activitystreams#Public"
+
+var (
+	// loaded holds the @context value of each bundled context, keyed by IRI.
+	loaded = map[string]any{}
+
+	// target is the context documents are compacted against.
+	target *context
+
+	// reverse maps an expanded IRI and container to the term used in the target context.
+	reverse = map[termKey]string{}
+)
+
+type termKey struct {
+	iri       string
+	container string
+}
+
+func init() {
+	for iri, file := range bundled {
+		b, err := contextFiles.ReadFile(file)
+		if err != nil {
+			panic(err)
+		}
+		var doc map[string]any
+		if err := json.Unmarshal(b, &doc); err != nil {
+			panic(fmt.Sprintf("jsonld: %s: %v", file, err))
+		}
+		loaded[iri] = doc["@context"]
+	}
+	target = newContext().process([]any{
+		"https://www.w3.org/ns/activitystreams",
+		"https://w3id.org/security/v1",
+		"http://joinmastodon.org/ns",
+	})
+	// visit terms in order so that, where two terms share an IRI, the choice is stable.
+	names := make([]string, 0, len(target.terms))
+	for name := range target.terms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t := target.terms[name]
+		key := termKey{iri: t.id, container: t.container}
+		if _, ok := reverse[key]; !ok {
+			reverse[key] = name
+		}
+	}
+}
+
+// setValued are the terms which are left as arrays even when they hold a single value.
+var setValued = map[string]bool{
+	"to":           true,
+	"cc":           true,
+	"bto":          true,
+	"bcc":          true,
+	"audience":     true,
+	"attachment":   true,
+	"attributedTo": true,
+	"tag":          true,
+	"items":        true,
+	"orderedItems": true,
+	"oneOf":        true,
+	"anyOf":        true,
+	"url":          true,
+	"alsoKnownAs":  true,
+	"focalPoint":   true,
+}
+
+// Compact returns a copy of doc with its properties renamed to the terms of the
+// ActivityStreams, security and Mastodon contexts.
+//
+// If doc has no @context, the bundled contexts are assumed. Compact never
+// returns an error; anything it does not understand is copied as is.
+func Compact(doc map[string]any) map[string]any {
+	ctx := target
+	if _, ok := doc["@context"]; ok {
+		ctx = newContext()
+	}
+	return compactNode(ctx, doc)
+}
+
+type term struct {
+	id        string // the expanded IRI, or keyword, of the term.
+	typ       string // the type coercion of the term, usually @id or an xsd datatype.
+	container string // @list, @set, or @language.
+	context   any    // the scoped context of the term, if any.
+}
+
+type context struct {
+	terms map[string]*term
+	vocab string
+}
+
+func newContext() *context {
+	return &context{terms: map[string]*term{}}
+}
+
+func (c *context) clone() *context {
+	terms := make(map[string]*term, len(c.terms))
+	for k, v := range c.terms {
+		terms[k] = v
+	}
+	return &context{terms: terms, vocab: c.vocab}
+}
+
+// process returns a new context which is the result of applying local to c.
+func (c *context) process(local any) *context {
+	switch local := local.(type) {
+	case nil:
+		return newContext()
+	case string:
+		if def, ok := loaded[local]; ok {
+			return c.process(def)
+		}
+		// remote contexts are not fetched.
+		return c
+	case []any:
+		for _, l := range local {
+			c = c.process(l)
+		}
+		return c
+	case map[string]any:
+		c = c.clone()
+		if v, ok := local["@vocab"].(string); ok {
+			c.vocab = c.expand(v, true)
+		}
+		d := &definer{ctx: c, local: local, defining: map[string]bool{}}
+		for name := range local {
+			if !strings.HasPrefix(name, "@") {
+				d.define(name)
+			}
+		}
+		return c
+	default:
+		return c
+	}
+}
+
+// definer defines the terms of a local context, which may refer to one another.
+type definer struct {
+	ctx      *context
+	local    map[string]any
+	defining map[string]bool
+}
+
+func (d *definer) define(name string) {
+	if d.defining[name] {
+		// already defined, or a cycle.
+		return
+	}
+	d.defining[name] = true
+	switch v := d.local[name].(type) {
+	case nil:
+		delete(d.ctx.terms, name)
+	case string:
+		d.ctx.terms[name] = &term{id: d.expand(v)}
+	case map[string]any:
+		t := new(term)
+		if id, ok := v["@id"].(string); ok {
+			t.id = d.expand(id)
+		} else {
+			t.id = d.expand(name)
+		}
+		if typ, ok := v["@type"].(string); ok {
+			t.typ = d.expand(typ)
+		}
+		t.container, _ = v["@container"].(string)
+		t.context = v["@context"]
+		d.ctx.terms[name] = t
+	}
+}
+
+// expand expands s, defining any terms in the local context it depends upon first.
+func (d *definer) expand(s string) string {
+	if strings.HasPrefix(s, "@") {
+		return s
+	}
+	prefix, _, found := strings.Cut(s, ":")
+	if !found {
+		prefix = s
+	}
+	if _, ok := d.local[prefix]; ok {
+		d.define(prefix)
+	}
+	return d.ctx.expand(s, true)
+}
+
+// expand expands s to an IRI. If vocab is true, s may be a term, or relative to
+// the context's @vocab.
+func (c *context) expand(s string, vocab bool) string {
+	if strings.HasPrefix(s, "@") {
+		return s
+	}
+	if vocab {
+		if t, ok := c.terms[s]; ok {
+			return t.id
+		}
+	}
+	if prefix, suffix, ok := strings.Cut(s, ":"); ok {
+		if strings.HasPrefix(suffix, "//") {
+			return s
+		}
+		if t, ok := c.terms[prefix]; ok {
+			return t.id + suffix
+		}
+		return s
+	}
+	if vocab && c.vocab != "" {
+		return c.vocab + s
+	}
+	return s
+}
+
+// termFor returns the definition of the term for iri, so that prefixed and
+// expanded properties are coerced the same way as the term would be.
+func (c *context) termFor(iri string) *term {
+	for _, t := range c.terms {
+		if t.id == iri && t.container == "" {
+			return t
+		}
+	}
+	return &term{id: iri}
+}
+
+// compactIRI returns the term in the target context for iri, or an empty string.
+func compactIRI(iri, container string) string {
+	if name, ok := reverse[termKey{iri: iri, container: container}]; ok {
+		return name
+	}
+	return reverse[termKey{iri: iri}]
+}
+
+func compactNode(ctx *context, node map[string]any) map[string]any {
+	if local, ok := node["@context"]; ok {
+		ctx = ctx.process(local)
+	}
+	out := make(map[string]any, len(node))
+	for name, v := range node {
+		if name == "@context" {
+			continue
+		}
+		iri := ctx.expand(name, true)
+		switch iri {
+		case "@id":
+			if s, ok := v.(string); ok {
+				v = ctx.expand(s, false)
+			}
+			out["id"] = v
+			continue
+		case "@type":
+			out["type"] = compactType(ctx, v)
+			continue
+		}
+
+		t := ctx.terms[name]
+		if t == nil {
+			t = ctx.termFor(iri)
+		}
+		vctx := ctx
+		if t.context != nil {
+			vctx = ctx.process(t.context)
+		}
+
+		var container string
+		if t.container == "@language" {
+			// a language map; its keys are language tags, not terms.
+			container = "@language"
+		} else {
+			v, container = compactValue(vctx, t, v)
+			if container == "" {
+				container = t.container
+			}
+		}
+
+		key := compactIRI(iri, container)
+		if key == "" {
+			key = name
+			if iri != name && !strings.HasPrefix(iri, "_:") {
+				key = iri
+			}
+		}
+		if arr, ok := v.([]any); ok && len(arr) == 1 && !setValued[key] && container != "@list" {
+			v = arr[0]
+		}
+		if _, ok := out[key]; ok && key != name {
+			// the document uses both a prefixed and an unprefixed form;
+			// prefer the unprefixed one.
+			continue
+		}
+		out[key] = v
+	}
+	return out
+}
+
+// compactType compacts the value of a type property. Where an object has several
+// types, the first one the target context knows is used.
+func compactType(ctx *context, v any) any {
+	switch v := v.(type) {
+	case string:
+		if name := compactIRI(ctx.expand(v, true), ""); name != "" {
+			return name
+		}
+		return v
+	case []any:
+		for _, typ := range v {
+			if s, ok := typ.(string); ok {
+				if name := compactIRI(ctx.expand(s, true), ""); name != "" {
+					return name
+				}
+			}
+		}
+		if len(v) > 0 {
+			return v[0]
+		}
+		return nil
+	default:
+		return v
+	}
+}
+
+// compactValue compacts the value of a property defined by t. If the value is a
+// list, or a set of language tagged strings, the container of the value is returned.
+func compactValue(ctx *context, t *term, v any) (any, string) {
+	switch v := v.(type) {
+	case string:
+		if t.typ == "@id" {
+			iri := ctx.expand(v, false)
+			if iri == "Public" {
+				iri = Public
+			}
+			return iri, ""
+		}
+		return v, ""
+	case map[string]any:
+		if lang, ok := v["@language"].(string); ok {
+			return map[string]any{lang: v["@value"]}, "@language"
+		}
+		if val, ok := v["@value"]; ok {
+			return val, ""
+		}
+		if list, ok := v["@list"]; ok {
+			l, _ := compactValue(ctx, t, list)
+			return l, "@list"
+		}
+		if set, ok := v["@set"]; ok {
+			return compactValue(ctx, t, set)
+		}
+		if id, ok := v["@id"].(string); ok && len(v) == 1 {
+			// a bare reference.
+			return ctx.expand(id, false), ""
+		}
+		return compactNode(ctx, v), ""
+	case []any:
+		if langs, ok := languageMap(v); ok {
+			return langs, "@language"
+		}
+		out := make([]any, 0, len(v))
+		var container string
+		for _, e := range v {
+			var c string
+			e, c = compactValue(ctx, t, e)
+			if c == "@list" {
+				container = c
+			}
+			out = append(out, e)
+		}
+		return out, container
+	default:
+		return v, ""
+	}
+}
+
+// languageMap converts an array of language tagged values to a language map.
+func languageMap(v []any) (map[string]any, bool) {
+	if len(v) == 0 {
+		return nil, false
+	}
+	langs := make(map[string]any, len(v))
+	for _, e := range v {
+		m, ok := e.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		lang, ok := m["@language"].(string)
+		if !ok {
+			return nil, false
+		}
+		langs[lang] = m["@value"]
+	}
+	return langs, true
+}
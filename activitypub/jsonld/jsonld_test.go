@@ -0,0 +1,143 @@
+package jsonld
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func compact(t *testing.T, doc string) map[string]any {
+	t.Helper()
+	var m map[string]any
+	require.NoError(t, json.Unmarshal([]byte(doc), &m))
+	return Compact(m)
+}
+
+func TestCompact(t *testing.T) {
+	t.Run("mastodon style document is unchanged", func(t *testing.T) {
+		require := require.New(t)
+		got := compact(t, `{
+			"@context": [
+				"https://www.w3.org/ns/activitystreams",
+				"https://w3id.org/security/v1",
+				{
+					"toot": "http://joinmastodon.org/ns#",
+					"sensitive": "as:sensitive",
+					"blurhash": "toot:blurhash",
+					"focalPoint": {"@container": "@list", "@id": "toot:focalPoint"}
+				}
+			],
+			"id": "https://example.com/users/alice/statuses/1",
+			"type": "Note",
+			"attributedTo": "https://example.com/users/alice",
+			"to": ["https://www.w3.org/ns/activitystreams#Public"],
+			"sensitive": true,
+			"content": "<p>hello</p>",
+			"contentMap": {"en": "<p>hello</p>"},
+			"attachment": [{"type": "Document", "blurhash": "UABC", "focalPoint": [0.5, 0.5]}]
+		}`)
+		require.Equal(map[string]any{
+			"id":           "https://example.com/users/alice/statuses/1",
+			"type":         "Note",
+			"attributedTo": "https://example.com/users/alice",
+			"to":           []any{Public},
+			"sensitive":    true,
+			"content":      "<p>hello</p>",
+			"contentMap":   map[string]any{"en": "<p>hello</p>"},
+			"attachment": []any{
+				map[string]any{"type": "Document", "blurhash": "UABC", "focalPoint": []any{0.5, 0.5}},
+			},
+		}, got)
+	})
+	t.Run("prefixed terms", func(t *testing.T) {
+		require := require.New(t)
+		got := compact(t, `{
+			"@context": "https://www.w3.org/ns/activitystreams",
+			"id": "https://example.com/notes/1",
+			"type": "as:Note",
+			"as:content": "hello",
+			"as:attributedTo": "https://example.com/actor",
+			"as:to": "as:Public"
+		}`)
+		require.Equal("Note", got["type"])
+		require.Equal("hello", got["content"])
+		require.Equal("https://example.com/actor", got["attributedTo"])
+		require.Equal(Public, got["to"])
+	})
+	t.Run("aliased terms", func(t *testing.T) {
+		require := require.New(t)
+		got := compact(t, `{
+			"@context": [
+				"https://www.w3.org/ns/activitystreams",
+				{"body": "as:content", "author": {"@id": "as:attributedTo", "@type": "@id"}, "@id": "@id"}
+			],
+			"@id": "https://example.com/notes/1",
+			"@type": "Note",
+			"body": "hello",
+			"author": "https://example.com/actor"
+		}`)
+		require.Equal("https://example.com/notes/1", got["id"])
+		require.Equal("Note", got["type"])
+		require.Equal("hello", got["content"])
+		require.Equal("https://example.com/actor", got["attributedTo"])
+	})
+	t.Run("scoped contexts", func(t *testing.T) {
+		require := require.New(t)
+		got := compact(t, `{
+			"@context": "https://www.w3.org/ns/activitystreams",
+			"type": "Create",
+			"object": {
+				"@context": {"text": "as:content"},
+				"type": "Note",
+				"text": "hello"
+			}
+		}`)
+		require.Equal("hello", got["object"].(map[string]any)["content"])
+	})
+	t.Run("expanded form", func(t *testing.T) {
+		require := require.New(t)
+		got := compact(t, `{
+			"@context": {},
+			"@id": "https://example.com/notes/1",
+			"@type": ["https://www.w3.org/ns/activitystreams#Note"],
+			"https://www.w3.org/ns/activitystreams#content": [
+				{"@value": "hello", "@language": "en"},
+				{"@value": "bonjour", "@language": "fr"}
+			],
+			"https://www.w3.org/ns/activitystreams#published": [
+				{"@value": "2023-04-01T12:00:00Z", "@type": "http://www.w3.org/2001/XMLSchema#dateTime"}
+			],
+			"https://www.w3.org/ns/activitystreams#attributedTo": [
+				{"@id": "https://example.com/actor"}
+			]
+		}`)
+		require.Equal("Note", got["type"])
+		require.Equal(map[string]any{"en": "hello", "fr": "bonjour"}, got["contentMap"])
+		require.Equal("2023-04-01T12:00:00Z", got["published"])
+		require.Equal([]any{"https://example.com/actor"}, got["attributedTo"])
+	})
+	t.Run("ordered collection", func(t *testing.T) {
+		require := require.New(t)
+		got := compact(t, `{
+			"@context": "https://www.w3.org/ns/activitystreams",
+			"type": "OrderedCollectionPage",
+			"orderedItems": ["https://example.com/1"]
+		}`)
+		require.Equal([]any{"https://example.com/1"}, got["orderedItems"])
+	})
+	t.Run("missing context assumes the bundled contexts", func(t *testing.T) {
+		require := require.New(t)
+		got := compact(t, `{"type": "Note", "as:content": "hello"}`)
+		require.Equal("hello", got["content"])
+	})
+	t.Run("unknown terms are preserved", func(t *testing.T) {
+		require := require.New(t)
+		got := compact(t, `{
+			"@context": ["https://www.w3.org/ns/activitystreams", "https://example.com/remote-context"],
+			"type": "Note",
+			"_misskey_quote": "https://example.com/notes/2"
+		}`)
+		require.Equal("https://example.com/notes/2", got["_misskey_quote"])
+	})
+}
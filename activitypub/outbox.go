@@ -1,28 +1,92 @@
 package activitypub
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 
+	"github.com/bardic/pub/activitypub/activities"
 	"github.com/bardic/pub/internal/algorithms"
+	"github.com/bardic/pub/internal/httpx"
 	"github.com/bardic/pub/internal/to"
 	"github.com/bardic/pub/models"
 	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
 )
 
+// noteContext is the @context of documents which embed Notes.
+var noteContext = []any{
+	"https://www.w3.org/ns/activitystreams",
+	map[string]any{
+		"ostatus":          "http://ostatus.org#",
+		"atomUri":          "ostatus:atomUri",
+		"inReplyToAtomUri": "ostatus:inReplyToAtomUri",
+		"conversation":     "ostatus:conversation",
+		"sensitive":        "as:sensitive",
+		"toot":             "http://joinmastodon.org/ns#",
+		"votersCount":      "toot:votersCount",
+		"blurhash":         "toot:blurhash",
+		"focalPoint": map[string]any{
+			"@container": "@list",
+			"@id":        "toot:focalPoint",
+		},
+		"Hashtag": "as:Hashtag",
+	},
+}
+
 func Outbox(env *Env, w http.ResponseWriter, r *http.Request) error {
+	var actor models.Actor
+	if err := env.DB.Take(&actor, "name = ? and domain = ?", chi.URLParam(r, "name"), r.Host).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.Error(http.StatusNotFound, err)
+		}
+		return err
+	}
+	visible, err := statusVisibility(env, r, &actor)
+	if err != nil {
+		return err
+	}
+	query := env.DB.Model(&models.Status{}).Where("statuses.actor_id = ?", actor.ID).Where(visible)
 	switch parseBool(r, "page") {
 	case true:
-		return outboxShow(env, w, r)
+		return outboxShow(w, r, query)
 	default:
-		return outboxIndex(env, w, r)
+		return outboxIndex(w, r, query)
 	}
 }
 
-func outboxIndex(env *Env, w http.ResponseWriter, r *http.Request) error {
+// statusVisibility returns the conditions which restrict actor's statuses to those
+// the requester may see. Anyone may see public and unlisted statuses. A request
+// signed by a follower of actor may also see followers-only statuses, and a request
+// signed by an actor mentioned in a direct status may see that status.
+func statusVisibility(env *Env, r *http.Request, actor *models.Actor) (*gorm.DB, error) {
+	visible := env.DB.Where("statuses.visibility IN ?", []models.Visibility{"public", "unlisted"})
+	if r.Header.Get("Signature") == "" {
+		return visible, nil
+	}
+	instance, err := findInstance(env.DB, r.Host)
+	if err != nil {
+		return nil, err
+	}
+	requester, err := signer(env.DB, instance.Admin, r)
+	if err != nil {
+		return nil, httpx.Error(http.StatusUnauthorized, err)
+	}
+	var following int64
+	if err := env.DB.Model(&models.Relationship{}).Where("actor_id = ? and target_id = ? and following = true", requester.ID, actor.ID).Count(&following).Error; err != nil {
+		return nil, err
+	}
+	if following > 0 {
+		visible = visible.Or("statuses.visibility = ?", "private")
+	}
+	mentioned := env.DB.Model(&models.StatusMention{}).Select("status_id").Where("actor_id = ?", requester.ID)
+	return visible.Or("statuses.visibility = ? and statuses.id IN (?)", "direct", mentioned), nil
+}
+
+func outboxIndex(w http.ResponseWriter, r *http.Request, query *gorm.DB) error {
 	var count int64
-	query := env.DB.Joins("JOIN actors ON actors.id = statuses.actor_id and actors.name = ? and actors.domain = ?", chi.URLParam(r, "name"), r.Host)
-	if err := query.Model(&models.Status{}).Count(&count).Error; err != nil {
+	if err := query.Count(&count).Error; err != nil {
 		return err
 	}
 	return to.JSON(w, map[string]any{
@@ -35,92 +99,35 @@ func outboxIndex(env *Env, w http.ResponseWriter, r *http.Request) error {
 	})
 }
 
-func outboxShow(env *Env, w http.ResponseWriter, r *http.Request) error {
+func outboxShow(w http.ResponseWriter, r *http.Request, query *gorm.DB) error {
 	resp := map[string]any{
-		"@context": []any{
-			"https://www.w3.org/ns/activitystreams",
-			map[string]any{
-				"ostatus":          "http://ostatus.org#",
-				"atomUri":          "ostatus:atomUri",
-				"inReplyToAtomUri": "ostatus:inReplyToAtomUri",
-				"conversation":     "ostatus:conversation",
-				"sensitive":        "as:sensitive",
-				"toot":             "http://joinmastodon.org/ns#",
-				"votersCount":      "toot:votersCount",
-				"blurhash":         "toot:blurhash",
-				"focalPoint": map[string]any{
-					"@container": "@list",
-					"@id":        "toot:focalPoint",
-				},
-			},
-		},
-		"id":     r.URL.String(),
-		"type":   "OrderedCollectionPage",
-		"partOf": fmt.Sprintf("https://%s%s", r.Host, r.URL.Path),
+		"@context": noteContext,
+		"id":       fmt.Sprintf("https://%s%s", r.Host, r.URL.RequestURI()),
+		"type":     "OrderedCollectionPage",
+		"partOf":   fmt.Sprintf("https://%s%s", r.Host, r.URL.Path),
 	}
 	var statuses []*models.Status
-	query := env.DB.Joins("JOIN actors ON actors.id = statuses.actor_id and actors.name = ? and actors.domain = ?", chi.URLParam(r, "name"), r.Host)
-	query = query.Scopes(models.PaginateStatuses(r), models.PreloadStatus).Preload("Actor")
+	query = query.Scopes(models.PaginateStatuses(r), models.PreloadStatus).Preload("InReplyTo")
 	if err := query.Find(&statuses).Error; err != nil {
 		return err
 	}
+	// when paging forwards with min_id, statuses are returned in ascending order.
+	sort.SliceStable(statuses, func(i, j int) bool {
+		return statuses[i].ID > statuses[j].ID
+	})
 	if len(statuses) > 0 {
-		resp["next"] = fmt.Sprintf("https://%s%s?max_id=%d&page=true", r.Host, r.URL.Path, statuses[0].ID)
-		resp["prev"] = fmt.Sprintf("https://%s%s?min_id=%d&page=true", r.Host, r.URL.Path, statuses[len(statuses)-1].ID)
+		resp["next"] = fmt.Sprintf("https://%s%s?max_id=%d&page=true", r.Host, r.URL.Path, statuses[len(statuses)-1].ID)
+		resp["prev"] = fmt.Sprintf("https://%s%s?min_id=%d&page=true", r.Host, r.URL.Path, statuses[0].ID)
 	}
 	resp["orderedItems"] = algorithms.Map(statuses, statusToItem)
 	return to.JSON(w, resp)
 }
 
-func statusToItem(s *models.Status) *Item {
-	return &Item{
-		ID:        s.URI,
-		Type:      statusType(s),
-		Actor:     s.Actor.URI,
-		Published: s.ID.ToTime().Format("2006-01-02T15:04:05Z"),
-		To:        statusTo(s),
-		CC:        statusCC(s),
-		Object:    statusToObject(s),
-	}
-}
-
-type Item struct {
-	ID        string   `json:"id"`
-	Type      string   `json:"type"`
-	Actor     string   `json:"actor"`
-	Published string   `json:"published"`
-	To        []string `json:"to"`
-	CC        []string `json:"cc"`
-	Object    any      `json:"object"`
-}
-
-func statusType(s *models.Status) string {
-	if s.ReblogID != nil {
-		return "Announce"
-	}
-	return "Create"
-}
-
-func statusTo(s *models.Status) []string {
-	if s.Visibility == "public" {
-		return []string{"https://www.w3.org/ns/activitystreams#Public"}
-	}
-	return []string{s.Actor.URI}
-}
-
-func statusCC(s *models.Status) []string {
-	if s.ReblogID != nil {
-		return []string{
-			s.Reblog.Actor.URI,
-			s.Actor.URI + "/followers",
-		}
-	}
-	return []string{}
-}
-
-func statusToObject(s *models.Status) any {
+// statusToItem returns the activity which created s; an Announce for a reblog,
+// otherwise a Create embedding the Note.
+func statusToItem(s *models.Status) map[string]any {
 	if s.ReblogID != nil {
-		return s.Reblog.URI
+		return activities.Announce(s)
 	}
-	return nil
+	return activities.Create(s)
 }
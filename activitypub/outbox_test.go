@@ -0,0 +1,84 @@
+package activitypub
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bardic/pub/internal/snowflake"
+	"github.com/bardic/pub/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-json-experiment/json"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutbox(t *testing.T) {
+	db := setupTestDB(t)
+
+	t.Run("unsigned requests only see public and unlisted statuses", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		alice := &models.Actor{
+			ID:        snowflake.Now(),
+			URI:       "https://example.com/u/alice",
+			Name:      "alice",
+			Domain:    "example.com",
+			PublicKey: []byte("-----BEGIN PUBLIC KEY-----"),
+		}
+		require.NoError(tx.Create(alice).Error)
+		for _, v := range []models.Visibility{"public", "unlisted", "private", "direct"} {
+			id := snowflake.Now()
+			require.NoError(tx.Create(&models.Status{
+				ID:           id,
+				URI:          fmt.Sprintf("https://example.com/u/alice/%d", id),
+				ActorID:      alice.ID,
+				Visibility:   v,
+				Conversation: &models.Conversation{Visibility: v},
+				Note:         string(v),
+			}).Error)
+		}
+
+		r := withURLParams(httptest.NewRequest("GET", "https://example.com/u/alice/outbox?page=true", nil), "name", "alice")
+		w := httptest.NewRecorder()
+		require.NoError(Outbox(&Env{DB: tx}, w, r))
+
+		var page struct {
+			OrderedItems []struct {
+				Type   string `json:"type"`
+				Object struct {
+					Type    string   `json:"type"`
+					Content string   `json:"content"`
+					To      []string `json:"to"`
+					CC      []string `json:"cc"`
+				} `json:"object"`
+			} `json:"orderedItems"`
+		}
+		require.NoError(json.Unmarshal(w.Body.Bytes(), &page))
+		require.Len(page.OrderedItems, 2)
+
+		public, unlisted := page.OrderedItems[0], page.OrderedItems[1]
+		if public.Object.Content != "public" {
+			public, unlisted = unlisted, public
+		}
+		require.Equal("Create", public.Type)
+		require.Equal("Note", public.Object.Type)
+		require.Equal("public", public.Object.Content)
+		require.Equal([]string{"https://www.w3.org/ns/activitystreams#Public"}, public.Object.To)
+		require.Equal("unlisted", unlisted.Object.Content)
+		require.Equal([]string{"https://example.com/u/alice/followers"}, unlisted.Object.To)
+		require.Contains(unlisted.Object.CC, "https://www.w3.org/ns/activitystreams#Public")
+	})
+}
+
+// withURLParams returns r with the chi URL parameters given as key, value pairs.
+func withURLParams(r *http.Request, kv ...string) *http.Request {
+	rctx := chi.NewRouteContext()
+	for i := 0; i+1 < len(kv); i += 2 {
+		rctx.URLParams.Add(kv[i], kv[i+1])
+	}
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+}
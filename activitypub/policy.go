@@ -0,0 +1,229 @@
+package activitypub
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bardic/pub/activitypub/vocab"
+	"github.com/bardic/pub/models"
+	"github.com/go-json-experiment/json"
+	"gorm.io/gorm"
+)
+
+// A Decision is the outcome of applying a Policy to an activity.
+type Decision string
+
+const (
+	// Accept passes the activity on unchanged.
+	Accept Decision = "accept"
+	// Rewrite passes the activity on after the policy has modified it.
+	Rewrite Decision = "rewrite"
+	// Reject drops the activity.
+	Reject Decision = "reject"
+)
+
+// A Policy moderates incoming activities. Every activity delivered to the inbox
+// passes through each configured Policy, in order, once its signature has been
+// checked. Statuses which are fetched, rather than delivered, pass through them
+// as a Create by their author.
+// A Policy may modify the activity in place, in which case it returns Rewrite.
+type Policy interface {
+	// Name identifies the policy in the log.
+	Name() string
+	Filter(db *gorm.DB, act *vocab.Object) (Decision, error)
+}
+
+// errRejected is returned when a fetched status is rejected by a Policy.
+var errRejected = errors.New("rejected by policy")
+
+// StripMediaPolicy removes the attachments of statuses from Domains.
+type StripMediaPolicy struct {
+	Domains []string
+}
+
+func (p *StripMediaPolicy) Name() string { return "strip_media" }
+
+func (p *StripMediaPolicy) Filter(db *gorm.DB, act *vocab.Object) (Decision, error) {
+	obj := statusObject(act)
+	if obj == nil || len(obj.Attachment) == 0 || !contains(p.Domains, actorDomain(act)) {
+		return Accept, nil
+	}
+	obj.Attachment = nil
+	return Rewrite, nil
+}
+
+// KeywordPolicy marks statuses which contain any of Keywords as sensitive, and
+// adds SpoilerText as their content warning if they do not already have one.
+type KeywordPolicy struct {
+	Keywords    []string
+	SpoilerText string
+}
+
+func (p *KeywordPolicy) Name() string { return "keyword_cw" }
+
+func (p *KeywordPolicy) Filter(db *gorm.DB, act *vocab.Object) (Decision, error) {
+	obj := statusObject(act)
+	if obj == nil {
+		return Accept, nil
+	}
+	text := strings.ToLower(obj.NameString() + " " + obj.SummaryString() + " " + obj.ContentString())
+	for _, keyword := range p.Keywords {
+		if !strings.Contains(text, strings.ToLower(keyword)) {
+			continue
+		}
+		obj.Sensitive = true
+		if obj.SummaryString() == "" {
+			obj.Summary = p.SpoilerText
+		}
+		return Rewrite, nil
+	}
+	return Accept, nil
+}
+
+// NewAccountMentionsPolicy removes the mentions from statuses by actors whose
+// accounts are younger than MinAge. Actors this server has not yet seen are
+// treated as new.
+type NewAccountMentionsPolicy struct {
+	MinAge time.Duration
+}
+
+func (p *NewAccountMentionsPolicy) Name() string { return "new_account_mentions" }
+
+func (p *NewAccountMentionsPolicy) Filter(db *gorm.DB, act *vocab.Object) (Decision, error) {
+	obj := statusObject(act)
+	if obj == nil || countMentions(obj) == 0 {
+		return Accept, nil
+	}
+	var actor models.Actor
+	err := db.Select("id").Take(&actor, "uri = ?", act.Actor.ID).Error
+	switch err {
+	case nil:
+		if time.Since(actor.ID.ToTime()) >= p.MinAge {
+			return Accept, nil
+		}
+	case gorm.ErrRecordNotFound:
+		// an actor we have not seen may be a fresh account; strip the mentions.
+	default:
+		return "", err
+	}
+	tags := obj.Tag[:0]
+	for _, tag := range obj.Tag {
+		if tag.Type != "Mention" {
+			tags = append(tags, tag)
+		}
+	}
+	obj.Tag = tags
+	return Rewrite, nil
+}
+
+// MaxMentionsPolicy rejects statuses which mention more than Max actors.
+type MaxMentionsPolicy struct {
+	Max int
+}
+
+func (p *MaxMentionsPolicy) Name() string { return "max_mentions" }
+
+func (p *MaxMentionsPolicy) Filter(db *gorm.DB, act *vocab.Object) (Decision, error) {
+	obj := statusObject(act)
+	if obj == nil || countMentions(obj) <= p.Max {
+		return Accept, nil
+	}
+	return Reject, nil
+}
+
+// statusObject returns the status created or updated by act, or nil if act
+// does not create or update a status.
+func statusObject(act *vocab.Object) *vocab.Object {
+	switch act.Type {
+	case "Create", "Update":
+		if act.Object == nil || act.Object.IsLink() {
+			return nil
+		}
+		switch act.Object.Type {
+		case "Note", "Question", "Article", "Page", "Video", "Audio", "Image", "Event":
+			return act.Object
+		}
+	}
+	return nil
+}
+
+// actorDomain returns the domain of the actor of act.
+func actorDomain(act *vocab.Object) string {
+	if act.Actor == nil {
+		return ""
+	}
+	u, err := url.Parse(act.Actor.ID)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+func countMentions(obj *vocab.Object) int {
+	n := 0
+	for _, tag := range obj.Tag {
+		if tag.Type == "Mention" {
+			n++
+		}
+	}
+	return n
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// policyConfig is an entry in the policy file.
+type policyConfig struct {
+	Policy      string   `json:"policy"`
+	Domains     []string `json:"domains"`
+	Keywords    []string `json:"keywords"`
+	SpoilerText string   `json:"spoiler_text"`
+	MinAge      string   `json:"min_age"`
+	Max         int      `json:"max"`
+}
+
+// LoadPolicies reads a JSON list of policies from r. Policies are applied in
+// the order they are listed. For example:
+//
+//	[
+//		{"policy": "strip_media", "domains": ["media.example"]},
+//		{"policy": "keyword_cw", "keywords": ["spoiler"], "spoiler_text": "spoilers"},
+//		{"policy": "new_account_mentions", "min_age": "24h"},
+//		{"policy": "max_mentions", "max": 10}
+//	]
+func LoadPolicies(r io.Reader) ([]Policy, error) {
+	var configs []policyConfig
+	if err := json.UnmarshalFull(r, &configs); err != nil {
+		return nil, fmt.Errorf("LoadPolicies: %w", err)
+	}
+	policies := make([]Policy, 0, len(configs))
+	for i, c := range configs {
+		switch c.Policy {
+		case "strip_media":
+			policies = append(policies, &StripMediaPolicy{Domains: c.Domains})
+		case "keyword_cw":
+			policies = append(policies, &KeywordPolicy{Keywords: c.Keywords, SpoilerText: c.SpoilerText})
+		case "new_account_mentions":
+			minAge, err := time.ParseDuration(c.MinAge)
+			if err != nil {
+				return nil, fmt.Errorf("LoadPolicies: policy %d: min_age: %w", i, err)
+			}
+			policies = append(policies, &NewAccountMentionsPolicy{MinAge: minAge})
+		case "max_mentions":
+			policies = append(policies, &MaxMentionsPolicy{Max: c.Max})
+		default:
+			return nil, fmt.Errorf("LoadPolicies: policy %d: unknown policy %q", i, c.Policy)
+		}
+	}
+	return policies, nil
+}
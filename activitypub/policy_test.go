@@ -0,0 +1,218 @@
+package activitypub
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bardic/pub/activitypub/vocab"
+	"github.com/bardic/pub/internal/httpx"
+	"github.com/bardic/pub/internal/snowflake"
+	"github.com/bardic/pub/models"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+)
+
+// mockCreate returns a Create activity by alice@remote.example of a Note
+// mentioning mentions actors, with one attachment.
+func mockCreate(t *testing.T, content string, mentions int) *vocab.Object {
+	t.Helper()
+	var tags []any
+	for i := 0; i < mentions; i++ {
+		tags = append(tags, map[string]any{
+			"type": "Mention",
+			"href": fmt.Sprintf("https://example.com/u/user%d", i),
+		})
+	}
+	tags = append(tags, map[string]any{"type": "Hashtag", "name": "#pub"})
+	return toObject(t, map[string]any{
+		"id":    "https://remote.example/users/alice/statuses/1/activity",
+		"type":  "Create",
+		"actor": "https://remote.example/users/alice",
+		"object": map[string]any{
+			"id":           "https://remote.example/users/alice/statuses/1",
+			"type":         "Note",
+			"attributedTo": "https://remote.example/users/alice",
+			"published":    "2023-05-01T00:00:00Z",
+			"content":      content,
+			"tag":          tags,
+			"attachment": []any{
+				map[string]any{"type": "Document", "mediaType": "image/png", "url": "https://remote.example/media/1.png"},
+			},
+		},
+	})
+}
+
+func TestPolicies(t *testing.T) {
+	db := setupTestDB(t)
+
+	t.Run("strip_media removes attachments from listed domains", func(t *testing.T) {
+		require := require.New(t)
+		p := &StripMediaPolicy{Domains: []string{"remote.example"}}
+
+		act := mockCreate(t, "hello", 0)
+		decision, err := p.Filter(db, act)
+		require.NoError(err)
+		require.Equal(Rewrite, decision)
+		require.Empty(act.Object.Attachment)
+
+		p.Domains = []string{"other.example"}
+		act = mockCreate(t, "hello", 0)
+		decision, err = p.Filter(db, act)
+		require.NoError(err)
+		require.Equal(Accept, decision)
+		require.Len(act.Object.Attachment, 1)
+	})
+
+	t.Run("keyword_cw adds a content warning", func(t *testing.T) {
+		require := require.New(t)
+		p := &KeywordPolicy{Keywords: []string{"spoiler"}, SpoilerText: "spoilers"}
+
+		act := mockCreate(t, "<p>Big SPOILER ahead</p>", 0)
+		decision, err := p.Filter(db, act)
+		require.NoError(err)
+		require.Equal(Rewrite, decision)
+		require.True(act.Object.Sensitive)
+		require.Equal("spoilers", act.Object.SummaryString())
+
+		act = mockCreate(t, "<p>nothing to see</p>", 0)
+		decision, err = p.Filter(db, act)
+		require.NoError(err)
+		require.Equal(Accept, decision)
+		require.False(act.Object.Sensitive)
+	})
+
+	t.Run("new_account_mentions drops mentions by new actors", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		p := &NewAccountMentionsPolicy{MinAge: 24 * time.Hour}
+
+		// alice is not known, so is treated as new.
+		act := mockCreate(t, "hello", 2)
+		decision, err := p.Filter(tx, act)
+		require.NoError(err)
+		require.Equal(Rewrite, decision)
+		require.Len(act.Object.Tag, 1)
+
+		act = mockCreate(t, "hello", 2)
+
+		alice := &models.Actor{
+			ID:        snowflake.Now(),
+			URI:       "https://remote.example/users/alice",
+			Name:      "alice",
+			Domain:    "remote.example",
+			PublicKey: []byte{},
+		}
+		require.NoError(tx.Create(alice).Error)
+		decision, err = p.Filter(tx, act)
+		require.NoError(err)
+		require.Equal(Rewrite, decision)
+		require.Len(act.Object.Tag, 1)
+		require.Equal("Hashtag", act.Object.Tag[0].Type)
+
+		// alice's account is a week old.
+		require.NoError(tx.Model(alice).UpdateColumn("id", snowflake.TimeToID(time.Now().AddDate(0, 0, -7))).Error)
+		act = mockCreate(t, "hello", 2)
+		decision, err = p.Filter(tx, act)
+		require.NoError(err)
+		require.Equal(Accept, decision)
+	})
+
+	t.Run("max_mentions rejects statuses with too many mentions", func(t *testing.T) {
+		require := require.New(t)
+		p := &MaxMentionsPolicy{Max: 2}
+
+		decision, err := p.Filter(db, mockCreate(t, "hello", 2))
+		require.NoError(err)
+		require.Equal(Accept, decision)
+		decision, err = p.Filter(db, mockCreate(t, "hello", 3))
+		require.NoError(err)
+		require.Equal(Reject, decision)
+	})
+
+	t.Run("every decision is logged and a rejection stops the pipeline", func(t *testing.T) {
+		require := require.New(t)
+		var buf bytes.Buffer
+		i := &inboxProcessor{
+			logger: slog.New(slog.NewTextHandler(&buf)),
+			db:     db,
+			policies: []Policy{
+				&StripMediaPolicy{Domains: []string{"remote.example"}},
+				&MaxMentionsPolicy{Max: 0},
+				&KeywordPolicy{Keywords: []string{"hello"}},
+			},
+		}
+		accepted, err := i.applyPolicies(mockCreate(t, "hello", 1))
+		require.NoError(err)
+		require.False(accepted)
+		require.Contains(buf.String(), "policy=strip_media decision=rewrite")
+		require.Contains(buf.String(), "policy=max_mentions decision=reject")
+		require.NotContains(buf.String(), "keyword_cw")
+	})
+}
+
+func TestInboxPolicies(t *testing.T) {
+	db := setupTestDB(t)
+
+	t.Run("policies are applied once the signature is checked", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		alice, key := mockSigningActor(t, tx, "https://remote.example/users/alice")
+		act := map[string]any{
+			"id":     "https://remote.example/users/alice/statuses/1/activity",
+			"type":   "Create",
+			"actor":  alice.URI,
+			"object": map[string]any{"id": "https://remote.example/users/alice/statuses/1", "type": "Note"},
+		}
+		i := &inboxProcessor{
+			logger:   slog.New(slog.NewTextHandler(io.Discard)),
+			req:      httptest.NewRequest("POST", "https://example.org/inbox", nil),
+			db:       tx,
+			policies: []Policy{&MaxMentionsPolicy{Max: 0}},
+		}
+		// an unsigned activity is refused, even though a policy would drop it.
+		err := i.processActivity(mockCreate(t, "hello", 1))
+		var se *httpx.StatusError
+		require.ErrorAs(err, &se)
+		require.Equal(http.StatusUnauthorized, se.Status())
+
+		i.req = signedInboxRequest(t, act, alice, key)
+		require.NoError(i.processActivity(mockCreate(t, "hello", 1)))
+		_, err = models.NewStatuses(tx).FindByURI("https://remote.example/users/alice/statuses/1")
+		require.ErrorIs(err, gorm.ErrRecordNotFound)
+	})
+}
+
+func TestLoadPolicies(t *testing.T) {
+	t.Run("policies are loaded in order", func(t *testing.T) {
+		require := require.New(t)
+		policies, err := LoadPolicies(strings.NewReader(`[
+			{"policy": "strip_media", "domains": ["media.example"]},
+			{"policy": "keyword_cw", "keywords": ["spoiler"], "spoiler_text": "spoilers"},
+			{"policy": "new_account_mentions", "min_age": "24h"},
+			{"policy": "max_mentions", "max": 10}
+		]`))
+		require.NoError(err)
+		require.Equal([]Policy{
+			&StripMediaPolicy{Domains: []string{"media.example"}},
+			&KeywordPolicy{Keywords: []string{"spoiler"}, SpoilerText: "spoilers"},
+			&NewAccountMentionsPolicy{MinAge: 24 * time.Hour},
+			&MaxMentionsPolicy{Max: 10},
+		}, policies)
+	})
+
+	t.Run("unknown policies are an error", func(t *testing.T) {
+		_, err := LoadPolicies(strings.NewReader(`[{"policy": "nope"}]`))
+		require.Error(t, err)
+	})
+}
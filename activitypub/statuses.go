@@ -0,0 +1,149 @@
+package activitypub
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bardic/pub/activitypub/activities"
+	"github.com/bardic/pub/internal/algorithms"
+	"github.com/bardic/pub/internal/httpx"
+	"github.com/bardic/pub/internal/snowflake"
+	"github.com/bardic/pub/internal/to"
+	"github.com/bardic/pub/models"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// StatusesShow serves a local status as a Note at its URI. Browsers are redirected
+// to the status' HTML page.
+func StatusesShow(env *Env, w http.ResponseWriter, r *http.Request) error {
+	if wantsHTML(r) {
+		return httpx.Redirect(w, fmt.Sprintf("https://%s/@%s/%s", r.Host, chi.URLParam(r, "name"), chi.URLParam(r, "id")))
+	}
+	status, err := findStatus(env, r, func(query *gorm.DB) *gorm.DB {
+		return query.Scopes(models.PreloadStatus).Preload("InReplyTo")
+	})
+	if err != nil {
+		return err
+	}
+	note := activities.Note(status)
+	note["@context"] = noteContext
+	note["replies"] = status.URI + "/replies"
+	note["likes"] = status.URI + "/likes"
+	note["shares"] = status.URI + "/shares"
+	return to.JSON(w, note)
+}
+
+// StatusesRepliesShow serves the collection of public and unlisted replies to a local status.
+// Pages are keyed by the reply's ID, in descending order.
+func StatusesRepliesShow(env *Env, w http.ResponseWriter, r *http.Request) error {
+	status, err := findStatus(env, r, nil)
+	if err != nil {
+		return err
+	}
+	id := status.URI + "/replies"
+	query := env.DB.Model(&models.Status{}).Where("in_reply_to_id = ? and visibility IN ?", status.ID, []models.Visibility{"public", "unlisted"})
+	if !parseBool(r, "page") {
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			return err
+		}
+		return to.JSON(w, map[string]any{
+			"@context":   "https://www.w3.org/ns/activitystreams",
+			"id":         id,
+			"type":       "OrderedCollection",
+			"totalItems": count,
+			"first":      id + "?page=true",
+		})
+	}
+	if maxID, err := snowflake.Parse(r.URL.Query().Get("max_id")); err == nil {
+		query = query.Where("id < ?", maxID)
+	}
+	var replies []*models.Status
+	if err := query.Order("id desc").Limit(collectionPageSize).Find(&replies).Error; err != nil {
+		return err
+	}
+	resp := map[string]any{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id":       fmt.Sprintf("https://%s%s", r.Host, r.URL.RequestURI()),
+		"type":     "OrderedCollectionPage",
+		"partOf":   id,
+		"orderedItems": algorithms.Map(replies, func(s *models.Status) string {
+			return s.URI
+		}),
+	}
+	if len(replies) == collectionPageSize {
+		resp["next"] = fmt.Sprintf("%s?page=true&max_id=%d", id, replies[len(replies)-1].ID)
+	}
+	return to.JSON(w, resp)
+}
+
+// StatusesLikesShow serves the collection of likes of a local status. Only the count is published.
+func StatusesLikesShow(env *Env, w http.ResponseWriter, r *http.Request) error {
+	status, err := findStatus(env, r, nil)
+	if err != nil {
+		return err
+	}
+	return to.JSON(w, map[string]any{
+		"@context":   "https://www.w3.org/ns/activitystreams",
+		"id":         status.URI + "/likes",
+		"type":       "Collection",
+		"totalItems": status.FavouritesCount,
+	})
+}
+
+// StatusesSharesShow serves the collection of shares of a local status. Only the count is published.
+func StatusesSharesShow(env *Env, w http.ResponseWriter, r *http.Request) error {
+	status, err := findStatus(env, r, nil)
+	if err != nil {
+		return err
+	}
+	return to.JSON(w, map[string]any{
+		"@context":   "https://www.w3.org/ns/activitystreams",
+		"id":         status.URI + "/shares",
+		"type":       "Collection",
+		"totalItems": status.ReblogsCount,
+	})
+}
+
+// findStatus returns the status named by the request, if the requester may see it.
+// Statuses which are not visible to the requester are reported as not found.
+func findStatus(env *Env, r *http.Request, scope func(*gorm.DB) *gorm.DB) (*models.Status, error) {
+	var actor models.Actor
+	if err := env.DB.Take(&actor, "name = ? and domain = ?", chi.URLParam(r, "name"), r.Host).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, httpx.Error(http.StatusNotFound, err)
+		}
+		return nil, err
+	}
+	id, err := snowflake.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		return nil, httpx.Error(http.StatusNotFound, err)
+	}
+	visible, err := statusVisibility(env, r, &actor)
+	if err != nil {
+		return nil, err
+	}
+	query := env.DB.Where("statuses.actor_id = ? and statuses.reblog_id IS NULL", actor.ID).Where(visible)
+	if scope != nil {
+		query = query.Scopes(scope)
+	}
+	var status models.Status
+	if err := query.Take(&status, "statuses.id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, httpx.Error(http.StatusNotFound, err)
+		}
+		return nil, err
+	}
+	return &status, nil
+}
+
+// wantsHTML reports whether the request prefers an HTML document to an ActivityStreams one.
+func wantsHTML(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "text/html") &&
+		!strings.Contains(accept, "application/activity+json") &&
+		!strings.Contains(accept, "application/ld+json")
+}
@@ -0,0 +1,98 @@
+package activitypub
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bardic/pub/internal/httpx"
+	"github.com/bardic/pub/internal/snowflake"
+	"github.com/bardic/pub/models"
+	"github.com/go-json-experiment/json"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestStatusesShow(t *testing.T) {
+	db := setupTestDB(t)
+
+	// mockLocalStatus creates a status by alice with visibility v.
+	mockLocalStatus := func(t *testing.T, tx *gorm.DB, v models.Visibility) *models.Status {
+		t.Helper()
+		require := require.New(t)
+		var alice models.Actor
+		err := tx.Take(&alice, "name = ? and domain = ?", "alice", "example.com").Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			alice = models.Actor{
+				ID:        snowflake.Now(),
+				URI:       "https://example.com/u/alice",
+				Name:      "alice",
+				Domain:    "example.com",
+				PublicKey: []byte("-----BEGIN PUBLIC KEY-----"),
+			}
+			err = tx.Create(&alice).Error
+		}
+		require.NoError(err)
+		id := snowflake.Now()
+		status := &models.Status{
+			ID:           id,
+			URI:          fmt.Sprintf("https://example.com/users/alice/%d", id),
+			ActorID:      alice.ID,
+			Visibility:   v,
+			Conversation: &models.Conversation{Visibility: v},
+			Note:         "hello",
+		}
+		require.NoError(tx.Create(status).Error)
+		return status
+	}
+
+	show := func(tx *gorm.DB, status *models.Status, accept string) (*httptest.ResponseRecorder, error) {
+		r := httptest.NewRequest("GET", status.URI, nil)
+		r.Header.Set("Accept", accept)
+		r = withURLParams(r, "name", "alice", "id", fmt.Sprint(status.ID))
+		w := httptest.NewRecorder()
+		return w, StatusesShow(&Env{DB: tx}, w, r)
+	}
+
+	t.Run("public status is served as a Note", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		status := mockLocalStatus(t, tx, "public")
+		w, err := show(tx, status, "application/activity+json")
+		require.NoError(err)
+
+		var note map[string]any
+		require.NoError(json.Unmarshal(w.Body.Bytes(), &note))
+		require.Equal(status.URI, note["id"])
+		require.Equal("Note", note["type"])
+		require.Equal(status.URI+"/replies", note["replies"])
+	})
+
+	t.Run("followers only status is not found for unsigned requests", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		status := mockLocalStatus(t, tx, "private")
+		_, err := show(tx, status, "application/activity+json")
+		var herr *httpx.StatusError
+		require.ErrorAs(err, &herr)
+		require.Equal(http.StatusNotFound, herr.Status())
+	})
+
+	t.Run("browsers are redirected to the HTML page", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		status := mockLocalStatus(t, tx, "public")
+		w, err := show(tx, status, "text/html,application/xhtml+xml")
+		require.NoError(err)
+		require.Equal(http.StatusFound, w.Code)
+		require.Equal(fmt.Sprintf("https://example.com/@alice/%d", status.ID), w.Header().Get("Location"))
+	})
+}
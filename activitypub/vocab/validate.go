@@ -0,0 +1,111 @@
+package vocab
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// ErrInvalid is wrapped by every error returned from Validate.
+var ErrInvalid = errors.New("invalid activitystreams object")
+
+// activityTypes are the Activity types which must have an actor and object.
+var activityTypes = map[string]bool{
+	"Accept":   true,
+	"Add":      true,
+	"Announce": true,
+	"Block":    true,
+	"Create":   true,
+	"Delete":   true,
+	"Follow":   true,
+	"Like":     true,
+	"Reject":   true,
+	"Remove":   true,
+	"Undo":     true,
+	"Update":   true,
+}
+
+// Validate reports whether the Object has the properties required to process it.
+// If the Object is an Activity, its embedded object is validated as well.
+// The returned error, if any, joins one error per problem found; each wraps ErrInvalid.
+func (o *Object) Validate() error {
+	v := new(validator)
+	v.object("", o)
+	return errors.Join(v.errs...)
+}
+
+type validator struct {
+	errs []error
+}
+
+func (v *validator) errorf(path, format string, args ...any) {
+	v.errs = append(v.errs, fmt.Errorf("%w: %s: %s", ErrInvalid, path, fmt.Sprintf(format, args...)))
+}
+
+func (v *validator) object(path string, o *Object) {
+	v.iri(join(path, "id"), o.ID)
+	if o.Type == "" {
+		v.errorf(join(path, "type"), "is required")
+	}
+	if activityTypes[o.Type] {
+		v.activity(path, o)
+		return
+	}
+	switch o.Type {
+	case "Note", "Question", "Article", "Page", "Video", "Audio", "Image", "Event":
+		if o.AttributedToID() == "" {
+			v.errorf(join(path, "attributedTo"), "is required")
+		}
+		if o.Published.IsZero() {
+			v.errorf(join(path, "published"), "is required")
+		}
+		for i := range o.Tag {
+			if o.Tag[i].Type == "Mention" {
+				v.iri(fmt.Sprintf("%s[%d].href", join(path, "tag"), i), o.Tag[i].Href)
+			}
+		}
+	}
+}
+
+func (v *validator) activity(path string, o *Object) {
+	if o.Actor == nil || o.Actor.ID == "" {
+		v.errorf(join(path, "actor"), "is required")
+	}
+	if o.Object == nil || (o.Object.ID == "" && o.Object.Type == "") {
+		v.errorf(join(path, "object"), "is required")
+		return
+	}
+	switch o.Type {
+	case "Add", "Remove":
+		if o.Target == nil || o.Target.ID == "" {
+			v.errorf(join(path, "target"), "is required")
+		}
+	}
+	if o.Object.IsLink() {
+		v.iri(join(path, "object"), o.Object.ID)
+		return
+	}
+	switch o.Type {
+	case "Create", "Update", "Undo", "Accept", "Reject":
+		// these activities must embed the object they act upon.
+		v.object(join(path, "object"), o.Object)
+	}
+}
+
+func (v *validator) iri(path, s string) {
+	if s == "" {
+		v.errorf(path, "is required")
+		return
+	}
+	u, err := url.Parse(s)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		v.errorf(path, "%q is not an absolute IRI", s)
+	}
+}
+
+func join(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
@@ -0,0 +1,360 @@
+// Package vocab contains a typed model of the ActivityStreams 2.0 vocabulary
+// as it is used by ActivityPub servers.
+//
+// The types in this package are deliberately lenient when unmarshalling;
+// ActivityStreams permits most properties to be expressed as a bare IRI,
+// an embedded object, or an array of either, and different servers choose
+// different forms. Use Validate to check that a decoded document has the
+// properties required to process it.
+package vocab
+
+import (
+	"bytes"
+	"sort"
+	"time"
+
+	"github.com/go-json-experiment/json"
+)
+
+// Public is the special collection which addresses an object to everyone.
+// https://www.w3.org/TR/activitypub/#public-addressing
+const Public = "https://www.w3.org/ns/activitystreams#Public"
+
+// Object is an ActivityStreams Object, Link, Activity, Actor or Collection.
+// https://www.w3.org/TR/activitystreams-vocabulary/#dfn-object
+//
+// An Object may be unmarshalled from a bare IRI, in which case only ID is set.
+type Object struct {
+	// ID is the Object's unique global identifier.
+	ID string `json:"id,omitempty"`
+	// Type is the type of the Object.
+	Type string `json:"type,omitempty"`
+
+	Name         string            `json:"name,omitempty"`
+	NameMap      map[string]string `json:"nameMap,omitempty"`
+	Summary      string            `json:"summary,omitempty"`
+	SummaryMap   map[string]string `json:"summaryMap,omitempty"`
+	Content      string            `json:"content,omitempty"`
+	ContentMap   map[string]string `json:"contentMap,omitempty"`
+	MediaType    string            `json:"mediaType,omitempty"`
+	URL          Links             `json:"url,omitempty"`
+	AttributedTo Objects           `json:"attributedTo,omitempty"`
+	InReplyTo    *Object           `json:"inReplyTo,omitempty"`
+	To           Objects           `json:"to,omitempty"`
+	CC           Objects           `json:"cc,omitempty"`
+	Published    Time              `json:"published,omitzero"`
+	Updated      Time              `json:"updated,omitzero"`
+	Sensitive    bool              `json:"sensitive,omitempty"`
+	Attachment   Objects           `json:"attachment,omitempty"`
+	Tag          Objects           `json:"tag,omitempty"`
+	Icon         *Object           `json:"icon,omitempty"`
+	Image        *Object           `json:"image,omitempty"`
+	Replies      *Object           `json:"replies,omitempty"`
+
+	// Link properties, used by Mention and Hashtag tags.
+	Href string `json:"href,omitempty"`
+
+	// Document properties.
+	Width      int       `json:"width,omitempty"`
+	Height     int       `json:"height,omitempty"`
+	Blurhash   string    `json:"blurhash,omitempty"`
+	FocalPoint []float64 `json:"focalPoint,omitempty"`
+
+	// PropertyValue properties.
+	Value string `json:"value,omitempty"`
+
+	// Question properties.
+	OneOf       Objects `json:"oneOf,omitempty"`
+	AnyOf       Objects `json:"anyOf,omitempty"`
+	EndTime     Time    `json:"endTime,omitzero"`
+	Closed      Time    `json:"closed,omitzero"`
+	VotersCount int     `json:"votersCount,omitempty"`
+
+	// Activity properties.
+	Actor  *Object `json:"actor,omitempty"`
+	Object *Object `json:"object,omitempty"`
+	Target *Object `json:"target,omitempty"`
+
+	// Actor properties.
+	PreferredUsername         string     `json:"preferredUsername,omitempty"`
+	Inbox                     string     `json:"inbox,omitempty"`
+	Outbox                    string     `json:"outbox,omitempty"`
+	Followers                 string     `json:"followers,omitempty"`
+	Following                 string     `json:"following,omitempty"`
+	Featured                  string     `json:"featured,omitempty"`
+	FeaturedTags              string     `json:"featuredTags,omitempty"`
+	Endpoints                 *Endpoints `json:"endpoints,omitempty"`
+	ManuallyApprovesFollowers bool       `json:"manuallyApprovesFollowers,omitempty"`
+	PublicKey                 *PublicKey `json:"publicKey,omitempty"`
+
+	// Collection properties.
+	TotalItems   int     `json:"totalItems,omitempty"`
+	First        *Object `json:"first,omitempty"`
+	Next         *Object `json:"next,omitempty"`
+	PartOf       *Object `json:"partOf,omitempty"`
+	Items        Objects `json:"items,omitempty"`
+	OrderedItems Objects `json:"orderedItems,omitempty"`
+}
+
+// object has the same fields as Object, but not its UnmarshalJSON method.
+type object Object
+
+// UnmarshalJSON decodes an Object from an IRI, a JSON object, or an array,
+// in which case the first element is used.
+func (o *Object) UnmarshalJSON(b []byte) error {
+	switch kind(b) {
+	case '"':
+		*o = Object{}
+		return json.Unmarshal(b, &o.ID)
+	case '[':
+		var objs []Object
+		if err := json.Unmarshal(b, &objs); err != nil {
+			return err
+		}
+		*o = Object{}
+		if len(objs) > 0 {
+			*o = objs[0]
+		}
+		return nil
+	case 'n':
+		return nil
+	default:
+		return json.Unmarshal(b, (*object)(o))
+	}
+}
+
+// IsLink reports whether the Object is a bare reference to another object;
+// that is, it has an ID but no Type.
+func (o *Object) IsLink() bool {
+	return o.ID != "" && o.Type == ""
+}
+
+// ContentString returns the content of the Object, falling back to an entry
+// from contentMap if content is not present.
+func (o *Object) ContentString() string {
+	return natural(o.Content, o.ContentMap)
+}
+
+// ContentLanguage returns the language tag of the Object's content; the key of
+// the contentMap entry ContentString would return. If contentMap is not present,
+// or content does not match any of its entries, ContentLanguage returns an empty string.
+func (o *Object) ContentLanguage() string {
+	content := o.ContentString()
+	keys := make([]string, 0, len(o.ContentMap))
+	for k := range o.ContentMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if o.ContentMap[k] == content {
+			return k
+		}
+	}
+	return ""
+}
+
+// SummaryString returns the summary of the Object, falling back to an entry
+// from summaryMap if summary is not present.
+func (o *Object) SummaryString() string {
+	return natural(o.Summary, o.SummaryMap)
+}
+
+// NameString returns the name of the Object, falling back to an entry
+// from nameMap if name is not present.
+func (o *Object) NameString() string {
+	return natural(o.Name, o.NameMap)
+}
+
+// AttributedToID returns the IRI of the actor the Object is attributed to.
+// Some servers attribute objects to both a Person and the Group it was posted
+// to; in that case the Person is preferred.
+func (o *Object) AttributedToID() string {
+	for _, a := range o.AttributedTo {
+		if a.Type == "Person" {
+			return a.ID
+		}
+	}
+	if len(o.AttributedTo) > 0 {
+		return o.AttributedTo[0].ID
+	}
+	return ""
+}
+
+// natural returns s if it is not empty, otherwise the value in m whose key sorts first.
+func natural(s string, m map[string]string) string {
+	if s != "" || len(m) == 0 {
+		return s
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return m[keys[0]]
+}
+
+// Objects is a list of Objects. Objects may be unmarshalled from a single
+// IRI or object, or an array of IRIs and objects.
+type Objects []Object
+
+func (o *Objects) UnmarshalJSON(b []byte) error {
+	switch kind(b) {
+	case '[':
+		var objs []Object
+		if err := json.Unmarshal(b, &objs); err != nil {
+			return err
+		}
+		*o = objs
+		return nil
+	case 'n':
+		*o = nil
+		return nil
+	default:
+		var obj Object
+		if err := json.Unmarshal(b, &obj); err != nil {
+			return err
+		}
+		*o = Objects{obj}
+		return nil
+	}
+}
+
+// IDs returns the IDs of the Objects.
+func (o Objects) IDs() []string {
+	ids := make([]string, 0, len(o))
+	for _, obj := range o {
+		if obj.ID != "" {
+			ids = append(ids, obj.ID)
+		}
+	}
+	return ids
+}
+
+// Contains reports whether an Object with the given ID is present.
+func (o Objects) Contains(id string) bool {
+	for _, obj := range o {
+		if obj.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Link is an ActivityStreams Link.
+// https://www.w3.org/TR/activitystreams-vocabulary/#dfn-link
+type Link struct {
+	Type      string `json:"type,omitempty"`
+	Href      string `json:"href,omitempty"`
+	MediaType string `json:"mediaType,omitempty"`
+	Name      string `json:"name,omitempty"`
+}
+
+// Links is a list of Links. Links may be unmarshalled from a single IRI
+// or Link, or an array of IRIs and Links.
+type Links []Link
+
+func (l *Links) UnmarshalJSON(b []byte) error {
+	switch kind(b) {
+	case '[':
+		var links []Link
+		if err := json.Unmarshal(b, &links); err != nil {
+			return err
+		}
+		*l = links
+		return nil
+	case 'n':
+		*l = nil
+		return nil
+	default:
+		var link Link
+		if err := json.Unmarshal(b, &link); err != nil {
+			return err
+		}
+		*l = Links{link}
+		return nil
+	}
+}
+
+func (l *Link) UnmarshalJSON(b []byte) error {
+	type link Link
+	switch kind(b) {
+	case '"':
+		*l = Link{}
+		return json.Unmarshal(b, &l.Href)
+	case 'n':
+		return nil
+	default:
+		return json.Unmarshal(b, (*link)(l))
+	}
+}
+
+// Href returns the href of the first Link, or an empty string if there are no Links.
+func (l Links) Href() string {
+	if len(l) > 0 {
+		return l[0].Href
+	}
+	return ""
+}
+
+// HTML returns the href of the first text/html Link, falling back to the
+// first Link if none are marked as text/html.
+func (l Links) HTML() string {
+	for _, link := range l {
+		if link.MediaType == "text/html" {
+			return link.Href
+		}
+	}
+	return l.Href()
+}
+
+// Endpoints are the endpoints advertised by an Actor.
+type Endpoints struct {
+	SharedInbox string `json:"sharedInbox,omitempty"`
+}
+
+// PublicKey is an Actor's public key, from the security vocabulary.
+type PublicKey struct {
+	ID           string `json:"id,omitempty"`
+	Owner        string `json:"owner,omitempty"`
+	PublicKeyPem string `json:"publicKeyPem,omitempty"`
+}
+
+// Time is a time.Time which unmarshals from the xsd:dateTime forms in use
+// in the wild. Values which cannot be parsed unmarshal as the zero Time.
+type Time struct {
+	time.Time
+}
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999", // no zone, assume UTC
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02",
+}
+
+func (t *Time) UnmarshalJSON(b []byte) error {
+	*t = Time{}
+	if kind(b) != '"' {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	for _, layout := range timeLayouts {
+		if parsed, err := time.Parse(layout, s); err == nil {
+			t.Time = parsed
+			return nil
+		}
+	}
+	return nil
+}
+
+// kind returns the first non whitespace byte of b.
+func kind(b []byte) byte {
+	b = bytes.TrimLeft(b, " \t\r\n")
+	if len(b) == 0 {
+		return 0
+	}
+	return b[0]
+}
@@ -0,0 +1,144 @@
+package vocab
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-json-experiment/json"
+	"github.com/stretchr/testify/require"
+)
+
+func unmarshal(t *testing.T, doc string) *Object {
+	t.Helper()
+	var obj Object
+	require.NoError(t, json.Unmarshal([]byte(doc), &obj))
+	return &obj
+}
+
+func TestObjectUnmarshal(t *testing.T) {
+	t.Run("to as a single string", func(t *testing.T) {
+		require := require.New(t)
+		obj := unmarshal(t, `{"to": "https://www.w3.org/ns/activitystreams#Public"}`)
+		require.Equal([]string{Public}, obj.To.IDs())
+	})
+	t.Run("to as an array of strings and objects", func(t *testing.T) {
+		require := require.New(t)
+		obj := unmarshal(t, `{"to": ["https://example.com/a", {"id": "https://example.com/b", "type": "Person"}]}`)
+		require.Equal([]string{"https://example.com/a", "https://example.com/b"}, obj.To.IDs())
+		require.True(obj.To.Contains("https://example.com/b"))
+	})
+	t.Run("attributedTo as an object", func(t *testing.T) {
+		require := require.New(t)
+		obj := unmarshal(t, `{"attributedTo": {"id": "https://example.com/users/alice", "type": "Person"}}`)
+		require.Equal("https://example.com/users/alice", obj.AttributedToID())
+	})
+	t.Run("attributedTo prefers the Person over the Group", func(t *testing.T) {
+		require := require.New(t)
+		obj := unmarshal(t, `{"attributedTo": [
+			{"id": "https://example.com/c/group", "type": "Group"},
+			{"id": "https://example.com/a/alice", "type": "Person"}
+		]}`)
+		require.Equal("https://example.com/a/alice", obj.AttributedToID())
+	})
+	t.Run("url as a string", func(t *testing.T) {
+		require := require.New(t)
+		obj := unmarshal(t, `{"url": "https://example.com/@alice/1"}`)
+		require.Equal("https://example.com/@alice/1", obj.URL.Href())
+	})
+	t.Run("url as a Link", func(t *testing.T) {
+		require := require.New(t)
+		obj := unmarshal(t, `{"url": {"type": "Link", "href": "https://example.com/@alice/1", "mediaType": "text/html"}}`)
+		require.Equal("https://example.com/@alice/1", obj.URL.Href())
+	})
+	t.Run("url as an array prefers text/html", func(t *testing.T) {
+		require := require.New(t)
+		obj := unmarshal(t, `{"url": [
+			{"type": "Link", "href": "https://example.com/video.mp4", "mediaType": "video/mp4"},
+			{"type": "Link", "href": "https://example.com/w/1", "mediaType": "text/html"}
+		]}`)
+		require.Equal("https://example.com/video.mp4", obj.URL.Href())
+		require.Equal("https://example.com/w/1", obj.URL.HTML())
+	})
+	t.Run("contentMap is used when content is missing", func(t *testing.T) {
+		require := require.New(t)
+		obj := unmarshal(t, `{"contentMap": {"fr": "bonjour", "de": "hallo"}}`)
+		require.Equal("hallo", obj.ContentString())
+
+		obj = unmarshal(t, `{"content": "hello", "contentMap": {"fr": "bonjour"}}`)
+		require.Equal("hello", obj.ContentString())
+	})
+	t.Run("object as an IRI", func(t *testing.T) {
+		require := require.New(t)
+		obj := unmarshal(t, `{"type": "Announce", "object": "https://example.com/notes/1"}`)
+		require.True(obj.Object.IsLink())
+		require.Equal("https://example.com/notes/1", obj.Object.ID)
+	})
+	t.Run("icon as an array", func(t *testing.T) {
+		require := require.New(t)
+		obj := unmarshal(t, `{"icon": [{"type": "Image", "url": "https://example.com/a.png"}, {"type": "Image", "url": "https://example.com/b.png"}]}`)
+		require.Equal("https://example.com/a.png", obj.Icon.URL.Href())
+	})
+	t.Run("times in various forms", func(t *testing.T) {
+		require := require.New(t)
+		obj := unmarshal(t, `{"published": "2023-04-01T12:00:00Z", "updated": "2023-04-01T12:00:00.123", "endTime": "yesterday"}`)
+		require.Equal(time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC), obj.Published.Time)
+		require.Equal(time.Date(2023, 4, 1, 12, 0, 0, 123000000, time.UTC), obj.Updated.Time)
+		require.True(obj.EndTime.IsZero())
+	})
+}
+
+func TestObjectValidate(t *testing.T) {
+	t.Run("valid Create", func(t *testing.T) {
+		require := require.New(t)
+		obj := unmarshal(t, `{
+			"id": "https://example.com/users/alice/statuses/1/activity",
+			"type": "Create",
+			"actor": "https://example.com/users/alice",
+			"object": {
+				"id": "https://example.com/users/alice/statuses/1",
+				"type": "Note",
+				"attributedTo": "https://example.com/users/alice",
+				"published": "2023-04-01T12:00:00Z",
+				"content": "hello"
+			}
+		}`)
+		require.NoError(obj.Validate())
+	})
+	t.Run("Create missing actor and object fields", func(t *testing.T) {
+		require := require.New(t)
+		obj := unmarshal(t, `{
+			"id": "https://example.com/users/alice/statuses/1/activity",
+			"type": "Create",
+			"object": {
+				"id": "/statuses/1",
+				"type": "Note"
+			}
+		}`)
+		err := obj.Validate()
+		require.ErrorIs(err, ErrInvalid)
+		var joined interface{ Unwrap() []error }
+		require.True(errors.As(err, &joined))
+		require.Len(joined.Unwrap(), 4) // actor, object.id, object.attributedTo, object.published
+	})
+	t.Run("Add requires a target", func(t *testing.T) {
+		require := require.New(t)
+		obj := unmarshal(t, `{
+			"id": "https://example.com/users/alice#add/1",
+			"type": "Add",
+			"actor": "https://example.com/users/alice",
+			"object": "https://example.com/users/alice/statuses/1"
+		}`)
+		require.ErrorContains(obj.Validate(), "target: is required")
+	})
+	t.Run("Delete of an actor", func(t *testing.T) {
+		require := require.New(t)
+		obj := unmarshal(t, `{
+			"id": "https://example.com/users/alice#delete",
+			"type": "Delete",
+			"actor": "https://example.com/users/alice",
+			"object": "https://example.com/users/alice"
+		}`)
+		require.NoError(obj.Validate())
+	})
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"github.com/bardic/pub/internal/webpush"
 	"github.com/bardic/pub/models"
 	"gorm.io/gorm"
 )
@@ -53,5 +54,29 @@ func (a *AutoMigrateCmd) Run(ctx *Context) error {
 		return err
 	}
 
+	ctx.Logger.Info("rebuilding peers from the actors which have interacted with local accounts")
+	if err := models.NewPeers(db).Rebuild(); err != nil {
+		return err
+	}
+
+	ctx.Logger.Info("generating VAPID keys for instances without them")
+	var instances []*models.Instance
+	if err := db.Find(&instances, "vapid_public_key = ?", "").Error; err != nil {
+		return err
+	}
+	for _, instance := range instances {
+		keys, err := webpush.GenerateVAPIDKeys()
+		if err != nil {
+			return err
+		}
+		err = db.Model(instance).UpdateColumns(map[string]any{
+			"vapid_public_key":  keys.PublicKey,
+			"vapid_private_key": keys.PrivateKey,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/bardic/pub/models"
+	"gorm.io/gorm"
+)
+
+type DomainBlockCmd struct {
+	Add    DomainBlockAddCmd    `cmd:"" help:"Block a domain, or change the severity of its block."`
+	Remove DomainBlockRemoveCmd `cmd:"" help:"Unblock a domain."`
+	List   DomainBlockListCmd   `cmd:"" help:"List blocked domains."`
+}
+
+type DomainBlockAddCmd struct {
+	Domain         string `arg:"" help:"domain to block"`
+	Severity       string `help:"severity of the block" enum:"reject_media,silence,suspend" default:"silence"`
+	PublicComment  string `help:"reason for the block, shown in the public list of blocks"`
+	PrivateComment string `help:"reason for the block, for admins only"`
+	Obfuscate      bool   `help:"partially hide the domain in the public list of blocks"`
+}
+
+func (d *DomainBlockAddCmd) Run(ctx *Context) error {
+	db, err := gorm.Open(ctx.Dialector, &ctx.Config)
+	if err != nil {
+		return err
+	}
+
+	block, err := models.NewDomainBlocks(db).Create(d.Domain, models.DomainBlockSeverity(d.Severity), d.PublicComment, d.PrivateComment, d.Obfuscate)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("blocked %s: %s\n", block.Domain, block.Severity)
+	return nil
+}
+
+type DomainBlockRemoveCmd struct {
+	Domain string `arg:"" help:"domain to unblock"`
+}
+
+func (d *DomainBlockRemoveCmd) Run(ctx *Context) error {
+	db, err := gorm.Open(ctx.Dialector, &ctx.Config)
+	if err != nil {
+		return err
+	}
+
+	return models.NewDomainBlocks(db).Delete(d.Domain)
+}
+
+type DomainBlockListCmd struct{}
+
+func (d *DomainBlockListCmd) Run(ctx *Context) error {
+	db, err := gorm.Open(ctx.Dialector, &ctx.Config)
+	if err != nil {
+		return err
+	}
+
+	var blocks []*models.DomainBlock
+	if err := db.Order("domain").Find(&blocks).Error; err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "DOMAIN\tSEVERITY\tOBFUSCATE\tPUBLIC COMMENT\tPRIVATE COMMENT")
+	for _, b := range blocks {
+		fmt.Fprintf(tw, "%s\t%s\t%t\t%s\t%s\n", b.Domain, b.Severity, b.Obfuscate, b.PublicComment, b.PrivateComment)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bardic/pub/internal/httpx"
+	"github.com/bardic/pub/models"
+	"github.com/bardic/pub/workers"
+	"gorm.io/gorm"
+)
+
+type FeedCmd struct {
+	Add FeedAddCmd `cmd:"" help:"Follow an RSS or Atom feed."`
+}
+
+type FeedAddCmd struct {
+	URL   string `arg:"" help:"URL of the feed to follow."`
+	Actor string `help:"actor to follow the feed with" required:"true"`
+}
+
+func (f *FeedAddCmd) Run(ctx *Context) error {
+	db, err := gorm.Open(ctx.Dialector, &ctx.Config)
+	if err != nil {
+		return err
+	}
+
+	var account models.Account
+	if err := db.Joins("Actor", &models.Actor{URI: f.Actor}).Take(&account).Error; err != nil {
+		return err
+	}
+
+	feed, err := workers.NewFeedPoller(db, httpx.DefaultClient).Add(context.Background(), account.Actor, f.URL)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("following %s as %s@%s\n", feed.URL, feed.Actor.Name, feed.Actor.Domain)
+	return nil
+}
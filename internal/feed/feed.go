@@ -0,0 +1,290 @@
+// Package feed parses RSS 2.0 and Atom feeds into a common form.
+package feed
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrUnsupported is returned by Parse when the document is not an RSS 2.0 or Atom feed.
+var ErrUnsupported = errors.New("feed: unsupported document")
+
+// Feed is an RSS or Atom feed.
+type Feed struct {
+	Title       string
+	Description string
+	// Link is the URL of the website the feed belongs to.
+	Link string
+	// Image is the URL of the feed's logo or icon.
+	Image   string
+	Entries []Entry
+}
+
+// Entry is an item of an RSS feed, or an entry of an Atom feed.
+type Entry struct {
+	// ID is the entry's guid or id, or its link if it has neither.
+	ID    string
+	Link  string
+	Title string
+	// Content is the HTML body of the entry.
+	Content string
+	// Summary is the HTML abstract of the entry, if it has both a summary and content.
+	Summary    string
+	Published  time.Time
+	Updated    time.Time
+	Enclosures []Enclosure
+}
+
+// Text returns the title and content of the entry as plain text.
+func (e *Entry) Text() string {
+	return e.Title + "\n" + html.UnescapeString(stripTags(e.Content))
+}
+
+// Enclosure is a media file attached to an entry.
+type Enclosure struct {
+	URL  string
+	Type string
+}
+
+// Parse parses an RSS 2.0 or Atom feed.
+func Parse(r io.Reader) (*Feed, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	root, err := rootElement(body)
+	if err != nil {
+		return nil, err
+	}
+	switch root {
+	case "rss":
+		var doc rssDocument
+		if err := xml.Unmarshal(body, &doc); err != nil {
+			return nil, err
+		}
+		return doc.feed(), nil
+	case "feed":
+		var doc atomFeed
+		if err := xml.Unmarshal(body, &doc); err != nil {
+			return nil, err
+		}
+		return doc.feed(), nil
+	default:
+		return nil, fmt.Errorf("%w: <%s>", ErrUnsupported, root)
+	}
+}
+
+// rootElement returns the local name of the document's root element.
+func rootElement(body []byte) (string, error) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", err
+		}
+		if se, ok := tok.(xml.StartElement); ok {
+			return se.Name.Local, nil
+		}
+	}
+}
+
+type rssDocument struct {
+	Channel struct {
+		Title       string `xml:"title"`
+		Link        string `xml:"link"`
+		Description string `xml:"description"`
+		Image       struct {
+			URL string `xml:"url"`
+		} `xml:"image"`
+		Items []struct {
+			GUID        string `xml:"guid"`
+			Link        string `xml:"link"`
+			Title       string `xml:"title"`
+			Description string `xml:"description"`
+			Encoded     string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+			PubDate     string `xml:"pubDate"`
+			Enclosures  []struct {
+				URL  string `xml:"url,attr"`
+				Type string `xml:"type,attr"`
+			} `xml:"enclosure"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+func (doc *rssDocument) feed() *Feed {
+	ch := &doc.Channel
+	f := &Feed{
+		Title:       strings.TrimSpace(ch.Title),
+		Description: strings.TrimSpace(ch.Description),
+		Link:        strings.TrimSpace(ch.Link),
+		Image:       strings.TrimSpace(ch.Image.URL),
+	}
+	for _, item := range ch.Items {
+		e := Entry{
+			ID:        strings.TrimSpace(item.GUID),
+			Link:      strings.TrimSpace(item.Link),
+			Title:     strings.TrimSpace(item.Title),
+			Content:   item.Description,
+			Published: parseTime(item.PubDate),
+		}
+		if item.Encoded != "" {
+			// content:encoded is the full post, description is then its abstract.
+			e.Content, e.Summary = item.Encoded, item.Description
+		}
+		if e.ID == "" {
+			e.ID = e.Link
+		}
+		e.Updated = e.Published
+		for _, enc := range item.Enclosures {
+			e.Enclosures = append(e.Enclosures, Enclosure{URL: enc.URL, Type: enc.Type})
+		}
+		f.Entries = append(f.Entries, e)
+	}
+	return f
+}
+
+type atomFeed struct {
+	Title    atomText   `xml:"title"`
+	Subtitle atomText   `xml:"subtitle"`
+	Links    []atomLink `xml:"link"`
+	Icon     string     `xml:"icon"`
+	Logo     string     `xml:"logo"`
+	Entries  []struct {
+		ID        string     `xml:"id"`
+		Title     atomText   `xml:"title"`
+		Links     []atomLink `xml:"link"`
+		Content   atomText   `xml:"content"`
+		Summary   atomText   `xml:"summary"`
+		Published string     `xml:"published"`
+		Updated   string     `xml:"updated"`
+	} `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+	Href string `xml:"href,attr"`
+}
+
+// atomText is an Atom text construct; text, HTML or XHTML.
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+// html returns the construct as HTML.
+func (t *atomText) html() string {
+	switch t.Type {
+	case "html":
+		return t.Text
+	case "xhtml":
+		return strings.TrimSpace(t.Inner)
+	default:
+		return html.EscapeString(strings.TrimSpace(t.Text))
+	}
+}
+
+// text returns the construct as plain text.
+func (t *atomText) text() string {
+	if t.Type == "html" || t.Type == "xhtml" {
+		return strings.TrimSpace(html.UnescapeString(stripTags(t.html())))
+	}
+	return strings.TrimSpace(t.Text)
+}
+
+// alternate returns the href of the alternate link, which is the default relation.
+func alternate(links []atomLink) string {
+	for _, l := range links {
+		if l.Rel == "" || l.Rel == "alternate" {
+			return l.Href
+		}
+	}
+	return ""
+}
+
+func (doc *atomFeed) feed() *Feed {
+	f := &Feed{
+		Title:       doc.Title.text(),
+		Description: doc.Subtitle.text(),
+		Link:        alternate(doc.Links),
+		Image:       strings.TrimSpace(doc.Logo),
+	}
+	if f.Image == "" {
+		f.Image = strings.TrimSpace(doc.Icon)
+	}
+	for _, entry := range doc.Entries {
+		e := Entry{
+			ID:        strings.TrimSpace(entry.ID),
+			Link:      alternate(entry.Links),
+			Title:     entry.Title.text(),
+			Content:   entry.Content.html(),
+			Published: parseTime(entry.Published),
+			Updated:   parseTime(entry.Updated),
+		}
+		if e.Content == "" {
+			e.Content = entry.Summary.html()
+		} else {
+			e.Summary = entry.Summary.html()
+		}
+		if e.Published.IsZero() {
+			e.Published = e.Updated
+		}
+		if e.ID == "" {
+			e.ID = e.Link
+		}
+		for _, l := range entry.Links {
+			if l.Rel == "enclosure" {
+				e.Enclosures = append(e.Enclosures, Enclosure{URL: l.Href, Type: l.Type})
+			}
+		}
+		f.Entries = append(f.Entries, e)
+	}
+	return f
+}
+
+// timeLayouts are the formats of dates found in feeds; RFC 822 and its variants in RSS, RFC 3339 in Atom.
+var timeLayouts = []string{
+	time.RFC3339,
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	time.RFC822Z,
+	time.RFC822,
+}
+
+// parseTime parses a feed date, returning the zero time if it is not in a known format.
+func parseTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// stripTags removes the markup from an HTML fragment.
+func stripTags(s string) string {
+	var sb strings.Builder
+	var inTag bool
+	for _, r := range s {
+		switch {
+		case r == '<':
+			inTag = true
+		case r == '>':
+			inTag = false
+		case !inTag:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
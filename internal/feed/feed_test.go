@@ -0,0 +1,100 @@
+package feed
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("rss", func(t *testing.T) {
+		require := require.New(t)
+		doc, err := Parse(strings.NewReader(`<?xml version="1.0"?>
+<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/">
+  <channel>
+    <title>Example Blog</title>
+    <link>https://blog.example.com/</link>
+    <description>Notes from example</description>
+    <image><url>https://blog.example.com/logo.png</url></image>
+    <item>
+      <guid>https://blog.example.com/posts/1</guid>
+      <link>https://blog.example.com/posts/1</link>
+      <title>First post</title>
+      <description>&lt;p&gt;The summary&lt;/p&gt;</description>
+      <content:encoded><![CDATA[<p>The whole post</p>]]></content:encoded>
+      <pubDate>Mon, 02 Jan 2023 15:04:05 +0000</pubDate>
+      <enclosure url="https://blog.example.com/episode.mp3" length="1234" type="audio/mpeg"/>
+    </item>
+    <item>
+      <link>https://blog.example.com/posts/2</link>
+      <description>Short</description>
+    </item>
+  </channel>
+</rss>`))
+		require.NoError(err)
+		require.Equal("Example Blog", doc.Title)
+		require.Equal("Notes from example", doc.Description)
+		require.Equal("https://blog.example.com/", doc.Link)
+		require.Equal("https://blog.example.com/logo.png", doc.Image)
+		require.Len(doc.Entries, 2)
+
+		e := doc.Entries[0]
+		require.Equal("https://blog.example.com/posts/1", e.ID)
+		require.Equal("First post", e.Title)
+		require.Equal("<p>The whole post</p>", e.Content)
+		require.Equal("<p>The summary</p>", e.Summary)
+		require.Equal(time.Date(2023, 1, 2, 15, 4, 5, 0, time.UTC), e.Published.UTC())
+		require.Equal([]Enclosure{{URL: "https://blog.example.com/episode.mp3", Type: "audio/mpeg"}}, e.Enclosures)
+
+		e = doc.Entries[1]
+		require.Equal("https://blog.example.com/posts/2", e.ID, "the link is the ID of entries without a guid")
+		require.Equal("Short", e.Content)
+		require.Empty(e.Summary)
+	})
+
+	t.Run("atom", func(t *testing.T) {
+		require := require.New(t)
+		doc, err := Parse(strings.NewReader(`<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title type="html">Example &amp;amp; Co</title>
+  <subtitle>All the news</subtitle>
+  <link rel="self" href="https://example.com/feed.atom"/>
+  <link href="https://example.com/"/>
+  <icon>https://example.com/icon.png</icon>
+  <entry>
+    <id>tag:example.com,2023:1</id>
+    <title>Hello &lt;world&gt;</title>
+    <link rel="alternate" type="text/html" href="https://example.com/1"/>
+    <link rel="enclosure" type="image/png" href="https://example.com/1.png"/>
+    <content type="html">&lt;p&gt;Hello&lt;/p&gt;</content>
+    <summary>Greetings</summary>
+    <updated>2023-01-03T00:00:00Z</updated>
+  </entry>
+</feed>`))
+		require.NoError(err)
+		require.Equal("Example & Co", doc.Title)
+		require.Equal("All the news", doc.Description)
+		require.Equal("https://example.com/", doc.Link)
+		require.Equal("https://example.com/icon.png", doc.Image)
+		require.Len(doc.Entries, 1)
+
+		e := doc.Entries[0]
+		require.Equal("tag:example.com,2023:1", e.ID)
+		require.Equal("https://example.com/1", e.Link)
+		require.Equal("Hello <world>", e.Title)
+		require.Equal("<p>Hello</p>", e.Content)
+		require.Equal("Greetings", e.Summary)
+		require.Equal(time.Date(2023, 1, 3, 0, 0, 0, 0, time.UTC), e.Published, "entries without published use updated")
+		require.Equal([]Enclosure{{URL: "https://example.com/1.png", Type: "image/png"}}, e.Enclosures)
+		require.Equal("Hello <world>\nHello", e.Text())
+	})
+
+	t.Run("other documents are unsupported", func(t *testing.T) {
+		require := require.New(t)
+		_, err := Parse(strings.NewReader(`<html><body>not a feed</body></html>`))
+		require.True(errors.Is(err, ErrUnsupported))
+	})
+}
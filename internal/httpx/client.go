@@ -0,0 +1,180 @@
+package httpx
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+const (
+	// MaxRedirects is the maximum number of redirects DefaultClient will follow.
+	MaxRedirects = 5
+	// MaxResponseSize is the maximum number of bytes DefaultTransport will read
+	// from a response body before returning ErrResponseTooLarge.
+	MaxResponseSize = 40 << 20 // large enough for the largest video attachment Mastodon will accept.
+	// DefaultTimeout is the overall timeout for a request made with DefaultClient,
+	// including redirects and reading the response body.
+	DefaultTimeout = 30 * time.Second
+)
+
+var (
+	// ErrDisallowedAddress is returned when a request resolves to an address
+	// which is not publicly routable.
+	ErrDisallowedAddress = errors.New("httpx: disallowed address")
+	// ErrResponseTooLarge is returned when a response body exceeds MaxResponseSize.
+	ErrResponseTooLarge = errors.New("httpx: response too large")
+	// ErrTooManyRedirects is returned when a request exceeds MaxRedirects.
+	ErrTooManyRedirects = errors.New("httpx: too many redirects")
+)
+
+// DefaultTransport is a hardened http.RoundTripper for fetching resources
+// named by remote servers. It refuses to connect to loopback, private,
+// link-local, and cloud metadata addresses, and caps the size of response bodies.
+var DefaultTransport http.RoundTripper = NewTransport(MaxResponseSize)
+
+// DefaultClient is an http.Client which uses DefaultTransport, follows at most
+// MaxRedirects redirects and gives up after DefaultTimeout.
+// Every outbound request made on behalf of a remote server should use DefaultClient,
+// or DefaultTransport if the caller needs to wrap the transport, as activitypub.Client does.
+var DefaultClient = &http.Client{
+	Transport:     DefaultTransport,
+	Timeout:       DefaultTimeout,
+	CheckRedirect: checkRedirect,
+}
+
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= MaxRedirects {
+		return ErrTooManyRedirects
+	}
+	return nil
+}
+
+// NewTransport returns a new http.RoundTripper which only dials publicly routable
+// addresses and limits response bodies to maxBytes.
+func NewTransport(maxBytes int64) http.RoundTripper {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+		// Control is called after DNS resolution, with the address about to be dialed,
+		// so a hostname which resolves to a private address is caught here, as is a
+		// hostname which resolves to a public address on the first lookup and a private
+		// address on the next.
+		Control: func(network, address string, _ syscall.RawConn) error {
+			return checkAddress(address)
+		},
+	}
+	return &limitedTransport{
+		maxBytes: maxBytes,
+		next: &http.Transport{
+			Proxy:                 nil, // a proxy would dial on our behalf, bypassing Control.
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 15 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+	}
+}
+
+func checkAddress(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !IsPublicAddr(addr) {
+		return fmt.Errorf("%w: %s", ErrDisallowedAddress, addr)
+	}
+	return nil
+}
+
+// disallowedPrefixes are the address ranges, beyond loopback, link-local (which includes
+// the 169.254.169.254 cloud metadata address), multicast, and private ranges, which
+// DefaultTransport will not connect to.
+var disallowedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),         // "this" network
+	netip.MustParsePrefix("100.64.0.0/10"),     // carrier grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),      // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),      // TEST-NET-1
+	netip.MustParsePrefix("198.18.0.0/15"),     // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"),   // TEST-NET-2
+	netip.MustParsePrefix("203.0.113.0/24"),    // TEST-NET-3
+	netip.MustParsePrefix("240.0.0.0/4"),       // reserved
+	netip.MustParsePrefix("64:ff9b::/96"),      // NAT64, may embed any IPv4 address
+	netip.MustParsePrefix("64:ff9b:1::/48"),    // local use IPv4/IPv6 translation
+	netip.MustParsePrefix("100::/64"),          // discard only
+	netip.MustParsePrefix("2001::/32"),         // teredo, may embed any IPv4 address
+	netip.MustParsePrefix("2001:db8::/32"),     // documentation
+	netip.MustParsePrefix("2002::/16"),         // 6to4, may embed any IPv4 address
+	netip.MustParsePrefix("fd00:ec2::254/128"), // AWS IPv6 metadata, also covered by IsPrivate
+	netip.MustParsePrefix("fec0::/10"),         // deprecated site local
+}
+
+// IsPublicAddr reports whether addr is a publicly routable unicast address.
+func IsPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, p := range disallowedPrefixes {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// limitedTransport wraps an http.RoundTripper, limiting the size of the response body.
+type limitedTransport struct {
+	maxBytes int64
+	next     http.RoundTripper
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.ContentLength > t.maxBytes {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s: Content-Length %d", ErrResponseTooLarge, req.URL, resp.ContentLength)
+	}
+	resp.Body = &limitedReader{
+		ReadCloser: resp.Body,
+		remaining:  t.maxBytes,
+	}
+	return resp, nil
+}
+
+// limitedReader is like io.LimitedReader, but returns ErrResponseTooLarge
+// rather than io.EOF if the underlying reader has more data than permitted.
+type limitedReader struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, ErrResponseTooLarge
+	}
+	if int64(len(p)) > l.remaining+1 {
+		// read one byte more than permitted to detect overflow.
+		p = p[:l.remaining+1]
+	}
+	n, err := l.ReadCloser.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n + int(l.remaining), ErrResponseTooLarge
+	}
+	return n, err
+}
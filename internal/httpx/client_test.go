@@ -0,0 +1,117 @@
+package httpx
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"1.1.1.1", true},
+		{"93.184.216.34", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"127.1.2.3", false},
+		{"10.0.0.1", false},
+		{"172.16.5.4", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"255.255.255.255", false},
+		{"224.0.0.1", false},
+		{"::1", false},
+		{"::", false},
+		{"fe80::1", false},
+		{"fd00:ec2::254", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"64:ff9b::a00:1", false},
+		{"2002:a00:1::", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			require.Equal(t, tt.want, IsPublicAddr(netip.MustParseAddr(tt.addr)))
+		})
+	}
+}
+
+func TestDefaultClient(t *testing.T) {
+	t.Run("requests to loopback addresses are refused", func(t *testing.T) {
+		require := require.New(t)
+
+		var called bool
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}))
+		defer srv.Close()
+
+		_, err := DefaultClient.Get(srv.URL)
+		require.ErrorIs(err, ErrDisallowedAddress)
+		require.False(called)
+	})
+
+	t.Run("redirects are capped", func(t *testing.T) {
+		require := require.New(t)
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/again", http.StatusFound)
+		}))
+		defer srv.Close()
+
+		// DefaultTransport would refuse to dial the test server, so borrow its redirect policy.
+		cl := &http.Client{CheckRedirect: DefaultClient.CheckRedirect}
+		_, err := cl.Get(srv.URL)
+		require.ErrorIs(err, ErrTooManyRedirects)
+	})
+}
+
+func TestLimitedTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("chunked") == "true" {
+			w.(http.Flusher).Flush() // suppress Content-Length
+		}
+		io.WriteString(w, strings.Repeat("x", 100))
+	}))
+	defer srv.Close()
+
+	get := func(t *testing.T, maxBytes int64, url string) ([]byte, error) {
+		t.Helper()
+		rt := &limitedTransport{maxBytes: maxBytes, next: http.DefaultTransport}
+		resp, err := (&http.Client{Transport: rt}).Get(url)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		return io.ReadAll(resp.Body)
+	}
+
+	t.Run("response within limit is returned", func(t *testing.T) {
+		require := require.New(t)
+		body, err := get(t, 100, srv.URL+"?chunked=true")
+		require.NoError(err)
+		require.Len(body, 100)
+	})
+
+	t.Run("response with large Content-Length is refused", func(t *testing.T) {
+		require := require.New(t)
+		_, err := get(t, 99, srv.URL)
+		require.ErrorIs(err, ErrResponseTooLarge)
+	})
+
+	t.Run("chunked response exceeding the limit is truncated", func(t *testing.T) {
+		require := require.New(t)
+		body, err := get(t, 99, srv.URL+"?chunked=true")
+		require.ErrorIs(err, ErrResponseTooLarge)
+		require.Len(body, 99)
+	})
+}
@@ -0,0 +1,195 @@
+// Package lang detects the natural language of short texts.
+//
+// Detection is offline. Texts in a script used by a single language, such as
+// Hangul or Thai, are identified by script alone. Texts in Latin and Cyrillic
+// scripts are compared against character trigram profiles built from the
+// small corpora embedded in this package, using the Cavnar-Trenkle
+// out-of-place measure.
+package lang
+
+import (
+	"embed"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+//go:embed corpus/*.txt
+var corpora embed.FS
+
+const (
+	// profileSize is the number of trigrams kept for each language.
+	profileSize = 300
+	// minLetters is the number of letters below which Detect will not guess.
+	minLetters = 12
+)
+
+// profile is a language's trigrams, ranked by frequency.
+type profile struct {
+	lang   string
+	script *unicode.RangeTable
+	ranks  map[string]int
+}
+
+var profiles []*profile
+
+func init() {
+	entries, err := corpora.ReadDir("corpus")
+	if err != nil {
+		panic(err)
+	}
+	for _, e := range entries {
+		b, err := corpora.ReadFile(path.Join("corpus", e.Name()))
+		if err != nil {
+			panic(err)
+		}
+		text := string(b)
+		profiles = append(profiles, &profile{
+			lang:   strings.TrimSuffix(e.Name(), ".txt"),
+			script: dominantScript(text).table,
+			ranks:  rank(trigrams(text)),
+		})
+	}
+}
+
+// script is a writing system and, if it is used by only one language we
+// support, that language.
+type script struct {
+	table *unicode.RangeTable
+	lang  string
+}
+
+var scripts = []script{
+	{unicode.Latin, ""},
+	{unicode.Cyrillic, ""},
+	{unicode.Greek, "el"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Thai, "th"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Hangul, "ko"},
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Han, "zh"},
+	{unicode.Armenian, "hy"},
+	{unicode.Georgian, "ka"},
+}
+
+// Detect returns the BCP 47 tag of the language text is written in, or an
+// empty string if the text is too short, or not in a language this package knows.
+func Detect(text string) string {
+	s := dominantScript(text)
+	if s.count < minLetters && !(s.table == unicode.Han || s.lang == "ja" || s.lang == "ko") {
+		// CJK scripts pack a word into a character or two.
+		return ""
+	}
+	if s.count == 0 {
+		return ""
+	}
+	if s.lang != "" {
+		if s.table == unicode.Han && s.kana > 0 {
+			// Japanese mixes kanji with kana; Chinese does not use kana.
+			return "ja"
+		}
+		return s.lang
+	}
+	doc := rank(trigrams(text))
+	best, bestDistance := "", -1
+	for _, p := range profiles {
+		if p.script != s.table {
+			continue
+		}
+		if d := distance(doc, p.ranks); bestDistance < 0 || d < bestDistance {
+			best, bestDistance = p.lang, d
+		}
+	}
+	return best
+}
+
+type scriptCount struct {
+	script
+	count int
+	kana  int
+}
+
+// dominantScript returns the script most of the letters in text are written in.
+func dominantScript(text string) scriptCount {
+	counts := make([]int, len(scripts))
+	var kana int
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		for i, s := range scripts {
+			if unicode.Is(s.table, r) {
+				counts[i]++
+				if s.lang == "ja" {
+					kana++
+				}
+				break
+			}
+		}
+	}
+	best := 0
+	for i := range counts {
+		if counts[i] > counts[best] {
+			best = i
+		}
+	}
+	return scriptCount{script: scripts[best], count: counts[best], kana: kana}
+}
+
+// trigrams counts the character trigrams of the words in text. Each word is
+// padded with a space either side, so that prefixes and suffixes are counted.
+func trigrams(text string) map[string]int {
+	counts := make(map[string]int)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	}) {
+		runes := []rune(" " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			counts[string(runes[i:i+3])]++
+		}
+	}
+	return counts
+}
+
+// rank returns the ranks of the profileSize most frequent trigrams in counts.
+func rank(counts map[string]int) map[string]int {
+	grams := make([]string, 0, len(counts))
+	for g := range counts {
+		grams = append(grams, g)
+	}
+	sort.Slice(grams, func(i, j int) bool {
+		if counts[grams[i]] != counts[grams[j]] {
+			return counts[grams[i]] > counts[grams[j]]
+		}
+		return grams[i] < grams[j]
+	})
+	if len(grams) > profileSize {
+		grams = grams[:profileSize]
+	}
+	ranks := make(map[string]int, len(grams))
+	for i, g := range grams {
+		ranks[g] = i
+	}
+	return ranks
+}
+
+// distance returns the out-of-place distance between a document and a language profile.
+func distance(doc, lang map[string]int) int {
+	var d int
+	for g, r := range doc {
+		lr, ok := lang[g]
+		switch {
+		case !ok:
+			d += profileSize
+		case lr > r:
+			d += lr - r
+		default:
+			d += r - lr
+		}
+	}
+	return d
+}
@@ -0,0 +1,38 @@
+package lang
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"", ""},
+		{"lol", ""},
+		{"Just finished reading a great book about the history of the internet, highly recommended!", "en"},
+		{"Heute Abend gehen wir mit den Kindern ins Kino, ich freue mich schon sehr darauf.", "de"},
+		{"Je suis vraiment content de vous retrouver ici, la journée a été longue mais belle.", "fr"},
+		{"Mañana vamos a la playa con mis amigos si no llueve, tengo muchas ganas.", "es"},
+		{"Hoje eu vou cozinhar uma feijoada para a minha família, estou muito animado.", "pt"},
+		{"Stasera andiamo a cena fuori con gli amici, non vedo l'ora di mangiare una pizza.", "it"},
+		{"Vanavond gaan we met de kinderen naar de bioscoop, ik heb er echt zin in.", "nl"},
+		{"Ikväll ska vi äta middag hos mina föräldrar, det ska bli mysigt.", "sv"},
+		{"Dzisiaj wieczorem idziemy do kina z dziećmi, bardzo się cieszę.", "pl"},
+		{"Bu akşam çocuklarla sinemaya gidiyoruz, çok heyecanlıyım.", "tr"},
+		{"Сегодня вечером мы идём в кино с детьми, я очень этому рад.", "ru"},
+		{"Сьогодні ввечері ми йдемо в кіно з дітьми, я дуже цьому радий.", "uk"},
+		{"今日はとても良い天気ですね。", "ja"},
+		{"今天天气很好，我们去公园散步吧。", "zh"},
+		{"오늘 날씨가 정말 좋네요.", "ko"},
+		{"Σήμερα το απόγευμα θα πάμε στη θάλασσα.", "el"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want+" "+tt.text, func(t *testing.T) {
+			require.Equal(t, tt.want, Detect(tt.text))
+		})
+	}
+}
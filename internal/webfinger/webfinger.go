@@ -6,6 +6,7 @@ import (
 	"net/url"
 	"strings"
 
+	"github.com/bardic/pub/internal/httpx"
 	"github.com/carlmjohnson/requests"
 )
 
@@ -87,7 +88,7 @@ func (a *Acct) SharedInbox() string {
 
 func (a *Acct) Fetch(ctx context.Context) (*Webfinger, error) {
 	var webfinger Webfinger
-	err := requests.URL(a.Webfinger()).ToJSON(&webfinger).Fetch(ctx)
+	err := requests.URL(a.Webfinger()).Client(httpx.DefaultClient).ToJSON(&webfinger).Fetch(ctx)
 	return &webfinger, err
 }
 
@@ -0,0 +1,253 @@
+// Package webpush delivers Web Push messages, encrypted as described in RFC 8291
+// and signed with a VAPID key as described in RFC 8292.
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// ErrGone is returned by Send if the push service reports that the subscription
+// no longer exists.
+var ErrGone = errors.New("webpush: subscription is gone")
+
+// recordSize is the record size advertised in the aes128gcm header. Payloads are
+// always encrypted as a single record, so must be smaller than this.
+const recordSize = 4096
+
+// VAPIDKeys are the application server's P-256 key pair, base64url encoded.
+type VAPIDKeys struct {
+	// PublicKey is the uncompressed public key, the applicationServerKey of the
+	// subscriptions.
+	PublicKey string
+	// PrivateKey is the private scalar.
+	PrivateKey string
+}
+
+// GenerateVAPIDKeys generates a new VAPID key pair.
+func GenerateVAPIDKeys() (*VAPIDKeys, error) {
+	priv, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &VAPIDKeys{
+		PublicKey:  base64.URLEncoding.EncodeToString(priv.PublicKey().Bytes()),
+		PrivateKey: base64.URLEncoding.EncodeToString(priv.Bytes()),
+	}, nil
+}
+
+// A Subscription is a push subscription created by a user agent.
+type Subscription struct {
+	Endpoint string
+	// P256DH is the user agent's public key, base64url encoded.
+	P256DH string
+	// Auth is the user agent's authentication secret, base64url encoded.
+	Auth string
+}
+
+// Send encrypts payload for sub and delivers it to the subscription's push service
+// with client, authorised with keys. subject is a mailto: or https: URL the operator
+// of the push service can use to contact the sender. Push services must be reached
+// over https.
+func Send(ctx context.Context, client *http.Client, sub *Subscription, payload []byte, keys *VAPIDKeys, subject string, ttl time.Duration) error {
+	if err := ValidateEndpoint(sub.Endpoint); err != nil {
+		return err
+	}
+	uaPublic, err := decode(sub.P256DH)
+	if err != nil {
+		return fmt.Errorf("webpush: p256dh: %w", err)
+	}
+	authSecret, err := decode(sub.Auth)
+	if err != nil {
+		return fmt.Errorf("webpush: auth: %w", err)
+	}
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	body, err := encrypt(payload, uaPublic, authSecret, asPrivate, salt)
+	if err != nil {
+		return err
+	}
+	authorization, err := vapid(sub.Endpoint, keys, subject, time.Now().Add(12*time.Hour))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(ttl.Seconds())))
+	req.Header.Set("Authorization", authorization)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrGone
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("webpush: %s: %s", sub.Endpoint, resp.Status)
+	default:
+		return nil
+	}
+}
+
+// ValidateEndpoint returns an error if endpoint is not an https URL.
+func ValidateEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("webpush: endpoint: %w", err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("webpush: endpoint %q is not an https URL", endpoint)
+	}
+	return nil
+}
+
+// encrypt encrypts plaintext for the user agent with public key uaPublic and
+// authentication secret authSecret, as a single aes128gcm record.
+// https://www.rfc-editor.org/rfc/rfc8291#section-3.4
+func encrypt(plaintext, uaPublic, authSecret []byte, asPrivate *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	if len(plaintext)+1+16 > recordSize {
+		return nil, errors.New("webpush: payload too large")
+	}
+	ua, err := ecdh.P256().NewPublicKey(uaPublic)
+	if err != nil {
+		return nil, fmt.Errorf("webpush: invalid user agent public key: %w", err)
+	}
+	ecdhSecret, err := asPrivate.ECDH(ua)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+
+	keyInfo := append([]byte("WebPush: info\x00"), uaPublic...)
+	keyInfo = append(keyInfo, asPublic...)
+	ikm, err := expand(hkdf.Extract(sha256.New, ecdhSecret, authSecret), keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	prk := hkdf.Extract(sha256.New, ikm, salt)
+	cek, err := expand(prk, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := expand(prk, []byte("Content-Encoding: nonce\x00"), 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// header: salt, record size, key id length and key id.
+	// https://www.rfc-editor.org/rfc/rfc8188#section-2.1
+	out := make([]byte, 0, 16+4+1+len(asPublic)+len(plaintext)+1+gcm.Overhead())
+	out = append(out, salt...)
+	out = binary.BigEndian.AppendUint32(out, recordSize)
+	out = append(out, byte(len(asPublic)))
+	out = append(out, asPublic...)
+	// 0x02 delimits the last, and only, record.
+	record := append(append([]byte{}, plaintext...), 0x02)
+	return gcm.Seal(out, nonce, record, nil), nil
+}
+
+func expand(prk, info []byte, n int) ([]byte, error) {
+	out := make([]byte, n)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, prk, info), out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// vapid returns the Authorization header for a push to endpoint, valid until exp.
+// https://www.rfc-editor.org/rfc/rfc8292#section-3
+func vapid(endpoint string, keys *VAPIDKeys, subject string, exp time.Time) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	priv, err := decode(keys.PrivateKey)
+	if err != nil {
+		return "", fmt.Errorf("webpush: vapid private key: %w", err)
+	}
+	pub, err := decode(keys.PublicKey)
+	if err != nil {
+		return "", fmt.Errorf("webpush: vapid public key: %w", err)
+	}
+	x, y := elliptic.Unmarshal(elliptic.P256(), pub)
+	if x == nil {
+		return "", errors.New("webpush: invalid vapid public key")
+	}
+	key := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y},
+		D:         new(big.Int).SetBytes(priv),
+	}
+
+	header, err := json.Marshal(map[string]string{"typ": "JWT", "alg": "ES256"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": exp.Unix(),
+		"sub": subject,
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	// ES256 signatures are the concatenation of r and s, each 32 bytes.
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	token := unsigned + "." + base64.RawURLEncoding.EncodeToString(sig)
+	return fmt.Sprintf("vapid t=%s, k=%s", token, base64.RawURLEncoding.EncodeToString(pub)), nil
+}
+
+// decode decodes base64url, with or without padding.
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
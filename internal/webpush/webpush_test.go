@@ -0,0 +1,129 @@
+package webpush
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func mustDecode(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := decode(s)
+	require.NoError(t, err)
+	return b
+}
+
+// TestEncrypt checks encrypt against the example in RFC 8291, Appendix A.
+func TestEncrypt(t *testing.T) {
+	require := require.New(t)
+	asPrivate, err := ecdh.P256().NewPrivateKey(mustDecode(t, "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"))
+	require.NoError(err)
+
+	body, err := encrypt(
+		[]byte("When I grow up, I want to be a watermelon"),
+		mustDecode(t, "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"),
+		mustDecode(t, "BTBZMqHH6r4Tts7J_aSIgg"),
+		asPrivate,
+		mustDecode(t, "DGv6ra1nlYgDCS1FRnbzlw"),
+	)
+	require.NoError(err)
+	require.Equal("DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN", base64.RawURLEncoding.EncodeToString(body))
+}
+
+func TestVAPID(t *testing.T) {
+	require := require.New(t)
+	keys, err := GenerateVAPIDKeys()
+	require.NoError(err)
+
+	exp := time.Now().Add(time.Hour)
+	header, err := vapid("https://push.example/send/1234", keys, "mailto:admin@example.com", exp)
+	require.NoError(err)
+	require.True(strings.HasPrefix(header, "vapid t="))
+	token, k, ok := strings.Cut(strings.TrimPrefix(header, "vapid t="), ", k=")
+	require.True(ok)
+	require.Equal(mustDecode(t, keys.PublicKey), mustDecode(t, k))
+
+	parts := strings.Split(token, ".")
+	require.Len(parts, 3)
+	var claims map[string]any
+	require.NoError(json.Unmarshal(mustDecode(t, parts[1]), &claims))
+	require.Equal("https://push.example", claims["aud"])
+	require.Equal("mailto:admin@example.com", claims["sub"])
+	require.EqualValues(exp.Unix(), claims["exp"])
+
+	x, y := elliptic.Unmarshal(elliptic.P256(), mustDecode(t, k))
+	pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+	sig := mustDecode(t, parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	require.True(ecdsa.Verify(pub, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])))
+}
+
+func TestSend(t *testing.T) {
+	keys, err := GenerateVAPIDKeys()
+	require.NoError(t, err)
+	ua, err := ecdh.P256().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	sub := &Subscription{
+		P256DH: base64.RawURLEncoding.EncodeToString(ua.PublicKey().Bytes()),
+		Auth:   base64.RawURLEncoding.EncodeToString([]byte("0123456789abcdef")),
+	}
+
+	t.Run("messages are encrypted and authorised", func(t *testing.T) {
+		require := require.New(t)
+		var got *http.Request
+		var body []byte
+		svr := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r
+			body, _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+		}))
+		defer svr.Close()
+
+		sub.Endpoint = svr.URL + "/push/1"
+		require.NoError(Send(context.Background(), svr.Client(), sub, []byte(`{"title":"hello"}`), keys, "https://example.com", time.Hour))
+		require.Equal("aes128gcm", got.Header.Get("Content-Encoding"))
+		require.Equal("3600", got.Header.Get("TTL"))
+		require.Contains(got.Header.Get("Authorization"), "vapid t=")
+		// salt, record size, key id length, key id, payload, delimiter and tag.
+		require.Len(body, 16+4+1+65+len(`{"title":"hello"}`)+1+16)
+	})
+
+	t.Run("subscriptions which are not found are gone", func(t *testing.T) {
+		require := require.New(t)
+		svr := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusGone)
+		}))
+		defer svr.Close()
+
+		sub.Endpoint = svr.URL + "/push/1"
+		err := Send(context.Background(), svr.Client(), sub, []byte("hello"), keys, "https://example.com", time.Hour)
+		require.ErrorIs(err, ErrGone)
+	})
+	t.Run("endpoints must be https", func(t *testing.T) {
+		require := require.New(t)
+		var called bool
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			w.WriteHeader(http.StatusCreated)
+		}))
+		defer svr.Close()
+
+		sub.Endpoint = svr.URL + "/push/1"
+		require.Error(Send(context.Background(), svr.Client(), sub, []byte("hello"), keys, "https://example.com", time.Hour))
+		require.False(called)
+	})
+}
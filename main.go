@@ -27,6 +27,8 @@ var cli struct {
 	CreateAccount        CreateAccountCmd        `cmd:"" help:"Create a new account."`
 	CreateInstance       CreateInstanceCmd       `cmd:"" help:"Create a new instance."`
 	DeleteAccount        DeleteAccountCmd        `cmd:"" help:"Delete an account."`
+	DomainBlock          DomainBlockCmd          `cmd:"" help:"Manage domain blocks."`
+	Feed                 FeedCmd                 `cmd:"" help:"Manage followed feeds."`
 	FetchActor           FetchActorCmd           `cmd:"" help:"Fetch an actor."`
 	HouseKeeping         HouseKeepingCmd         `cmd:"" help:"Perform housekeeping."`
 	Serve                ServeCmd                `cmd:"" help:"Serve a local web server."`
@@ -39,6 +39,17 @@ func AccountsStatusesShow(env *Env, w http.ResponseWriter, r *http.Request) erro
 		return err
 	}
 
+	var actor models.Actor
+	if err := env.DB.Take(&actor, "id = ?", chi.URLParam(r, "id")).Error; err != nil {
+		return httpx.Error(http.StatusNotFound, err)
+	}
+	if actor.IsRemote() && actor.StatusesCount == 0 {
+		// we have never seen this actor post, import their recent statuses.
+		if err := models.NewActors(env.DB).Backfill(&actor); err != nil {
+			return err
+		}
+	}
+
 	var statuses []*models.Status
 	query := env.DB.Scopes(
 		models.PaginateStatuses(r),
@@ -49,7 +60,7 @@ func AccountsStatusesShow(env *Env, w http.ResponseWriter, r *http.Request) erro
 	)
 	query = query.Preload("Reaction", &models.Reaction{ActorID: user.Actor.ID}) // reactions
 	query = query.Preload("Reblog.Reaction", &models.Reaction{ActorID: user.Actor.ID})
-	if err := query.Find(&statuses, "statuses.actor_id = ?", chi.URLParam(r, "id")).Error; err != nil {
+	if err := query.Find(&statuses, "statuses.actor_id = ?", actor.ID).Error; err != nil {
 		return err
 	}
 
@@ -58,8 +69,11 @@ func AccountsStatusesShow(env *Env, w http.ResponseWriter, r *http.Request) erro
 	if len(statuses) > 0 {
 		linkHeader(w, r, statuses[0].ID, statuses[len(statuses)-1].ID)
 	}
-	seralise := Serialiser{req: r}
-	return to.JSON(w, algorithms.Map(statuses, seralise.Status))
+	statuses, serialise, err := filter(env, r, user, "account", statuses)
+	if err != nil {
+		return err
+	}
+	return to.JSON(w, algorithms.Map(statuses, serialise.Status))
 }
 
 func AccountsFollowersShow(env *Env, w http.ResponseWriter, r *http.Request) error {
@@ -121,10 +135,39 @@ func AccountsUpdateCredentials(env *Env, w http.ResponseWriter, r *http.Request)
 	if err := env.DB.Save(account).Error; err != nil {
 		return err
 	}
+
+	if r.Form.Has("hide_collections") || r.Form.Has("hide_collections_count") || r.Form.Has("noindex") {
+		prefs, err := models.NewAccounts(env.DB).PreferencesForActor(account.Actor)
+		if err != nil {
+			return err
+		}
+		if r.Form.Has("hide_collections") {
+			prefs.HideCollections = formBool(r.Form.Get("hide_collections"))
+		}
+		if r.Form.Has("hide_collections_count") {
+			prefs.HideCollectionsCount = formBool(r.Form.Get("hide_collections_count"))
+		}
+		if r.Form.Has("noindex") {
+			prefs.NoIndex = formBool(r.Form.Get("noindex"))
+		}
+		if err := env.DB.Save(prefs).Error; err != nil {
+			return err
+		}
+	}
 	serialise := Serialiser{req: r}
 	return to.JSON(w, serialise.Account(account.Actor))
 }
 
+// formBool reports whether a form value is true.
+func formBool(v string) bool {
+	switch v {
+	case "true", "1", "on":
+		return true
+	default:
+		return false
+	}
+}
+
 func AccountsShowListMembership(env *Env, w http.ResponseWriter, r *http.Request) error {
 	_, err := env.authenticate(r)
 	if err != nil {
@@ -176,11 +219,3 @@ func AccountsFamiliarFollowersShow(env *Env, w http.ResponseWriter, req *http.Re
 	}
 	return to.JSON(w, resp)
 }
-
-func AccountsFeaturedTagsShow(env *Env, w http.ResponseWriter, r *http.Request) error {
-	_, err := env.authenticate(r)
-	if err != nil {
-		return err
-	}
-	return to.JSON(w, []any{})
-}
@@ -0,0 +1,134 @@
+package mastodon
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bardic/pub/internal/httpx"
+	"github.com/bardic/pub/internal/snowflake"
+	"github.com/bardic/pub/internal/to"
+	"github.com/bardic/pub/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-json-experiment/json"
+)
+
+func FeaturedTagsIndex(env *Env, w http.ResponseWriter, r *http.Request) error {
+	user, err := env.authenticate(r)
+	if err != nil {
+		return err
+	}
+	tags, err := featuredTags(env, r, user.Actor.ID)
+	if err != nil {
+		return err
+	}
+	return to.JSON(w, tags)
+}
+
+func FeaturedTagsCreate(env *Env, w http.ResponseWriter, r *http.Request) error {
+	user, err := env.authenticate(r)
+	if err != nil {
+		return err
+	}
+	var params struct {
+		Name string `json:"name"`
+	}
+	switch strings.Split(r.Header.Get("Content-Type"), ";")[0] {
+	case "application/x-www-form-urlencoded", "multipart/form-data":
+		params.Name = r.FormValue("name")
+	case "application/json":
+		if err := json.UnmarshalFull(r.Body, &params); err != nil {
+			return httpx.Error(http.StatusBadRequest, err)
+		}
+	default:
+		return httpx.Error(http.StatusUnsupportedMediaType, fmt.Errorf("unsupported media type"))
+	}
+	name := strings.TrimLeft(params.Name, "#")
+	if name == "" || len(name) > 64 {
+		return httpx.Error(http.StatusUnprocessableEntity, errors.New("name is invalid"))
+	}
+
+	var tag models.Tag
+	if err := env.DB.Where("name = ?", name).FirstOrCreate(&tag, models.Tag{Name: name}).Error; err != nil {
+		return err
+	}
+	var count int64
+	if err := env.DB.Model(&models.FeaturedTag{}).Where("actor_id = ? and tag_id = ?", user.Actor.ID, tag.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return httpx.Error(http.StatusUnprocessableEntity, errors.New("tag is already featured"))
+	}
+	featured := models.FeaturedTag{
+		ID:      snowflake.Now(),
+		ActorID: user.Actor.ID,
+		TagID:   tag.ID,
+		Tag:     &tag,
+	}
+	if err := env.DB.Omit("Tag").Create(&featured).Error; err != nil {
+		return err
+	}
+	serialise := Serialiser{req: r}
+	return to.JSON(w, serialise.FeaturedTag(&featured))
+}
+
+func FeaturedTagsDestroy(env *Env, w http.ResponseWriter, r *http.Request) error {
+	user, err := env.authenticate(r)
+	if err != nil {
+		return err
+	}
+	var featured models.FeaturedTag
+	if err := env.DB.Take(&featured, "id = ? and actor_id = ?", chi.URLParam(r, "id"), user.Actor.ID).Error; err != nil {
+		return httpx.Error(http.StatusNotFound, err)
+	}
+	if err := env.DB.Delete(&featured).Error; err != nil {
+		return err
+	}
+	return to.JSON(w, map[string]any{})
+}
+
+func AccountsFeaturedTagsShow(env *Env, w http.ResponseWriter, r *http.Request) error {
+	_, err := env.authenticate(r)
+	if err != nil {
+		return err
+	}
+	var actor models.Actor
+	if err := env.DB.Take(&actor, "id = ?", chi.URLParam(r, "id")).Error; err != nil {
+		return httpx.Error(http.StatusNotFound, err)
+	}
+	tags, err := featuredTags(env, r, actor.ID)
+	if err != nil {
+		return err
+	}
+	return to.JSON(w, tags)
+}
+
+// featuredTags returns the serialised featured tags of an actor, with the
+// number of statuses they have posted with each tag.
+func featuredTags(env *Env, r *http.Request, actorID snowflake.ID) ([]*FeaturedTag, error) {
+	var featured []*models.FeaturedTag
+	if err := env.DB.Preload("Tag").Order("id").Find(&featured, "actor_id = ?", actorID).Error; err != nil {
+		return nil, err
+	}
+	serialise := Serialiser{req: r}
+	tags := make([]*FeaturedTag, 0, len(featured))
+	for _, ft := range featured {
+		var stats struct {
+			Count  int
+			LastID snowflake.ID
+		}
+		query := env.DB.Table("statuses").Select("COUNT(statuses.id) AS count, COALESCE(MAX(statuses.id), 0) AS last_id")
+		query = query.Joins("JOIN status_tags ON status_tags.status_id = statuses.id")
+		if err := query.Where("statuses.actor_id = ? AND status_tags.tag_id = ?", actorID, ft.TagID).Scan(&stats).Error; err != nil {
+			return nil, err
+		}
+		tag := serialise.FeaturedTag(ft)
+		tag.StatusesCount = stats.Count
+		if stats.LastID != 0 {
+			tag.LastStatusAt = stats.LastID.ToTime().Format("2006-01-02")
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
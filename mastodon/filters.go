@@ -1,16 +1,777 @@
 package mastodon
 
 import (
+	"errors"
+	"fmt"
+	"mime"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/bardic/pub/internal/algorithms"
+	"github.com/bardic/pub/internal/httpx"
+	"github.com/bardic/pub/internal/snowflake"
 	"github.com/bardic/pub/internal/to"
+	"github.com/bardic/pub/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-json-experiment/json"
+	"gorm.io/gorm"
 )
 
+func FiltersIndexV2(env *Env, w http.ResponseWriter, r *http.Request) error {
+	user, err := env.authenticate(r)
+	if err != nil {
+		return err
+	}
+	var filters []*models.AccountFilter
+	if err := env.DB.Preload("Keywords").Preload("Statuses").Find(&filters, "account_id = ?", user.ID).Error; err != nil {
+		return err
+	}
+	serialise := Serialiser{req: r}
+	return to.JSON(w, algorithms.Map(filters, serialise.Filter))
+}
+
+func FiltersShowV2(env *Env, w http.ResponseWriter, r *http.Request) error {
+	user, err := env.authenticate(r)
+	if err != nil {
+		return err
+	}
+	filter, err := findFilter(env, user, chi.URLParam(r, "id"))
+	if err != nil {
+		return err
+	}
+	serialise := Serialiser{req: r}
+	return to.JSON(w, serialise.Filter(filter))
+}
+
+func FiltersCreateV2(env *Env, w http.ResponseWriter, r *http.Request) error {
+	user, err := env.authenticate(r)
+	if err != nil {
+		return err
+	}
+	var params filterParams
+	if err := decodeParams(r, &params, params.fromForm); err != nil {
+		return err
+	}
+	if params.Title == "" {
+		return httpx.Error(http.StatusUnprocessableEntity, errors.New("title is required"))
+	}
+	filter := models.AccountFilter{
+		ID:        snowflake.Now(),
+		AccountID: user.ID,
+		Title:     params.Title,
+		Action:    "warn",
+	}
+	if err := params.apply(&filter); err != nil {
+		return err
+	}
+	for _, kw := range params.KeywordsAttributes {
+		if kw.Keyword == "" {
+			return httpx.Error(http.StatusUnprocessableEntity, errors.New("keyword is required"))
+		}
+		filter.Keywords = append(filter.Keywords, models.AccountFilterKeyword{
+			ID:        snowflake.Now(),
+			Keyword:   kw.Keyword,
+			WholeWord: kw.WholeWord == nil || bool(*kw.WholeWord),
+		})
+	}
+	if err := env.DB.Create(&filter).Error; err != nil {
+		return err
+	}
+	serialise := Serialiser{req: r}
+	return to.JSON(w, serialise.Filter(&filter))
+}
+
+func FiltersUpdateV2(env *Env, w http.ResponseWriter, r *http.Request) error {
+	user, err := env.authenticate(r)
+	if err != nil {
+		return err
+	}
+	filter, err := findFilter(env, user, chi.URLParam(r, "id"))
+	if err != nil {
+		return err
+	}
+	var params filterParams
+	if err := decodeParams(r, &params, params.fromForm); err != nil {
+		return err
+	}
+	if params.Title != "" {
+		filter.Title = params.Title
+	}
+	if err := params.apply(filter); err != nil {
+		return err
+	}
+	err = env.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Keywords", "Statuses").Save(filter).Error; err != nil {
+			return err
+		}
+		for _, kw := range params.KeywordsAttributes {
+			if err := updateFilterKeyword(tx, filter, &kw); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	filter, err = findFilter(env, user, chi.URLParam(r, "id"))
+	if err != nil {
+		return err
+	}
+	serialise := Serialiser{req: r}
+	return to.JSON(w, serialise.Filter(filter))
+}
+
+// updateFilterKeyword creates, updates or, if it is marked for destruction, deletes
+// a keyword of filter.
+func updateFilterKeyword(tx *gorm.DB, filter *models.AccountFilter, params *filterKeywordParams) error {
+	if params.ID == 0 {
+		if params.Keyword == "" {
+			return httpx.Error(http.StatusUnprocessableEntity, errors.New("keyword is required"))
+		}
+		return tx.Create(&models.AccountFilterKeyword{
+			ID:              snowflake.Now(),
+			AccountFilterID: filter.ID,
+			Keyword:         params.Keyword,
+			WholeWord:       params.WholeWord == nil || bool(*params.WholeWord),
+		}).Error
+	}
+	var kw models.AccountFilterKeyword
+	if err := tx.Take(&kw, "id = ? and account_filter_id = ?", params.ID, filter.ID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return httpx.Error(http.StatusNotFound, err)
+		}
+		return err
+	}
+	if params.Destroy {
+		return tx.Delete(&kw).Error
+	}
+	if params.Keyword != "" {
+		kw.Keyword = params.Keyword
+	}
+	if params.WholeWord != nil {
+		kw.WholeWord = bool(*params.WholeWord)
+	}
+	return tx.Save(&kw).Error
+}
+
+func FiltersDestroyV2(env *Env, w http.ResponseWriter, r *http.Request) error {
+	user, err := env.authenticate(r)
+	if err != nil {
+		return err
+	}
+	filter, err := findFilter(env, user, chi.URLParam(r, "id"))
+	if err != nil {
+		return err
+	}
+	if err := env.DB.Delete(filter).Error; err != nil {
+		return err
+	}
+	return to.JSON(w, map[string]any{})
+}
+
+func FilterKeywordsIndex(env *Env, w http.ResponseWriter, r *http.Request) error {
+	user, err := env.authenticate(r)
+	if err != nil {
+		return err
+	}
+	filter, err := findFilter(env, user, chi.URLParam(r, "id"))
+	if err != nil {
+		return err
+	}
+	serialise := Serialiser{req: r}
+	return to.JSON(w, algorithms.Map(filter.Keywords, func(kw models.AccountFilterKeyword) *FilterKeyword {
+		return serialise.FilterKeyword(&kw)
+	}))
+}
+
+func FilterKeywordsCreate(env *Env, w http.ResponseWriter, r *http.Request) error {
+	user, err := env.authenticate(r)
+	if err != nil {
+		return err
+	}
+	filter, err := findFilter(env, user, chi.URLParam(r, "id"))
+	if err != nil {
+		return err
+	}
+	var params filterKeywordParams
+	if err := decodeParams(r, &params, params.fromForm); err != nil {
+		return err
+	}
+	if params.Keyword == "" {
+		return httpx.Error(http.StatusUnprocessableEntity, errors.New("keyword is required"))
+	}
+	kw := models.AccountFilterKeyword{
+		ID:              snowflake.Now(),
+		AccountFilterID: filter.ID,
+		Keyword:         params.Keyword,
+		WholeWord:       params.WholeWord == nil || bool(*params.WholeWord),
+	}
+	if err := env.DB.Create(&kw).Error; err != nil {
+		return err
+	}
+	serialise := Serialiser{req: r}
+	return to.JSON(w, serialise.FilterKeyword(&kw))
+}
+
+func FilterKeywordsShow(env *Env, w http.ResponseWriter, r *http.Request) error {
+	user, err := env.authenticate(r)
+	if err != nil {
+		return err
+	}
+	kw, err := findFilterKeyword(env, user, chi.URLParam(r, "id"))
+	if err != nil {
+		return err
+	}
+	serialise := Serialiser{req: r}
+	return to.JSON(w, serialise.FilterKeyword(kw))
+}
+
+func FilterKeywordsUpdate(env *Env, w http.ResponseWriter, r *http.Request) error {
+	user, err := env.authenticate(r)
+	if err != nil {
+		return err
+	}
+	kw, err := findFilterKeyword(env, user, chi.URLParam(r, "id"))
+	if err != nil {
+		return err
+	}
+	var params filterKeywordParams
+	if err := decodeParams(r, &params, params.fromForm); err != nil {
+		return err
+	}
+	if params.Keyword != "" {
+		kw.Keyword = params.Keyword
+	}
+	if params.WholeWord != nil {
+		kw.WholeWord = bool(*params.WholeWord)
+	}
+	if err := env.DB.Omit("AccountFilter").Save(kw).Error; err != nil {
+		return err
+	}
+	serialise := Serialiser{req: r}
+	return to.JSON(w, serialise.FilterKeyword(kw))
+}
+
+func FilterKeywordsDestroy(env *Env, w http.ResponseWriter, r *http.Request) error {
+	user, err := env.authenticate(r)
+	if err != nil {
+		return err
+	}
+	kw, err := findFilterKeyword(env, user, chi.URLParam(r, "id"))
+	if err != nil {
+		return err
+	}
+	if err := env.DB.Delete(kw).Error; err != nil {
+		return err
+	}
+	return to.JSON(w, map[string]any{})
+}
+
+func FilterStatusesIndex(env *Env, w http.ResponseWriter, r *http.Request) error {
+	user, err := env.authenticate(r)
+	if err != nil {
+		return err
+	}
+	filter, err := findFilter(env, user, chi.URLParam(r, "id"))
+	if err != nil {
+		return err
+	}
+	serialise := Serialiser{req: r}
+	return to.JSON(w, algorithms.Map(filter.Statuses, func(fs models.AccountFilterStatus) *FilterStatus {
+		return serialise.FilterStatus(&fs)
+	}))
+}
+
+func FilterStatusesCreate(env *Env, w http.ResponseWriter, r *http.Request) error {
+	user, err := env.authenticate(r)
+	if err != nil {
+		return err
+	}
+	filter, err := findFilter(env, user, chi.URLParam(r, "id"))
+	if err != nil {
+		return err
+	}
+	var params struct {
+		StatusID snowflake.ID `json:"status_id,string"`
+	}
+	err = decodeParams(r, &params, func(form url.Values) error {
+		id, err := snowflake.Parse(form.Get("status_id"))
+		params.StatusID = id
+		return err
+	})
+	if err != nil {
+		return httpx.Error(http.StatusBadRequest, err)
+	}
+	var status models.Status
+	if err := env.DB.Take(&status, params.StatusID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return httpx.Error(http.StatusNotFound, err)
+		}
+		return err
+	}
+	fs := models.AccountFilterStatus{
+		ID:              snowflake.Now(),
+		AccountFilterID: filter.ID,
+		StatusID:        status.ID,
+	}
+	if err := env.DB.Create(&fs).Error; err != nil {
+		return err
+	}
+	serialise := Serialiser{req: r}
+	return to.JSON(w, serialise.FilterStatus(&fs))
+}
+
+func FilterStatusesShow(env *Env, w http.ResponseWriter, r *http.Request) error {
+	user, err := env.authenticate(r)
+	if err != nil {
+		return err
+	}
+	fs, err := findFilterStatus(env, user, chi.URLParam(r, "id"))
+	if err != nil {
+		return err
+	}
+	serialise := Serialiser{req: r}
+	return to.JSON(w, serialise.FilterStatus(fs))
+}
+
+func FilterStatusesDestroy(env *Env, w http.ResponseWriter, r *http.Request) error {
+	user, err := env.authenticate(r)
+	if err != nil {
+		return err
+	}
+	fs, err := findFilterStatus(env, user, chi.URLParam(r, "id"))
+	if err != nil {
+		return err
+	}
+	if err := env.DB.Delete(fs).Error; err != nil {
+		return err
+	}
+	return to.JSON(w, map[string]any{})
+}
+
+// FiltersIndex returns the keywords of the account's filters as v1 filters.
+// The v1 API predates filters with several keywords; each of its filters is a
+// keyword, and the context, expiry and action of the filter it belongs to.
 func FiltersIndex(env *Env, w http.ResponseWriter, r *http.Request) error {
-	_, err := env.authenticate(r)
+	user, err := env.authenticate(r)
 	if err != nil {
 		return err
 	}
+	var keywords []*models.AccountFilterKeyword
+	if err := env.DB.Joins("AccountFilter").Find(&keywords, "AccountFilter.account_id = ?", user.ID).Error; err != nil {
+		return err
+	}
+	serialise := Serialiser{req: r}
+	return to.JSON(w, algorithms.Map(keywords, serialise.V1Filter))
+}
 
-	return to.JSON(w, []map[string]any{})
+func FiltersShow(env *Env, w http.ResponseWriter, r *http.Request) error {
+	user, err := env.authenticate(r)
+	if err != nil {
+		return err
+	}
+	kw, err := findFilterKeyword(env, user, chi.URLParam(r, "id"))
+	if err != nil {
+		return err
+	}
+	serialise := Serialiser{req: r}
+	return to.JSON(w, serialise.V1Filter(kw))
+}
+
+// FiltersCreate creates a filter with a single keyword, the v1 filter's phrase.
+func FiltersCreate(env *Env, w http.ResponseWriter, r *http.Request) error {
+	user, err := env.authenticate(r)
+	if err != nil {
+		return err
+	}
+	var params v1FilterParams
+	if err := decodeParams(r, &params, params.fromForm); err != nil {
+		return err
+	}
+	if params.Phrase == "" {
+		return httpx.Error(http.StatusUnprocessableEntity, errors.New("phrase is required"))
+	}
+	filter := models.AccountFilter{
+		ID:        snowflake.Now(),
+		AccountID: user.ID,
+		Title:     params.Phrase,
+	}
+	if err := params.apply(&filter); err != nil {
+		return err
+	}
+	filter.Keywords = []models.AccountFilterKeyword{{
+		ID:        snowflake.Now(),
+		Keyword:   params.Phrase,
+		WholeWord: params.WholeWord == nil || bool(*params.WholeWord),
+	}}
+	if err := env.DB.Create(&filter).Error; err != nil {
+		return err
+	}
+	kw := filter.Keywords[0]
+	kw.AccountFilter = &filter
+	serialise := Serialiser{req: r}
+	return to.JSON(w, serialise.V1Filter(&kw))
+}
+
+// FiltersUpdate updates a v1 filter; its phrase and whole word option update the
+// keyword, the remainder update the filter the keyword belongs to.
+func FiltersUpdate(env *Env, w http.ResponseWriter, r *http.Request) error {
+	user, err := env.authenticate(r)
+	if err != nil {
+		return err
+	}
+	kw, err := findFilterKeyword(env, user, chi.URLParam(r, "id"))
+	if err != nil {
+		return err
+	}
+	var params v1FilterParams
+	if err := decodeParams(r, &params, params.fromForm); err != nil {
+		return err
+	}
+	if params.Phrase != "" {
+		kw.Keyword = params.Phrase
+	}
+	if params.WholeWord != nil {
+		kw.WholeWord = bool(*params.WholeWord)
+	}
+	if err := params.apply(kw.AccountFilter); err != nil {
+		return err
+	}
+	err = env.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Keywords", "Statuses").Save(kw.AccountFilter).Error; err != nil {
+			return err
+		}
+		return tx.Omit("AccountFilter").Save(kw).Error
+	})
+	if err != nil {
+		return err
+	}
+	serialise := Serialiser{req: r}
+	return to.JSON(w, serialise.V1Filter(kw))
+}
+
+func FiltersDestroy(env *Env, w http.ResponseWriter, r *http.Request) error {
+	user, err := env.authenticate(r)
+	if err != nil {
+		return err
+	}
+	kw, err := findFilterKeyword(env, user, chi.URLParam(r, "id"))
+	if err != nil {
+		return err
+	}
+	if err := env.DB.Delete(kw).Error; err != nil {
+		return err
+	}
+	return to.JSON(w, map[string]any{})
+}
+
+// findFilter returns the filter of user with id, and its keywords and statuses.
+func findFilter(env *Env, user *models.Account, id string) (*models.AccountFilter, error) {
+	var filter models.AccountFilter
+	if err := env.DB.Preload("Keywords").Preload("Statuses").Take(&filter, "id = ? and account_id = ?", id, user.ID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, httpx.Error(http.StatusNotFound, err)
+		}
+		return nil, err
+	}
+	return &filter, nil
+}
+
+// findFilterKeyword returns the keyword with id of one of user's filters, and
+// the filter it belongs to.
+func findFilterKeyword(env *Env, user *models.Account, id string) (*models.AccountFilterKeyword, error) {
+	var kw models.AccountFilterKeyword
+	if err := env.DB.Joins("AccountFilter").Take(&kw, "account_filter_keywords.id = ? and AccountFilter.account_id = ?", id, user.ID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, httpx.Error(http.StatusNotFound, err)
+		}
+		return nil, err
+	}
+	return &kw, nil
+}
+
+// findFilterStatus returns the status with id of one of user's filters.
+func findFilterStatus(env *Env, user *models.Account, id string) (*models.AccountFilterStatus, error) {
+	var fs models.AccountFilterStatus
+	if err := env.DB.Joins("AccountFilter").Take(&fs, "account_filter_statuses.id = ? and AccountFilter.account_id = ?", id, user.ID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, httpx.Error(http.StatusNotFound, err)
+		}
+		return nil, err
+	}
+	return &fs, nil
+}
+
+type filterParams struct {
+	Title              string                `json:"title"`
+	Context            []string              `json:"context"`
+	FilterAction       string                `json:"filter_action"`
+	ExpiresIn          any                   `json:"expires_in"`
+	KeywordsAttributes []filterKeywordParams `json:"keywords_attributes"`
+}
+
+// fromForm decodes form parameters; nested attributes are sent in the Rails style,
+// either indexed, keywords_attributes[0][keyword]=foo&keywords_attributes[0][whole_word]=false,
+// or not, keywords_attributes[][keyword]=foo&keywords_attributes[][whole_word]=false.
+func (p *filterParams) fromForm(form url.Values) error {
+	p.Title = form.Get("title")
+	p.Context = form["context[]"]
+	p.FilterAction = form.Get("filter_action")
+	if form.Has("expires_in") {
+		p.ExpiresIn = form.Get("expires_in")
+	}
+	entries, err := nestedAttributes(form, "keywords_attributes")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		var kw filterKeywordParams
+		if entry.Has("id") {
+			id, err := snowflake.Parse(entry.Get("id"))
+			if err != nil {
+				return httpx.Error(http.StatusBadRequest, err)
+			}
+			kw.ID = id
+		}
+		if err := kw.fromForm(entry); err != nil {
+			return err
+		}
+		kw.Destroy = BoolOrBit(entry.Get("_destroy") == "true" || entry.Get("_destroy") == "1")
+		p.KeywordsAttributes = append(p.KeywordsAttributes, kw)
+	}
+	return nil
+}
+
+// nestedAttributes returns the entries of the Rails style nested attributes
+// name[index][field] in form, ordered by index. url.Values does not keep the
+// order of different keys, so unindexed entries, name[][field], can only be told
+// apart if each of them has the same fields; they come before the indexed entries.
+func nestedAttributes(form url.Values, name string) ([]url.Values, error) {
+	unindexed := make(url.Values)
+	indexed := make(map[string]url.Values)
+	for key, values := range form {
+		rest, ok := strings.CutPrefix(key, name+"[")
+		if !ok {
+			continue
+		}
+		index, field, ok := strings.Cut(rest, "][")
+		if !ok || !strings.HasSuffix(field, "]") {
+			continue
+		}
+		field = strings.TrimSuffix(field, "]")
+		if index == "" {
+			unindexed[field] = values
+			continue
+		}
+		if indexed[index] == nil {
+			indexed[index] = make(url.Values)
+		}
+		// an indexed field has one value; take the last, as Rails does.
+		indexed[index].Set(field, values[len(values)-1])
+	}
+
+	n := -1
+	for field, values := range unindexed {
+		if n >= 0 && len(values) != n {
+			return nil, httpx.Error(http.StatusUnprocessableEntity, fmt.Errorf("%s[][%s]: entries have different fields, index them as %s[0][%s]", name, field, name, field))
+		}
+		n = len(values)
+	}
+	var entries []url.Values
+	for i := 0; i < n; i++ {
+		entry := make(url.Values)
+		for field, values := range unindexed {
+			entry.Set(field, values[i])
+		}
+		entries = append(entries, entry)
+	}
+
+	indexes := make([]string, 0, len(indexed))
+	for index := range indexed {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		a, aerr := strconv.Atoi(indexes[i])
+		b, berr := strconv.Atoi(indexes[j])
+		switch {
+		case aerr == nil && berr == nil:
+			return a < b
+		case aerr == nil || berr == nil:
+			// numbered entries come first.
+			return aerr == nil
+		default:
+			return indexes[i] < indexes[j]
+		}
+	})
+	for _, index := range indexes {
+		entries = append(entries, indexed[index])
+	}
+	return entries, nil
+}
+
+// apply sets the context, action and expiry of filter, if they are present.
+func (p *filterParams) apply(filter *models.AccountFilter) error {
+	if len(p.Context) > 0 || len(filter.Contexts()) == 0 {
+		if err := filter.SetContexts(p.Context); err != nil {
+			return httpx.Error(http.StatusUnprocessableEntity, err)
+		}
+	}
+	switch p.FilterAction {
+	case "":
+		// unchanged
+	case "warn", "hide":
+		filter.Action = models.FilterAction(p.FilterAction)
+	default:
+		return httpx.Error(http.StatusUnprocessableEntity, fmt.Errorf("invalid filter_action: %q", p.FilterAction))
+	}
+	return applyExpiresIn(filter, p.ExpiresIn)
+}
+
+type filterKeywordParams struct {
+	ID        snowflake.ID `json:"id,string"`
+	Keyword   string       `json:"keyword"`
+	WholeWord *BoolOrBit   `json:"whole_word"`
+	Destroy   BoolOrBit    `json:"_destroy"`
+}
+
+func (p *filterKeywordParams) fromForm(form url.Values) error {
+	p.Keyword = form.Get("keyword")
+	if form.Has("whole_word") {
+		b := BoolOrBit(form.Get("whole_word") == "true" || form.Get("whole_word") == "1")
+		p.WholeWord = &b
+	}
+	return nil
+}
+
+type v1FilterParams struct {
+	Phrase       string     `json:"phrase"`
+	Context      []string   `json:"context"`
+	Irreversible *BoolOrBit `json:"irreversible"`
+	WholeWord    *BoolOrBit `json:"whole_word"`
+	ExpiresIn    any        `json:"expires_in"`
+}
+
+func (p *v1FilterParams) fromForm(form url.Values) error {
+	p.Phrase = form.Get("phrase")
+	p.Context = form["context[]"]
+	if form.Has("irreversible") {
+		b := BoolOrBit(form.Get("irreversible") == "true" || form.Get("irreversible") == "1")
+		p.Irreversible = &b
+	}
+	if form.Has("whole_word") {
+		b := BoolOrBit(form.Get("whole_word") == "true" || form.Get("whole_word") == "1")
+		p.WholeWord = &b
+	}
+	if form.Has("expires_in") {
+		p.ExpiresIn = form.Get("expires_in")
+	}
+	return nil
+}
+
+// apply sets the context, action and expiry of filter, if they are present.
+// Irreversible v1 filters hide the statuses they match.
+func (p *v1FilterParams) apply(filter *models.AccountFilter) error {
+	if len(p.Context) > 0 || len(filter.Contexts()) == 0 {
+		if err := filter.SetContexts(p.Context); err != nil {
+			return httpx.Error(http.StatusUnprocessableEntity, err)
+		}
+	}
+	switch {
+	case p.Irreversible != nil && bool(*p.Irreversible):
+		filter.Action = "hide"
+	case p.Irreversible != nil, filter.Action == "":
+		filter.Action = "warn"
+	}
+	return applyExpiresIn(filter, p.ExpiresIn)
+}
+
+// applyExpiresIn sets the expiry of filter to expiresIn seconds from now. An
+// empty expiresIn removes the expiry, a missing one leaves it unchanged.
+func applyExpiresIn(filter *models.AccountFilter, expiresIn any) error {
+	var seconds int
+	switch v := expiresIn.(type) {
+	case nil:
+		return nil
+	case float64:
+		seconds = int(v)
+	case string:
+		if v == "" {
+			filter.ExpiresAt = nil
+			return nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return httpx.Error(http.StatusUnprocessableEntity, fmt.Errorf("invalid expires_in: %w", err))
+		}
+		seconds = n
+	default:
+		return httpx.Error(http.StatusUnprocessableEntity, fmt.Errorf("invalid expires_in: %v", v))
+	}
+	if seconds <= 0 {
+		return httpx.Error(http.StatusUnprocessableEntity, fmt.Errorf("invalid expires_in: %d", seconds))
+	}
+	expiresAt := time.Now().Add(time.Duration(seconds) * time.Second)
+	filter.ExpiresAt = &expiresAt
+	return nil
+}
+
+// decodeParams decodes a JSON request body into v. Form parameters, and the query
+// parameters of requests without a Content-Type, are passed to fromForm.
+// httpx.Params is not used as gorilla/schema cannot decode Rails style nested
+// attributes.
+func decodeParams(r *http.Request, v any, fromForm func(url.Values) error) error {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil && r.Header.Get("Content-Type") != "" {
+		return httpx.Error(http.StatusBadRequest, err)
+	}
+	switch mt {
+	case "application/json":
+		if err := json.UnmarshalFull(r.Body, v); err != nil {
+			return httpx.Error(http.StatusBadRequest, err)
+		}
+		return nil
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(0); err != nil {
+			return httpx.Error(http.StatusBadRequest, err)
+		}
+	case "application/x-www-form-urlencoded", "":
+		if err := r.ParseForm(); err != nil {
+			return httpx.Error(http.StatusBadRequest, err)
+		}
+	default:
+		return httpx.Error(http.StatusUnsupportedMediaType, fmt.Errorf("unsupported media type: %q", mt))
+	}
+	return fromForm(r.Form)
+}
+
+// filter returns statuses without those hidden by the active filters of user in
+// context, and a Serialiser which attaches the results of the filters to the
+// statuses which remain.
+func filter(env *Env, r *http.Request, user *models.Account, context models.FilterContext, statuses []*models.Status) ([]*models.Status, Serialiser, error) {
+	filters, err := models.NewAccountFilters(env.DB).Active(user, context)
+	if err != nil {
+		return nil, Serialiser{}, err
+	}
+	visible := algorithms.Filter(statuses, func(st *models.Status) bool {
+		return !hidden(filters, st)
+	})
+	return visible, Serialiser{req: r, filters: filters}, nil
+}
+
+// hidden reports whether any of filters whose action is hide matches st.
+func hidden(filters []*models.AccountFilter, st *models.Status) bool {
+	for _, f := range filters {
+		if f.Action != "hide" {
+			continue
+		}
+		if keywords, statuses := f.Match(st); len(keywords) > 0 || len(statuses) > 0 {
+			return true
+		}
+	}
+	return false
 }
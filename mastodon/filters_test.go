@@ -0,0 +1,136 @@
+package mastodon
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bardic/pub/internal/snowflake"
+	"github.com/bardic/pub/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestFilterParamsFromForm(t *testing.T) {
+	t.Run("indexed entries are kept apart and ordered by index", func(t *testing.T) {
+		require := require.New(t)
+		var p filterParams
+		require.NoError(p.fromForm(url.Values{
+			"keywords_attributes[10][keyword]":    {"third"},
+			"keywords_attributes[2][keyword]":     {"second"},
+			"keywords_attributes[2][_destroy]":    {"true"},
+			"keywords_attributes[2][id]":          {"110330528023225442"},
+			"keywords_attributes[0][keyword]":     {"first"},
+			"keywords_attributes[10][whole_word]": {"false"},
+		}))
+		require.Len(p.KeywordsAttributes, 3)
+		require.Equal("first", p.KeywordsAttributes[0].Keyword)
+		require.Nil(p.KeywordsAttributes[0].WholeWord)
+		require.Equal("second", p.KeywordsAttributes[1].Keyword)
+		require.Equal(snowflake.ID(110330528023225442), p.KeywordsAttributes[1].ID)
+		require.True(bool(p.KeywordsAttributes[1].Destroy))
+		require.Equal("third", p.KeywordsAttributes[2].Keyword)
+		require.False(bool(*p.KeywordsAttributes[2].WholeWord))
+		require.False(bool(p.KeywordsAttributes[2].Destroy))
+	})
+
+	t.Run("unindexed entries must have the same fields", func(t *testing.T) {
+		require := require.New(t)
+		var p filterParams
+		require.NoError(p.fromForm(url.Values{
+			"keywords_attributes[][keyword]":    {"foo", "bar"},
+			"keywords_attributes[][whole_word]": {"false", "true"},
+		}))
+		require.Len(p.KeywordsAttributes, 2)
+		require.Equal("bar", p.KeywordsAttributes[1].Keyword)
+		require.True(bool(*p.KeywordsAttributes[1].WholeWord))
+
+		p = filterParams{}
+		require.Error(p.fromForm(url.Values{
+			"keywords_attributes[][keyword]":    {"foo", "bar"},
+			"keywords_attributes[][whole_word]": {"false"},
+		}))
+	})
+}
+
+func TestFiltersUpdateV2(t *testing.T) {
+	db := setupTestDB(t)
+
+	// setup creates alice, her access token, and her filter with the keyword "spoiler".
+	setup := func(t *testing.T, tx *gorm.DB) (*models.AccountFilter, string) {
+		t.Helper()
+		require := require.New(t)
+		instance, err := models.NewInstances(tx).Create("example.com", "Example", "Example instance", "admin@example.com")
+		require.NoError(err)
+		alice, err := models.NewAccounts(tx).Create(instance, "alice", "alice@example.com", "password")
+		require.NoError(err)
+		app := &models.Application{ID: snowflake.Now(), InstanceID: instance.ID, Name: "test", ClientID: "id", ClientSecret: "secret"}
+		require.NoError(tx.Create(app).Error)
+		require.NoError(tx.Create(&models.Token{AccessToken: "token", AccountID: &alice.ID, ApplicationID: app.ID, TokenType: "Bearer"}).Error)
+		filter := &models.AccountFilter{
+			ID:          snowflake.Now(),
+			AccountID:   alice.ID,
+			Title:       "spoilers",
+			ContextHome: true,
+			Action:      "warn",
+			Keywords: []models.AccountFilterKeyword{
+				{ID: snowflake.Now(), Keyword: "spoiler", WholeWord: true},
+			},
+		}
+		require.NoError(tx.Create(filter).Error)
+		return filter, "token"
+	}
+
+	t.Run("keywords are updated, created and destroyed from a form", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		filter, token := setup(t, tx)
+		existing := strconv.FormatUint(uint64(filter.Keywords[0].ID), 10)
+		form := url.Values{
+			"title":                              {"spoilers"},
+			"keywords_attributes[0][id]":         {existing},
+			"keywords_attributes[0][whole_word]": {"false"},
+			"keywords_attributes[1][keyword]":    {"ending"},
+			"keywords_attributes[2][keyword]":    {"finale"},
+			"keywords_attributes[2][whole_word]": {"true"},
+		}
+		r := httptest.NewRequest("PUT", "https://example.com/api/v2/filters/"+fmt.Sprint(filter.ID), strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Authorization", "Bearer "+token)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", fmt.Sprint(filter.ID))
+		r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+		require.NoError(FiltersUpdateV2(&Env{DB: tx}, w, r))
+		require.Equal(http.StatusOK, w.Code)
+
+		var keywords []models.AccountFilterKeyword
+		require.NoError(tx.Order("keyword").Find(&keywords, "account_filter_id = ?", filter.ID).Error)
+		require.Len(keywords, 3)
+		require.Equal("ending", keywords[0].Keyword)
+		require.True(keywords[0].WholeWord)
+		require.Equal("finale", keywords[1].Keyword)
+		require.True(keywords[1].WholeWord)
+		require.Equal("spoiler", keywords[2].Keyword)
+		require.False(keywords[2].WholeWord)
+
+		form = url.Values{
+			"keywords_attributes[0][id]":       {existing},
+			"keywords_attributes[0][_destroy]": {"1"},
+		}
+		r = httptest.NewRequest("PUT", "https://example.com/api/v2/filters/"+fmt.Sprint(filter.ID), strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Authorization", "Bearer "+token)
+		r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+		require.NoError(FiltersUpdateV2(&Env{DB: tx}, httptest.NewRecorder(), r))
+		require.ErrorIs(tx.Take(&models.AccountFilterKeyword{}, "id = ?", existing).Error, gorm.ErrRecordNotFound)
+	})
+}
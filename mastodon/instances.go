@@ -1,7 +1,10 @@
 package mastodon
 
 import (
+	"crypto/sha256"
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/bardic/pub/internal/algorithms"
 	"github.com/bardic/pub/internal/httpx"
@@ -99,7 +102,8 @@ func instancesIndex(env *Env, w http.ResponseWriter, r *http.Request, serialiser
 
 func InstancesPeersShow(env *Env, w http.ResponseWriter, r *http.Request) error {
 	var domains []string
-	if err := env.DB.Model(&models.Peer{}).Group("Domain").Where("Domain != ?", r.Host).Pluck("domain", &domains).Error; err != nil {
+	local := env.DB.Model(&models.Instance{}).Select("domain")
+	if err := env.DB.Model(&models.Peer{}).Where("domain NOT IN (?)", local).Order("domain").Pluck("domain", &domains).Error; err != nil {
 		return err
 	}
 	return to.JSON(w, domains)
@@ -193,10 +197,42 @@ func urls(i *models.Instance) any {
 	}
 }
 
+// InstancesActivityShow serves the weekly activity of the instance, most recent week first.
 func InstancesActivityShow(env *Env, w http.ResponseWriter, r *http.Request) error {
-	return to.JSON(w, []map[string]interface{}{})
+	var instance models.Instance
+	if err := env.DB.Where("domain = ?", r.Host).Take(&instance).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return httpx.Error(http.StatusNotFound, err)
+		}
+		return err
+	}
+	activity, err := models.NewInstances(env.DB).Activity(&instance)
+	if err != nil {
+		return err
+	}
+	return to.JSON(w, algorithms.Map(activity, func(a *models.InstanceActivity) map[string]any {
+		return map[string]any{
+			"week":          strconv.FormatInt(a.Week.Unix(), 10),
+			"statuses":      strconv.Itoa(a.Statuses),
+			"logins":        strconv.Itoa(a.Logins),
+			"registrations": strconv.Itoa(a.Registrations),
+		}
+	}))
 }
 
+// InstancesDomainBlocksShow serves the list of blocked domains. Obfuscated domains are
+// partially hidden, their digest can be compared with the SHA256 of a known domain.
 func InstancesDomainBlocksShow(env *Env, w http.ResponseWriter, r *http.Request) error {
-	return to.JSON(w, []map[string]interface{}{})
+	var blocks []*models.DomainBlock
+	if err := env.DB.Order("domain").Find(&blocks).Error; err != nil {
+		return err
+	}
+	return to.JSON(w, algorithms.Map(blocks, func(b *models.DomainBlock) map[string]any {
+		return map[string]any{
+			"domain":   b.PublicDomain(),
+			"digest":   fmt.Sprintf("%x", sha256.Sum256([]byte(b.Domain))),
+			"severity": b.Severity,
+			"comment":  b.PublicComment,
+		}
+	}))
 }
@@ -8,6 +8,7 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/bardic/pub/activitypub"
 	"github.com/bardic/pub/internal/httpx"
 	"github.com/bardic/pub/internal/snowflake"
 	"github.com/bardic/pub/internal/streaming"
@@ -20,6 +21,8 @@ type Env struct {
 	*gorm.DB
 	*streaming.Mux
 	Logger *slog.Logger
+	// Policies are applied to statuses fetched while handling a request.
+	Policies []activitypub.Policy
 }
 
 func (e *Env) Log() *slog.Logger {
@@ -6,7 +6,11 @@ import (
 	"testing"
 
 	"github.com/bardic/pub/internal/snowflake"
+	"github.com/bardic/pub/models"
 	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
 func TestLinkHeader(t *testing.T) {
@@ -25,3 +29,16 @@ func TestLinkHeader(t *testing.T) {
 		`<https://example.com/api/v1/timelines/public?max_id=110330528023225442>; rel="next", <https://example.com/api/v1/timelines/public?min_id=110330528023226442>; rel="prev"`,
 	})
 }
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	require := require.New(t)
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{
+		TranslateError: true,
+		Logger:         logger.Default.LogMode(logger.Warn),
+	})
+	require.NoError(err)
+	require.NoError(db.AutoMigrate(models.AllTables()...))
+	require.NoError(db.Exec("PRAGMA foreign_keys = ON").Error)
+	return db
+}
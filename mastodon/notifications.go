@@ -2,14 +2,117 @@ package mastodon
 
 import (
 	"net/http"
+	"sort"
 
+	"github.com/bardic/pub/internal/algorithms"
+	"github.com/bardic/pub/internal/httpx"
 	"github.com/bardic/pub/internal/to"
+	"github.com/bardic/pub/models"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
 )
 
 func NotificationsIndex(env *Env, w http.ResponseWriter, r *http.Request) error {
-	_, err := env.authenticate(r)
+	user, err := env.authenticate(r)
 	if err != nil {
 		return err
 	}
-	return to.JSON(w, []map[string]any{})
+	q := r.URL.Query()
+	query := env.DB.Scopes(models.PaginateNotifications(r), preloadNotification(user.Actor)).Where("account_id = ?", user.ID)
+	if types := q["types[]"]; len(types) > 0 {
+		query = query.Where("type IN ?", types)
+	}
+	if excludeTypes := q["exclude_types[]"]; len(excludeTypes) > 0 {
+		query = query.Where("type NOT IN ?", excludeTypes)
+	}
+	if accountID := q.Get("account_id"); accountID != "" {
+		query = query.Where("from_actor_id = ?", accountID)
+	}
+	var notifications []*models.Notification
+	if err := query.Find(&notifications).Error; err != nil {
+		return err
+	}
+
+	// PaginateNotifications may sort ascending, clients expect descending.
+	sort.SliceStable(notifications, func(i, j int) bool {
+		return notifications[i].ID > notifications[j].ID
+	})
+	if len(notifications) > 0 {
+		linkHeader(w, r, notifications[0].ID, notifications[len(notifications)-1].ID)
+	}
+	filters, err := models.NewAccountFilters(env.DB).Active(user, "notifications")
+	if err != nil {
+		return err
+	}
+	notifications = algorithms.Filter(notifications, func(n *models.Notification) bool {
+		return n.Status == nil || !hidden(filters, n.Status)
+	})
+	serialise := Serialiser{req: r, filters: filters}
+	return to.JSON(w, algorithms.Map(notifications, serialise.Notification))
+}
+
+func NotificationsShow(env *Env, w http.ResponseWriter, r *http.Request) error {
+	user, err := env.authenticate(r)
+	if err != nil {
+		return err
+	}
+	var notification models.Notification
+	query := env.DB.Scopes(preloadNotification(user.Actor)).Where("account_id = ?", user.ID)
+	if err := query.Take(&notification, chi.URLParam(r, "id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return httpx.Error(http.StatusNotFound, err)
+		}
+		return err
+	}
+	serialise := Serialiser{req: r}
+	return to.JSON(w, serialise.Notification(&notification))
+}
+
+func NotificationsDismiss(env *Env, w http.ResponseWriter, r *http.Request) error {
+	user, err := env.authenticate(r)
+	if err != nil {
+		return err
+	}
+	if err := env.DB.Where("account_id = ? and id = ?", user.ID, chi.URLParam(r, "id")).Delete(&models.Notification{}).Error; err != nil {
+		return err
+	}
+	return to.JSON(w, map[string]any{})
+}
+
+func NotificationsClear(env *Env, w http.ResponseWriter, r *http.Request) error {
+	user, err := env.authenticate(r)
+	if err != nil {
+		return err
+	}
+	if err := env.DB.Where("account_id = ?", user.ID).Delete(&models.Notification{}).Error; err != nil {
+		return err
+	}
+	return to.JSON(w, map[string]any{})
+}
+
+// NotificationsUnreadCount returns the number of notifications newer than the
+// account's notifications marker.
+func NotificationsUnreadCount(env *Env, w http.ResponseWriter, r *http.Request) error {
+	user, err := env.authenticate(r)
+	if err != nil {
+		return err
+	}
+	count, err := models.NewNotifications(env.DB).UnreadCount(user)
+	if err != nil {
+		return err
+	}
+	return to.JSON(w, map[string]any{
+		"count": count,
+	})
+}
+
+// preloadNotification preloads the actor and status of a notification, and
+// actor's reaction to the status.
+func preloadNotification(actor *models.Actor) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Preload("FromActor").Preload("FromActor.Attributes").
+			Preload("Status", func(db *gorm.DB) *gorm.DB {
+				return db.Scopes(models.PreloadStatus, models.PreloadReaction(actor))
+			})
+	}
 }
@@ -0,0 +1,68 @@
+package mastodon
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bardic/pub/internal/httpx"
+	"github.com/bardic/pub/internal/to"
+	"github.com/bardic/pub/models"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+func PinsCreate(env *Env, w http.ResponseWriter, r *http.Request) error {
+	user, err := env.authenticate(r)
+	if err != nil {
+		return err
+	}
+	status, err := pinnableStatus(env, r, user.Actor)
+	if err != nil {
+		return err
+	}
+	reaction, err := models.NewReactions(env.DB).Pin(status, user.Actor)
+	if err != nil {
+		return err
+	}
+	serialise := Serialiser{req: r}
+	return to.JSON(w, serialise.Status(reaction.Status))
+}
+
+func PinsDestroy(env *Env, w http.ResponseWriter, r *http.Request) error {
+	user, err := env.authenticate(r)
+	if err != nil {
+		return err
+	}
+	status, err := pinnableStatus(env, r, user.Actor)
+	if err != nil {
+		return err
+	}
+	reaction, err := models.NewReactions(env.DB).Unpin(status, user.Actor)
+	if err != nil {
+		return err
+	}
+	serialise := Serialiser{req: r}
+	return to.JSON(w, serialise.Status(reaction.Status))
+}
+
+// pinnableStatus returns the status named in the request if actor may pin it.
+// Actors may only pin their own public or unlisted statuses.
+func pinnableStatus(env *Env, r *http.Request, actor *models.Actor) (*models.Status, error) {
+	var status models.Status
+	query := env.DB.Joins("Actor").Scopes(models.PreloadStatus, models.PreloadReaction(actor))
+	if err := query.Take(&status, chi.URLParam(r, "id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, httpx.Error(http.StatusNotFound, err)
+		}
+		return nil, err
+	}
+	if status.ActorID != actor.ID {
+		return nil, httpx.Error(http.StatusUnprocessableEntity, errors.New("cannot pin another account's status"))
+	}
+	switch status.Visibility {
+	case "public", "unlisted":
+		return &status, nil
+	default:
+		return nil, httpx.Error(http.StatusUnprocessableEntity, errors.New("cannot pin a private status"))
+	}
+}
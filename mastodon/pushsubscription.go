@@ -1,11 +1,14 @@
 package mastodon
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/bardic/pub/internal/httpx"
 	"github.com/bardic/pub/internal/to"
+	"github.com/bardic/pub/internal/webpush"
 	"github.com/bardic/pub/models"
+	"gorm.io/gorm"
 )
 
 func PushSubscriptionCreate(env *Env, w http.ResponseWriter, r *http.Request) error {
@@ -38,10 +41,22 @@ func PushSubscriptionCreate(env *Env, w http.ResponseWriter, r *http.Request) er
 	if err := httpx.Params(r, &body); err != nil {
 		return err
 	}
+	if body.Subscription.Endpoint == "" || body.Subscription.Keys.P256DH == "" || body.Subscription.Keys.Auth == "" {
+		return httpx.Error(http.StatusUnprocessableEntity, errors.New("subscription endpoint and keys are required"))
+	}
+	if err := webpush.ValidateEndpoint(body.Subscription.Endpoint); err != nil {
+		return httpx.Error(http.StatusUnprocessableEntity, err)
+	}
+	policy := models.PushSubscriptionPolicy(body.Data.Policy)
+	if policy == "" {
+		policy = "all"
+	}
 	sub := models.PushSubscription{
 		AccountID:     account.ID,
 		Endpoint:      body.Subscription.Endpoint,
-		Mention:       false,
+		P256DH:        body.Subscription.Keys.P256DH,
+		Auth:          body.Subscription.Keys.Auth,
+		Mention:       bool(body.Data.Alerts.Mention),
 		Status:        bool(body.Data.Alerts.Status),
 		Reblog:        bool(body.Data.Alerts.Reblog),
 		Follow:        bool(body.Data.Alerts.Follow),
@@ -49,13 +64,24 @@ func PushSubscriptionCreate(env *Env, w http.ResponseWriter, r *http.Request) er
 		Favourite:     bool(body.Data.Alerts.Favourite),
 		Poll:          bool(body.Data.Alerts.Poll),
 		Update:        bool(body.Data.Alerts.Update),
-		Policy:        models.PushSubscriptionPolicy(body.Data.Policy),
+		Policy:        policy,
+	}
+	// an account has one subscription, creating a new one replaces the old.
+	err = env.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("account_id = ?", account.ID).Delete(&models.PushSubscription{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&sub).Error
+	})
+	if err != nil {
+		return err
 	}
-	if err := env.DB.Create(&sub).Error; err != nil {
+	serverKey, err := vapidPublicKey(env, account)
+	if err != nil {
 		return err
 	}
 	ser := Serialiser{req: r}
-	return to.JSON(w, ser.WebPushSubscription(&sub))
+	return to.JSON(w, ser.WebPushSubscription(&sub, serverKey))
 }
 
 func PushSubscriptionUpdate(env *Env, w http.ResponseWriter, r *http.Request) error {
@@ -99,8 +125,12 @@ func PushSubscriptionUpdate(env *Env, w http.ResponseWriter, r *http.Request) er
 	if err := env.DB.Save(&sub).Error; err != nil {
 		return err
 	}
+	serverKey, err := vapidPublicKey(env, account)
+	if err != nil {
+		return err
+	}
 	ser := Serialiser{req: r}
-	return to.JSON(w, ser.WebPushSubscription(&sub))
+	return to.JSON(w, ser.WebPushSubscription(&sub, serverKey))
 }
 
 func PushSubscriptionShow(env *Env, w http.ResponseWriter, r *http.Request) error {
@@ -113,9 +143,13 @@ func PushSubscriptionShow(env *Env, w http.ResponseWriter, r *http.Request) erro
 	if err := env.DB.FirstOrInit(&sub, models.PushSubscription{AccountID: account.ID}).Error; err != nil {
 		return err
 	}
+	serverKey, err := vapidPublicKey(env, account)
+	if err != nil {
+		return err
+	}
 
 	ser := Serialiser{req: r}
-	return to.JSON(w, ser.WebPushSubscription(&sub))
+	return to.JSON(w, ser.WebPushSubscription(&sub, serverKey))
 }
 
 func PushSubscriptionDestroy(env *Env, w http.ResponseWriter, r *http.Request) error {
@@ -130,3 +164,12 @@ func PushSubscriptionDestroy(env *Env, w http.ResponseWriter, r *http.Request) e
 
 	return to.JSON(w, make(map[string]interface{}))
 }
+
+// vapidPublicKey returns the VAPID public key of the account's instance.
+func vapidPublicKey(env *Env, account *models.Account) (string, error) {
+	var instance models.Instance
+	if err := env.DB.Select("vapid_public_key").Take(&instance, account.InstanceID).Error; err != nil {
+		return "", err
+	}
+	return instance.VapidPublicKey, nil
+}
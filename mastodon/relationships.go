@@ -50,10 +50,27 @@ func RelationshipsCreate(env *Env, w http.ResponseWriter, req *http.Request) err
 		}
 		return err
 	}
+	// reblogs and languages are accepted, but not yet supported.
+	var params struct {
+		Reblogs   bool     `json:"reblogs" schema:"reblogs"`
+		Notify    bool     `json:"notify" schema:"notify"`
+		Languages []string `json:"languages" schema:"languages[]"`
+	}
+	if req.Header.Get("Content-Type") != "" {
+		// most clients send no parameters, and no Content-Type, at all.
+		if err := httpx.Params(req, &params); err != nil {
+			return err
+		}
+	}
 	rel, err := models.NewRelationships(env.DB).Follow(user.Actor, &target)
 	if err != nil {
 		return err
-
+	}
+	if rel.Notifying != params.Notify {
+		rel.Notifying = params.Notify
+		if err := env.DB.Model(rel).UpdateColumn("notifying", rel.Notifying).Error; err != nil {
+			return err
+		}
 	}
 	serialise := Serialiser{req: req}
 	return to.JSON(w, serialise.Relationship(rel))
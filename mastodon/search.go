@@ -100,7 +100,7 @@ func searchStatuses(env *Env, w http.ResponseWriter, r *http.Request, q string)
 		if err := env.DB.Joins("Admin").Preload("Admin.Actor").Where("domain = ?", r.Host).First(&instance).Error; err != nil {
 			return httpx.Error(http.StatusInternalServerError, err)
 		}
-		fetcher := activitypub.NewRemoteStatusFetcher(instance.Admin, env.DB)
+		fetcher := activitypub.NewRemoteStatusFetcher(instance.Admin, env.DB, env.Logger, env.Policies...)
 		status, err = models.NewStatuses(env.DB).FindOrCreate(q, fetcher.Fetch)
 	default:
 		status, err = models.NewStatuses(env.DB).FindByURI(q)
@@ -3,6 +3,7 @@ package mastodon
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/bardic/pub/internal/algorithms"
@@ -14,6 +15,9 @@ import (
 // responses.
 type Serialiser struct {
 	req *http.Request
+	// filters are the active filters of the authenticated account in the context
+	// being serialised, their results are attached to each Status.
+	filters []*models.AccountFilter
 }
 
 func NewSerialiser(req *http.Request) Serialiser {
@@ -163,8 +167,8 @@ func (s *Serialiser) Relationship(rel *models.Relationship) *Relationship {
 	return &Relationship{
 		ID:                  rel.TargetID,
 		Following:           rel.Following,
-		ShowingReblogs:      true,  // todo
-		Notifying:           false, // todo
+		ShowingReblogs:      true, // todo
+		Notifying:           rel.Notifying,
 		FollowedBy:          rel.FollowedBy,
 		Blocking:            rel.Blocking,
 		BlockedBy:           rel.BlockedBy,
@@ -199,7 +203,7 @@ type Status struct {
 	Pinned             bool               `json:"pinned"`
 	Bookmarked         bool               `json:"bookmarked"`
 	Content            string             `json:"content"`
-	Filtered           []any              `json:"filtered,omitempty"`
+	Filtered           []*FilterResult    `json:"filtered,omitempty"`
 	Reblog             *Status            `json:"reblog"`
 	Application        any                `json:"application,omitempty"`
 	Account            *Account           `json:"account"`
@@ -244,6 +248,9 @@ func (s *Serialiser) Status(st *models.Status) *Status {
 			if st.Reblog != nil {
 				return nil
 			}
+			if st.URL != "" {
+				return st.URL
+			}
 			return st.URI
 		}(),
 		RepliesCount:     st.RepliesCount,
@@ -252,19 +259,79 @@ func (s *Serialiser) Status(st *models.Status) *Status {
 		Favourited:       st.Reaction != nil && st.Reaction.Favourited,
 		Reblogged:        st.Reaction != nil && st.Reaction.Reblogged,
 		Muted:            st.Reaction != nil && st.Reaction.Muted,
+		Pinned:           st.Reaction != nil && st.Reaction.Pinned,
 		Bookmarked:       st.Reaction != nil && st.Reaction.Bookmarked,
 		Content:          st.Note,
+		Filtered:         s.filterResults(st),
 		Reblog:           s.Status(st.Reblog),
 		Account:          s.Account(st.Actor),
 		MediaAttachments: s.MediaAttachments(st.Attachments),
 		Mentions:         s.Mentions(st.Mentions),
 		Tags:             s.Tags(st.Tags),
 		Emojis:           nil,
-		Card:             nil,
+		Card:             s.PreviewCard(st),
 		Poll:             s.Poll(st.Poll),
 	}
 }
 
+// PreviewCard represents a rich preview card.
+// https://docs.joinmastodon.org/entities/PreviewCard/
+type PreviewCard struct {
+	URL          string `json:"url"`
+	Title        string `json:"title"`
+	Description  string `json:"description"`
+	Type         string `json:"type"`
+	AuthorName   string `json:"author_name"`
+	AuthorURL    string `json:"author_url"`
+	ProviderName string `json:"provider_name"`
+	ProviderURL  string `json:"provider_url"`
+	HTML         string `json:"html"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	Image        any    `json:"image"`
+	EmbedURL     string `json:"embed_url"`
+	Blurhash     any    `json:"blurhash"`
+}
+
+// PreviewCard returns a card linking to the original of a long form status,
+// such as an Article or Video, or nil for Notes and Questions.
+func (s *Serialiser) PreviewCard(st *models.Status) *PreviewCard {
+	switch st.Type {
+	case "", "Note", "Question":
+		return nil
+	}
+	url := st.URL
+	if url == "" {
+		url = st.URI
+	}
+	card := &PreviewCard{
+		URL:   url,
+		Title: st.Title,
+		Type:  "link",
+	}
+	if st.Type == "Video" {
+		card.Type = "video"
+	}
+	if st.Actor != nil {
+		card.AuthorName = st.Actor.DisplayName
+		card.AuthorURL = st.Actor.URL()
+		card.ProviderName = st.Actor.Domain
+		card.ProviderURL = "https://" + st.Actor.Domain
+	}
+	for _, att := range st.Attachments {
+		if att.ToType() == "image" {
+			card.Image = s.mediaPreviewURL(&att.Attachment)
+			card.Width = att.Width
+			card.Height = att.Height
+			if att.Blurhash != "" {
+				card.Blurhash = att.Blurhash
+			}
+			break
+		}
+	}
+	return card
+}
+
 func (s *Serialiser) Tags(tags []models.StatusTag) []*Tag {
 	return algorithms.Map(
 		algorithms.Map(
@@ -380,6 +447,136 @@ func (s *Serialiser) Marker(m *models.AccountMarker) *Marker {
 	}
 }
 
+// https://docs.joinmastodon.org/entities/Notification/
+type Notification struct {
+	ID        snowflake.ID `json:"id,string"`
+	Type      string       `json:"type"`
+	CreatedAt string       `json:"created_at"`
+	Account   *Account     `json:"account"`
+	Status    *Status      `json:"status,omitempty"`
+}
+
+func (s *Serialiser) Notification(n *models.Notification) *Notification {
+	return &Notification{
+		ID:        n.ID,
+		Type:      string(n.Type),
+		CreatedAt: n.ID.ToTime().Round(time.Second).Format("2006-01-02T15:04:05.000Z"),
+		Account:   s.Account(n.FromActor),
+		Status:    s.Status(n.Status),
+	}
+}
+
+// https://docs.joinmastodon.org/entities/Filter/
+type Filter struct {
+	ID           snowflake.ID           `json:"id,string"`
+	Title        string                 `json:"title"`
+	Context      []models.FilterContext `json:"context"`
+	ExpiresAt    any                    `json:"expires_at"`
+	FilterAction models.FilterAction    `json:"filter_action"`
+	Keywords     []*FilterKeyword       `json:"keywords"`
+	Statuses     []*FilterStatus        `json:"statuses"`
+}
+
+func (s *Serialiser) Filter(f *models.AccountFilter) *Filter {
+	return &Filter{
+		ID:           f.ID,
+		Title:        f.Title,
+		Context:      f.Contexts(),
+		ExpiresAt:    maybeExpiresAt(f.ExpiresAt),
+		FilterAction: f.Action,
+		Keywords: algorithms.Map(f.Keywords, func(kw models.AccountFilterKeyword) *FilterKeyword {
+			return s.FilterKeyword(&kw)
+		}),
+		Statuses: algorithms.Map(f.Statuses, func(fs models.AccountFilterStatus) *FilterStatus {
+			return s.FilterStatus(&fs)
+		}),
+	}
+}
+
+// https://docs.joinmastodon.org/entities/FilterKeyword/
+type FilterKeyword struct {
+	ID        snowflake.ID `json:"id,string"`
+	Keyword   string       `json:"keyword"`
+	WholeWord bool         `json:"whole_word"`
+}
+
+func (s *Serialiser) FilterKeyword(kw *models.AccountFilterKeyword) *FilterKeyword {
+	return &FilterKeyword{
+		ID:        kw.ID,
+		Keyword:   kw.Keyword,
+		WholeWord: kw.WholeWord,
+	}
+}
+
+// https://docs.joinmastodon.org/entities/FilterStatus/
+type FilterStatus struct {
+	ID       snowflake.ID `json:"id,string"`
+	StatusID snowflake.ID `json:"status_id,string"`
+}
+
+func (s *Serialiser) FilterStatus(fs *models.AccountFilterStatus) *FilterStatus {
+	return &FilterStatus{
+		ID:       fs.ID,
+		StatusID: fs.StatusID,
+	}
+}
+
+// https://docs.joinmastodon.org/entities/FilterResult/
+type FilterResult struct {
+	Filter         *Filter  `json:"filter"`
+	KeywordMatches []string `json:"keyword_matches"`
+	StatusMatches  []string `json:"status_matches"`
+}
+
+// filterResults returns the results of the serialiser's filters which match st.
+func (s *Serialiser) filterResults(st *models.Status) []*FilterResult {
+	var results []*FilterResult
+	for _, f := range s.filters {
+		keywords, statuses := f.Match(st)
+		if len(keywords) == 0 && len(statuses) == 0 {
+			continue
+		}
+		results = append(results, &FilterResult{
+			Filter:         s.Filter(f),
+			KeywordMatches: keywords,
+			StatusMatches: algorithms.Map(statuses, func(id snowflake.ID) string {
+				return strconv.FormatUint(uint64(id), 10)
+			}),
+		})
+	}
+	return results
+}
+
+// V1Filter is a keyword of a filter, as presented by the v1 filters API.
+// https://docs.joinmastodon.org/entities/V1_Filter/
+type V1Filter struct {
+	ID           snowflake.ID           `json:"id,string"`
+	Phrase       string                 `json:"phrase"`
+	Context      []models.FilterContext `json:"context"`
+	ExpiresAt    any                    `json:"expires_at"`
+	Irreversible bool                   `json:"irreversible"`
+	WholeWord    bool                   `json:"whole_word"`
+}
+
+func (s *Serialiser) V1Filter(kw *models.AccountFilterKeyword) *V1Filter {
+	return &V1Filter{
+		ID:           kw.ID,
+		Phrase:       kw.Keyword,
+		Context:      kw.AccountFilter.Contexts(),
+		ExpiresAt:    maybeExpiresAt(kw.AccountFilter.ExpiresAt),
+		Irreversible: kw.AccountFilter.Action == "hide",
+		WholeWord:    kw.WholeWord,
+	}
+}
+
+// maybeExpiresAt returns a string representation of expiresAt, or null if it is nil.
+func maybeExpiresAt(expiresAt *time.Time) any {
+	if expiresAt == nil {
+		return nil
+	}
+	return expiresAt.Format("2006-01-02T15:04:05.000Z")
+}
+
 type List struct {
 	ID            snowflake.ID `json:"id,string"`
 	Title         string       `json:"title"`
@@ -433,6 +630,23 @@ type Tag struct {
 	History []map[string]any `json:"history,omitempty"`
 }
 
+// https://docs.joinmastodon.org/entities/FeaturedTag/
+type FeaturedTag struct {
+	ID            snowflake.ID `json:"id,string"`
+	Name          string       `json:"name"`
+	URL           string       `json:"url"`
+	StatusesCount int          `json:"statuses_count"`
+	LastStatusAt  any          `json:"last_status_at"`
+}
+
+func (s *Serialiser) FeaturedTag(ft *models.FeaturedTag) *FeaturedTag {
+	return &FeaturedTag{
+		ID:   ft.ID,
+		Name: ft.Tag.Name,
+		URL:  s.urlFor("/tags/" + ft.Tag.Name),
+	}
+}
+
 // https://docs.joinmastodon.org/entities/Poll/
 type Poll struct {
 	ID          snowflake.ID `json:"id,string"`
@@ -668,7 +882,9 @@ type Alerts struct {
 	Update        bool `json:"update"`
 }
 
-func (s *Serialiser) WebPushSubscription(sub *models.PushSubscription) *WebPushSubscription {
+// WebPushSubscription serialises sub. serverKey is the VAPID public key of the
+// instance the subscription's pushes are sent from.
+func (s *Serialiser) WebPushSubscription(sub *models.PushSubscription, serverKey string) *WebPushSubscription {
 	return &WebPushSubscription{
 		ID:       sub.ID,
 		Endpoint: sub.Endpoint,
@@ -682,6 +898,6 @@ func (s *Serialiser) WebPushSubscription(sub *models.PushSubscription) *WebPushS
 			Poll:          sub.Poll,
 			Update:        sub.Update,
 		},
-		ServerKey: "BCk-QqERU0q-CfYZjcuB6lnyyOYfJ2AifKqfeGIm7Z-HiTU5T9eTG5GxVA0_OH5mMlI4UkkDTpaZwozy0TzdZ2M=",
+		ServerKey: serverKey,
 	}
 }
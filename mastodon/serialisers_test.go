@@ -23,7 +23,7 @@ func TestSerialiserMediaOriginalURL(t *testing.T) {
 		req, err := http.NewRequest("GET", "https://example.com/u/user", nil)
 		require.NoError(err)
 
-		s := Serialiser{req}
+		s := Serialiser{req: req}
 
 		require.Equal(fmt.Sprintf("https://%s/media/original/%d.jpg", req.Host, att.ID), s.mediaOriginalURL(att))
 	})
@@ -39,7 +39,7 @@ func TestSerialiserMediaOriginalURL(t *testing.T) {
 		req, err := http.NewRequest("GET", "https://example.com/u/user", nil)
 		require.NoError(err)
 
-		s := Serialiser{req}
+		s := Serialiser{req: req}
 
 		require.Equal(att.URL, s.mediaOriginalURL(att))
 	})
@@ -58,7 +58,7 @@ func TestSerialiserMediaPreviewURL(t *testing.T) {
 		req, err := http.NewRequest("GET", "https://example.com/u/user", nil)
 		require.NoError(err)
 
-		s := Serialiser{req}
+		s := Serialiser{req: req}
 
 		require.Empty(s.mediaPreviewURL(att))
 	})
@@ -73,7 +73,7 @@ func TestSerialiserMediaPreviewURL(t *testing.T) {
 		req, err := http.NewRequest("GET", "https://example.com/u/user", nil)
 		require.NoError(err)
 
-		s := Serialiser{req}
+		s := Serialiser{req: req}
 
 		require.Empty(s.mediaPreviewURL(att))
 	})
@@ -88,7 +88,7 @@ func TestSerialiserMediaPreviewURL(t *testing.T) {
 		req, err := http.NewRequest("GET", "https://example.com/u/user", nil)
 		require.NoError(err)
 
-		s := Serialiser{req}
+		s := Serialiser{req: req}
 
 		require.Empty(s.mediaPreviewURL(att))
 	})
@@ -103,7 +103,7 @@ func TestSerialiserMediaPreviewURL(t *testing.T) {
 		req, err := http.NewRequest("GET", "https://example.com/u/user", nil)
 		require.NoError(err)
 
-		s := Serialiser{req}
+		s := Serialiser{req: req}
 
 		require.Empty(s.mediaPreviewURL(att))
 	})
@@ -122,7 +122,7 @@ func TestSerialiserMediaPreviewURL(t *testing.T) {
 		req, err := http.NewRequest("GET", "https://example.com/u/user", nil)
 		require.NoError(err)
 
-		s := Serialiser{req}
+		s := Serialiser{req: req}
 
 		want := fmt.Sprintf("https://example.com/media/preview/%d.jpg", id)
 		require.Equal(want, s.mediaPreviewURL(att))
@@ -142,7 +142,7 @@ func TestSerialiserMediaPreviewURL(t *testing.T) {
 		req, err := http.NewRequest("GET", "https://example.com/u/user", nil)
 		require.NoError(err)
 
-		s := Serialiser{req}
+		s := Serialiser{req: req}
 
 		want := fmt.Sprintf("https://example.com/media/original/%d.jpg", id)
 		require.Equal(want, s.mediaPreviewURL(att))
@@ -159,7 +159,7 @@ func TestSerialiserMediaPreviewURL(t *testing.T) {
 		req, err := http.NewRequest("GET", "https://example.com/u/user", nil)
 		require.NoError(err)
 
-		s := Serialiser{req}
+		s := Serialiser{req: req}
 
 		require.Empty(s.mediaPreviewURL(att))
 	})
@@ -329,3 +329,74 @@ func TestSmallMetaFormat(t *testing.T) {
 		}, smallMetaFormat(att))
 	})
 }
+
+func TestSerialiserPreviewCard(t *testing.T) {
+	req, err := http.NewRequest("GET", "https://example.com/api/v1/timelines/home", nil)
+	require.NoError(t, err)
+	s := Serialiser{req: req}
+
+	t.Run("Note has no card", func(t *testing.T) {
+		require := require.New(t)
+		require.Nil(s.PreviewCard(&models.Status{Type: "Note"}))
+	})
+
+	t.Run("Article links to its canonical URL", func(t *testing.T) {
+		require := require.New(t)
+		st := &models.Status{
+			Type:  "Article",
+			Title: "A blog post",
+			URI:   "https://blog.example.org/ap/posts/1",
+			URL:   "https://blog.example.org/a-blog-post",
+			Actor: &models.Actor{
+				Name:        "alice",
+				Domain:      "blog.example.org",
+				DisplayName: "Alice",
+			},
+		}
+		card := s.PreviewCard(st)
+		require.Equal("https://blog.example.org/a-blog-post", card.URL)
+		require.Equal("A blog post", card.Title)
+		require.Equal("link", card.Type)
+		require.Equal("Alice", card.AuthorName)
+		require.Equal("blog.example.org", card.ProviderName)
+	})
+
+	t.Run("Video falls back to its URI", func(t *testing.T) {
+		require := require.New(t)
+		card := s.PreviewCard(&models.Status{
+			Type: "Video",
+			URI:  "https://videos.example.org/videos/watch/1",
+		})
+		require.Equal("https://videos.example.org/videos/watch/1", card.URL)
+		require.Equal("video", card.Type)
+	})
+}
+
+func TestSerialiserFilterResults(t *testing.T) {
+	req, err := http.NewRequest("GET", "https://example.com/api/v1/timelines/home", nil)
+	require.NoError(t, err)
+	status := &models.Status{ID: snowflake.Now(), Note: "<p>soup for dinner</p>"}
+	s := Serialiser{req: req, filters: []*models.AccountFilter{{
+		ID:          snowflake.Now(),
+		Title:       "food",
+		ContextHome: true,
+		Action:      "warn",
+		Keywords:    []models.AccountFilterKeyword{{ID: snowflake.Now(), Keyword: "soup", WholeWord: true}},
+		Statuses:    []models.AccountFilterStatus{{ID: snowflake.Now(), StatusID: status.ID}},
+	}}}
+
+	t.Run("matching statuses carry the results", func(t *testing.T) {
+		require := require.New(t)
+		results := s.filterResults(status)
+		require.Len(results, 1)
+		require.Equal("food", results[0].Filter.Title)
+		require.Equal([]models.FilterContext{"home"}, results[0].Filter.Context)
+		require.Equal([]string{"soup"}, results[0].KeywordMatches)
+		require.Equal([]string{fmt.Sprint(status.ID)}, results[0].StatusMatches)
+	})
+
+	t.Run("other statuses do not", func(t *testing.T) {
+		require := require.New(t)
+		require.Empty(s.filterResults(&models.Status{ID: snowflake.Now(), Note: "<p>salad</p>"}))
+	})
+}
@@ -216,6 +216,14 @@ func StatusesContextsShow(env *Env, w http.ResponseWriter, r *http.Request) erro
 		return err
 	}
 
+	if !status.Actor.IsLocal() {
+		// fill in the parts of the thread we have not seen, so they are
+		// present the next time the context is requested.
+		if err := models.NewStatuses(env.DB).Backfill(&status); err != nil {
+			return err
+		}
+	}
+
 	// load conversation statuses
 	var statuses []models.Status
 	query = env.DB.Joins("Actor").Scopes(models.PreloadStatus)
@@ -226,7 +234,14 @@ func StatusesContextsShow(env *Env, w http.ResponseWriter, r *http.Request) erro
 	}
 
 	ancestors, descendants := thread(status.ID, statuses)
-	serialise := Serialiser{req: r}
+	ancestors, serialise, err := filter(env, r, user, "thread", ancestors)
+	if err != nil {
+		return err
+	}
+	descendants, _, err = filter(env, r, user, "thread", descendants)
+	if err != nil {
+		return err
+	}
 	return to.JSON(w, struct {
 		Ancestors   []*Status `json:"ancestors"`
 		Descendants []*Status `json:"descendants"`
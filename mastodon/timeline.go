@@ -21,7 +21,7 @@ func TimelinesHome(env *Env, w http.ResponseWriter, r *http.Request) error {
 
 	var statuses []*models.Status
 	// TODO stop copying and pasting this query
-	scope := env.DB.Joins("Actor").Scopes(models.PaginateStatuses(r), models.PreloadStatus).
+	scope := env.DB.Joins("Actor").Scopes(models.PaginateStatuses(r), models.MaybeFilterLanguages(r), models.PreloadStatus).
 		Where("(actor_id IN (?) AND in_reply_to_actor_id is null) or (actor_id in (?) and in_reply_to_actor_id IN (?))", following, following, following)
 	query := scope.Preload("Reaction", "actor_id = ?", user.Actor.ID) // reactions
 	query = query.Preload("Reblog.Reaction", "actor_id = ?", user.Actor.ID)
@@ -34,7 +34,10 @@ func TimelinesHome(env *Env, w http.ResponseWriter, r *http.Request) error {
 	if len(statuses) > 0 {
 		linkHeader(w, r, statuses[0].ID, statuses[len(statuses)-1].ID)
 	}
-	serialise := Serialiser{req: r}
+	statuses, serialise, err := filter(env, r, user, "home", statuses)
+	if err != nil {
+		return err
+	}
 	return to.JSON(w, algorithms.Map(statuses, serialise.Status))
 }
 
@@ -43,7 +46,7 @@ func TimelinesPublic(env *Env, w http.ResponseWriter, r *http.Request) error {
 	authenticated := err == nil
 
 	var statuses []*models.Status
-	query := env.DB.Scopes(models.PaginateStatuses(r), publicStatuses, localOnly(r), models.PreloadStatus)
+	query := env.DB.Scopes(models.PaginateStatuses(r), publicStatuses, localOnly(r), models.ExcludeSilenced, models.MaybeFilterLanguages(r), models.PreloadStatus)
 	// localOnly handles the join to the actors table
 	if authenticated {
 		query = query.Preload("Reaction", "actor_id = ?", user.Actor.ID) // reactions
@@ -58,7 +61,14 @@ func TimelinesPublic(env *Env, w http.ResponseWriter, r *http.Request) error {
 	if len(statuses) > 0 {
 		linkHeader(w, r, statuses[0].ID, statuses[len(statuses)-1].ID)
 	}
-	serialise := Serialiser{req: r}
+	if !authenticated {
+		serialise := Serialiser{req: r}
+		return to.JSON(w, algorithms.Map(statuses, serialise.Status))
+	}
+	statuses, serialise, err := filter(env, r, user, "public", statuses)
+	if err != nil {
+		return err
+	}
 	return to.JSON(w, algorithms.Map(statuses, serialise.Status))
 }
 
@@ -100,7 +110,10 @@ func TimelinesListShow(env *Env, w http.ResponseWriter, r *http.Request) error {
 	if len(statuses) > 0 {
 		linkHeader(w, r, statuses[0].ID, statuses[len(statuses)-1].ID)
 	}
-	serialise := Serialiser{req: r}
+	statuses, serialise, err := filter(env, r, user, "home", statuses)
+	if err != nil {
+		return err
+	}
 	return to.JSON(w, algorithms.Map(statuses, serialise.Status))
 }
 
@@ -111,11 +124,7 @@ func TimelinesTagShow(env *Env, w http.ResponseWriter, r *http.Request) error {
 	}
 
 	var statuses []*models.Status
-	scope := env.DB.Scopes(models.PaginateStatuses(r))
-	// use Joins("JOIN status_tags ...") as Joins("Tags") -- joining on an association -- causes a reflect panic in gorm.
-	// no biggie, just write the JOIN manually.
-	tag := env.DB.Select("id").Where("name = ?", chi.URLParam(r, "tag")).Table("tags")
-	query := scope.Joins("JOIN status_tags ON status_tags.status_id = statuses.id").Where("status_tags.tag_id = (?)", tag)
+	query := env.DB.Scopes(models.PaginateStatuses(r), models.TaggedWith(chi.URLParam(r, "tag")), models.ExcludeSilenced)
 	query = query.Preload("Actor").Scopes(models.PreloadStatus)
 	query = query.Preload("Reaction", "actor_id = ?", user.Actor.ID) // reactions
 	query = query.Preload("Reblog.Reaction", "actor_id = ?", user.Actor.ID)
@@ -128,7 +137,10 @@ func TimelinesTagShow(env *Env, w http.ResponseWriter, r *http.Request) error {
 	if len(statuses) > 0 {
 		linkHeader(w, r, statuses[0].ID, statuses[len(statuses)-1].ID)
 	}
-	serialise := Serialiser{req: r}
+	statuses, serialise, err := filter(env, r, user, "public", statuses)
+	if err != nil {
+		return err
+	}
 	return to.JSON(w, algorithms.Map(statuses, serialise.Status))
 }
 
@@ -25,7 +25,7 @@ func Avatar(env *models.Env, w http.ResponseWriter, r *http.Request) error {
 	if actor.Avatar == "" {
 		return httpx.Error(http.StatusNotFound, fmt.Errorf("no avatar for actor %q", actor.ID))
 	}
-	return stream(w, actor.Avatar)
+	return stream(w, r, actor.Avatar)
 }
 
 func Header(env *models.Env, w http.ResponseWriter, r *http.Request) error {
@@ -36,15 +36,15 @@ func Header(env *models.Env, w http.ResponseWriter, r *http.Request) error {
 	if actor.Header == "" {
 		return httpx.Error(http.StatusNotFound, fmt.Errorf("no header for actor %q", actor.ID))
 	}
-	return stream(w, actor.Header)
+	return stream(w, r, actor.Header)
 }
 
 func Original(env *models.Env, w http.ResponseWriter, r *http.Request) error {
-	var att models.StatusAttachment
-	if err := env.DB.Take(&att, chi.URLParam(r, "id")).Error; err != nil {
-		return httpx.Error(http.StatusNotFound, err)
+	att, err := findAttachment(env, r)
+	if err != nil {
+		return err
 	}
-	return stream(w, att.URL)
+	return stream(w, r, att.URL)
 }
 
 const (
@@ -55,12 +55,11 @@ const (
 // Preview returns a preview of the attachment in the format requested by the
 // file extension in the URL.
 func Preview(env *models.Env, w http.ResponseWriter, r *http.Request) error {
-	var att models.StatusAttachment
-
-	if err := env.DB.Take(&att, chi.URLParam(r, "id")).Error; err != nil {
-		return httpx.Error(http.StatusNotFound, err)
+	att, err := findAttachment(env, r)
+	if err != nil {
+		return err
 	}
-	resp, err := http.DefaultClient.Get(fmt.Sprintf("https://%s/media/original/%d.%s", r.Host, att.ID, att.Extension()))
+	resp, err := fetch(r, att.URL)
 	if err != nil {
 		return httpx.Error(http.StatusBadGateway, err)
 	}
@@ -93,9 +92,35 @@ func Preview(env *models.Env, w http.ResponseWriter, r *http.Request) error {
 	}
 }
 
+// findAttachment returns the attachment with the id in the request. Attachments
+// from domains whose media is rejected are not found.
+func findAttachment(env *models.Env, r *http.Request) (*models.StatusAttachment, error) {
+	var att models.StatusAttachment
+	if err := env.DB.Take(&att, chi.URLParam(r, "id")).Error; err != nil {
+		return nil, httpx.Error(http.StatusNotFound, err)
+	}
+	rejected, err := models.NewDomainBlocks(env.DB).RejectsMedia(att.StatusID)
+	if err != nil {
+		return nil, err
+	}
+	if rejected {
+		return nil, httpx.Error(http.StatusNotFound, fmt.Errorf("media of attachment %d is rejected", att.ID))
+	}
+	return &att, nil
+}
+
+// fetch fetches the remote url on behalf of r using httpx.DefaultClient.
+func fetch(r *http.Request, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return httpx.DefaultClient.Do(req)
+}
+
 // stream streams the content of the url to the http.ResponseWriter.
-func stream(w http.ResponseWriter, url string) error {
-	resp, err := http.DefaultClient.Get(url)
+func stream(w http.ResponseWriter, r *http.Request, url string) error {
+	resp, err := fetch(r, url)
 	if err != nil {
 		return httpx.Error(http.StatusBadGateway, err)
 	}
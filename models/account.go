@@ -29,6 +29,24 @@ type Account struct {
 	Role              *AccountRole
 }
 
+func (a *Account) AfterCreate(tx *gorm.DB) error {
+	return forEach(tx, a.updateInstanceAccountsCount)
+}
+
+func (a *Account) AfterDelete(tx *gorm.DB) error {
+	return forEach(tx, a.updateInstanceAccountsCount)
+}
+
+// updateInstanceAccountsCount updates the accounts_count field on the account's instance.
+// As with NodeInfo's usage, the instance's admin service account is not counted.
+func (a *Account) updateInstanceAccountsCount(tx *gorm.DB) error {
+	users := tx.Model(&Actor{}).Select("id").Where("type = ?", "LocalPerson")
+	accountsCount := tx.Model(&Account{}).Select("COUNT(id)").Where("instance_id = ? and actor_id IN (?)", a.InstanceID, users)
+	return tx.Model(&Instance{ID: a.InstanceID}).UpdateColumns(map[string]interface{}{
+		"accounts_count": accountsCount,
+	}).Error
+}
+
 func (a *Account) Name() string {
 	return a.Actor.Name
 }
@@ -88,6 +106,20 @@ func (a *Accounts) AccountForActor(actor *Actor) (*Account, error) {
 	return &account, nil
 }
 
+// PreferencesForActor returns the preferences of the account which owns actor,
+// creating the default preferences if the account has none.
+func (a *Accounts) PreferencesForActor(actor *Actor) (*AccountPreferences, error) {
+	account, err := a.AccountForActor(actor)
+	if err != nil {
+		return nil, err
+	}
+	prefs := AccountPreferences{AccountID: account.ID}
+	if err := a.db.FirstOrCreate(&prefs, AccountPreferences{AccountID: account.ID}).Error; err != nil {
+		return nil, err
+	}
+	return &prefs, nil
+}
+
 func (a *Accounts) Create(instance *Instance, name, email, password string) (*Account, error) {
 	var account Account
 	err := a.db.Transaction(func(tx *gorm.DB) error {
@@ -142,4 +174,10 @@ type AccountPreferences struct {
 	PostingDefaultLanguage   string       `gorm:"size:8;"`
 	ReadingExpandMedia       string       `gorm:"enum('default','show_all','hide_all');not null;default:'default'"`
 	ReadingExpandSpoilers    bool         `gorm:"not null;default:false"`
+	// HideCollections hides the members of the account's followers and following collections.
+	HideCollections bool `gorm:"not null;default:false"`
+	// HideCollectionsCount also hides the size of those collections.
+	HideCollectionsCount bool `gorm:"not null;default:false"`
+	// NoIndex asks search engines not to index the account's public pages.
+	NoIndex bool `gorm:"not null;default:false"`
 }
@@ -70,4 +70,27 @@ func TestAccounts(t *testing.T) {
 		require.NoError(err)
 		require.NotNil(actor)
 	})
+
+	t.Run("preferences default to showing collections", func(t *testing.T) {
+		require := require.New(t)
+
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		instance := MockInstance(t, tx, "example.com")
+		account, err := NewAccounts(tx).Create(instance, "alice", "alice@example.com", "password")
+		require.NoError(err)
+
+		prefs, err := NewAccounts(tx).PreferencesForActor(account.Actor)
+		require.NoError(err)
+		require.False(prefs.HideCollections)
+		require.False(prefs.HideCollectionsCount)
+
+		prefs.HideCollections = true
+		require.NoError(tx.Save(prefs).Error)
+
+		prefs, err = NewAccounts(tx).PreferencesForActor(account.Actor)
+		require.NoError(err)
+		require.True(prefs.HideCollections)
+	})
 }
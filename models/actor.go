@@ -34,6 +34,8 @@ type Actor struct {
 	InboxURL       string            `gorm:"size:255;not null;default:''"`
 	OutboxURL      string            `gorm:"size:255;not null;default:''"`
 	SharedInboxURL string            `gorm:"size:255;not null;default:''"`
+	FollowersURL   string            `gorm:"size:255;not null;default:''"`
+	FeaturedURL    string            `gorm:"size:255;not null;default:''"`
 }
 
 type ActorType string
@@ -65,17 +67,6 @@ func (a *Actor) AfterUpdate(tx *gorm.DB) error {
 	return forEach(tx, a.maybeScheduleRefresh)
 }
 
-func (a *Actor) AfterSave(tx *gorm.DB) error {
-	peer := &Peer{
-		Domain: a.Domain,
-	}
-	// save peer ignore if exists
-	return tx.Clauses(clause.OnConflict{
-		Columns:   []clause.Column{{Name: "domain"}},
-		DoNothing: true,
-	}).Create(peer).Error
-}
-
 func (a *Actor) updateInstanceDomainsCount(tx *gorm.DB) error {
 	return tx.Model(&Instance{}).Where("1 = 1").UpdateColumns(map[string]interface{}{
 		"domains_count": tx.Select("COUNT(distinct domain)").Model(&Actor{}),
@@ -94,6 +85,10 @@ func (a *Actor) needsRefresh() bool {
 	if a.OutboxURL == "" || (a.InboxURL == "" && a.SharedInboxURL == "") {
 		return true
 	}
+	if a.IsRemote() && a.FollowersURL == "" {
+		// fetched before we recorded the followers collection.
+		return true
+	}
 	return false
 }
 
@@ -176,6 +171,9 @@ func (a *Actors) FindOrCreate(uri string, createFn func(context.Context, string)
 		// found cached key
 		return &actors[0], nil
 	}
+	if err := NewDomainBlocks(a.db).CheckURI(uri); err != nil {
+		return nil, err
+	}
 
 	acc, err := createFn(a.db.Statement.Context, uri)
 	if err != nil {
@@ -194,6 +192,10 @@ func (a *Actors) FindByURI(uri string) (*Actor, error) {
 
 // Refesh schedules a refresh of an actor's data.
 func (a *Actors) Refresh(actor *Actor) error {
+	if feed, err := isFeed(a.db, actor.ID); err != nil || feed {
+		// feeds are polled by the FeedPollProcessor.
+		return err
+	}
 	db := a.db.Clauses(clause.OnConflict{
 		Columns: []clause.Column{{Name: "actor_id"}},
 		DoUpdates: clause.AssignmentColumns([]string{
@@ -205,6 +207,19 @@ func (a *Actors) Refresh(actor *Actor) error {
 	return db.Create(&ActorRefreshRequest{ActorID: actor.ID}).Error
 }
 
+// Backfill schedules the import of an actor's recent statuses from its outbox.
+// If a backfill of the actor is already pending, Backfill does nothing.
+func (a *Actors) Backfill(actor *Actor) error {
+	if feed, err := isFeed(a.db, actor.ID); err != nil || feed {
+		return err
+	}
+	db := a.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "actor_id"}},
+		DoNothing: true,
+	})
+	return db.Create(&ActorBackfillRequest{ActorID: actor.ID}).Error
+}
+
 type Request struct {
 	ID uint32 `gorm:"primarykey;"`
 	// CreatedAt is the time the request was created.
@@ -228,6 +243,15 @@ type ActorRefreshRequest struct {
 	Actor *Actor `gorm:"constraint:OnDelete:CASCADE;<-:false;"`
 }
 
+// ActorBackfillRequest is a request to import an actor's recent statuses.
+type ActorBackfillRequest struct {
+	Request
+	// ActorID is the ID of the actor whose outbox will be imported.
+	ActorID snowflake.ID `gorm:"uniqueIndex;not null;"`
+	// Actor is the actor whose outbox will be imported.
+	Actor *Actor `gorm:"constraint:OnDelete:CASCADE;<-:false;"`
+}
+
 // MaybeExcludeReplies returns a query that excludes replies if the request contains
 // the exclude_replies parameter.
 func MaybeExcludeReplies(r *http.Request) func(db *gorm.DB) *gorm.DB {
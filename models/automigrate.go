@@ -4,18 +4,21 @@ package models
 func AllTables() []interface{} {
 	return []interface{}{
 		&ActivitypubRefresh{}, &ActivitypubOutboxRequest{},
-		&Actor{}, &ActorAttribute{}, &ActorRefreshRequest{},
+		&Actor{}, &ActorAttribute{}, &ActorRefreshRequest{}, &ActorBackfillRequest{},
 		&Account{}, &AccountList{}, &AccountListMember{}, &AccountRole{}, &AccountMarker{}, &AccountPreferences{},
+		&AccountFilter{}, &AccountFilterKeyword{}, &AccountFilterStatus{},
 		&Application{},
 		&Conversation{},
-		&Instance{}, &InstanceRule{},
+		&DomainBlock{},
+		&FeaturedTag{}, &Feed{},
+		&Instance{}, &InstanceRule{}, &InstanceActivity{},
 		&Peer{},
-		&PushSubscription{},
+		&PushSubscription{}, &PushRequest{},
 		&Reaction{}, &ReactionRequest{},
+		&Notification{},
 		&Relationship{}, &RelationshipRequest{},
-		// &Notification{},
 		&Status{}, &StatusPoll{}, &StatusPollOption{}, &StatusAttachment{}, &StatusMention{}, &StatusTag{},
-		&StatusAttachmentRequest{},
+		&StatusAttachmentRequest{}, &StatusBackfillRequest{},
 		&Tag{},
 		&Token{},
 	}
@@ -0,0 +1,281 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bardic/pub/internal/snowflake"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// A DomainBlock moderates the actors of a remote domain.
+// DomainBlocks are managed by the admins of this server with the domain-block command.
+type DomainBlock struct {
+	ID        uint32 `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Domain    string              `gorm:"size:64;uniqueIndex;not null"`
+	Severity  DomainBlockSeverity `gorm:"not null"`
+	// PublicComment is the reason for the block shown in the public list of blocks.
+	PublicComment string `gorm:"size:255;not null;default:''"`
+	// PrivateComment is the reason for the block, for admins only.
+	PrivateComment string `gorm:"type:text"`
+	// Obfuscate partially hides the domain in the public list of blocks.
+	Obfuscate bool `gorm:"not null;default:false"`
+}
+
+// DomainBlockSeverity is how severely a domain is blocked.
+//   - reject_media: attachments of statuses from the domain are not fetched.
+//   - silence: statuses from the domain are hidden from public timelines.
+//   - suspend: activities from the domain are rejected, and its actors, and their
+//     statuses, are deleted.
+type DomainBlockSeverity string
+
+func (DomainBlockSeverity) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	switch db.Dialector.Name() {
+	case "mysql", "postgres":
+		return "enum('reject_media', 'silence', 'suspend')"
+	case "sqlite":
+		return "TEXT"
+	default:
+		return ""
+	}
+}
+
+// AfterSave purges the actors of a suspended domain.
+func (d *DomainBlock) AfterSave(tx *gorm.DB) error {
+	return forEach(tx, d.purgeSuspendedActors)
+}
+
+// purgeSuspendedActors deletes the actors of the domain, if it is suspended. Their
+// statuses, reactions and relationships are deleted with them by the database, so
+// no hooks run; the counts of the statuses and actors of other domains which
+// included them are recounted afterwards.
+func (d *DomainBlock) purgeSuspendedActors(tx *gorm.DB) error {
+	if d.Severity != "suspend" {
+		return nil
+	}
+	actors := tx.Model(&Actor{}).Select("id").Where(hostInDomains(tx, "domain", []string{d.Domain}))
+	statuses := tx.Model(&Status{}).Select("id").Where("actor_id IN (?)", actors)
+	var parents, reblogged, reacted, followed, following, reblogging []snowflake.ID
+	if err := tx.Model(&Status{}).Where("actor_id IN (?) and in_reply_to_id IS NOT NULL", actors).Distinct().Pluck("in_reply_to_id", &parents).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&Status{}).Where("actor_id IN (?) and reblog_id IS NOT NULL", actors).Distinct().Pluck("reblog_id", &reblogged).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&Reaction{}).Where("actor_id IN (?)", actors).Distinct().Pluck("status_id", &reacted).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&Relationship{}).Where("actor_id IN (?)", actors).Distinct().Pluck("target_id", &followed).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&Relationship{}).Where("target_id IN (?)", actors).Distinct().Pluck("actor_id", &following).Error; err != nil {
+		return err
+	}
+	// reblogs of the actors' statuses are deleted with them.
+	if err := tx.Model(&Status{}).Where("reblog_id IN (?)", statuses).Distinct().Pluck("actor_id", &reblogging).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Where(hostInDomains(tx, "domain", []string{d.Domain})).Delete(&Actor{}).Error; err != nil {
+		return err
+	}
+
+	for _, id := range reacted {
+		if err := (&Reaction{StatusID: id}).updateStatusCount(tx); err != nil {
+			return err
+		}
+	}
+	for _, id := range parents {
+		if err := (&Status{InReplyToID: &id}).updateRepliesCount(tx); err != nil {
+			return err
+		}
+	}
+	for _, id := range reblogged {
+		if err := (&Status{ReblogID: &id}).updateReblogsCount(tx); err != nil {
+			return err
+		}
+	}
+	for _, id := range followed {
+		if err := (&Relationship{ActorID: id}).updateFollowersCount(tx); err != nil {
+			return err
+		}
+	}
+	for _, id := range following {
+		if err := (&Relationship{TargetID: id}).updateFollowingCount(tx); err != nil {
+			return err
+		}
+	}
+	for _, id := range reblogging {
+		statusesCount := tx.Select("COUNT(id)").Where("actor_id = ?", id).Table("statuses")
+		if err := tx.Model(&Actor{ID: id}).UpdateColumn("statuses_count", statusesCount).Error; err != nil {
+			return err
+		}
+	}
+	var instances []*Instance
+	if err := tx.Preload("Admin").Find(&instances).Error; err != nil {
+		return err
+	}
+	for _, instance := range instances {
+		if instance.Admin == nil {
+			continue
+		}
+		if err := (&Status{ActorID: instance.Admin.ActorID}).updateInstanceStatusesCount(tx); err != nil {
+			return err
+		}
+	}
+	return (&Actor{}).updateInstanceDomainsCount(tx)
+}
+
+// PublicDomain returns the domain as shown in the public list of blocks; if the
+// block is obfuscated, every other letter of the domain, other than the separating
+// dots, is replaced with an asterisk.
+func (d *DomainBlock) PublicDomain() string {
+	if !d.Obfuscate {
+		return d.Domain
+	}
+	var sb strings.Builder
+	for i, r := range d.Domain {
+		if r != '.' && i%2 == 1 {
+			r = '*'
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+type DomainBlocks struct {
+	db *gorm.DB
+}
+
+func NewDomainBlocks(db *gorm.DB) *DomainBlocks {
+	return &DomainBlocks{db: db}
+}
+
+// Create blocks domain with severity, or updates the severity of an existing block.
+func (d *DomainBlocks) Create(domain string, severity DomainBlockSeverity, publicComment, privateComment string, obfuscate bool) (*DomainBlock, error) {
+	switch severity {
+	case "reject_media", "silence", "suspend":
+		// ok
+	default:
+		return nil, errors.New("DomainBlocks.Create: severity must be one of reject_media, silence or suspend")
+	}
+	domain = normaliseDomain(strings.TrimSpace(domain))
+	if domain == "" {
+		return nil, errors.New("DomainBlocks.Create: domain is empty")
+	}
+	var block DomainBlock
+	if err := d.db.Where(DomainBlock{Domain: domain}).FirstOrInit(&block).Error; err != nil {
+		return nil, err
+	}
+	block.Severity = severity
+	block.PublicComment = publicComment
+	block.PrivateComment = privateComment
+	block.Obfuscate = obfuscate
+	return &block, d.db.Save(&block).Error
+}
+
+// Delete removes the block of domain. Actors purged by a suspension are not restored.
+func (d *DomainBlocks) Delete(domain string) error {
+	return d.db.Where("domain = ?", domain).Delete(&DomainBlock{}).Error
+}
+
+// IsSuspended reports whether domain, or a domain it is a subdomain of, is suspended.
+// Case and port are ignored.
+func (d *DomainBlocks) IsSuspended(domain string) (bool, error) {
+	var count int64
+	err := d.db.Model(&DomainBlock{}).Where("domain IN ? and severity = ?", parentDomains(domain), "suspend").Count(&count).Error
+	return count > 0, err
+}
+
+// ErrSuspended is wrapped by the error returned when an actor or status of a
+// suspended domain would be fetched.
+var ErrSuspended = errors.New("domain is suspended")
+
+// CheckURI returns an error wrapping ErrSuspended if the host of uri is suspended.
+func (d *DomainBlocks) CheckURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return err
+	}
+	suspended, err := d.IsSuspended(u.Hostname())
+	if err != nil {
+		return err
+	}
+	if suspended {
+		return fmt.Errorf("%w: %q", ErrSuspended, u.Hostname())
+	}
+	return nil
+}
+
+// RejectsMedia reports whether the attachments of the status with id should not be
+// fetched, because the domain of its actor, or a domain it is a subdomain of, is blocked.
+func (d *DomainBlocks) RejectsMedia(statusID snowflake.ID) (bool, error) {
+	actors := d.db.Model(&Status{}).Select("actor_id").Where("id = ?", statusID)
+	var domains []string
+	if err := d.db.Model(&Actor{}).Where("id IN (?)", actors).Pluck("domain", &domains).Error; err != nil {
+		return false, err
+	}
+	if len(domains) == 0 {
+		return false, nil
+	}
+	var count int64
+	err := d.db.Model(&DomainBlock{}).Where("domain IN ? and severity IN ?", parentDomains(domains[0]), []DomainBlockSeverity{"reject_media", "suspend"}).Count(&count).Error
+	return count > 0, err
+}
+
+// ExcludeSilenced excludes statuses by actors of silenced, or suspended, domains
+// and their subdomains.
+func ExcludeSilenced(db *gorm.DB) *gorm.DB {
+	tx := db.Session(&gorm.Session{NewDB: true})
+	var blocked []string
+	if err := tx.Model(&DomainBlock{}).Where("severity IN ?", []DomainBlockSeverity{"silence", "suspend"}).Pluck("domain", &blocked).Error; err != nil {
+		db.AddError(err)
+		return db
+	}
+	if len(blocked) == 0 {
+		return db
+	}
+	actors := tx.Model(&Actor{}).Select("id").Where(hostInDomains(tx, "domain", blocked))
+	return db.Where("statuses.actor_id NOT IN (?)", actors)
+}
+
+// normaliseDomain returns host lower cased, without its port or a trailing dot.
+func normaliseDomain(host string) string {
+	u := url.URL{Host: host}
+	return strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+}
+
+// parentDomains returns host, normalised, followed by each domain it is a
+// subdomain of; a.b.example, b.example and example.
+func parentDomains(host string) []string {
+	domain := normaliseDomain(host)
+	domains := []string{domain}
+	for {
+		i := strings.IndexByte(domain, '.')
+		if i < 0 {
+			return domains
+		}
+		domain = domain[i+1:]
+		domains = append(domains, domain)
+	}
+}
+
+// hostInDomains returns a condition matching the rows whose column holds one of
+// domains, or a subdomain of one, ignoring case and port.
+func hostInDomains(db *gorm.DB, column string, domains []string) *gorm.DB {
+	cond := db.Session(&gorm.Session{NewDB: true})
+	if len(domains) == 0 {
+		return cond.Where("1 = 0")
+	}
+	host := "LOWER(" + column + ")"
+	for _, domain := range domains {
+		cond = cond.Or(host+" = ? OR "+host+" LIKE ? OR "+host+" LIKE ? OR "+host+" LIKE ?", domain, "%."+domain, domain+":%", "%."+domain+":%")
+	}
+	return cond
+}
@@ -0,0 +1,217 @@
+package models
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDomainBlocks(t *testing.T) {
+	db := setupTestDB(t)
+
+	t.Run("severity must be valid", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		_, err := NewDomainBlocks(tx).Create("remote.example", "ignore", "", "", false)
+		require.Error(err)
+	})
+
+	t.Run("create updates an existing block", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		first, err := NewDomainBlocks(tx).Create("Remote.Example", "reject_media", "", "", false)
+		require.NoError(err)
+		require.Equal("remote.example", first.Domain)
+		second, err := NewDomainBlocks(tx).Create("remote.example", "silence", "spam", "", false)
+		require.NoError(err)
+		require.Equal(first.ID, second.ID)
+		require.EqualValues("silence", second.Severity)
+		require.Equal("spam", second.PublicComment)
+	})
+
+	t.Run("suspend deletes the domain's actors", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		alice := MockActor(t, tx, "alice", "remote.example")
+		status := MockStatus(t, tx, alice, "hello")
+		bob := MockActor(t, tx, "bob", "other.example")
+
+		_, err := NewDomainBlocks(tx).Create("remote.example", "suspend", "", "", false)
+		require.NoError(err)
+
+		suspended, err := NewDomainBlocks(tx).IsSuspended("remote.example")
+		require.NoError(err)
+		require.True(suspended)
+		suspended, err = NewDomainBlocks(tx).IsSuspended("other.example")
+		require.NoError(err)
+		require.False(suspended)
+
+		require.Error(tx.Take(&Actor{}, alice.ID).Error)
+		require.Error(tx.Take(&Status{}, status.ID).Error)
+		require.NoError(tx.Take(&Actor{}, bob.ID).Error)
+	})
+
+	t.Run("suspend recounts the statuses and actors the domain interacted with", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		alice := MockActor(t, tx, "alice", "other.example")
+		status := MockStatus(t, tx, alice, "hello")
+		bob := MockActor(t, tx, "bob", "remote.example")
+		reply := MockStatus(t, tx, bob, "hi alice")
+		require.NoError(tx.Model(reply).UpdateColumn("in_reply_to_id", status.ID).Error)
+		require.NoError((&Status{InReplyToID: &status.ID}).updateRepliesCount(tx))
+		_, err := NewRelationships(tx).Follow(bob, alice)
+		require.NoError(err)
+		_, err = NewRelationships(tx).Follow(alice, bob)
+		require.NoError(err)
+
+		require.NoError(tx.First(status, status.ID).Error)
+		require.Equal(1, status.RepliesCount)
+		require.NoError(tx.First(alice, alice.ID).Error)
+		require.EqualValues(1, alice.FollowersCount)
+		require.EqualValues(1, alice.FollowingCount)
+
+		_, err = NewDomainBlocks(tx).Create("remote.example", "suspend", "", "", false)
+		require.NoError(err)
+
+		require.NoError(tx.First(status, status.ID).Error)
+		require.Equal(0, status.RepliesCount)
+		require.NoError(tx.First(alice, alice.ID).Error)
+		require.EqualValues(0, alice.FollowersCount)
+		require.EqualValues(0, alice.FollowingCount)
+	})
+
+	t.Run("actors and statuses of suspended domains are not created", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		_, err := NewDomainBlocks(tx).Create("remote.example", "suspend", "", "", false)
+		require.NoError(err)
+
+		_, err = NewActors(tx).FindOrCreate("https://remote.example/users/bob", func(context.Context, string) (*Actor, error) {
+			t.Fatal("suspended actor fetched")
+			return nil, nil
+		})
+		require.ErrorIs(err, ErrSuspended)
+		_, err = NewStatuses(tx).FindOrCreate("https://remote.example/users/bob/statuses/1", func(string) (*Status, error) {
+			t.Fatal("suspended status fetched")
+			return nil, nil
+		})
+		require.ErrorIs(err, ErrSuspended)
+	})
+
+	t.Run("blocks apply regardless of case and port, and to subdomains", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		sub := MockActor(t, tx, "alice", "Sub.Suspended.example:8443")
+		other := MockActor(t, tx, "bob", "notsuspended.example")
+		_, err := NewDomainBlocks(tx).Create("suspended.example", "suspend", "", "", false)
+		require.NoError(err)
+
+		blocks := NewDomainBlocks(tx)
+		for _, uri := range []string{
+			"https://suspended.example/users/mallory",
+			"https://Suspended.Example/users/mallory",
+			"https://suspended.example:443/users/mallory",
+			"https://sub.suspended.example/users/mallory",
+			"https://SUB.suspended.example:8443/users/mallory",
+		} {
+			require.ErrorIs(blocks.CheckURI(uri), ErrSuspended, uri)
+		}
+		require.NoError(blocks.CheckURI("https://notsuspended.example/users/bob"))
+
+		require.Error(tx.Take(&Actor{}, sub.ID).Error)
+		require.NoError(tx.Take(&Actor{}, other.ID).Error)
+	})
+
+	t.Run("silence and reject_media apply to subdomains", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		alice := MockActor(t, tx, "alice", "www.Silenced.example:8443")
+		MockStatus(t, tx, alice, "hello")
+		bob := MockActor(t, tx, "bob", "cdn.Media.example:8443")
+		media := MockStatus(t, tx, bob, "hello")
+		carol := MockActor(t, tx, "carol", "notsilenced.example")
+		visible := MockStatus(t, tx, carol, "hello")
+		_, err := NewDomainBlocks(tx).Create("silenced.example", "silence", "", "", false)
+		require.NoError(err)
+		_, err = NewDomainBlocks(tx).Create("media.example", "reject_media", "", "", false)
+		require.NoError(err)
+
+		var statuses []Status
+		require.NoError(tx.Scopes(ExcludeSilenced).Find(&statuses).Error)
+		require.Len(statuses, 2)
+		for _, status := range statuses {
+			require.NotEqual(alice.ID, status.ActorID)
+		}
+
+		rejected, err := NewDomainBlocks(tx).RejectsMedia(media.ID)
+		require.NoError(err)
+		require.True(rejected)
+		rejected, err = NewDomainBlocks(tx).RejectsMedia(visible.ID)
+		require.NoError(err)
+		require.False(rejected)
+	})
+
+	t.Run("reject_media and suspend reject media", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		alice := MockActor(t, tx, "alice", "media.example")
+		media := MockStatus(t, tx, alice, "hello")
+		bob := MockActor(t, tx, "bob", "silenced.example")
+		silenced := MockStatus(t, tx, bob, "hello")
+		_, err := NewDomainBlocks(tx).Create("media.example", "reject_media", "", "", false)
+		require.NoError(err)
+		_, err = NewDomainBlocks(tx).Create("silenced.example", "silence", "", "", false)
+		require.NoError(err)
+
+		rejected, err := NewDomainBlocks(tx).RejectsMedia(media.ID)
+		require.NoError(err)
+		require.True(rejected)
+		rejected, err = NewDomainBlocks(tx).RejectsMedia(silenced.ID)
+		require.NoError(err)
+		require.False(rejected)
+	})
+
+	t.Run("silenced statuses are excluded", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		alice := MockActor(t, tx, "alice", "silenced.example")
+		MockStatus(t, tx, alice, "hello")
+		bob := MockActor(t, tx, "bob", "other.example")
+		visible := MockStatus(t, tx, bob, "hello")
+		_, err := NewDomainBlocks(tx).Create("silenced.example", "silence", "", "", false)
+		require.NoError(err)
+
+		var statuses []Status
+		require.NoError(tx.Scopes(ExcludeSilenced).Find(&statuses).Error)
+		require.Len(statuses, 1)
+		require.Equal(visible.ID, statuses[0].ID)
+	})
+}
+
+func TestDomainBlockPublicDomain(t *testing.T) {
+	require := require.New(t)
+	block := DomainBlock{Domain: "remote.example"}
+	require.Equal("remote.example", block.PublicDomain())
+	block.Obfuscate = true
+	require.Equal("r*m*t*.*x*m*l*", block.PublicDomain())
+}
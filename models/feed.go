@@ -0,0 +1,138 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bardic/pub/internal/snowflake"
+	"gorm.io/gorm"
+)
+
+// A Feed is an RSS or Atom feed which is followed as if it were an actor.
+// Each Feed has a remote Service Actor, whose statuses are the feed's entries.
+type Feed struct {
+	ActorID snowflake.ID `gorm:"primarykey;autoIncrement:false"`
+	Actor   *Actor       `gorm:"constraint:OnDelete:CASCADE;<-:false"`
+	// URL is the address the feed is fetched from.
+	URL string `gorm:"size:128;uniqueIndex;not null"`
+	// ETag is the entity tag of the last successful fetch, sent as If-None-Match.
+	ETag string `gorm:"size:255;not null;default:''"`
+	// LastModified is the Last-Modified header of the last successful fetch, sent as If-Modified-Since.
+	LastModified string `gorm:"size:64;not null;default:''"`
+	// PolledAt is the time the feed was last polled.
+	PolledAt time.Time
+	// LastResult is the error of the last poll, if it failed.
+	LastResult string `gorm:"type:text"`
+}
+
+type Feeds struct {
+	db *gorm.DB
+}
+
+func NewFeeds(db *gorm.DB) *Feeds {
+	return &Feeds{
+		db: db,
+	}
+}
+
+// Create creates a feed, and its actor, for the feed at uri.
+func (f *Feeds) Create(uri, title, description, link, image string) (*Feed, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return nil, fmt.Errorf("Feeds.Create: %q is not an http or https URL", uri)
+	}
+	if len(uri) > 128 {
+		return nil, errors.New("Feeds.Create: feed URL is too long")
+	}
+	if title == "" {
+		title = u.Host
+	}
+	feed := Feed{
+		URL: uri,
+		Actor: &Actor{
+			ID:          snowflake.Now(),
+			Type:        "Service",
+			URI:         uri,
+			Name:        feedName(u),
+			Domain:      u.Host,
+			DisplayName: truncate(title, 128),
+			Note:        description,
+			Avatar:      truncate(image, 255),
+			PublicKey:   []byte{},
+		},
+	}
+	if link != "" && len(link) <= 255 {
+		feed.Actor.Attributes = []*ActorAttribute{{Name: "Website", Value: link}}
+	}
+	err = f.db.Transaction(func(tx *gorm.DB) error {
+		var taken int64
+		if err := tx.Model(&Actor{}).Where("name = ? and domain = ?", feed.Actor.Name, feed.Actor.Domain).Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			// another feed on this host has the same name, tell them apart by their URL.
+			feed.Actor.Name = uniqueFeedName(feed.Actor.Name, uri)
+		}
+		if err := tx.Create(feed.Actor).Error; err != nil {
+			return err
+		}
+		feed.ActorID = feed.Actor.ID
+		return tx.Create(&feed).Error
+	})
+	return &feed, err
+}
+
+// FindByActor returns the feed of actor.
+func (f *Feeds) FindByActor(actor *Actor) (*Feed, error) {
+	var feed Feed
+	if err := f.db.Preload("Actor").Take(&feed, "actor_id = ?", actor.ID).Error; err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
+
+// isFeed reports whether the actor with id is the actor of a feed. Feed actors
+// have no ActivityPub representation, so are neither fetched nor followed.
+func isFeed(tx *gorm.DB, actorID snowflake.ID) (bool, error) {
+	var count int64
+	err := tx.Model(&Feed{}).Where("actor_id = ?", actorID).Count(&count).Error
+	return count > 0, err
+}
+
+var nonName = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// feedName returns the actor name for the feed at u; its path, with the extension
+// removed, reduced to the characters allowed in a username.
+func feedName(u *url.URL) string {
+	path := strings.TrimSuffix(u.Path, "/")
+	if i := strings.LastIndexByte(path, '.'); i > strings.LastIndexByte(path, '/') {
+		path = path[:i]
+	}
+	name := strings.Trim(nonName.ReplaceAllString(path, "_"), "_")
+	if name == "" {
+		name = "feed"
+	}
+	return truncate(name, 64)
+}
+
+// uniqueFeedName returns name suffixed with a hash of the feed's uri.
+func uniqueFeedName(name, uri string) string {
+	sum := sha256.Sum256([]byte(uri))
+	return truncate(name, 55) + "_" + hex.EncodeToString(sum[:4])
+}
+
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
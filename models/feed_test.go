@@ -0,0 +1,26 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeedsCreate(t *testing.T) {
+	db := setupTestDB(t)
+
+	t.Run("feeds on the same host whose names collide get distinct names", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		feeds := NewFeeds(tx)
+		xml, err := feeds.Create("https://blog.example/feed.xml", "", "", "", "")
+		require.NoError(err)
+		require.Equal("feed", xml.Actor.Name)
+		atom, err := feeds.Create("https://blog.example/feed.atom", "", "", "", "")
+		require.NoError(err)
+		require.NotEqual(xml.Actor.Name, atom.Actor.Name)
+		require.Regexp(`^feed_[0-9a-f]{8}$`, atom.Actor.Name)
+	})
+}
@@ -0,0 +1,238 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bardic/pub/internal/snowflake"
+	"golang.org/x/net/html"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// An AccountFilter matches statuses which contain any of its Keywords, or are one
+// of its Statuses. Matching statuses are hidden, or shown behind a warning, in the
+// contexts the filter applies to.
+type AccountFilter struct {
+	snowflake.ID `gorm:"primarykey;autoIncrement:false"`
+	AccountID    snowflake.ID `gorm:"not null;index"`
+	Account      *Account     `gorm:"constraint:OnDelete:CASCADE;<-:false;"`
+	Title        string       `gorm:"size:255;not null"`
+	// ContextHome applies the filter to the home and list timelines.
+	ContextHome bool `gorm:"not null;default:false"`
+	// ContextNotifications applies the filter to notifications.
+	ContextNotifications bool `gorm:"not null;default:false"`
+	// ContextPublic applies the filter to the public and tag timelines.
+	ContextPublic bool `gorm:"not null;default:false"`
+	// ContextThread applies the filter to the context of a status.
+	ContextThread bool `gorm:"not null;default:false"`
+	// ContextAccount applies the filter to the statuses of an account.
+	ContextAccount bool `gorm:"not null;default:false"`
+	// ExpiresAt is the time the filter stops applying, or nil if it does not expire.
+	ExpiresAt *time.Time
+	Action    FilterAction           `gorm:"not null;default:'warn'"`
+	Keywords  []AccountFilterKeyword `gorm:"constraint:OnDelete:CASCADE;"`
+	Statuses  []AccountFilterStatus  `gorm:"constraint:OnDelete:CASCADE;"`
+}
+
+// An AccountFilterKeyword is a word or phrase an AccountFilter matches.
+type AccountFilterKeyword struct {
+	snowflake.ID    `gorm:"primarykey;autoIncrement:false"`
+	AccountFilterID snowflake.ID   `gorm:"not null;index"`
+	AccountFilter   *AccountFilter `gorm:"constraint:OnDelete:CASCADE;<-:false;"`
+	Keyword         string         `gorm:"size:255;not null"`
+	// WholeWord matches the keyword only if it is not part of a longer word.
+	WholeWord bool `gorm:"not null"`
+}
+
+// An AccountFilterStatus is a status an AccountFilter matches.
+type AccountFilterStatus struct {
+	snowflake.ID    `gorm:"primarykey;autoIncrement:false"`
+	AccountFilterID snowflake.ID   `gorm:"not null;index"`
+	AccountFilter   *AccountFilter `gorm:"constraint:OnDelete:CASCADE;<-:false;"`
+	StatusID        snowflake.ID   `gorm:"not null"`
+	Status          *Status        `gorm:"constraint:OnDelete:CASCADE;<-:false;"`
+}
+
+// FilterAction is what happens to the statuses an AccountFilter matches.
+//   - warn: the status is shown behind a warning naming the filter.
+//   - hide: the status is not shown.
+type FilterAction string
+
+func (FilterAction) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	switch db.Dialector.Name() {
+	case "mysql", "postgres":
+		return "enum('warn', 'hide')"
+	case "sqlite":
+		return "TEXT"
+	default:
+		return ""
+	}
+}
+
+// FilterContext is where an AccountFilter applies.
+//   - home: the home and list timelines.
+//   - notifications: notifications.
+//   - public: the public and tag timelines.
+//   - thread: the context of a status.
+//   - account: the statuses of an account.
+type FilterContext string
+
+// Contexts returns the contexts the filter applies to.
+func (f *AccountFilter) Contexts() []FilterContext {
+	contexts := []FilterContext{}
+	for _, c := range []struct {
+		context FilterContext
+		set     bool
+	}{
+		{"home", f.ContextHome},
+		{"notifications", f.ContextNotifications},
+		{"public", f.ContextPublic},
+		{"thread", f.ContextThread},
+		{"account", f.ContextAccount},
+	} {
+		if c.set {
+			contexts = append(contexts, c.context)
+		}
+	}
+	return contexts
+}
+
+// SetContexts sets the contexts the filter applies to. At least one context is
+// required.
+func (f *AccountFilter) SetContexts(contexts []string) error {
+	if len(contexts) == 0 {
+		return errors.New("at least one context is required")
+	}
+	f.ContextHome, f.ContextNotifications, f.ContextPublic, f.ContextThread, f.ContextAccount = false, false, false, false, false
+	for _, c := range contexts {
+		switch c {
+		case "home":
+			f.ContextHome = true
+		case "notifications":
+			f.ContextNotifications = true
+		case "public":
+			f.ContextPublic = true
+		case "thread":
+			f.ContextThread = true
+		case "account":
+			f.ContextAccount = true
+		default:
+			return errors.New("invalid context: " + c)
+		}
+	}
+	return nil
+}
+
+// Match returns the keywords of the filter which st contains, and the IDs of the
+// statuses of the filter st is. If st is a reblog, the reblogged status is matched.
+func (f *AccountFilter) Match(st *Status) (keywords []string, statuses []snowflake.ID) {
+	if st.Reblog != nil {
+		st = st.Reblog
+	}
+	for _, fs := range f.Statuses {
+		if fs.StatusID == st.ID {
+			statuses = append(statuses, fs.StatusID)
+		}
+	}
+	if len(f.Keywords) == 0 {
+		return keywords, statuses
+	}
+	text := statusText(st)
+	for _, kw := range f.Keywords {
+		if kw.matchString(text) {
+			keywords = append(keywords, kw.Keyword)
+		}
+	}
+	return keywords, statuses
+}
+
+// matchString reports whether text contains the keyword, ignoring case. If the
+// keyword is whole word, it must not be adjacent to other word characters.
+func (kw *AccountFilterKeyword) matchString(text string) bool {
+	if kw.Keyword == "" {
+		return false
+	}
+	expr := regexp.QuoteMeta(kw.Keyword)
+	if kw.WholeWord {
+		if isWordChar(kw.Keyword[0]) {
+			expr = `\b` + expr
+		}
+		if isWordChar(kw.Keyword[len(kw.Keyword)-1]) {
+			expr = expr + `\b`
+		}
+	}
+	re, err := regexp.Compile(`(?i)` + expr)
+	if err != nil {
+		return false
+	}
+	return re.MatchString(text)
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// statusText returns the text a filter matches st against; its content warning,
+// the text of its content, the options of its poll, and the descriptions of its
+// attachments, each on a separate line.
+func statusText(st *Status) string {
+	lines := []string{st.SpoilerText}
+	var sb strings.Builder
+	z := html.NewTokenizer(strings.NewReader(st.Note))
+	for tt := z.Next(); tt != html.ErrorToken; tt = z.Next() {
+		switch tt {
+		case html.TextToken:
+			sb.Write(z.Text())
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if name, _ := z.TagName(); string(name) == "p" || string(name) == "br" {
+				sb.WriteByte('\n')
+			}
+		}
+	}
+	lines = append(lines, sb.String())
+	if st.Poll != nil {
+		for _, option := range st.Poll.Options {
+			lines = append(lines, option.Title)
+		}
+	}
+	for _, att := range st.Attachments {
+		lines = append(lines, att.Name)
+	}
+	return strings.Join(lines, "\n")
+}
+
+type AccountFilters struct {
+	db *gorm.DB
+}
+
+func NewAccountFilters(db *gorm.DB) *AccountFilters {
+	return &AccountFilters{db: db}
+}
+
+// Active returns the filters of account which apply to context and have not expired.
+func (f *AccountFilters) Active(account *Account, context FilterContext) ([]*AccountFilter, error) {
+	query := f.db.Preload("Keywords").Preload("Statuses").
+		Where("account_id = ? and (expires_at IS NULL or expires_at > ?)", account.ID, time.Now())
+	switch context {
+	case "home":
+		query = query.Where("context_home = ?", true)
+	case "notifications":
+		query = query.Where("context_notifications = ?", true)
+	case "public":
+		query = query.Where("context_public = ?", true)
+	case "thread":
+		query = query.Where("context_thread = ?", true)
+	case "account":
+		query = query.Where("context_account = ?", true)
+	default:
+		return nil, errors.New("invalid context: " + string(context))
+	}
+	var filters []*AccountFilter
+	if err := query.Find(&filters).Error; err != nil {
+		return nil, err
+	}
+	return filters, nil
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bardic/pub/internal/snowflake"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountFilterMatch(t *testing.T) {
+	status := &Status{
+		ID:          snowflake.Now(),
+		SpoilerText: "cooking",
+		Note:        "<p>Making <a href=\"https://example.com/tags/soup\">#soup</a> for dinner</p><p>with carrots</p>",
+		Poll:        &StatusPoll{Options: []StatusPollOption{{Title: "pumpkin"}}},
+		Attachments: []*StatusAttachment{{Attachment: Attachment{Name: "a bowl of broth"}}},
+	}
+
+	tests := []struct {
+		name     string
+		keywords []AccountFilterKeyword
+		want     []string
+	}{
+		{"content", []AccountFilterKeyword{{Keyword: "dinner", WholeWord: true}}, []string{"dinner"}},
+		{"ignores case", []AccountFilterKeyword{{Keyword: "DINNER", WholeWord: true}}, []string{"DINNER"}},
+		{"spoiler text", []AccountFilterKeyword{{Keyword: "cooking", WholeWord: true}}, []string{"cooking"}},
+		{"poll options", []AccountFilterKeyword{{Keyword: "pumpkin", WholeWord: true}}, []string{"pumpkin"}},
+		{"attachment descriptions", []AccountFilterKeyword{{Keyword: "broth", WholeWord: true}}, []string{"broth"}},
+		{"hashtags", []AccountFilterKeyword{{Keyword: "#soup", WholeWord: true}}, []string{"#soup"}},
+		{"phrases", []AccountFilterKeyword{{Keyword: "with carrots", WholeWord: true}}, []string{"with carrots"}},
+		{"whole word", []AccountFilterKeyword{{Keyword: "carrot", WholeWord: true}}, nil},
+		{"part of a word", []AccountFilterKeyword{{Keyword: "carrot", WholeWord: false}}, []string{"carrot"}},
+		{"markup is not matched", []AccountFilterKeyword{{Keyword: "href", WholeWord: false}}, nil},
+		{"paragraphs are separated", []AccountFilterKeyword{{Keyword: "dinnerwith", WholeWord: false}}, nil},
+		{"empty keyword", []AccountFilterKeyword{{Keyword: "", WholeWord: true}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &AccountFilter{Keywords: tt.keywords}
+			keywords, statuses := f.Match(status)
+			require.Equal(t, tt.want, keywords)
+			require.Empty(t, statuses)
+		})
+	}
+
+	t.Run("statuses", func(t *testing.T) {
+		require := require.New(t)
+		f := &AccountFilter{Statuses: []AccountFilterStatus{{StatusID: status.ID}}}
+		keywords, statuses := f.Match(status)
+		require.Empty(keywords)
+		require.Equal([]snowflake.ID{status.ID}, statuses)
+	})
+
+	t.Run("reblogs match the reblogged status", func(t *testing.T) {
+		require := require.New(t)
+		f := &AccountFilter{
+			Keywords: []AccountFilterKeyword{{Keyword: "dinner", WholeWord: true}},
+			Statuses: []AccountFilterStatus{{StatusID: status.ID}},
+		}
+		keywords, statuses := f.Match(&Status{ID: snowflake.Now(), Reblog: status})
+		require.Equal([]string{"dinner"}, keywords)
+		require.Equal([]snowflake.ID{status.ID}, statuses)
+	})
+}
+
+func TestAccountFilterContexts(t *testing.T) {
+	require := require.New(t)
+
+	var f AccountFilter
+	require.Error(f.SetContexts(nil))
+	require.Error(f.SetContexts([]string{"home", "elsewhere"}))
+	require.NoError(f.SetContexts([]string{"thread", "home"}))
+	require.Equal([]FilterContext{"home", "thread"}, f.Contexts())
+	require.NoError(f.SetContexts([]string{"account"}))
+	require.Equal([]FilterContext{"account"}, f.Contexts())
+}
+
+func TestAccountFilters(t *testing.T) {
+	db := setupTestDB(t)
+
+	t.Run("Active", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		alice, err := NewAccounts(tx).Create(MockInstance(t, tx, "example.com"), "alice", "alice@example.com", "password")
+		require.NoError(err)
+		expired := time.Now().Add(-time.Hour)
+		expires := time.Now().Add(time.Hour)
+		for _, f := range []*AccountFilter{
+			{ID: snowflake.Now(), AccountID: alice.ID, Title: "home", ContextHome: true, Action: "warn",
+				Keywords: []AccountFilterKeyword{{ID: snowflake.Now(), Keyword: "soup"}}},
+			{ID: snowflake.Now(), AccountID: alice.ID, Title: "expires", ContextHome: true, ContextPublic: true, ExpiresAt: &expires, Action: "hide"},
+			{ID: snowflake.Now(), AccountID: alice.ID, Title: "expired", ContextHome: true, ExpiresAt: &expired, Action: "warn"},
+			{ID: snowflake.Now(), AccountID: alice.ID, Title: "thread", ContextThread: true, Action: "warn"},
+		} {
+			require.NoError(tx.Create(f).Error)
+		}
+
+		titles := func(context FilterContext) []string {
+			filters, err := NewAccountFilters(tx).Active(alice, context)
+			require.NoError(err)
+			var titles []string
+			for _, f := range filters {
+				titles = append(titles, f.Title)
+			}
+			return titles
+		}
+		require.ElementsMatch([]string{"home", "expires"}, titles("home"))
+		require.Equal([]string{"expires"}, titles("public"))
+		require.Equal([]string{"thread"}, titles("thread"))
+		require.Empty(titles("notifications"))
+
+		filters, err := NewAccountFilters(tx).Active(alice, "home")
+		require.NoError(err)
+		for _, f := range filters {
+			if f.Title == "home" {
+				require.Len(f.Keywords, 1)
+				require.False(f.Keywords[0].WholeWord)
+			}
+		}
+
+		_, err = NewAccountFilters(tx).Active(alice, "elsewhere")
+		require.Error(err)
+	})
+}
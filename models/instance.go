@@ -6,8 +6,10 @@ import (
 
 	"github.com/bardic/pub/internal/crypto"
 	"github.com/bardic/pub/internal/snowflake"
+	"github.com/bardic/pub/internal/webpush"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // An Instance is an ActivityPub domain managed by this server.
@@ -28,6 +30,9 @@ type Instance struct {
 	StatusesCount    int            `gorm:"default:0;not null"`
 	DomainsCount     int32          `gorm:"default:0;not null"`
 	Rules            []InstanceRule `gorm:"constraint:OnDelete:CASCADE;"`
+	// VapidPublicKey and VapidPrivateKey are the keys Web Push messages from this instance are signed with.
+	VapidPublicKey  string `gorm:"size:128;not null;default:''"`
+	VapidPrivateKey string `gorm:"size:64;not null;default:''"`
 }
 
 type InstanceRule struct {
@@ -54,6 +59,11 @@ func (i *Instances) Create(domain, title, description, adminEmail string) (*Inst
 			return err
 		}
 
+		vapid, err := webpush.GenerateVAPIDKeys()
+		if err != nil {
+			return err
+		}
+
 		// use the first 72 bytes of the private key as the bcrypt password for the admin account
 		passwd := trim(kp.PrivateKey, 72)
 
@@ -73,6 +83,8 @@ func (i *Instances) Create(domain, title, description, adminEmail string) (*Inst
 			Rules: []InstanceRule{{
 				Text: "No loafing",
 			}},
+			VapidPublicKey:  vapid.PublicKey,
+			VapidPrivateKey: vapid.PrivateKey,
 		}
 		if err := tx.Create(&instance).Error; err != nil {
 			return err
@@ -117,6 +129,126 @@ func (i *Instances) Create(domain, title, description, adminEmail string) (*Inst
 	return &instance, err
 }
 
+// InstanceUsage is the number of users of an Instance, and of the statuses they have posted.
+type InstanceUsage struct {
+	Users int64
+	// ActiveMonth and ActiveHalfyear are the users who have posted in the last 30 and 180 days.
+	ActiveMonth    int64
+	ActiveHalfyear int64
+	LocalPosts     int64
+}
+
+// Usage returns the usage of instance. The instance's admin is a service actor, and
+// is not counted as a user.
+func (i *Instances) Usage(instance *Instance) (*InstanceUsage, error) {
+	users := func() *gorm.DB {
+		return i.db.Model(&Actor{}).Where("type = ? and id IN (?)", "LocalPerson", i.db.Model(&Account{}).Select("actor_id").Where("instance_id = ?", instance.ID))
+	}
+	var usage InstanceUsage
+	if err := users().Count(&usage.Users).Error; err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if err := users().Where("last_status_at > ?", now.AddDate(0, 0, -30)).Count(&usage.ActiveMonth).Error; err != nil {
+		return nil, err
+	}
+	if err := users().Where("last_status_at > ?", now.AddDate(0, 0, -180)).Count(&usage.ActiveHalfyear).Error; err != nil {
+		return nil, err
+	}
+	// reblogs are not posts.
+	posts := i.db.Model(&Status{}).Where("reblog_id IS NULL and actor_id IN (?)", users().Select("id"))
+	if err := posts.Count(&usage.LocalPosts).Error; err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// An InstanceActivity is the activity of an Instance's users in the week starting at Week.
+// InstanceActivities are recounted by the InstanceActivityProcessor.
+type InstanceActivity struct {
+	InstanceID snowflake.ID `gorm:"primarykey;autoIncrement:false"`
+	Instance   *Instance    `gorm:"constraint:OnDelete:CASCADE;<-:false;"`
+	// Week is midnight UTC on the Monday the week starts.
+	Week time.Time `gorm:"primarykey;autoIncrement:false"`
+	// Statuses is the number of statuses, excluding reblogs, posted by local users.
+	Statuses int `gorm:"not null;default:0"`
+	// Logins is the number of users who signed in.
+	Logins int `gorm:"not null;default:0"`
+	// Registrations is the number of accounts created.
+	Registrations int `gorm:"not null;default:0"`
+}
+
+// ActivityWeeks is the number of weeks of activity reported for an instance.
+const ActivityWeeks = 12
+
+// StartOfWeek returns the start of the week containing t.
+func StartOfWeek(t time.Time) time.Time {
+	t = t.UTC().Truncate(24 * time.Hour)
+	// time.Weekday counts from Sunday, weeks start on Monday.
+	return t.AddDate(0, 0, -(int(t.Weekday())+6)%7)
+}
+
+// UpdateActivity recounts the activity of instance in the week starting at week.
+func (i *Instances) UpdateActivity(instance *Instance, week time.Time) error {
+	end := week.AddDate(0, 0, 7)
+	accounts := func() *gorm.DB {
+		return i.db.Model(&Account{}).Where("instance_id = ?", instance.ID)
+	}
+	activity := InstanceActivity{
+		InstanceID: instance.ID,
+		Week:       week,
+	}
+	var count int64
+	if err := i.db.Model(&Status{}).Where("id >= ? and id < ? and reblog_id IS NULL and actor_id IN (?)", minID(week), minID(end), accounts().Select("actor_id")).Count(&count).Error; err != nil {
+		return err
+	}
+	activity.Statuses = int(count)
+	if err := i.db.Model(&Token{}).Distinct("account_id").Where("created_at >= ? and created_at < ? and account_id IN (?)", week, end, accounts().Select("id")).Count(&count).Error; err != nil {
+		return err
+	}
+	activity.Logins = int(count)
+	// as with accounts_count, the admin service account is not a registration.
+	users := i.db.Model(&Actor{}).Select("id").Where("type = ?", "LocalPerson")
+	if err := accounts().Where("id >= ? and id < ? and actor_id IN (?)", minID(week), minID(end), users).Count(&count).Error; err != nil {
+		return err
+	}
+	activity.Registrations = int(count)
+	return i.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "instance_id"}, {Name: "week"}},
+		DoUpdates: clause.AssignmentColumns([]string{"statuses", "logins", "registrations"}),
+	}).Create(&activity).Error
+}
+
+// Activity returns the activity of instance in each of the last ActivityWeeks weeks,
+// most recent first. Weeks which have not been counted have no activity.
+func (i *Instances) Activity(instance *Instance) ([]*InstanceActivity, error) {
+	week := StartOfWeek(time.Now())
+	since := week.AddDate(0, 0, -7*(ActivityWeeks-1))
+	var counted []*InstanceActivity
+	if err := i.db.Where("instance_id = ? and week >= ?", instance.ID, since).Find(&counted).Error; err != nil {
+		return nil, err
+	}
+	byWeek := make(map[int64]*InstanceActivity, len(counted))
+	for _, a := range counted {
+		byWeek[a.Week.Unix()] = a
+	}
+	activity := make([]*InstanceActivity, 0, ActivityWeeks)
+	for n := 0; n < ActivityWeeks; n++ {
+		w := week.AddDate(0, 0, -7*n)
+		a, ok := byWeek[w.Unix()]
+		if !ok {
+			a = &InstanceActivity{InstanceID: instance.ID, Week: w}
+		}
+		activity = append(activity, a)
+	}
+	return activity, nil
+}
+
+// minID returns the smallest ID which can be created at t.
+func minID(t time.Time) snowflake.ID {
+	return snowflake.ID(uint64(t.UnixMilli()) << 16)
+}
+
 // trim trims the first n bytes from the given byte slice
 func trim[S []T, T any](s S, n int) S {
 	return s[:min(len(s), n)]
@@ -2,7 +2,9 @@ package models
 
 import (
 	"testing"
+	"time"
 
+	"github.com/bardic/pub/internal/snowflake"
 	"github.com/stretchr/testify/require"
 )
 
@@ -36,4 +38,95 @@ func TestInstances(t *testing.T) {
 		require.Error(err)
 		require.Equal("record not found", err.Error())
 	})
+
+	t.Run("usage", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		instance := MockInstance(t, tx, "example.com")
+		alice, err := NewAccounts(tx).Create(instance, "alice", "alice@example.com", "password")
+		require.NoError(err)
+		_, err = NewAccounts(tx).Create(instance, "bob", "bob@example.com", "password")
+		require.NoError(err)
+		_, err = NewStatuses(tx).Create(alice.Actor, nil, "public", false, "", "en", "hello")
+		require.NoError(err)
+		remote := MockActor(t, tx, "carol", "remote.example")
+		MockStatus(t, tx, remote, "not local")
+
+		usage, err := NewInstances(tx).Usage(instance)
+		require.NoError(err)
+		require.EqualValues(2, usage.Users)
+		require.EqualValues(1, usage.ActiveMonth)
+		require.EqualValues(1, usage.ActiveHalfyear)
+		require.EqualValues(1, usage.LocalPosts)
+
+		// bob last posted a year ago.
+		require.NoError(tx.Model(&Actor{}).Where("name = ?", "bob").UpdateColumn("last_status_at", time.Now().AddDate(-1, 0, 0)).Error)
+		usage, err = NewInstances(tx).Usage(instance)
+		require.NoError(err)
+		require.EqualValues(1, usage.ActiveHalfyear)
+	})
+	t.Run("counters", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		instance := MockInstance(t, tx, "example.com")
+		alice, err := NewAccounts(tx).Create(instance, "alice", "alice@example.com", "password")
+		require.NoError(err)
+		status, err := NewStatuses(tx).Create(alice.Actor, nil, "public", false, "", "en", "hello")
+		require.NoError(err)
+		_, err = NewReactions(tx).Reblog(status, alice.Actor)
+		require.NoError(err)
+		remote := MockActor(t, tx, "bob", "remote.example")
+		MockStatus(t, tx, remote, "not local")
+
+		var i Instance
+		require.NoError(tx.Take(&i, instance.ID).Error)
+		require.Equal(1, i.AccountsCount)
+		require.Equal(1, i.StatusesCount)
+
+		require.NoError(tx.Delete(status).Error)
+		require.NoError(tx.Take(&i, instance.ID).Error)
+		require.Equal(0, i.StatusesCount)
+	})
+
+	t.Run("activity", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		instance := MockInstance(t, tx, "example.com")
+		alice, err := NewAccounts(tx).Create(instance, "alice", "alice@example.com", "password")
+		require.NoError(err)
+		_, err = NewStatuses(tx).Create(alice.Actor, nil, "public", false, "", "en", "hello")
+		require.NoError(err)
+		app := &Application{ID: snowflake.Now(), InstanceID: instance.ID, Name: "test", ClientID: "id", ClientSecret: "secret"}
+		require.NoError(tx.Create(app).Error)
+		require.NoError(tx.Create(&Token{AccessToken: "token", AccountID: &alice.ID, ApplicationID: app.ID, TokenType: "Bearer"}).Error)
+
+		week := StartOfWeek(time.Now())
+		require.NoError(NewInstances(tx).UpdateActivity(instance, week))
+		// recounting updates the week's activity in place.
+		require.NoError(NewInstances(tx).UpdateActivity(instance, week))
+
+		activity, err := NewInstances(tx).Activity(instance)
+		require.NoError(err)
+		require.Len(activity, ActivityWeeks)
+		require.Equal(week.Unix(), activity[0].Week.Unix())
+		require.Equal(1, activity[0].Statuses)
+		require.Equal(1, activity[0].Logins)
+		require.Equal(1, activity[0].Registrations, "alice, not the admin")
+		require.Equal(week.AddDate(0, 0, -7).Unix(), activity[1].Week.Unix())
+		require.Zero(activity[1].Statuses)
+	})
+}
+
+func TestStartOfWeek(t *testing.T) {
+	require := require.New(t)
+	monday := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+	require.Equal(monday, StartOfWeek(monday))
+	require.Equal(monday, StartOfWeek(time.Date(2023, 5, 3, 12, 30, 0, 0, time.UTC)))
+	require.Equal(monday, StartOfWeek(time.Date(2023, 5, 7, 23, 59, 0, 0, time.UTC)))
 }
@@ -0,0 +1,166 @@
+package models
+
+import (
+	"time"
+
+	"github.com/bardic/pub/internal/snowflake"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// A Notification tells a local Account that another actor has interacted with
+// it, or its statuses. Notifications are created by hooks on the Status,
+// Relationship and Reaction models, and by the PollNotificationProcessor.
+type Notification struct {
+	snowflake.ID `gorm:"primarykey;autoIncrement:false"`
+	// AccountID is the ID of the account being notified.
+	AccountID snowflake.ID `gorm:"not null;index"`
+	Account   *Account     `gorm:"constraint:OnDelete:CASCADE;<-:false;"`
+	// FromActorID is the ID of the actor whose action caused the notification.
+	FromActorID snowflake.ID `gorm:"not null"`
+	FromActor   *Actor       `gorm:"constraint:OnDelete:CASCADE;<-:false;"`
+	// StatusID is the ID of the status the notification is about, if any.
+	StatusID *snowflake.ID
+	Status   *Status          `gorm:"constraint:OnDelete:CASCADE;<-:false;"`
+	Type     NotificationType `gorm:"not null"`
+}
+
+// AfterCreate schedules the delivery of the notification to the push subscriptions
+// of its account.
+func (n *Notification) AfterCreate(tx *gorm.DB) error {
+	return forEach(tx, n.createPushRequest)
+}
+
+// createPushRequest creates a push request for the notification, if its account
+// has any push subscriptions.
+func (n *Notification) createPushRequest(tx *gorm.DB) error {
+	var count int64
+	if err := tx.Model(&PushSubscription{}).Where("account_id = ?", n.AccountID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return nil
+	}
+	return tx.Create(&PushRequest{NotificationID: n.ID}).Error
+}
+
+// NotificationType is the kind of event a Notification is for.
+//   - mention: a status mentions the account.
+//   - status: an actor the account has enabled notifications for has posted.
+//   - reblog: a status of the account has been reblogged.
+//   - follow: the account has been followed.
+//   - follow_request: the account is locked, and has been followed.
+//   - favourite: a status of the account has been favourited.
+//   - poll: a poll of the account has ended.
+//   - update: a status the account reblogged has been edited.
+type NotificationType string
+
+func (NotificationType) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	switch db.Dialector.Name() {
+	case "mysql", "postgres":
+		return "enum('mention', 'status', 'reblog', 'follow', 'follow_request', 'favourite', 'poll', 'update')"
+	case "sqlite":
+		return "TEXT"
+	default:
+		return ""
+	}
+}
+
+// notify notifies the account of the local actor recipientID of an action by the
+// actor fromID. Remote recipients, actors acting upon themselves, and actors
+// the recipient mutes or blocks, do not cause a notification.
+func notify(tx *gorm.DB, typ NotificationType, recipientID, fromID snowflake.ID, statusID *snowflake.ID) error {
+	if recipientID == fromID {
+		return nil
+	}
+	var accounts []Account
+	if err := tx.Select("id").Where("actor_id = ?", recipientID).Find(&accounts).Error; err != nil {
+		return err
+	}
+	if len(accounts) == 0 {
+		// remote actors are notified by their own server.
+		return nil
+	}
+	var ignored int64
+	if err := tx.Model(&Relationship{}).Where("actor_id = ? and target_id = ? and (muting = ? or blocking = ?)", recipientID, fromID, true, true).Count(&ignored).Error; err != nil {
+		return err
+	}
+	if ignored > 0 {
+		return nil
+	}
+	return tx.Create(&Notification{
+		ID:          snowflake.Now(),
+		AccountID:   accounts[0].ID,
+		FromActorID: fromID,
+		StatusID:    statusID,
+		Type:        typ,
+	}).Error
+}
+
+type Notifications struct {
+	db *gorm.DB
+}
+
+func NewNotifications(db *gorm.DB) *Notifications {
+	return &Notifications{db: db}
+}
+
+// Update notifies the local actors who reblogged status that it has been edited.
+func (n *Notifications) Update(status *Status) error {
+	var reactions []Reaction
+	if err := n.db.Where("status_id = ? and reblogged = ?", status.ID, true).Find(&reactions).Error; err != nil {
+		return err
+	}
+	for _, r := range reactions {
+		if err := notify(n.db, "update", r.ActorID, status.ActorID, &status.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EndedPolls notifies the local authors of polls which have ended since they were
+// last notified. Votes are not recorded, so voters are not notified.
+func (n *Notifications) EndedPolls(now time.Time) error {
+	local := n.db.Model(&Account{}).Select("actor_id")
+	// polls without an end time have a zero expires_at.
+	ended := n.db.Model(&StatusPoll{}).Select("status_id").Where("expires_at BETWEEN ? AND ?", time.Unix(0, 0), now)
+	notified := n.db.Model(&Notification{}).Select("status_id").Where("type = ? and status_id IS NOT NULL", "poll")
+	var statuses []Status
+	if err := n.db.Where("actor_id IN (?) and id IN (?) and id NOT IN (?)", local, ended, notified).Find(&statuses).Error; err != nil {
+		return err
+	}
+	for i := range statuses {
+		st := &statuses[i]
+		var account Account
+		if err := n.db.Select("id").Take(&account, "actor_id = ?", st.ActorID).Error; err != nil {
+			return err
+		}
+		if err := n.db.Create(&Notification{
+			ID:          snowflake.Now(),
+			AccountID:   account.ID,
+			FromActorID: st.ActorID,
+			StatusID:    &st.ID,
+			Type:        "poll",
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnreadCount returns the number of notifications of account newer than its
+// notifications marker.
+func (n *Notifications) UnreadCount(account *Account) (int64, error) {
+	var markers []AccountMarker
+	if err := n.db.Where("account_id = ? and name = ?", account.ID, "notifications").Find(&markers).Error; err != nil {
+		return 0, err
+	}
+	var lastReadID snowflake.ID
+	if len(markers) > 0 {
+		lastReadID = markers[0].LastReadID
+	}
+	var count int64
+	err := n.db.Model(&Notification{}).Where("account_id = ? and id > ?", account.ID, lastReadID).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,210 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bardic/pub/internal/snowflake"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestNotifications(t *testing.T) {
+	db := setupTestDB(t)
+
+	// notifications returns the types of the notifications of account, oldest first.
+	notifications := func(t *testing.T, tx *gorm.DB, account *Account) []NotificationType {
+		t.Helper()
+		var ns []Notification
+		require.NoError(t, tx.Order("id asc").Find(&ns, "account_id = ?", account.ID).Error)
+		var types []NotificationType
+		for _, n := range ns {
+			types = append(types, n.Type)
+		}
+		return types
+	}
+
+	t.Run("mentions", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		alice, err := NewAccounts(tx).Create(MockInstance(t, tx, "example.com"), "alice", "alice@example.com", "password")
+		require.NoError(err)
+		bob := MockActor(t, tx, "bob", "remote.example")
+		id := snowflake.Now()
+		require.NoError(tx.Create(&Status{
+			ID:           id,
+			URI:          "https://remote.example/bob/status/1",
+			ActorID:      bob.ID,
+			Conversation: &Conversation{Visibility: "public"},
+			Visibility:   "public",
+			Mentions:     []StatusMention{{StatusID: id, ActorID: alice.ActorID}},
+		}).Error)
+
+		require.Equal([]NotificationType{"mention"}, notifications(t, tx, alice))
+	})
+
+	t.Run("follows, favourites and reblogs", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		alice, err := NewAccounts(tx).Create(MockInstance(t, tx, "example.com"), "alice", "alice@example.com", "password")
+		require.NoError(err)
+		status, err := NewStatuses(tx).Create(alice.Actor, nil, "public", false, "", "en", "hello")
+		require.NoError(err)
+		bob := MockActor(t, tx, "bob", "remote.example")
+
+		_, err = NewRelationships(tx).Follow(bob, alice.Actor)
+		require.NoError(err)
+		_, err = NewReactions(tx).Favourite(status, bob)
+		require.NoError(err)
+		_, err = NewReactions(tx).Reblog(status, bob)
+		require.NoError(err)
+		// alice's own reactions are not notified.
+		_, err = NewReactions(tx).Favourite(status, alice.Actor)
+		require.NoError(err)
+
+		require.ElementsMatch([]NotificationType{"follow", "favourite", "reblog"}, notifications(t, tx, alice))
+	})
+
+	t.Run("locked accounts are notified of follows, as follows are granted immediately", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		alice, err := NewAccounts(tx).Create(MockInstance(t, tx, "example.com"), "alice", "alice@example.com", "password")
+		require.NoError(err)
+		require.NoError(tx.Model(alice.Actor).UpdateColumn("locked", true).Error)
+		bob := MockActor(t, tx, "bob", "remote.example")
+
+		_, err = NewRelationships(tx).Follow(bob, &Actor{ID: alice.ActorID})
+		require.NoError(err)
+		require.Equal([]NotificationType{"follow"}, notifications(t, tx, alice))
+	})
+
+	t.Run("muted and blocked actors are not notified", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		alice, err := NewAccounts(tx).Create(MockInstance(t, tx, "example.com"), "alice", "alice@example.com", "password")
+		require.NoError(err)
+		status, err := NewStatuses(tx).Create(alice.Actor, nil, "public", false, "", "en", "hello")
+		require.NoError(err)
+		bob := MockActor(t, tx, "bob", "remote.example")
+		carol := MockActor(t, tx, "carol", "remote.example")
+		_, err = NewRelationships(tx).Mute(alice.Actor, bob)
+		require.NoError(err)
+		_, err = NewRelationships(tx).Block(alice.Actor, carol)
+		require.NoError(err)
+
+		_, err = NewReactions(tx).Favourite(status, bob)
+		require.NoError(err)
+		_, err = NewReactions(tx).Favourite(status, carol)
+		require.NoError(err)
+		require.Empty(notifications(t, tx, alice))
+	})
+
+	t.Run("statuses of notifying follows", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		alice, err := NewAccounts(tx).Create(MockInstance(t, tx, "example.com"), "alice", "alice@example.com", "password")
+		require.NoError(err)
+		bob := MockActor(t, tx, "bob", "remote.example")
+		require.NoError(tx.Create(&Relationship{ActorID: alice.ActorID, TargetID: bob.ID, Following: true, Notifying: true}).Error)
+
+		status := MockStatus(t, tx, bob, "hello")
+		// replies to others are not notified.
+		other := MockActor(t, tx, "carol", "remote.example")
+		reply := MockStatus(t, tx, other, "hi")
+		require.NoError(tx.Create(&Status{
+			ID:               snowflake.Now(),
+			URI:              "https://remote.example/bob/status/reply",
+			ActorID:          bob.ID,
+			InReplyToID:      &reply.ID,
+			InReplyToActorID: &other.ID,
+			Conversation:     &Conversation{Visibility: "public"},
+			Visibility:       "public",
+		}).Error)
+
+		var ns []Notification
+		require.NoError(tx.Find(&ns, "account_id = ?", alice.ID).Error)
+		require.Len(ns, 1)
+		require.EqualValues("status", ns[0].Type)
+		require.Equal(status.ID, *ns[0].StatusID)
+	})
+
+	t.Run("edits of reblogged statuses", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		alice, err := NewAccounts(tx).Create(MockInstance(t, tx, "example.com"), "alice", "alice@example.com", "password")
+		require.NoError(err)
+		bob := MockActor(t, tx, "bob", "remote.example")
+		status := MockStatus(t, tx, bob, "hello")
+		_, err = NewReactions(tx).Reblog(status, alice.Actor)
+		require.NoError(err)
+
+		require.NoError(NewNotifications(tx).Update(status))
+		require.Equal([]NotificationType{"update"}, notifications(t, tx, alice))
+	})
+
+	t.Run("ended polls", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		alice, err := NewAccounts(tx).Create(MockInstance(t, tx, "example.com"), "alice", "alice@example.com", "password")
+		require.NoError(err)
+		ended, err := NewStatuses(tx).Create(alice.Actor, nil, "public", false, "", "en", "ended")
+		require.NoError(err)
+		require.NoError(tx.Create(&StatusPoll{StatusID: ended.ID, ExpiresAt: time.Now().Add(-time.Minute), Options: []StatusPollOption{{Title: "yes"}}}).Error)
+		open, err := NewStatuses(tx).Create(alice.Actor, nil, "public", false, "", "en", "open")
+		require.NoError(err)
+		require.NoError(tx.Create(&StatusPoll{StatusID: open.ID, ExpiresAt: time.Now().Add(time.Hour), Options: []StatusPollOption{{Title: "yes"}}}).Error)
+
+		require.NoError(NewNotifications(tx).EndedPolls(time.Now()))
+		// polls are only notified once.
+		require.NoError(NewNotifications(tx).EndedPolls(time.Now()))
+
+		var ns []Notification
+		require.NoError(tx.Find(&ns, "account_id = ?", alice.ID).Error)
+		require.Len(ns, 1)
+		require.EqualValues("poll", ns[0].Type)
+		require.Equal(ended.ID, *ns[0].StatusID)
+	})
+
+	t.Run("unread count", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		alice, err := NewAccounts(tx).Create(MockInstance(t, tx, "example.com"), "alice", "alice@example.com", "password")
+		require.NoError(err)
+		status, err := NewStatuses(tx).Create(alice.Actor, nil, "public", false, "", "en", "hello")
+		require.NoError(err)
+		bob := MockActor(t, tx, "bob", "remote.example")
+		carol := MockActor(t, tx, "carol", "remote.example")
+		_, err = NewReactions(tx).Favourite(status, bob)
+		require.NoError(err)
+
+		count, err := NewNotifications(tx).UnreadCount(alice)
+		require.NoError(err)
+		require.EqualValues(1, count)
+
+		var read Notification
+		require.NoError(tx.Take(&read, "account_id = ?", alice.ID).Error)
+		require.NoError(tx.Create(&AccountMarker{AccountID: alice.ID, Name: "notifications", LastReadID: read.ID}).Error)
+		_, err = NewReactions(tx).Favourite(status, carol)
+		require.NoError(err)
+
+		count, err = NewNotifications(tx).UnreadCount(alice)
+		require.NoError(err)
+		require.EqualValues(1, count)
+	})
+}
@@ -143,3 +143,42 @@ func PaginateStatuses(r *http.Request) func(db *gorm.DB) *gorm.DB {
 		return db
 	}
 }
+
+// PaginateNotifications paginates notifications by their ID. As with PaginateStatuses,
+// if min_id is passed the notifications are sorted ascending and must be sorted
+// descending before rendering.
+func PaginateNotifications(r *http.Request) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		q := r.URL.Query()
+
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		switch {
+		case limit > 80:
+			limit = 80
+		case limit <= 0:
+			limit = 40
+		}
+		db = db.Limit(limit)
+
+		maxID := q.Get("max_id")
+		minID := q.Get("min_id")
+		sinceID := q.Get("since_id")
+		switch minID {
+		case "":
+			db = db.Order("notifications.id desc")
+			if maxID != "" {
+				db = db.Where("notifications.id < ?", maxID)
+			}
+			if sinceID != "" {
+				db = db.Where("notifications.id > ?", sinceID)
+			}
+		default:
+			db = db.Order("notifications.id asc")
+			db = db.Where("notifications.id > ?", minID)
+			if maxID != "" {
+				db = db.Where("notifications.id < ?", maxID)
+			}
+		}
+		return db
+	}
+}
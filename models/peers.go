@@ -1,5 +1,56 @@
 package models
 
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// A Peer is a remote domain this server has exchanged activities with.
 type Peer struct {
 	Domain string `gorm:"primary_key;size:64"`
 }
+
+type Peers struct {
+	db *gorm.DB
+}
+
+func NewPeers(db *gorm.DB) *Peers {
+	return &Peers{db: db}
+}
+
+// Record records domain as a peer, if it is not one already.
+func (p *Peers) Record(domain string) error {
+	return p.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "domain"}},
+		DoNothing: true,
+	}).Create(&Peer{Domain: domain}).Error
+}
+
+// Rebuild replaces the recorded peers with the domains of the remote actors which
+// have posted or reacted to statuses, or follow or are followed by local actors.
+func (p *Peers) Rebuild() error {
+	return p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&Peer{}).Error; err != nil {
+			return err
+		}
+		local := tx.Model(&Instance{}).Select("domain")
+		posted := tx.Model(&Status{}).Select("actor_id")
+		reacted := tx.Model(&Reaction{}).Select("actor_id")
+		related := tx.Model(&Relationship{}).Select("actor_id").
+			Where("(following = true or followed_by = true) and target_id IN (?)", tx.Model(&Account{}).Select("actor_id"))
+		var domains []string
+		err := tx.Model(&Actor{}).Distinct("domain").
+			Where("domain NOT IN (?)", local).
+			Where("id IN (?) or id IN (?) or id IN (?)", posted, reacted, related).
+			Pluck("domain", &domains).Error
+		if err != nil {
+			return err
+		}
+		for _, domain := range domains {
+			if err := NewPeers(tx).Record(domain); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/bardic/pub/internal/snowflake"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeersRebuild(t *testing.T) {
+	db := setupTestDB(t)
+
+	t.Run("only domains of actors which posted or follow or are followed are peers", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		alice, err := NewAccounts(tx).Create(MockInstance(t, tx, "example.com"), "alice", "alice@example.com", "password")
+		require.NoError(err)
+		remote := func(domain string) *Actor {
+			actor := &Actor{
+				ID:        snowflake.Now(),
+				URI:       "https://" + domain + "/users/bob",
+				Name:      "bob",
+				Domain:    domain,
+				PublicKey: []byte("-----BEGIN PUBLIC KEY-----"),
+			}
+			require.NoError(tx.Create(actor).Error)
+			return actor
+		}
+		poster := remote("posted.example")
+		require.NoError(tx.Create(&Status{
+			ID:           snowflake.Now(),
+			URI:          poster.URI + "/statuses/1",
+			ActorID:      poster.ID,
+			Conversation: &Conversation{Visibility: "public"},
+			Visibility:   "public",
+			Note:         "hello",
+		}).Error)
+		_, err = NewRelationships(tx).Follow(remote("follower.example"), alice.Actor)
+		require.NoError(err)
+		_, err = NewRelationships(tx).Follow(alice.Actor, remote("followed.example"))
+		require.NoError(err)
+		remote("mentioned.example")
+		// a bogus peer, as recorded for every actor saved.
+		require.NoError(NewPeers(tx).Record("example.com"))
+
+		require.NoError(NewPeers(tx).Rebuild())
+		var peers []string
+		require.NoError(tx.Model(&Peer{}).Order("domain").Pluck("domain", &peers).Error)
+		require.Equal([]string{"followed.example", "follower.example", "posted.example"}, peers)
+	})
+}
@@ -6,11 +6,18 @@ import (
 	"gorm.io/gorm/schema"
 )
 
+// A PushSubscription is a Web Push subscription of an Account. Notifications
+// of the types the subscription alerts for are delivered to its Endpoint by
+// the PushRequestProcessor.
 type PushSubscription struct {
-	ID            uint32 `gorm:"primaryKey"`
-	AccountID     snowflake.ID
-	Account       *Account `gorm:"constraint:OnDelete:CASCADE;<-:false;"`
-	Endpoint      string   `gorm:"not null"`
+	ID        uint32 `gorm:"primaryKey"`
+	AccountID snowflake.ID
+	Account   *Account `gorm:"constraint:OnDelete:CASCADE;<-:false;"`
+	Endpoint  string   `gorm:"not null"`
+	// P256DH is the user agent's public key, base64url encoded.
+	P256DH string `gorm:"size:128;not null;default:''"`
+	// Auth is the user agent's authentication secret, base64url encoded.
+	Auth          string `gorm:"size:32;not null;default:''"`
 	Mention       bool
 	Status        bool
 	Reblog        bool
@@ -22,6 +29,11 @@ type PushSubscription struct {
 	Policy        PushSubscriptionPolicy `gorm:"not null;default:'all'"`
 }
 
+// PushSubscriptionPolicy is whose notifications are pushed.
+//   - all: everyone's.
+//   - followed: those of actors the account follows.
+//   - follower: those of actors who follow the account.
+//   - none: no one's.
 type PushSubscriptionPolicy string
 
 func (PushSubscriptionPolicy) GormDBDataType(db *gorm.DB, field *schema.Field) string {
@@ -34,3 +46,39 @@ func (PushSubscriptionPolicy) GormDBDataType(db *gorm.DB, field *schema.Field) s
 		return ""
 	}
 }
+
+// Alerts reports whether the subscription alerts for notifications of typ.
+func (p *PushSubscription) Alerts(typ NotificationType) bool {
+	switch typ {
+	case "mention":
+		return p.Mention
+	case "status":
+		return p.Status
+	case "reblog":
+		return p.Reblog
+	case "follow":
+		return p.Follow
+	case "follow_request":
+		return p.FollowRequest
+	case "favourite":
+		return p.Favourite
+	case "poll":
+		return p.Poll
+	case "update":
+		return p.Update
+	default:
+		return false
+	}
+}
+
+// A PushRequest is a request to deliver a Notification to the push subscriptions
+// of its account. PushRequests are created by hooks on the Notification model,
+// and are processed by the PushRequestProcessor in the background.
+type PushRequest struct {
+	Request
+
+	// NotificationID is the ID of the notification to push.
+	NotificationID snowflake.ID `gorm:"uniqueIndex;not null;"`
+	// Notification is the notification to push.
+	Notification *Notification `gorm:"constraint:OnDelete:CASCADE;<-:false;"`
+}
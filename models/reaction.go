@@ -23,7 +23,20 @@ type Reaction struct {
 }
 
 func (r *Reaction) BeforeUpdate(tx *gorm.DB) error {
-	return forEach(tx, r.createReactionRequest)
+	return forEach(tx, r.createReactionRequest, r.notifyFavourite)
+}
+
+// notifyFavourite notifies the actor of the status if the reaction's actor has
+// favourited it.
+func (r *Reaction) notifyFavourite(tx *gorm.DB) error {
+	var original Reaction
+	if err := tx.Preload("Status").Take(&original, "actor_id = ? and status_id = ?", r.ActorID, r.StatusID).Error; err != nil {
+		return err
+	}
+	if original.Favourited || !r.Favourited {
+		return nil
+	}
+	return notify(tx, "favourite", original.Status.ActorID, r.ActorID, &r.StatusID)
 }
 
 func (r *Reaction) AfterSave(tx *gorm.DB) error {
@@ -44,7 +57,7 @@ func (r *Reaction) updateStatusCount(tx *gorm.DB) error {
 // createReactionRequest creates a reaction request between the actor and target if needed.
 func (r *Reaction) createReactionRequest(tx *gorm.DB) error {
 	var original Reaction
-	if err := tx.First(&original, "actor_id = ? and status_id = ?", r.ActorID, r.StatusID).Error; err != nil {
+	if err := tx.Preload("Actor").First(&original, "actor_id = ? and status_id = ?", r.ActorID, r.StatusID).Error; err != nil {
 		return err
 	}
 	fmt.Printf("reaction changed from %+v to %+v\n", original, r)
@@ -77,6 +90,20 @@ func (r *Reaction) createReactionRequest(tx *gorm.DB) error {
 			TargetID: r.StatusID,
 			Action:   "like",
 		}).Error
+	case original.Pinned && !r.Pinned && original.Actor.IsLocal():
+		// unpin, remote actors' pins are synced from their featured collection.
+		return tx.Create(&ReactionRequest{
+			ActorID:  r.ActorID,
+			TargetID: r.StatusID,
+			Action:   "unpin",
+		}).Error
+	case !original.Pinned && r.Pinned && original.Actor.IsLocal():
+		// pin
+		return tx.Create(&ReactionRequest{
+			ActorID:  r.ActorID,
+			TargetID: r.StatusID,
+			Action:   "pin",
+		}).Error
 	default:
 		return nil
 	}
@@ -104,7 +131,7 @@ type ReactionRequestAction string
 func (ReactionRequestAction) GormDBDataType(db *gorm.DB, field *schema.Field) string {
 	switch db.Dialector.Name() {
 	case "mysql", "postgres":
-		return "enum('like', 'unlike')"
+		return "enum('like', 'unlike', 'pin', 'unpin')"
 	case "sqlite":
 		return "TEXT"
 	default:
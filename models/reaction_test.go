@@ -79,6 +79,37 @@ func TestReactions(t *testing.T) {
 		require.False(reaction.Pinned)
 	})
 
+	t.Run("Pin and Unpin by a local actor are federated", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		author := MockActor(t, tx, "alice", "example.com", WithType("LocalPerson"))
+		remote := MockActor(t, tx, "bob", "example.org")
+		status := MockStatus(t, tx, author, "This speech is my recital, I think it's very vital")
+		remoteStatus := MockStatus(t, tx, remote, "I think it's very vital to rock a rhyme")
+
+		reactions := NewReactions(tx)
+		_, err := reactions.Pin(status, author)
+		require.NoError(err)
+
+		var rr ReactionRequest
+		require.NoError(tx.Where("actor_id = ? AND target_id = ?", author.ID, status.ID).First(&rr).Error)
+		require.EqualValues("pin", rr.Action)
+
+		_, err = reactions.Unpin(status, author)
+		require.NoError(err)
+		require.NoError(tx.Where("actor_id = ? AND target_id = ?", author.ID, status.ID).First(&rr).Error)
+		require.EqualValues("unpin", rr.Action)
+
+		// remote actors' pins are not federated.
+		_, err = reactions.Pin(remoteStatus, remote)
+		require.NoError(err)
+		var count int64
+		require.NoError(tx.Model(&ReactionRequest{}).Where("actor_id = ?", remote.ID).Count(&count).Error)
+		require.EqualValues(0, count)
+	})
+
 	t.Run("Reblog and Unreblog", func(t *testing.T) {
 		require := require.New(t)
 		tx := db.Begin()
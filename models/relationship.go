@@ -19,12 +19,29 @@ type Relationship struct {
 	BlockedBy  bool         `gorm:"not null;default:false"`
 	Following  bool         `gorm:"not null;default:false"`
 	FollowedBy bool         `gorm:"not null;default:false"`
-	Note       string       `gorm:"type:text"`
+	// Notifying is true if the actor is notified when the target posts.
+	Notifying bool   `gorm:"not null;default:false"`
+	Note      string `gorm:"type:text"`
 }
 
-// BeforeUpdate creates a relationship request between the actor and target.
+// BeforeUpdate creates a relationship request between the actor and target, and
+// notifies the target if they have been followed.
 func (r *Relationship) BeforeUpdate(tx *gorm.DB) error {
-	return forEach(tx, r.updateRelationshipRequest)
+	return forEach(tx, r.updateRelationshipRequest, r.notifyFollow)
+}
+
+// notifyFollow notifies the target if the actor has started following them.
+// Follows are granted immediately, so locked targets are notified of a follow
+// too, not a follow request.
+func (r *Relationship) notifyFollow(tx *gorm.DB) error {
+	var original Relationship
+	if err := tx.Take(&original, "actor_id = ? and target_id = ?", r.ActorID, r.TargetID).Error; err != nil {
+		return err
+	}
+	if original.Following || !r.Following {
+		return nil
+	}
+	return notify(tx, "follow", r.TargetID, r.ActorID, nil)
 }
 
 // updateRelationshipRequest schedules a ActivityPub follow or unfollow request if
@@ -41,6 +58,19 @@ func (r *Relationship) updateRelationshipRequest(tx *gorm.DB) error {
 
 	fmt.Printf("relationship changed from %+v to %+v\n", original, r)
 
+	if feed, err := isFeed(tx, r.TargetID); err != nil || feed {
+		// following a feed is local only, the FeedPollProcessor fetches its entries.
+		return err
+	}
+
+	if !original.Following && r.Following {
+		// import the target's recent statuses so their profile, and our home
+		// timeline, are not empty until they next post.
+		if err := NewActors(tx).Backfill(&Actor{ID: r.TargetID}); err != nil {
+			return err
+		}
+	}
+
 	// if there is a conflict; eg. a follow then an unfollow before the follow is processed
 	// update the existing row to reflect the new action.
 	tx = tx.Clauses(clause.OnConflict{
@@ -233,6 +263,29 @@ func (r *Relationships) Unfollow(actor, target *Actor) (*Relationship, error) {
 	return forward, nil
 }
 
+// FollowerInboxes returns the inboxes of actor's remote followers.
+// Followers which share an inbox are only included once.
+func (r *Relationships) FollowerInboxes(actor *Actor) ([]string, error) {
+	var followers []*Relationship
+	if err := r.db.Preload("Actor").Find(&followers, "target_id = ? and following = true", actor.ID).Error; err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var inboxes []string
+	for _, f := range followers {
+		if f.Actor.IsLocal() {
+			continue
+		}
+		inbox := f.Actor.Inbox()
+		if inbox == "" || seen[inbox] {
+			continue
+		}
+		seen[inbox] = true
+		inboxes = append(inboxes, inbox)
+	}
+	return inboxes, nil
+}
+
 // pair returns the pair of Relationships between actor and target.
 func (r *Relationships) pair(actor, target *Actor) (*Relationship, *Relationship, error) {
 	forward, err := r.findOrCreate(actor, target)
@@ -93,4 +93,18 @@ func TestRelationships(t *testing.T) {
 		err = tx.Where("actor_id = ? AND target_id = ?", bob.ID, alice.ID).First(&follower).Error
 		require.Error(err)
 	})
+
+	t.Run("following a remote actor schedules a backfill", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		alice := MockActor(t, tx, "alice", "example.com", WithType("LocalPerson"))
+		bob := MockActor(t, tx, "bob", "example.org")
+		_, err := NewRelationships(tx).Follow(alice, bob)
+		require.NoError(err)
+
+		var req ActorBackfillRequest
+		require.NoError(tx.First(&req, "actor_id = ?", bob.ID).Error)
+	})
 }
@@ -3,10 +3,13 @@ package models
 import (
 	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/bardic/pub/internal/snowflake"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/schema"
 )
 
@@ -26,7 +29,7 @@ type Status struct {
 	Sensitive        bool       `gorm:"not null;default:false"`
 	SpoilerText      string     `gorm:"size:128"`
 	Visibility       Visibility `gorm:"not null"`
-	Language         string     `gorm:"size:2"`
+	Language         string     `gorm:"size:35"` // BCP 47
 	Note             string     `gorm:"type:text"`
 	URI              string     `gorm:"uniqueIndex;size:128"`
 	RepliesCount     int        `gorm:"not null;default:0"`
@@ -39,6 +42,12 @@ type Status struct {
 	Mentions         []StatusMention     `gorm:"constraint:OnDelete:CASCADE;"`
 	Tags             []StatusTag         `gorm:"constraint:OnDelete:CASCADE;"`
 	Poll             *StatusPoll         `gorm:"constraint:OnDelete:CASCADE;"`
+	// Type is the ActivityStreams type of the object this status was created from.
+	Type StatusType `gorm:"default:'Note';not null"`
+	// Title is the name of a long form object, such as an Article or Video.
+	Title string `gorm:"size:255;not null;default:''"`
+	// URL is the canonical, human readable, URL of the status if it differs from URI.
+	URL string `gorm:"size:255;not null;default:''"`
 }
 
 func (st *Status) AfterCreate(tx *gorm.DB) error {
@@ -46,9 +55,17 @@ func (st *Status) AfterCreate(tx *gorm.DB) error {
 		st.updateStatusCount,
 		st.updateRepliesCount,
 		st.updateReblogsCount,
+		st.updateInstanceStatusesCount,
+		st.notifyMentions,
+		st.notifyFollowers,
+		st.notifyReblog,
 	)
 }
 
+func (st *Status) AfterDelete(tx *gorm.DB) error {
+	return forEach(tx, st.updateInstanceStatusesCount)
+}
+
 func (st *Status) AfterUpdate(tx *gorm.DB) error {
 	return forEach(tx, st.updateStatusCount, st.updateRepliesCount, st.updateReblogsCount, st.maybeScheduleActorRefresh)
 }
@@ -91,6 +108,62 @@ func (st *Status) updateStatusCount(tx *gorm.DB) error {
 	}).Error
 }
 
+// updateInstanceStatusesCount updates the statuses_count field on the instance of
+// the status' actor, if they are local. Reblogs are not counted.
+func (st *Status) updateInstanceStatusesCount(tx *gorm.DB) error {
+	accounts := tx.Model(&Account{}).Select("instance_id").Where("actor_id = ?", st.ActorID)
+	local := tx.Model(&Account{}).Select("actor_id").Where("instance_id IN (?)", accounts)
+	statusesCount := tx.Model(&Status{}).Select("COUNT(id)").Where("reblog_id IS NULL and actor_id IN (?)", local)
+	return tx.Model(&Instance{}).Where("id IN (?)", accounts).UpdateColumns(map[string]interface{}{
+		"statuses_count": statusesCount,
+	}).Error
+}
+
+// notifyMentions notifies the local actors mentioned by the status.
+func (st *Status) notifyMentions(tx *gorm.DB) error {
+	var mentions []StatusMention
+	if err := tx.Where("status_id = ?", st.ID).Find(&mentions).Error; err != nil {
+		return err
+	}
+	for _, m := range mentions {
+		if err := notify(tx, "mention", m.ActorID, st.ActorID, &st.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notifyFollowers notifies the local followers of the status' actor who have
+// asked to be notified when they post. Reblogs, and replies to others, are not
+// notified.
+func (st *Status) notifyFollowers(tx *gorm.DB) error {
+	if st.ReblogID != nil || (st.InReplyToActorID != nil && *st.InReplyToActorID != st.ActorID) {
+		return nil
+	}
+	var followers []Relationship
+	if err := tx.Where("target_id = ? and following = ? and notifying = ?", st.ActorID, true, true).Find(&followers).Error; err != nil {
+		return err
+	}
+	for _, f := range followers {
+		if err := notify(tx, "status", f.ActorID, st.ActorID, &st.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notifyReblog notifies the actor of the status reblogged by the status.
+func (st *Status) notifyReblog(tx *gorm.DB) error {
+	if st.ReblogID == nil {
+		return nil
+	}
+	var reblogged Status
+	if err := tx.Select("id", "actor_id").Take(&reblogged, *st.ReblogID).Error; err != nil {
+		return err
+	}
+	return notify(tx, "reblog", reblogged.ActorID, st.ActorID, &reblogged.ID)
+}
+
 func (st *Status) maybeScheduleActorRefresh(tx *gorm.DB) error {
 	if st.Actor == nil {
 		return fmt.Errorf("status %d has no actor", st.ID)
@@ -113,6 +186,40 @@ type Conversation struct {
 	Visibility Visibility `gorm:"not null;check <> ''"`
 }
 
+// MaybeFilterLanguages returns a query that only includes statuses in the languages
+// listed by the languages[] parameter, if present. A language matches any more
+// specific tag, so pt matches pt-BR. Statuses whose language is unknown, including
+// reblogs, are always included.
+func MaybeFilterLanguages(r *http.Request) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		q := r.URL.Query()
+		languages := append(q["languages[]"], q["languages"]...)
+		if len(languages) == 0 {
+			return db
+		}
+		where := []string{"statuses.language IS NULL", "statuses.language = ''"}
+		var args []any
+		for _, lang := range languages {
+			where = append(where, "statuses.language = ?", "statuses.language LIKE ?")
+			args = append(args, lang, lang+"-%")
+		}
+		return db.Where("("+strings.Join(where, " OR ")+")", args...)
+	}
+}
+
+type StatusType string
+
+func (StatusType) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	switch db.Dialector.Name() {
+	case "mysql", "postgres":
+		return "enum('Note', 'Question', 'Article', 'Page', 'Video', 'Audio', 'Image', 'Event')"
+	case "sqlite":
+		return "TEXT"
+	default:
+		return ""
+	}
+}
+
 type Visibility string
 
 func (Visibility) GormDBDataType(db *gorm.DB, field *schema.Field) string {
@@ -184,6 +291,9 @@ func (s *Statuses) FindOrCreate(uri string, createFn func(string) (*Status, erro
 	if !errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, err
 	}
+	if err := NewDomainBlocks(s.db).CheckURI(uri); err != nil {
+		return nil, err
+	}
 	status, err = createFn(uri)
 	if err != nil {
 		return nil, fmt.Errorf("Statuses.FindOrCreate: %w", err)
@@ -194,6 +304,17 @@ func (s *Statuses) FindOrCreate(uri string, createFn func(string) (*Status, erro
 	return status, nil
 }
 
+// Backfill schedules the fetching of the ancestors and replies of a remote status
+// which were not delivered to us. If a backfill of the status is already pending,
+// Backfill does nothing.
+func (s *Statuses) Backfill(status *Status) error {
+	db := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "status_id"}},
+		DoNothing: true,
+	})
+	return db.Create(&StatusBackfillRequest{StatusID: status.ID}).Error
+}
+
 func (s *Statuses) FindByURI(uri string) (*Status, error) {
 	if uri == "" {
 		return nil, errors.New("Statuses.FindByURI: uri is empty")
@@ -279,3 +400,12 @@ func PreloadReaction(actor *Actor) func(query *gorm.DB) *gorm.DB {
 		return query.Preload("Reaction", "actor_id = ?", actor.ID).Preload("Reblog.Reaction", "actor_id = ?", actor.ID)
 	}
 }
+
+// StatusBackfillRequest is a request to fetch the missing parts of a status' thread.
+type StatusBackfillRequest struct {
+	Request
+	// StatusID is the ID of the status to backfill.
+	StatusID snowflake.ID `gorm:"uniqueIndex;not null;"`
+	// Status is the status to backfill.
+	Status *Status `gorm:"constraint:OnDelete:CASCADE;<-:false;"`
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"errors"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -194,4 +195,48 @@ func TestStatuses(t *testing.T) {
 			require.Len(convs, 1)
 		})
 	})
+
+	t.Run("Backfill schedules a backfill", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		alice := MockActor(t, tx, "alice", "example.com")
+		status := MockStatus(t, tx, alice, "Hello world")
+		require.NoError(NewStatuses(tx).Backfill(status))
+
+		var req StatusBackfillRequest
+		require.NoError(tx.First(&req, "status_id = ?", status.ID).Error)
+
+		// a pending backfill is not scheduled twice
+		require.NoError(NewStatuses(tx).Backfill(status))
+		var count int64
+		require.NoError(tx.Model(&StatusBackfillRequest{}).Where("status_id = ?", status.ID).Count(&count).Error)
+		require.Equal(int64(1), count)
+	})
+}
+
+func TestMaybeFilterLanguages(t *testing.T) {
+	db := setupTestDB(t)
+
+	require := require.New(t)
+	tx := db.Begin()
+	defer tx.Rollback()
+
+	alice := MockActor(t, tx, "alice", "example.com")
+	for _, lang := range []string{"en", "pt-BR", "pt", "de", ""} {
+		st := MockStatus(t, tx, alice, "Hello "+lang)
+		require.NoError(tx.Model(st).UpdateColumn("language", lang).Error)
+	}
+
+	find := func(rawQuery string) []string {
+		r := httptest.NewRequest("GET", "/api/v1/timelines/public?"+rawQuery, nil)
+		var langs []string
+		require.NoError(tx.Model(&Status{}).Scopes(MaybeFilterLanguages(r)).Order("language").Pluck("language", &langs).Error)
+		return langs
+	}
+
+	require.Equal([]string{"", "de", "en", "pt", "pt-BR"}, find(""))
+	require.Equal([]string{"", "pt", "pt-BR"}, find("languages[]=pt"))
+	require.Equal([]string{"", "de", "pt-BR"}, find("languages[]=pt-BR&languages[]=de"))
 }
@@ -1,6 +1,30 @@
 package models
 
+import (
+	"github.com/bardic/pub/internal/snowflake"
+	"gorm.io/gorm"
+)
+
 type Tag struct {
 	ID   uint32 `gorm:"primaryKey"`
 	Name string `gorm:"size:64;uniqueIndex"`
 }
+
+// FeaturedTag is a hashtag an actor features on their profile.
+type FeaturedTag struct {
+	snowflake.ID `gorm:"primarykey;autoIncrement:false"`
+	ActorID      snowflake.ID `gorm:"uniqueIndex:uidx_featured_tags_actor_id_tag_id;not null"`
+	Actor        *Actor       `gorm:"constraint:OnDelete:CASCADE;<-:false"`
+	TagID        uint32       `gorm:"uniqueIndex:uidx_featured_tags_actor_id_tag_id;not null"`
+	Tag          *Tag         `gorm:"constraint:OnDelete:CASCADE;<-:false"`
+}
+
+// TaggedWith returns a scope which restricts statuses to those tagged with the named tag.
+func TaggedWith(name string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		// use Joins("JOIN status_tags ...") as Joins("Tags") -- joining on an association -- causes a reflect panic in gorm.
+		// no biggie, just write the JOIN manually.
+		tag := db.Session(&gorm.Session{NewDB: true}).Select("id").Where("name = ?", name).Table("tags")
+		return db.Joins("JOIN status_tags ON status_tags.status_id = statuses.id").Where("status_tags.tag_id = (?)", tag)
+	}
+}
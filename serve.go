@@ -18,6 +18,7 @@ import (
 	"github.com/bardic/pub/media"
 	"github.com/bardic/pub/models"
 	"github.com/bardic/pub/oauth"
+	"github.com/bardic/pub/web"
 	"github.com/bardic/pub/wellknown"
 	"github.com/bardic/pub/workers"
 	"github.com/pkg/group"
@@ -31,6 +32,7 @@ type ServeCmd struct {
 	Addr             string `help:"address to listen" default:"127.0.0.1:9999"`
 	DebugPrintRoutes bool   `help:"print routes to stdout on startup"`
 	LogHTTP          bool   `help:"log HTTP requests"`
+	PolicyFile       string `help:"path to a JSON file of inbound moderation policies" type:"path"`
 }
 
 func (s *ServeCmd) Run(ctx *Context) error {
@@ -50,6 +52,11 @@ func (s *ServeCmd) Run(ctx *Context) error {
 		r.Use(middleware.Logger)
 	}
 
+	policies, err := s.loadPolicies()
+	if err != nil {
+		return err
+	}
+
 	var mux streaming.Mux
 	r.Use(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -62,9 +69,10 @@ func (s *ServeCmd) Run(ctx *Context) error {
 	r.Route("/api", func(r chi.Router) {
 		envFn := func(r *http.Request) *mastodon.Env {
 			return &mastodon.Env{
-				DB:     db.WithContext(r.Context()),
-				Mux:    &mux,
-				Logger: ctx.Logger,
+				DB:       db.WithContext(r.Context()),
+				Mux:      &mux,
+				Logger:   ctx.Logger,
+				Policies: policies,
 			}
 		}
 		r.Route("/v1", func(r chi.Router) {
@@ -93,7 +101,14 @@ func (s *ServeCmd) Run(ctx *Context) error {
 			r.Get("/custom_emojis", httpx.HandlerFunc(envFn, mastodon.EmojisIndex))
 			r.Get("/directory", httpx.HandlerFunc(envFn, mastodon.DirectoryIndex))
 			r.Get("/favourites", httpx.HandlerFunc(envFn, mastodon.FavouritesIndex))
+			r.Get("/featured_tags", httpx.HandlerFunc(envFn, mastodon.FeaturedTagsIndex))
+			r.Post("/featured_tags", httpx.HandlerFunc(envFn, mastodon.FeaturedTagsCreate))
+			r.Delete("/featured_tags/{id}", httpx.HandlerFunc(envFn, mastodon.FeaturedTagsDestroy))
 			r.Get("/filters", httpx.HandlerFunc(envFn, mastodon.FiltersIndex))
+			r.Post("/filters", httpx.HandlerFunc(envFn, mastodon.FiltersCreate))
+			r.Get("/filters/{id}", httpx.HandlerFunc(envFn, mastodon.FiltersShow))
+			r.Put("/filters/{id}", httpx.HandlerFunc(envFn, mastodon.FiltersUpdate))
+			r.Delete("/filters/{id}", httpx.HandlerFunc(envFn, mastodon.FiltersDestroy))
 			r.Get("/lists", httpx.HandlerFunc(envFn, mastodon.ListsIndex))
 			r.Post("/lists", httpx.HandlerFunc(envFn, mastodon.ListsCreate))
 			r.Get("/lists/{id}", httpx.HandlerFunc(envFn, mastodon.ListsShow))
@@ -116,6 +131,10 @@ func (s *ServeCmd) Run(ctx *Context) error {
 			r.Post("/markers", httpx.HandlerFunc(envFn, mastodon.MarkersCreate))
 			r.Get("/mutes", httpx.HandlerFunc(envFn, mastodon.MutesIndex))
 			r.Get("/notifications", httpx.HandlerFunc(envFn, mastodon.NotificationsIndex))
+			r.Post("/notifications/clear", httpx.HandlerFunc(envFn, mastodon.NotificationsClear))
+			r.Get("/notifications/unread_count", httpx.HandlerFunc(envFn, mastodon.NotificationsUnreadCount))
+			r.Get("/notifications/{id}", httpx.HandlerFunc(envFn, mastodon.NotificationsShow))
+			r.Post("/notifications/{id}/dismiss", httpx.HandlerFunc(envFn, mastodon.NotificationsDismiss))
 			r.Get("/preferences", httpx.HandlerFunc(envFn, mastodon.PreferencesShow))
 			r.Post("/push/subscription", httpx.HandlerFunc(envFn, mastodon.PushSubscriptionCreate))
 			r.Delete("/push/subscription", httpx.HandlerFunc(envFn, mastodon.PushSubscriptionDestroy))
@@ -130,6 +149,8 @@ func (s *ServeCmd) Run(ctx *Context) error {
 			r.Post("/statuses/{id}/unfavourite", httpx.HandlerFunc(envFn, mastodon.FavouritesDestroy))
 			r.Post("/statuses/{id}/bookmark", httpx.HandlerFunc(envFn, mastodon.BookmarksCreate))
 			r.Post("/statuses/{id}/unbookmark", httpx.HandlerFunc(envFn, mastodon.BookmarksDestroy))
+			r.Post("/statuses/{id}/pin", httpx.HandlerFunc(envFn, mastodon.PinsCreate))
+			r.Post("/statuses/{id}/unpin", httpx.HandlerFunc(envFn, mastodon.PinsDestroy))
 			r.Post("/statuses/{id}/reblog", httpx.HandlerFunc(envFn, mastodon.StatusesReblogCreate))
 			r.Post("/statuses/{id}/unreblog", httpx.HandlerFunc(envFn, mastodon.StatusesReblogDestroy))
 			r.Get("/statuses/{id}", httpx.HandlerFunc(envFn, mastodon.StatusesShow))
@@ -148,6 +169,22 @@ func (s *ServeCmd) Run(ctx *Context) error {
 
 		})
 		r.Route("/v2", func(r chi.Router) {
+			r.Route("/filters", func(r chi.Router) {
+				r.Get("/", httpx.HandlerFunc(envFn, mastodon.FiltersIndexV2))
+				r.Post("/", httpx.HandlerFunc(envFn, mastodon.FiltersCreateV2))
+				r.Get("/keywords/{id}", httpx.HandlerFunc(envFn, mastodon.FilterKeywordsShow))
+				r.Put("/keywords/{id}", httpx.HandlerFunc(envFn, mastodon.FilterKeywordsUpdate))
+				r.Delete("/keywords/{id}", httpx.HandlerFunc(envFn, mastodon.FilterKeywordsDestroy))
+				r.Get("/statuses/{id}", httpx.HandlerFunc(envFn, mastodon.FilterStatusesShow))
+				r.Delete("/statuses/{id}", httpx.HandlerFunc(envFn, mastodon.FilterStatusesDestroy))
+				r.Get("/{id}", httpx.HandlerFunc(envFn, mastodon.FiltersShowV2))
+				r.Put("/{id}", httpx.HandlerFunc(envFn, mastodon.FiltersUpdateV2))
+				r.Delete("/{id}", httpx.HandlerFunc(envFn, mastodon.FiltersDestroyV2))
+				r.Get("/{id}/keywords", httpx.HandlerFunc(envFn, mastodon.FilterKeywordsIndex))
+				r.Post("/{id}/keywords", httpx.HandlerFunc(envFn, mastodon.FilterKeywordsCreate))
+				r.Get("/{id}/statuses", httpx.HandlerFunc(envFn, mastodon.FilterStatusesIndex))
+				r.Post("/{id}/statuses", httpx.HandlerFunc(envFn, mastodon.FilterStatusesCreate))
+			})
 			r.Get("/instance", httpx.HandlerFunc(envFn, mastodon.InstancesIndexV2))
 			r.Get("/search", httpx.HandlerFunc(envFn, mastodon.SearchIndex))
 		})
@@ -155,9 +192,10 @@ func (s *ServeCmd) Run(ctx *Context) error {
 
 	envFn := func(r *http.Request) *activitypub.Env {
 		return &activitypub.Env{
-			DB:     db.WithContext(r.Context()),
-			Mux:    &mux,
-			Logger: ctx.Logger,
+			DB:       db.WithContext(r.Context()),
+			Mux:      &mux,
+			Logger:   ctx.Logger,
+			Policies: policies,
 		}
 	}
 
@@ -168,7 +206,7 @@ func (s *ServeCmd) Run(ctx *Context) error {
 		r.Post("/revoke", httpx.HandlerFunc(envFn, oauth.TokenDestroy))
 	})
 
-	inbox := activitypub.NewInbox(db)
+	inbox := activitypub.NewInbox(db, policies...)
 	r.Post("/inbox", httpx.HandlerFunc(envFn, inbox.Create))
 	r.Route("/u/{name}", func(r chi.Router) {
 		r.Get("/", httpx.HandlerFunc(envFn, activitypub.UsersShow))
@@ -178,6 +216,19 @@ func (s *ServeCmd) Run(ctx *Context) error {
 		r.Get("/following", httpx.HandlerFunc(envFn, activitypub.Following))
 		r.Get("/collections/{collection}", httpx.HandlerFunc(envFn, activitypub.CollectionsShow))
 	})
+	r.Route("/users/{name}/{id}", func(r chi.Router) {
+		r.Get("/", httpx.HandlerFunc(envFn, activitypub.StatusesShow))
+		r.Get("/replies", httpx.HandlerFunc(envFn, activitypub.StatusesRepliesShow))
+		r.Get("/likes", httpx.HandlerFunc(envFn, activitypub.StatusesLikesShow))
+		r.Get("/shares", httpx.HandlerFunc(envFn, activitypub.StatusesSharesShow))
+	})
+
+	r.Get("/@{name}", httpx.HandlerFunc(envFn, web.ProfileShow))
+	r.Get("/@{name}.{format:rss|atom}", httpx.HandlerFunc(envFn, web.ProfileFeedShow))
+	r.Get("/@{name}/{id}", httpx.HandlerFunc(envFn, web.StatusShow))
+	r.Get("/tags/{tag}.{format:rss|atom}", httpx.HandlerFunc(envFn, web.TagFeedShow))
+	r.Get("/authorize_interaction", httpx.HandlerFunc(envFn, web.AuthorizeInteractionShow))
+	r.Post("/authorize_interaction", httpx.HandlerFunc(envFn, web.AuthorizeInteractionCreate))
 
 	r.Route("/.well-known", func(r chi.Router) {
 		r.Get("/webfinger", httpx.HandlerFunc(envFn, wellknown.WebfingerShow))
@@ -233,14 +284,33 @@ func (s *ServeCmd) Run(ctx *Context) error {
 	g.Add(workers.NewRelationshipRequestProcessor(ctx.Logger, db))
 	g.Add(workers.NewReactionRequestProcessor(db))
 	g.Add(workers.NewStatusAttachmentRequestProcessor(db))
+	g.Add(workers.NewFeedPollProcessor(db, ctx.Logger.With("worker", "FeedPollProcessor")))
+	g.Add(workers.NewInstanceActivityProcessor(db, ctx.Logger.With("worker", "InstanceActivityProcessor")))
+	g.Add(workers.NewPollNotificationProcessor(db, ctx.Logger.With("worker", "PollNotificationProcessor")))
+	g.Add(workers.NewPushRequestProcessor(db, ctx.Logger.With("worker", "PushRequestProcessor")))
 
-	// ActorRefreshProcessor needs an admin account to sign the activitypub requests.
+	// The ActorRefresh and Backfill processors need an admin account to sign the activitypub requests.
 	// Pick _an_ admin account, it doesn't matter which one.
 	var admin models.Account
 	if err := db.Joins("Actor", "name = ? and type = ?", "admin", "LocalService").Take(&admin).Error; err != nil {
 		return err
 	}
-	g.Add(workers.NewActorRefreshProcessor(db, &admin, ctx.Logger.With("worker", "ActorRefreshProcessor")))
+	g.Add(workers.NewActorRefreshProcessor(db, &admin, ctx.Logger.With("worker", "ActorRefreshProcessor"), policies...))
+	g.Add(workers.NewStatusBackfillProcessor(db, &admin, ctx.Logger.With("worker", "StatusBackfillProcessor"), policies...))
+	g.Add(workers.NewActorBackfillProcessor(db, &admin, ctx.Logger.With("worker", "ActorBackfillProcessor"), policies...))
 
 	return g.Wait()
 }
+
+// loadPolicies loads the inbound moderation policies from the policy file, if any.
+func (s *ServeCmd) loadPolicies() ([]activitypub.Policy, error) {
+	if s.PolicyFile == "" {
+		return nil, nil
+	}
+	f, err := os.Open(s.PolicyFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return activitypub.LoadPolicies(f)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/bardic/pub/internal/httpx"
 	"github.com/carlmjohnson/requests"
 )
 
@@ -30,6 +31,7 @@ func (s *SynchroniseFollowersCmd) Run(_ *Context) error {
 	var col OrderedCollection
 	err := requests.URL(s.Source+"/following").
 		Header("Accept", `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`).
+		Client(httpx.DefaultClient).
 		ToJSON(&col).
 		Fetch(context.Background())
 	if err != nil {
@@ -42,6 +44,7 @@ func (s *SynchroniseFollowersCmd) Run(_ *Context) error {
 		var page OrderedCollectionPage
 		err := requests.URL(url).
 			Header("Accept", `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`).
+			Client(httpx.DefaultClient).
 			ToJSON(&page).
 			Fetch(context.Background())
 		if err != nil {
@@ -0,0 +1,345 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bardic/pub/activitypub"
+	"github.com/bardic/pub/internal/httpx"
+	"github.com/bardic/pub/models"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// ProfileFeedShow serves the public statuses of a local actor as an RSS or Atom feed.
+// As with AccountsStatusesShow, replies are included unless exclude_replies is given.
+func ProfileFeedShow(env *activitypub.Env, w http.ResponseWriter, r *http.Request) error {
+	var actor models.Actor
+	if err := env.DB.Take(&actor, "name = ? and domain = ?", chi.URLParam(r, "name"), r.Host).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.Error(http.StatusNotFound, err)
+		}
+		return err
+	}
+	var statuses []*models.Status
+	query := env.DB.Scopes(
+		models.PaginateStatuses(r),
+		models.PreloadStatus,
+		models.MaybeExcludeReplies(r),
+		publicStatuses,
+	)
+	if err := query.Find(&statuses, "statuses.actor_id = ?", actor.ID).Error; err != nil {
+		return err
+	}
+	return serveFeed(w, r, &feed{
+		Title:       title(&actor),
+		Description: text(actor.Note),
+		Link:        actor.URL(),
+		Self:        fmt.Sprintf("https://%s%s", r.Host, r.URL.Path),
+		Image:       actor.Avatar,
+		Statuses:    statuses,
+	})
+}
+
+// TagFeedShow serves the public statuses with a hashtag as an RSS or Atom feed.
+func TagFeedShow(env *activitypub.Env, w http.ResponseWriter, r *http.Request) error {
+	tag := chi.URLParam(r, "tag")
+	var statuses []*models.Status
+	query := env.DB.Scopes(
+		models.PaginateStatuses(r),
+		models.TaggedWith(tag),
+		models.PreloadStatus,
+		publicStatuses,
+	)
+	if err := query.Find(&statuses).Error; err != nil {
+		return err
+	}
+	return serveFeed(w, r, &feed{
+		Title:       "#" + tag,
+		Description: fmt.Sprintf("Public posts tagged #%s", tag),
+		Link:        fmt.Sprintf("https://%s/tags/%s", r.Host, tag),
+		Self:        fmt.Sprintf("https://%s%s", r.Host, r.URL.Path),
+		Statuses:    statuses,
+	})
+}
+
+// publicStatuses restricts a query to public statuses; feeds are read by anyone, and are
+// not the place for reblogs of other actors' statuses.
+func publicStatuses(db *gorm.DB) *gorm.DB {
+	return db.Where("statuses.visibility = ? and statuses.reblog_id IS NULL", "public")
+}
+
+// feed is the format independent content of a feed.
+type feed struct {
+	Title       string
+	Description string
+	Link        string
+	Self        string
+	Image       string
+	Statuses    []*models.Status
+}
+
+// serveFeed writes f in the format named by the request's format parameter. If the
+// client's cached copy, identified by If-None-Match or If-Modified-Since, is current,
+// only the status is written.
+func serveFeed(w http.ResponseWriter, r *http.Request, f *feed) error {
+	// PaginateStatuses doesn't sort, so we have to do it ourselves.
+	sort.SliceStable(f.Statuses, func(i, j int) bool {
+		return f.Statuses[i].ID > f.Statuses[j].ID
+	})
+
+	var updated time.Time
+	h := sha256.New()
+	fmt.Fprintln(h, r.URL.Path, f.Title, f.Description, f.Image)
+	for _, s := range f.Statuses {
+		modified := modifiedAt(s)
+		if modified.After(updated) {
+			updated = modified
+		}
+		fmt.Fprintln(h, s.ID, modified.Unix())
+	}
+	etag := fmt.Sprintf(`W/"%x"`, h.Sum(nil)[:16])
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if !updated.IsZero() {
+		w.Header().Set("Last-Modified", updated.UTC().Format(http.TimeFormat))
+	}
+	if notModified(r, etag, updated) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	var doc any
+	switch chi.URLParam(r, "format") {
+	case "atom":
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		doc = atom(r, f, updated)
+	default:
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		doc = rss(r, f, updated)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(doc)
+}
+
+// notModified reports whether the client's copy of a resource with etag, last modified
+// at updated, is current. If-None-Match takes precedence over If-Modified-Since.
+func notModified(r *http.Request, etag string, updated time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			if tag = strings.TrimSpace(tag); tag == etag || tag == "*" {
+				return true
+			}
+		}
+		return false
+	}
+	if ims, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !updated.IsZero() {
+		return !updated.Truncate(time.Second).After(ims)
+	}
+	return false
+}
+
+// modifiedAt returns the time s was last edited, or created if it has not been edited.
+func modifiedAt(s *models.Status) time.Time {
+	if created := s.ID.ToTime(); created.After(s.UpdatedAt) {
+		return created
+	}
+	return s.UpdatedAt
+}
+
+// entryTitle returns a title for s; feed readers expect one, statuses do not have one.
+func entryTitle(s *models.Status) string {
+	if s.Title != "" {
+		return s.Title
+	}
+	if s.SpoilerText != "" {
+		return s.SpoilerText
+	}
+	t := text(s.Note)
+	if utf8.RuneCountInString(t) > 80 {
+		t = string([]rune(t)[:79]) + "…"
+	}
+	return t
+}
+
+// statusURL returns the URL of the HTML page of s.
+func statusURL(s *models.Status) string {
+	if s.URL != "" {
+		return s.URL
+	}
+	if s.Actor.IsLocal() {
+		return fmt.Sprintf("%s/%d", s.Actor.URL(), s.ID)
+	}
+	return s.URI
+}
+
+// enclosureURL returns the URL at which att may be downloaded.
+func enclosureURL(r *http.Request, att *models.StatusAttachment) string {
+	if att.ToType() == "image" {
+		// call through /media proxy to cache
+		return fmt.Sprintf("https://%s/media/original/%d.%s", r.Host, att.ID, att.Extension())
+	}
+	return att.URL
+}
+
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Image         *rssImage `xml:"image,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssImage struct {
+	URL   string `xml:"url"`
+	Title string `xml:"title"`
+	Link  string `xml:"link"`
+}
+
+type rssItem struct {
+	GUID        rssGUID        `xml:"guid"`
+	Link        string         `xml:"link"`
+	PubDate     string         `xml:"pubDate"`
+	Description string         `xml:"description"`
+	Enclosures  []rssEnclosure `xml:"enclosure"`
+	Categories  []string       `xml:"category"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int    `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+func rss(r *http.Request, f *feed, updated time.Time) *rssDocument {
+	doc := &rssDocument{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       f.Title,
+			Link:        f.Link,
+			Description: f.Description,
+		},
+	}
+	if !updated.IsZero() {
+		doc.Channel.LastBuildDate = updated.UTC().Format(time.RFC1123Z)
+	}
+	if f.Image != "" {
+		doc.Channel.Image = &rssImage{URL: f.Image, Title: f.Title, Link: f.Link}
+	}
+	for _, s := range f.Statuses {
+		item := rssItem{
+			GUID:        rssGUID{IsPermaLink: true, Value: statusURL(s)},
+			Link:        statusURL(s),
+			PubDate:     s.ID.ToTime().UTC().Format(time.RFC1123Z),
+			Description: sanitise(s.Note),
+		}
+		for _, att := range s.Attachments {
+			// the size of remote attachments is not known.
+			item.Enclosures = append(item.Enclosures, rssEnclosure{URL: enclosureURL(r, att), Type: att.MediaType})
+		}
+		for _, t := range s.Tags {
+			if t.Tag != nil {
+				item.Categories = append(item.Categories, t.Tag.Name)
+			}
+		}
+		doc.Channel.Items = append(doc.Channel.Items, item)
+	}
+	return doc
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Icon    string      `xml:"icon,omitempty"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID        string       `xml:"id"`
+	Title     string       `xml:"title"`
+	Published string       `xml:"published"`
+	Updated   string       `xml:"updated"`
+	Author    atomAuthor   `xml:"author"`
+	Links     []atomLink   `xml:"link"`
+	Content   atomContent  `xml:"content"`
+	Summary   *atomContent `xml:"summary,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+func atom(r *http.Request, f *feed, updated time.Time) *atomFeed {
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+	doc := &atomFeed{
+		ID:      f.Self,
+		Title:   f.Title,
+		Updated: updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: f.Self},
+			{Rel: "alternate", Type: "text/html", Href: f.Link},
+		},
+		Icon: f.Image,
+	}
+	for _, s := range f.Statuses {
+		entry := atomEntry{
+			ID:        s.URI,
+			Title:     entryTitle(s),
+			Published: s.ID.ToTime().UTC().Format(time.RFC3339),
+			Updated:   modifiedAt(s).UTC().Format(time.RFC3339),
+			Author:    atomAuthor{Name: s.Actor.DisplayName, URI: s.Actor.URL()},
+			Links:     []atomLink{{Rel: "alternate", Type: "text/html", Href: statusURL(s)}},
+			Content:   atomContent{Type: "html", Value: sanitise(s.Note)},
+		}
+		if s.SpoilerText != "" {
+			entry.Summary = &atomContent{Type: "text", Value: s.SpoilerText}
+		}
+		for _, att := range s.Attachments {
+			entry.Links = append(entry.Links, atomLink{Rel: "enclosure", Type: att.MediaType, Href: enclosureURL(r, att)})
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+	return doc
+}
@@ -0,0 +1,126 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bardic/pub/activitypub"
+	"github.com/bardic/pub/internal/httpx"
+	"github.com/bardic/pub/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+)
+
+func TestFeeds(t *testing.T) {
+	db := setupTestDB(t)
+
+	t.Run("profile feeds include public statuses and support conditional requests", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		instance, err := models.NewInstances(tx).Create("example.com", "Example", "Example instance", "admin@example.com")
+		require.NoError(err)
+		account, err := models.NewAccounts(tx).Create(instance, "alice", "alice@example.com", "password")
+		require.NoError(err)
+		for _, v := range []models.Visibility{"public", "unlisted", "private"} {
+			status, err := models.NewStatuses(tx).Create(account.Actor, nil, v, false, "", "en", "hello "+string(v))
+			require.NoError(err)
+			if v == "public" {
+				require.NoError(tx.Create(&models.StatusAttachment{
+					Attachment: models.Attachment{ID: status.ID, MediaType: "image/png", URL: "https://example.com/a.png", Width: 1, Height: 1},
+					StatusID:   status.ID,
+				}).Error)
+			}
+		}
+
+		router := chi.NewRouter()
+		envFn := func(r *http.Request) *activitypub.Env {
+			return &activitypub.Env{DB: tx, Logger: slog.Default()}
+		}
+		router.Get("/@{name}", httpx.HandlerFunc(envFn, ProfileShow))
+		router.Get("/@{name}.{format:rss|atom}", httpx.HandlerFunc(envFn, ProfileFeedShow))
+
+		get := func(path string, header ...string) *httptest.ResponseRecorder {
+			r := httptest.NewRequest("GET", "https://example.com"+path, nil)
+			for i := 0; i+1 < len(header); i += 2 {
+				r.Header.Set(header[i], header[i+1])
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			return w
+		}
+
+		w := get("/@alice.rss")
+		require.Equal(http.StatusOK, w.Code)
+		require.Equal("application/rss+xml; charset=utf-8", w.Header().Get("Content-Type"))
+		body := w.Body.String()
+		require.Contains(body, "hello public")
+		require.NotContains(body, "hello unlisted")
+		require.NotContains(body, "hello private")
+		require.Contains(body, `<enclosure url="https://example.com/media/original/`)
+
+		etag := w.Header().Get("ETag")
+		require.NotEmpty(etag)
+		require.Equal(http.StatusNotModified, get("/@alice.rss", "If-None-Match", etag).Code)
+		require.Equal(http.StatusNotModified, get("/@alice.rss", "If-Modified-Since", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)).Code)
+		require.Equal(http.StatusOK, get("/@alice.rss", "If-Modified-Since", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)).Code)
+
+		w = get("/@alice.atom")
+		require.Equal(http.StatusOK, w.Code)
+		require.Contains(w.Body.String(), `<feed xmlns="http://www.w3.org/2005/Atom">`)
+
+		// the profile page is still served at /@name
+		w = get("/@alice")
+		require.Equal(http.StatusOK, w.Code)
+		require.Contains(w.Header().Get("Content-Type"), "text/html")
+	})
+
+	t.Run("tag feeds include public statuses with the tag only", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		instance, err := models.NewInstances(tx).Create("example.com", "Example", "Example instance", "admin@example.com")
+		require.NoError(err)
+		account, err := models.NewAccounts(tx).Create(instance, "alice", "alice@example.com", "password")
+		require.NoError(err)
+		cats := &models.Tag{Name: "cats"}
+		require.NoError(tx.Create(cats).Error)
+		for _, v := range []models.Visibility{"public", "unlisted", "private", "direct"} {
+			status, err := models.NewStatuses(tx).Create(account.Actor, nil, v, false, "", "en", "cats "+string(v))
+			require.NoError(err)
+			require.NoError(tx.Create(&models.StatusTag{StatusID: status.ID, TagID: cats.ID}).Error)
+		}
+		_, err = models.NewStatuses(tx).Create(account.Actor, nil, "public", false, "", "en", "dogs public")
+		require.NoError(err)
+
+		router := chi.NewRouter()
+		envFn := func(r *http.Request) *activitypub.Env {
+			return &activitypub.Env{DB: tx, Logger: slog.Default()}
+		}
+		router.Get("/tags/{tag}.{format:rss|atom}", httpx.HandlerFunc(envFn, TagFeedShow))
+
+		r := httptest.NewRequest("GET", "https://example.com/tags/cats.rss", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		require.Equal(http.StatusOK, w.Code)
+		require.Equal("application/rss+xml; charset=utf-8", w.Header().Get("Content-Type"))
+		body := w.Body.String()
+		require.Contains(body, "<title>#cats</title>")
+		require.Contains(body, "cats public")
+		require.NotContains(body, "cats unlisted")
+		require.NotContains(body, "cats private")
+		require.NotContains(body, "cats direct")
+		require.NotContains(body, "dogs public")
+
+		r = httptest.NewRequest("GET", "https://example.com/tags/cats.atom", nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		require.Equal(http.StatusOK, w.Code)
+		require.Contains(w.Body.String(), "cats public")
+	})
+}
@@ -0,0 +1,178 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bardic/pub/activitypub"
+	"github.com/bardic/pub/internal/httpx"
+	"github.com/bardic/pub/internal/webfinger"
+	"github.com/bardic/pub/models"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// AuthorizeInteractionShow renders the form with which a local user follows the
+// actor, or replies to, reblogs or favourites the status, with the uri parameter.
+// Other servers send their users here from the subscribe template advertised by
+// WebfingerShow. The form is shown to anyone, so only actors and statuses already
+// known are previewed; unknown ones are fetched once the user has signed in.
+func AuthorizeInteractionShow(env *activitypub.Env, w http.ResponseWriter, r *http.Request) error {
+	var params struct {
+		URI string `schema:"uri,required"`
+	}
+	if err := httpx.Params(r, &params); err != nil {
+		return err
+	}
+	actor, status, err := lookup(env, params.URI)
+	if err != nil {
+		return err
+	}
+	var reply string
+	if status != nil {
+		reply = "@" + status.Actor.Name + "@" + status.Actor.Domain + " "
+	}
+	return render(w, "interaction", map[string]any{
+		"Meta": meta{
+			Title:   "Interact with " + params.URI,
+			NoIndex: true,
+		},
+		"URI":    params.URI,
+		"Actor":  actor,
+		"Status": status,
+		"Reply":  reply,
+	})
+}
+
+// AuthorizeInteractionCreate authenticates the user with their username and password
+// and performs the interaction they chose, then redirects them to its target.
+func AuthorizeInteractionCreate(env *activitypub.Env, w http.ResponseWriter, r *http.Request) error {
+	var params struct {
+		URI      string `schema:"uri,required"`
+		Username string `schema:"username,required"`
+		Password string `schema:"password,required"`
+		Action   string `schema:"action,required"`
+		Status   string `schema:"status"`
+	}
+	if err := httpx.Params(r, &params); err != nil {
+		return err
+	}
+
+	// do not reveal whether the username or the password was wrong.
+	errInvalid := httpx.Error(http.StatusUnauthorized, errors.New("invalid username or password"))
+	var account models.Account
+	if err := env.DB.Joins("Actor").Take(&account, "name = ? and domain = ?", params.Username, r.Host).Error; err != nil {
+		return errInvalid
+	}
+	if err := bcrypt.CompareHashAndPassword(account.EncryptedPassword, []byte(params.Password)); err != nil {
+		return errInvalid
+	}
+
+	actor, status, err := resolve(env, r, params.URI)
+	if err != nil {
+		return err
+	}
+	if actor != nil {
+		if params.Action != "follow" {
+			return httpx.Error(http.StatusBadRequest, fmt.Errorf("cannot %s an actor", params.Action))
+		}
+		if _, err := models.NewRelationships(env.DB).Follow(account.Actor, actor); err != nil {
+			return err
+		}
+		return httpx.Redirect(w, actor.URL())
+	}
+
+	switch params.Action {
+	case "reply":
+		if strings.TrimSpace(params.Status) == "" {
+			return httpx.Error(http.StatusBadRequest, errors.New("reply is empty"))
+		}
+		if _, err := models.NewStatuses(env.DB).Create(account.Actor, status, status.Visibility, false, "", "", params.Status); err != nil {
+			return err
+		}
+	case "reblog":
+		if _, err := models.NewReactions(env.DB).Reblog(status, account.Actor); err != nil {
+			return err
+		}
+	case "favourite":
+		if _, err := models.NewReactions(env.DB).Favourite(status, account.Actor); err != nil {
+			return err
+		}
+	default:
+		return httpx.Error(http.StatusBadRequest, fmt.Errorf("cannot %s a status", params.Action))
+	}
+	if status.URL != "" {
+		return httpx.Redirect(w, status.URL)
+	}
+	return httpx.Redirect(w, status.URI)
+}
+
+// lookup returns the actor or status identified by uri, which may be the URI of
+// either, or the acct: of an actor, if it is already known. Nothing is fetched;
+// if neither is known, both are nil.
+func lookup(env *activitypub.Env, uri string) (*models.Actor, *models.Status, error) {
+	if !strings.HasPrefix(uri, "https://") && !strings.HasPrefix(uri, "http://") {
+		acct, err := webfinger.Parse(uri)
+		if err != nil {
+			return nil, nil, httpx.Error(http.StatusBadRequest, err)
+		}
+		var actors []*models.Actor
+		if err := env.DB.Limit(1).Find(&actors, "name = ? and domain = ?", acct.User, acct.Host).Error; err != nil || len(actors) == 0 {
+			return nil, nil, err
+		}
+		return actors[0], nil, nil
+	}
+	if actor, err := models.NewActors(env.DB).FindByURI(uri); err == nil {
+		return actor, nil, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, err
+	}
+	status, err := models.NewStatuses(env.DB).FindByURI(uri)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if status.Visibility != "public" && status.Visibility != "unlisted" {
+		return nil, nil, nil
+	}
+	return nil, status, nil
+}
+
+// resolve returns the actor or status identified by uri, which may be the URI of
+// either, or the acct: of an actor. Unknown actors and statuses are fetched.
+func resolve(env *activitypub.Env, r *http.Request, uri string) (*models.Actor, *models.Status, error) {
+	if !strings.HasPrefix(uri, "https://") && !strings.HasPrefix(uri, "http://") {
+		acct, err := webfinger.Parse(uri)
+		if err != nil {
+			return nil, nil, httpx.Error(http.StatusBadRequest, err)
+		}
+		wf, err := acct.Fetch(r.Context())
+		if err != nil {
+			return nil, nil, httpx.Error(http.StatusBadGateway, err)
+		}
+		if uri, err = wf.ActivityPub(); err != nil {
+			return nil, nil, httpx.Error(http.StatusBadGateway, err)
+		}
+	}
+	// find admin of this request's domain
+	var instance models.Instance
+	if err := env.DB.Joins("Admin").Preload("Admin.Actor").Where("domain = ?", r.Host).Take(&instance).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, httpx.Error(http.StatusNotFound, err)
+		}
+		return nil, nil, err
+	}
+	actor, status, err := activitypub.NewResolver(instance.Admin, env.DB, env.Logger, env.Policies...).Resolve(r.Context(), uri)
+	if err != nil {
+		return nil, nil, httpx.Error(http.StatusNotFound, err)
+	}
+	if status != nil && status.Visibility != "public" && status.Visibility != "unlisted" {
+		// the user may not be permitted to see the status.
+		return nil, nil, httpx.Error(http.StatusNotFound, errors.New("status not found"))
+	}
+	return actor, status, nil
+}
@@ -0,0 +1,158 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bardic/pub/activitypub"
+	"github.com/bardic/pub/internal/httpx"
+	"github.com/bardic/pub/internal/snowflake"
+	"github.com/bardic/pub/models"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestAuthorizeInteraction(t *testing.T) {
+	db := setupTestDB(t)
+
+	// mockRemote creates alice's account, and bob, a remote actor, with a public status.
+	mockRemote := func(t *testing.T, tx *gorm.DB) (*models.Account, *models.Actor, *models.Status) {
+		t.Helper()
+		require := require.New(t)
+		instance, err := models.NewInstances(tx).Create("example.com", "Example", "Example instance", "admin@example.com")
+		require.NoError(err)
+		alice, err := models.NewAccounts(tx).Create(instance, "alice", "alice@example.com", "password")
+		require.NoError(err)
+		bob := &models.Actor{
+			ID:        snowflake.Now(),
+			Type:      "Person",
+			URI:       "https://remote.example/users/bob",
+			Name:      "bob",
+			Domain:    "remote.example",
+			PublicKey: []byte{},
+		}
+		require.NoError(tx.Create(bob).Error)
+		status := &models.Status{
+			ID:           snowflake.Now(),
+			ActorID:      bob.ID,
+			Actor:        bob,
+			Conversation: &models.Conversation{Visibility: "public"},
+			Visibility:   "public",
+			URI:          "https://remote.example/users/bob/statuses/1",
+			Note:         "hello from bob",
+		}
+		require.NoError(tx.Create(status).Error)
+		return alice, bob, status
+	}
+
+	post := func(tx *gorm.DB, form url.Values) (*httptest.ResponseRecorder, error) {
+		r := httptest.NewRequest("POST", "https://example.com/authorize_interaction", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		return w, AuthorizeInteractionCreate(&activitypub.Env{DB: tx}, w, r)
+	}
+
+	t.Run("actors can be followed", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		alice, bob, _ := mockRemote(t, tx)
+		r := httptest.NewRequest("GET", "https://example.com/authorize_interaction?uri="+url.QueryEscape(bob.URI), nil)
+		w := httptest.NewRecorder()
+		require.NoError(AuthorizeInteractionShow(&activitypub.Env{DB: tx}, w, r))
+		require.Contains(w.Body.String(), `value="follow"`)
+		require.Contains(w.Body.String(), `<meta name="robots" content="noindex, noarchive">`)
+
+		_, err := post(tx, url.Values{"uri": {bob.URI}, "username": {"alice"}, "password": {"wrong"}, "action": {"follow"}})
+		var herr *httpx.StatusError
+		require.ErrorAs(err, &herr)
+		require.Equal(http.StatusUnauthorized, herr.Status())
+
+		w, err = post(tx, url.Values{"uri": {bob.URI}, "username": {"alice"}, "password": {"password"}, "action": {"follow"}})
+		require.NoError(err)
+		require.Equal(http.StatusFound, w.Code)
+		require.Equal(bob.URL(), w.Header().Get("Location"))
+
+		var rel models.Relationship
+		require.NoError(tx.Take(&rel, "actor_id = ? and target_id = ?", alice.Actor.ID, bob.ID).Error)
+		require.True(rel.Following)
+	})
+
+	t.Run("statuses can be favourited and replied to", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		alice, _, status := mockRemote(t, tx)
+		r := httptest.NewRequest("GET", "https://example.com/authorize_interaction?uri="+url.QueryEscape(status.URI), nil)
+		w := httptest.NewRecorder()
+		require.NoError(AuthorizeInteractionShow(&activitypub.Env{DB: tx}, w, r))
+		require.Contains(w.Body.String(), "hello from bob")
+		require.Contains(w.Body.String(), "@bob@remote.example ")
+
+		w, err := post(tx, url.Values{"uri": {status.URI}, "username": {"alice"}, "password": {"password"}, "action": {"favourite"}})
+		require.NoError(err)
+		require.Equal(status.URI, w.Header().Get("Location"))
+		var reaction models.Reaction
+		require.NoError(tx.Take(&reaction, "status_id = ? and actor_id = ?", status.ID, alice.Actor.ID).Error)
+		require.True(reaction.Favourited)
+
+		_, err = post(tx, url.Values{"uri": {status.URI}, "username": {"alice"}, "password": {"password"}, "action": {"reply"}, "status": {"@bob@remote.example hi"}})
+		require.NoError(err)
+		var reply models.Status
+		require.NoError(tx.Take(&reply, "in_reply_to_id = ?", status.ID).Error)
+		require.Equal(alice.Actor.ID, reply.ActorID)
+		require.Equal(status.ConversationID, reply.ConversationID)
+	})
+
+	t.Run("the form does not fetch unknown actors or statuses", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		mockRemote(t, tx)
+		for _, uri := range []string{"https://unknown.example/users/carol", "carol@unknown.example"} {
+			r := httptest.NewRequest("GET", "https://example.com/authorize_interaction?uri="+url.QueryEscape(uri), nil)
+			w := httptest.NewRecorder()
+			require.NoError(AuthorizeInteractionShow(&activitypub.Env{DB: tx}, w, r))
+			require.Contains(w.Body.String(), uri)
+			require.Contains(w.Body.String(), `value="follow"`)
+			require.Contains(w.Body.String(), `value="reply"`)
+		}
+
+		var count int64
+		require.NoError(tx.Model(&models.Actor{}).Where("domain = ?", "unknown.example").Count(&count).Error)
+		require.Zero(count)
+	})
+
+	t.Run("known actors are found by acct", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		mockRemote(t, tx)
+		r := httptest.NewRequest("GET", "https://example.com/authorize_interaction?uri="+url.QueryEscape("bob@remote.example"), nil)
+		w := httptest.NewRecorder()
+		require.NoError(AuthorizeInteractionShow(&activitypub.Env{DB: tx}, w, r))
+		require.Contains(w.Body.String(), `value="follow"`)
+		require.NotContains(w.Body.String(), `value="reply"`)
+	})
+
+	t.Run("a wrong username and a wrong password are indistinguishable", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		_, bob, _ := mockRemote(t, tx)
+		_, wrongUsername := post(tx, url.Values{"uri": {bob.URI}, "username": {"mallory"}, "password": {"password"}, "action": {"follow"}})
+		_, wrongPassword := post(tx, url.Values{"uri": {bob.URI}, "username": {"alice"}, "password": {"wrong"}, "action": {"follow"}})
+		var herr *httpx.StatusError
+		require.ErrorAs(wrongUsername, &herr)
+		require.Equal(http.StatusUnauthorized, herr.Status())
+		require.Equal(wrongPassword.Error(), wrongUsername.Error())
+	})
+}
@@ -0,0 +1,115 @@
+package web
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// allowedTags are the elements which sanitise keeps, with the attributes kept on each.
+var allowedTags = map[string]map[string]bool{
+	"a":          {"href": true, "class": true},
+	"b":          nil,
+	"blockquote": nil,
+	"br":         nil,
+	"code":       nil,
+	"del":        nil,
+	"em":         nil,
+	"i":          nil,
+	"li":         nil,
+	"ol":         nil,
+	"p":          nil,
+	"pre":        nil,
+	"s":          nil,
+	"span":       {"class": true},
+	"strong":     nil,
+	"u":          nil,
+	"ul":         nil,
+}
+
+// droppedTags are the elements whose contents, as well as the element, sanitise removes.
+var droppedTags = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"template": true,
+	"iframe":   true,
+	"object":   true,
+}
+
+// sanitise returns fragment with only the markup found in statuses and profiles;
+// paragraphs, line breaks, links, mentions and simple formatting. Everything
+// else is removed, and text is escaped.
+func sanitise(fragment string) string {
+	var sb strings.Builder
+	var dropped int
+	z := html.NewTokenizer(strings.NewReader(fragment))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return sb.String()
+		case html.TextToken:
+			if dropped == 0 {
+				sb.WriteString(html.EscapeString(string(z.Text())))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			if droppedTags[tok.Data] {
+				if tok.Type == html.StartTagToken {
+					dropped++
+				}
+				continue
+			}
+			attrs, ok := allowedTags[tok.Data]
+			if !ok || dropped > 0 {
+				continue
+			}
+			sb.WriteString("<" + tok.Data)
+			for _, attr := range tok.Attr {
+				if !attrs[attr.Key] || (attr.Key == "href" && !safeURL(attr.Val)) {
+					continue
+				}
+				fmt.Fprintf(&sb, ` %s="%s"`, attr.Key, html.EscapeString(attr.Val))
+			}
+			if tok.Data == "a" {
+				sb.WriteString(` rel="nofollow noopener noreferrer"`)
+			}
+			sb.WriteString(">")
+		case html.EndTagToken:
+			tok := z.Token()
+			if droppedTags[tok.Data] {
+				if dropped > 0 {
+					dropped--
+				}
+				continue
+			}
+			if _, ok := allowedTags[tok.Data]; ok && dropped == 0 && tok.Data != "br" {
+				sb.WriteString("</" + tok.Data + ">")
+			}
+		}
+	}
+}
+
+// safeURL reports whether uri is an absolute http or https URL.
+func safeURL(uri string) bool {
+	u, err := url.Parse(uri)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http")
+}
+
+// text returns the text of an HTML fragment, with whitespace collapsed.
+func text(fragment string) string {
+	var sb strings.Builder
+	z := html.NewTokenizer(strings.NewReader(fragment))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return strings.Join(strings.Fields(sb.String()), " ")
+		case html.TextToken:
+			sb.Write(z.Text())
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			// tags such as <p> and <br> separate words.
+			sb.WriteByte(' ')
+		}
+	}
+}
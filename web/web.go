@@ -0,0 +1,233 @@
+// Package web serves the public HTML pages of local actors and their statuses.
+package web
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/bardic/pub/activitypub"
+	"github.com/bardic/pub/internal/httpx"
+	"github.com/bardic/pub/internal/snowflake"
+	"github.com/bardic/pub/models"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// pageSize is the number of statuses shown on a page of a profile.
+const pageSize = 20
+
+// maxThreadStatuses is the number of statuses of a conversation shown on a status' page.
+const maxThreadStatuses = 200
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+var funcs = template.FuncMap{
+	"content": func(s string) template.HTML {
+		return template.HTML(sanitise(s))
+	},
+	"text": text,
+	"datetime": func(t time.Time) string {
+		return t.UTC().Format(time.RFC3339)
+	},
+	"date": func(t time.Time) string {
+		return t.UTC().Format("2 Jan 2006, 15:04")
+	},
+	"media": func(att *models.StatusAttachment) string {
+		if att.ToType() == "image" {
+			// call through /media proxy to cache
+			return fmt.Sprintf("/media/original/%d.%s", att.ID, att.Extension())
+		}
+		return att.URL
+	},
+}
+
+// templates are the pages which can be rendered, each parsed with the shared layout.
+var templates = map[string]*template.Template{
+	"interaction": parse("interaction.html"),
+	"profile":     parse("profile.html"),
+	"status":      parse("status.html"),
+}
+
+func parse(page string) *template.Template {
+	return template.Must(template.New(page).Funcs(funcs).ParseFS(templateFiles, "templates/layout.html", "templates/entry.html", "templates/"+page))
+}
+
+// meta is the metadata of a page, used for its title, OpenGraph tags, and robots directives.
+type meta struct {
+	Title       string
+	Description string
+	URL         string
+	Image       string
+	Type        string
+	// Alternate is the URI of the ActivityPub representation of the page.
+	Alternate string
+	// NoIndex asks search engines not to index the page.
+	NoIndex bool
+}
+
+// ProfileShow renders the profile of a local actor, and their public statuses.
+func ProfileShow(env *activitypub.Env, w http.ResponseWriter, r *http.Request) error {
+	actor, prefs, err := findActor(env, r)
+	if err != nil {
+		return err
+	}
+	query := env.DB.Where("actor_id = ? and reblog_id IS NULL and visibility IN ?", actor.ID, []models.Visibility{"public", "unlisted"})
+	if maxID, err := snowflake.Parse(r.URL.Query().Get("max_id")); err == nil {
+		query = query.Where("id < ?", maxID)
+	}
+	var statuses []*models.Status
+	if err := query.Preload("Actor").Preload("Attachments").Preload("InReplyTo").Order("id desc").Limit(pageSize).Find(&statuses).Error; err != nil {
+		return err
+	}
+	var older string
+	if len(statuses) == pageSize {
+		older = fmt.Sprintf("%s?max_id=%d", actor.URL(), statuses[len(statuses)-1].ID)
+	}
+	return render(w, "profile", map[string]any{
+		"Meta": meta{
+			Title:       title(actor),
+			Description: text(actor.Note),
+			URL:         actor.URL(),
+			Image:       actor.Avatar,
+			Type:        "profile",
+			Alternate:   actor.URI,
+			NoIndex:     prefs.NoIndex,
+		},
+		"Actor":    actor,
+		"Statuses": statuses,
+		"Older":    older,
+		// the sizes of the followers and following collections are hidden at the actor's request.
+		"HideCollectionsCount": prefs.HideCollectionsCount,
+	})
+}
+
+// StatusShow renders a public or unlisted status of a local actor, with the
+// visible statuses of its thread.
+func StatusShow(env *activitypub.Env, w http.ResponseWriter, r *http.Request) error {
+	actor, prefs, err := findActor(env, r)
+	if err != nil {
+		return err
+	}
+	id, err := snowflake.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		return httpx.Error(http.StatusNotFound, err)
+	}
+	visible := []models.Visibility{"public", "unlisted"}
+	var status models.Status
+	if err := env.DB.Preload("Attachments").Preload("InReplyTo").Take(&status, "id = ? and actor_id = ? and reblog_id IS NULL and visibility IN ?", id, actor.ID, visible).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.Error(http.StatusNotFound, err)
+		}
+		return err
+	}
+	var conversation []*models.Status
+	query := env.DB.Where("conversation_id = ? and reblog_id IS NULL and visibility IN ?", status.ConversationID, visible)
+	if err := query.Preload("Actor").Preload("Attachments").Preload("InReplyTo").Order("id").Limit(maxThreadStatuses).Find(&conversation).Error; err != nil {
+		return err
+	}
+	ancestors, focus, descendants := thread(conversation, status.ID)
+	if focus == nil {
+		// the conversation is larger than maxThreadStatuses; show the status alone.
+		focus = &status
+		focus.Actor = actor
+	}
+
+	description := text(focus.Note)
+	if focus.SpoilerText != "" {
+		description = focus.SpoilerText
+	}
+	image := actor.Avatar
+	for _, att := range focus.Attachments {
+		if att.ToType() == "image" {
+			image = fmt.Sprintf("https://%s/media/original/%d.%s", r.Host, att.ID, att.Extension())
+			break
+		}
+	}
+	return render(w, "status", map[string]any{
+		"Meta": meta{
+			Title:       title(actor),
+			Description: description,
+			URL:         fmt.Sprintf("%s/%d", actor.URL(), focus.ID),
+			Image:       image,
+			Type:        "article",
+			Alternate:   focus.URI,
+			NoIndex:     prefs.NoIndex,
+		},
+		"Actor":       actor,
+		"Ancestors":   ancestors,
+		"Status":      focus,
+		"Descendants": descendants,
+	})
+}
+
+// findActor returns the local actor named in the request, and their preferences.
+func findActor(env *activitypub.Env, r *http.Request) (*models.Actor, *models.AccountPreferences, error) {
+	var actor models.Actor
+	if err := env.DB.Take(&actor, "name = ? and domain = ?", chi.URLParam(r, "name"), r.Host).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, httpx.Error(http.StatusNotFound, err)
+		}
+		return nil, nil, err
+	}
+	prefs, err := models.NewAccounts(env.DB).PreferencesForActor(&actor)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// the actor is local, but is not an account's; eg. the instance actor.
+			return nil, nil, httpx.Error(http.StatusNotFound, err)
+		}
+		return nil, nil, err
+	}
+	return &actor, prefs, nil
+}
+
+// thread returns the ancestors of the status with the given id, the status itself,
+// and its descendants, in the order they are read, from the statuses of its
+// conversation. Statuses which are not in the status' branch are omitted.
+func thread(conversation []*models.Status, id snowflake.ID) (ancestors []*models.Status, status *models.Status, descendants []*models.Status) {
+	byID := make(map[snowflake.ID]*models.Status, len(conversation))
+	children := make(map[snowflake.ID][]*models.Status)
+	for _, s := range conversation {
+		byID[s.ID] = s
+		if s.InReplyToID != nil {
+			children[*s.InReplyToID] = append(children[*s.InReplyToID], s)
+		}
+	}
+	status, ok := byID[id]
+	if !ok {
+		return nil, nil, nil
+	}
+	for parent := status; parent.InReplyToID != nil; {
+		if parent, ok = byID[*parent.InReplyToID]; !ok {
+			break
+		}
+		ancestors = append([]*models.Status{parent}, ancestors...)
+	}
+	var walk func(*models.Status)
+	walk = func(s *models.Status) {
+		for _, child := range children[s.ID] {
+			descendants = append(descendants, child)
+			walk(child)
+		}
+	}
+	walk(status)
+	return ancestors, status, descendants
+}
+
+// title returns the title of actor's pages.
+func title(actor *models.Actor) string {
+	name := actor.DisplayName
+	if name == "" {
+		name = actor.Name
+	}
+	return fmt.Sprintf("%s (@%s@%s)", name, actor.Name, actor.Domain)
+}
+
+func render(w http.ResponseWriter, page string, data any) error {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return templates[page].ExecuteTemplate(w, "layout", data)
+}
@@ -0,0 +1,174 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bardic/pub/activitypub"
+	"github.com/bardic/pub/internal/httpx"
+	"github.com/bardic/pub/internal/snowflake"
+	"github.com/bardic/pub/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestSanitise(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"plain text is escaped", `1 < 2 & 3`, `1 &lt; 2 &amp; 3`},
+		{"formatting is kept", `<p>hello<br>world</p>`, `<p>hello<br>world</p>`},
+		{"links are kept, without unknown attributes", `<a href="https://example.com" onclick="x()">x</a>`, `<a href="https://example.com" rel="nofollow noopener noreferrer">x</a>`},
+		{"javascript links are removed", `<a href="javascript:alert(1)">x</a>`, `<a rel="nofollow noopener noreferrer">x</a>`},
+		{"scripts are removed with their contents", `<p>a<script>alert(1)</script>b</p>`, `<p>ab</p>`},
+		{"unknown elements are unwrapped", `<div><img src="x">text</div>`, `text`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, sanitise(tt.in))
+		})
+	}
+}
+
+func TestThread(t *testing.T) {
+	require := require.New(t)
+	status := func(id snowflake.ID, parent snowflake.ID) *models.Status {
+		s := &models.Status{ID: id}
+		if parent != 0 {
+			s.InReplyToID = &parent
+		}
+		return s
+	}
+	// 1 <- 2 <- 3 <- 5
+	//        \
+	//         4
+	conversation := []*models.Status{status(1, 0), status(2, 1), status(3, 2), status(4, 1), status(5, 3)}
+	ancestors, focus, descendants := thread(conversation, 2)
+	require.Equal(snowflake.ID(2), focus.ID)
+	require.Len(ancestors, 1)
+	require.Equal(snowflake.ID(1), ancestors[0].ID)
+	require.Len(descendants, 2)
+	require.Equal(snowflake.ID(3), descendants[0].ID)
+	require.Equal(snowflake.ID(5), descendants[1].ID)
+}
+
+func TestPages(t *testing.T) {
+	db := setupTestDB(t)
+
+	// mockAccount creates alice's account, with a status of each visibility.
+	mockAccount := func(t *testing.T, tx *gorm.DB) (*models.Account, map[models.Visibility]*models.Status) {
+		t.Helper()
+		require := require.New(t)
+		instance, err := models.NewInstances(tx).Create("example.com", "Example", "Example instance", "admin@example.com")
+		require.NoError(err)
+		account, err := models.NewAccounts(tx).Create(instance, "alice", "alice@example.com", "password")
+		require.NoError(err)
+		statuses := make(map[models.Visibility]*models.Status)
+		for _, v := range []models.Visibility{"public", "private"} {
+			status, err := models.NewStatuses(tx).Create(account.Actor, nil, v, false, "", "en", "hello "+string(v))
+			require.NoError(err)
+			statuses[v] = status
+		}
+		return account, statuses
+	}
+
+	get := func(tx *gorm.DB, fn func(*activitypub.Env, http.ResponseWriter, *http.Request) error, path string, kv ...string) (*httptest.ResponseRecorder, error) {
+		r := httptest.NewRequest("GET", "https://example.com"+path, nil)
+		rctx := chi.NewRouteContext()
+		for i := 0; i+1 < len(kv); i += 2 {
+			rctx.URLParams.Add(kv[i], kv[i+1])
+		}
+		r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+		return w, fn(&activitypub.Env{DB: tx}, w, r)
+	}
+
+	t.Run("profile shows public statuses only", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		mockAccount(t, tx)
+		w, err := get(tx, ProfileShow, "/@alice", "name", "alice")
+		require.NoError(err)
+		body := w.Body.String()
+		require.Contains(body, `class="h-card"`)
+		require.Contains(body, `<meta property="og:url" content="https://example.com/@alice">`)
+		require.Contains(body, "hello public")
+		require.NotContains(body, "hello private")
+		require.NotContains(body, "noindex")
+	})
+
+	t.Run("pages of accounts which opt out of indexing are marked noindex", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		account, _ := mockAccount(t, tx)
+		prefs, err := models.NewAccounts(tx).PreferencesForActor(account.Actor)
+		require.NoError(err)
+		prefs.NoIndex = true
+		require.NoError(tx.Save(prefs).Error)
+
+		w, err := get(tx, ProfileShow, "/@alice", "name", "alice")
+		require.NoError(err)
+		require.Contains(w.Body.String(), `<meta name="robots" content="noindex, noarchive">`)
+	})
+
+	t.Run("profile hides follower counts at the account's request", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		account, _ := mockAccount(t, tx)
+		w, err := get(tx, ProfileShow, "/@alice", "name", "alice")
+		require.NoError(err)
+		require.Contains(w.Body.String(), "0 followers")
+
+		prefs, err := models.NewAccounts(tx).PreferencesForActor(account.Actor)
+		require.NoError(err)
+		prefs.HideCollectionsCount = true
+		require.NoError(tx.Save(prefs).Error)
+
+		w, err = get(tx, ProfileShow, "/@alice", "name", "alice")
+		require.NoError(err)
+		require.Contains(w.Body.String(), "posts</p>")
+		require.NotContains(w.Body.String(), "followers")
+		require.NotContains(w.Body.String(), "following")
+	})
+
+	t.Run("followers only statuses are not found", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		_, statuses := mockAccount(t, tx)
+		w, err := get(tx, StatusShow, "/@alice", "name", "alice", "id", fmt.Sprint(statuses["public"].ID))
+		require.NoError(err)
+		require.Contains(w.Body.String(), `class="h-entry"`)
+
+		_, err = get(tx, StatusShow, "/@alice", "name", "alice", "id", fmt.Sprint(statuses["private"].ID))
+		var herr *httpx.StatusError
+		require.ErrorAs(err, &herr)
+		require.Equal(http.StatusNotFound, herr.Status())
+	})
+}
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	require := require.New(t)
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{
+		TranslateError: true,
+		Logger:         logger.Default.LogMode(logger.Warn),
+	})
+	require.NoError(err)
+	require.NoError(db.AutoMigrate(models.AllTables()...))
+	require.NoError(db.Exec("PRAGMA foreign_keys = ON").Error)
+	return db
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/bardic/pub/activitypub"
 	"github.com/bardic/pub/internal/httpx"
@@ -31,30 +33,35 @@ func NodeInfoIndex(env *activitypub.Env, w http.ResponseWriter, r *http.Request)
 
 func NodeInfoShow(env *activitypub.Env, w http.ResponseWriter, r *http.Request) error {
 	var instance models.Instance
-	if err := env.DB.Where("domain = ?", r.Host).First(&instance).Error; err != nil {
+	if err := env.DB.Joins("Admin").Preload("Admin.Actor").Where("domain = ?", r.Host).First(&instance).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return httpx.Error(http.StatusNotFound, err)
 		}
 		return err
 	}
+	u, err := usage(env.DB, &instance)
+	if err != nil {
+		return err
+	}
 	switch chi.URLParam(r, "version") {
 	case "2.0":
 		// https://github.com/jhass/nodeinfo/blob/main/schemas/2.0/schema.json
-		w.Header().Set("cache-control", "max-age=259200, public")
+		w.Header().Set("cache-control", "max-age=1800, public")
 		return to.JSON(w, map[string]any{
 			"version": "2.0",
 			"software": map[string]any{
-				"name":    "https://github.com/bardic/pub",
+				// 2.0 names must match ^[a-z0-9-]+$; the repository was added in 2.1.
+				"name":    "pub",
 				"version": "0.0.0-devel",
 			},
 			"protocols":         protocols(),
 			"services":          services(),
-			"usage":             usage(),
+			"usage":             u,
 			"openRegistrations": false,
-			"metadata":          metadata(),
+			"metadata":          metadata(&instance),
 		})
 	case "2.1":
-		w.Header().Set("cache-control", "max-age=259200, public")
+		w.Header().Set("cache-control", "max-age=1800, public")
 		return to.JSON(w, map[string]any{
 			"version": "2.1",
 			"software": map[string]any{
@@ -64,17 +71,30 @@ func NodeInfoShow(env *activitypub.Env, w http.ResponseWriter, r *http.Request)
 			},
 			"protocols":         protocols(),
 			"services":          services(),
-			"usage":             usage(),
+			"usage":             u,
 			"openRegistrations": false,
-			"metadata":          metadata(),
+			"metadata":          metadata(&instance),
 		})
 	default:
 		return httpx.Error(http.StatusNotFound, errors.New("unsupported version: "+chi.URLParam(r, "version")))
 	}
 }
 
-func metadata() map[string]any {
-	return map[string]any{}
+func metadata(instance *models.Instance) map[string]any {
+	md := map[string]any{
+		"nodeName":        instance.Title,
+		"nodeDescription": instance.Description,
+	}
+	if instance.Admin != nil {
+		maintainer := map[string]any{
+			"email": instance.Admin.Email,
+		}
+		if instance.Admin.Actor != nil {
+			maintainer["name"] = instance.Admin.Actor.Name
+		}
+		md["maintainer"] = maintainer
+	}
+	return md
 }
 
 func protocols() []any {
@@ -90,8 +110,40 @@ func services() map[string]any {
 	}
 }
 
-func usage() map[string]any {
-	return map[string]any{
-		"users": map[string]any{},
+// usageTTL is how long the usage of an instance is cached; counting statuses is not cheap.
+const usageTTL = 30 * time.Minute
+
+var usageCache = struct {
+	sync.Mutex
+	entries map[string]usageEntry
+}{
+	entries: make(map[string]usageEntry),
+}
+
+type usageEntry struct {
+	usage   map[string]any
+	expires time.Time
+}
+
+// usage returns the NodeInfo usage of instance, recounting it at most once per usageTTL.
+func usage(db *gorm.DB, instance *models.Instance) (map[string]any, error) {
+	usageCache.Lock()
+	defer usageCache.Unlock()
+	if e, ok := usageCache.entries[instance.Domain]; ok && time.Now().Before(e.expires) {
+		return e.usage, nil
+	}
+	u, err := models.NewInstances(db).Usage(instance)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]any{
+		"users": map[string]any{
+			"total":          u.Users,
+			"activeMonth":    u.ActiveMonth,
+			"activeHalfyear": u.ActiveHalfyear,
+		},
+		"localPosts": u.LocalPosts,
 	}
+	usageCache.entries[instance.Domain] = usageEntry{usage: m, expires: time.Now().Add(usageTTL)}
+	return m, nil
 }
@@ -14,16 +14,18 @@ import (
 	"gorm.io/gorm"
 )
 
-// NewActorRefreshProcessor handles updating the actor's record.
-func NewActorRefreshProcessor(db *gorm.DB, admin *models.Account, logger *slog.Logger) func(ctx context.Context) error {
+// NewActorRefreshProcessor handles updating the actor's record. The statuses
+// fetched for an actor's featured collection pass through policies.
+func NewActorRefreshProcessor(db *gorm.DB, admin *models.Account, logger *slog.Logger, policies ...activitypub.Policy) func(ctx context.Context) error {
 
 	return func(ctx context.Context) error {
 		fmt.Println("NewActorRefreshProcessor started")
 		defer fmt.Println("NewActorRefreshProcessor stopped")
 
 		refresher := &actorRefresher{
-			signAs: admin,
-			logger: logger,
+			signAs:   admin,
+			logger:   logger,
+			policies: policies,
 		}
 
 		db := db.WithContext(ctx)
@@ -50,6 +52,8 @@ type actorRefresher struct {
 	signAs *models.Account
 	// logger is the slog.Logger to use for logging.
 	logger *slog.Logger
+	// policies are applied to the statuses fetched.
+	policies []activitypub.Policy
 }
 
 func (a *actorRefresher) processActorRefresh(db *gorm.DB, request *models.ActorRefreshRequest) error {
@@ -101,12 +105,66 @@ func (a *actorRefresher) processActorRefresh(db *gorm.DB, request *models.ActorR
 	// even if the created-at date has not changed because of the random component of the ID.
 	// We need to update the ID to match the original record.
 	updated.ID = orig.ID
-	return db.Transaction(func(tx *gorm.DB) error {
+	if err := db.Transaction(func(tx *gorm.DB) error {
 		// delete actor attributes
 		if err := tx.Where("actor_id = ?", orig.ID).Delete(&models.ActorAttribute{}).Error; err != nil {
 			return err
 		}
 		// save updated actor
 		return tx.Session(&gorm.Session{FullSaveAssociations: true}).Updates(updated).Error
-	})
+	}); err != nil {
+		return err
+	}
+
+	// sync the actor's pinned statuses.
+	backfiller, err := activitypub.NewBackfiller(a.signAs, db, a.logger, a.policies...)
+	if err != nil {
+		return err
+	}
+	if err := backfiller.Featured(db.Statement.Context, updated); err != nil {
+		// the actor has been refreshed, don't retry the whole request for the sake of its pins.
+		a.logger.Error("error fetching featured collection", "uri", updated.URI, "error", err)
+	}
+	return nil
+}
+
+// NewActorBackfillProcessor imports the recent statuses of remote actors from their
+// outbox, passing them through policies.
+func NewActorBackfillProcessor(db *gorm.DB, admin *models.Account, logger *slog.Logger, policies ...activitypub.Policy) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		fmt.Println("ActorBackfillProcessor started")
+		defer fmt.Println("ActorBackfillProcessor stopped")
+
+		db := db.WithContext(ctx)
+		for {
+			if err := process(db, actorBackfillScope, func(db *gorm.DB, request *models.ActorBackfillRequest) error {
+				return processActorBackfill(db, admin, logger, policies, request)
+			}); err != nil {
+				return err
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(30 * time.Second):
+				// continue
+			}
+		}
+	}
+}
+
+func actorBackfillScope(db *gorm.DB) *gorm.DB {
+	return db.Preload("Actor").Where("attempts < 3")
+}
+
+func processActorBackfill(db *gorm.DB, signAs *models.Account, logger *slog.Logger, policies []activitypub.Policy, request *models.ActorBackfillRequest) error {
+	if request.Actor.IsLocal() {
+		// local actors' statuses are already here.
+		return nil
+	}
+	logger.Info("processActorBackfill", slog.String("uri", request.Actor.URI), slog.Int("attempt", int(request.Attempts)+1))
+	backfiller, err := activitypub.NewBackfiller(signAs, db, logger, policies...)
+	if err != nil {
+		return err
+	}
+	return backfiller.Outbox(db.Statement.Context, request.Actor)
 }
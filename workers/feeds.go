@@ -0,0 +1,266 @@
+package workers
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bardic/pub/internal/feed"
+	"github.com/bardic/pub/internal/httpx"
+	"github.com/bardic/pub/internal/lang"
+	"github.com/bardic/pub/internal/snowflake"
+	"github.com/bardic/pub/models"
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+)
+
+const (
+	// feedPollInterval is the minimum time between polls of a feed.
+	feedPollInterval = 30 * time.Minute
+	// maxFeedEntries is the number of entries imported by a single poll of a feed.
+	maxFeedEntries = 20
+	// maxInlineContent is the length above which an entry's content is replaced
+	// with its title, summary and a link to the original.
+	maxInlineContent = 500
+)
+
+// NewFeedPollProcessor polls followed feeds, importing their new entries as statuses.
+func NewFeedPollProcessor(db *gorm.DB, logger *slog.Logger) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		fmt.Println("FeedPollProcessor started")
+		defer fmt.Println("FeedPollProcessor stopped")
+
+		db := db.WithContext(ctx)
+		poller := NewFeedPoller(db, httpx.DefaultClient)
+		for {
+			feeds, err := dueFeeds(db, time.Now().Add(-feedPollInterval))
+			if err != nil {
+				return err
+			}
+			for _, f := range feeds {
+				if err := poller.Poll(ctx, f); err != nil {
+					if ctx.Err() != nil {
+						return nil
+					}
+					logger.Error("error polling feed", "url", f.URL, "error", err)
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(time.Minute):
+				// continue
+			}
+		}
+	}
+}
+
+// dueFeeds returns the feeds last polled before t. Feeds which no actor follows
+// are not polled.
+func dueFeeds(db *gorm.DB, t time.Time) ([]*models.Feed, error) {
+	followed := db.Model(&models.Relationship{}).Select("target_id").Where("following = true")
+	var feeds []*models.Feed
+	if err := db.Preload("Actor").Where("polled_at < ? and actor_id IN (?)", t, followed).Find(&feeds).Error; err != nil {
+		return nil, err
+	}
+	return feeds, nil
+}
+
+// A FeedPoller fetches feeds and imports their entries as statuses by the feed's actor.
+type FeedPoller struct {
+	db     *gorm.DB
+	client *http.Client
+}
+
+// NewFeedPoller returns a FeedPoller which fetches feeds with client.
+func NewFeedPoller(db *gorm.DB, client *http.Client) *FeedPoller {
+	return &FeedPoller{
+		db:     db,
+		client: client,
+	}
+}
+
+// Add creates a feed for the RSS or Atom feed at uri, follows it as actor, and imports its recent entries.
+func (p *FeedPoller) Add(ctx context.Context, actor *models.Actor, uri string) (*models.Feed, error) {
+	header, doc, err := p.fetch(ctx, uri, "", "")
+	if err != nil {
+		return nil, err
+	}
+	f, err := models.NewFeeds(p.db).Create(uri, doc.Title, doc.Description, doc.Link, doc.Image)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := models.NewRelationships(p.db).Follow(actor, f.Actor); err != nil {
+		return nil, err
+	}
+	return f, p.update(f, header, doc)
+}
+
+// Poll fetches f, if it has changed since it was last fetched, and imports its new entries.
+// The feed's Actor must be loaded.
+func (p *FeedPoller) Poll(ctx context.Context, f *models.Feed) error {
+	header, doc, err := p.fetch(ctx, f.URL, f.ETag, f.LastModified)
+	if err != nil {
+		f.PolledAt = time.Now()
+		f.LastResult = err.Error()
+		if err := p.db.Model(f).Select("PolledAt", "LastResult").Updates(f).Error; err != nil {
+			return err
+		}
+		return err
+	}
+	if doc == nil {
+		// not modified.
+		f.PolledAt = time.Now()
+		f.LastResult = ""
+		return p.db.Model(f).Select("PolledAt", "LastResult").Updates(f).Error
+	}
+	return p.update(f, header, doc)
+}
+
+// update imports the entries of doc, and records the validators of the response they came from.
+func (p *FeedPoller) update(f *models.Feed, header http.Header, doc *feed.Feed) error {
+	if err := p.importEntries(f, doc.Entries); err != nil {
+		return err
+	}
+	f.ETag = truncate(header.Get("ETag"), 255)
+	f.LastModified = truncate(header.Get("Last-Modified"), 64)
+	f.PolledAt = time.Now()
+	f.LastResult = ""
+	return p.db.Model(f).Select("ETag", "LastModified", "PolledAt", "LastResult").Updates(f).Error
+}
+
+// fetch fetches the feed at uri. If etag or lastModified are given, the request is
+// conditional, and if the feed has not changed, the returned feed is nil.
+func (p *FeedPoller) fetch(ctx context.Context, uri, etag, lastModified string) (http.Header, *feed.Feed, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/xml;q=0.9, text/xml;q=0.8")
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		doc, err := feed.Parse(resp.Body)
+		return resp.Header, doc, err
+	case http.StatusNotModified:
+		return resp.Header, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("fetch %s: unexpected status %s", uri, resp.Status)
+	}
+}
+
+// importEntries creates a status for each entry which has not already been imported.
+// Feeds list their newest entries first, only the first maxFeedEntries are considered.
+func (p *FeedPoller) importEntries(f *models.Feed, entries []feed.Entry) error {
+	if len(entries) > maxFeedEntries {
+		entries = entries[:maxFeedEntries]
+	}
+	for i := range entries {
+		e := &entries[i]
+		uri := entryURI(e)
+		if uri == "" {
+			continue
+		}
+		var count int64
+		if err := p.db.Model(&models.Status{}).Where("uri = ?", uri).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		if err := p.db.Create(entryStatus(f.Actor, e, uri)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entryURI returns the URI of the status for e; its ID if it fits models.Status.URI,
+// otherwise a URN derived from it.
+func entryURI(e *feed.Entry) string {
+	if e.ID == "" || len(e.ID) <= 128 {
+		return e.ID
+	}
+	return fmt.Sprintf("urn:sha256:%x", sha256.Sum256([]byte(e.ID)))
+}
+
+// entryStatus returns the status for e. Entries are stored as Articles, in the same
+// form as inbound long form objects; the title, then the summary or short content,
+// then a link to the original. Entries are unlisted, so they appear in the home
+// timelines of the feed's followers, but not the public timelines.
+func entryStatus(actor *models.Actor, e *feed.Entry, uri string) *models.Status {
+	published := e.Published
+	if published.IsZero() || published.After(time.Now()) {
+		published = time.Now()
+	}
+	link := e.Link
+	if link == "" {
+		link = e.ID
+	}
+
+	var sb strings.Builder
+	if e.Title != "" {
+		fmt.Fprintf(&sb, "<p><strong>%s</strong></p>", html.EscapeString(e.Title))
+	}
+	switch {
+	case e.Summary != "":
+		sb.WriteString(e.Summary)
+	case len(e.Content) <= maxInlineContent:
+		sb.WriteString(e.Content)
+	}
+	if link != "" {
+		fmt.Fprintf(&sb, `<p><a href="%s">%s</a></p>`, html.EscapeString(link), html.EscapeString(link))
+	}
+
+	id := snowflake.TimeToID(published)
+	status := &models.Status{
+		ID:           id,
+		UpdatedAt:    e.Updated,
+		ActorID:      actor.ID,
+		Actor:        actor,
+		Conversation: &models.Conversation{Visibility: "unlisted"},
+		Visibility:   "unlisted",
+		Language:     lang.Detect(e.Text()),
+		Note:         sb.String(),
+		URI:          uri,
+		Type:         "Article",
+		Title:        truncate(e.Title, 255),
+	}
+	if len(link) <= 255 && link != uri {
+		status.URL = link
+	}
+	for _, enc := range e.Enclosures {
+		if enc.URL == "" || len(enc.URL) > 255 {
+			continue
+		}
+		status.Attachments = append(status.Attachments, &models.StatusAttachment{
+			Attachment: models.Attachment{
+				ID:        snowflake.Now(),
+				MediaType: truncate(enc.Type, 64),
+				URL:       enc.URL,
+			},
+		})
+	}
+	return status
+}
+
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
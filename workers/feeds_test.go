@@ -0,0 +1,144 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bardic/pub/models"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestFeedPoller(t *testing.T) {
+	require := require.New(t)
+	db := setupTestDB(t)
+	tx := db.Begin()
+	defer tx.Rollback()
+
+	// the feed has one entry, until it is published, when it has two.
+	var published atomic.Bool
+	var conditional atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := fmt.Sprintf(`"%t"`, published.Load())
+		if r.Header.Get("If-None-Match") == etag {
+			conditional.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>Example Blog</title><link>https://blog.example.com/</link>`)
+		if published.Load() {
+			fmt.Fprint(w, `<item><guid>https://blog.example.com/2</guid><title>Second post</title><description>Another post</description><pubDate>Tue, 03 Jan 2023 00:00:00 +0000</pubDate></item>`)
+		}
+		fmt.Fprint(w, `<item><guid>https://blog.example.com/1</guid><title>First post</title><description>Hello, world</description><pubDate>Mon, 02 Jan 2023 00:00:00 +0000</pubDate></item>`)
+		fmt.Fprint(w, `</channel></rss>`)
+	}))
+	defer srv.Close()
+
+	instance, err := models.NewInstances(tx).Create("example.com", "Example", "Example instance", "admin@example.com")
+	require.NoError(err)
+	account, err := models.NewAccounts(tx).Create(instance, "alice", "alice@example.com", "password")
+	require.NoError(err)
+
+	ctx := context.Background()
+	poller := NewFeedPoller(tx, srv.Client())
+	f, err := poller.Add(ctx, account.Actor, srv.URL+"/feed.xml")
+	require.NoError(err)
+	require.Equal("Example Blog", f.Actor.DisplayName)
+	require.Equal(`"false"`, f.ETag)
+
+	countStatuses := func() int64 {
+		var count int64
+		require.NoError(tx.Model(&models.Status{}).Where("actor_id = ?", f.ActorID).Count(&count).Error)
+		return count
+	}
+	require.EqualValues(1, countStatuses())
+
+	var status models.Status
+	require.NoError(tx.Take(&status, "uri = ?", "https://blog.example.com/1").Error)
+	require.Equal("unlisted", string(status.Visibility))
+	require.Equal("First post", status.Title)
+	require.Contains(status.Note, "Hello, world")
+
+	var rel models.Relationship
+	require.NoError(tx.Take(&rel, "actor_id = ? and target_id = ?", account.Actor.ID, f.ActorID).Error)
+	require.True(rel.Following)
+
+	// following and creating statuses for a feed does not send follow requests
+	// or fetch the feed's actor.
+	var count int64
+	require.NoError(tx.Model(&models.RelationshipRequest{}).Where("target_id = ?", f.ActorID).Count(&count).Error)
+	require.Zero(count)
+	require.NoError(tx.Model(&models.ActorRefreshRequest{}).Where("actor_id = ?", f.ActorID).Count(&count).Error)
+	require.Zero(count)
+
+	require.NoError(poller.Poll(ctx, f))
+	require.EqualValues(1, conditional.Load())
+	require.EqualValues(1, countStatuses())
+
+	published.Store(true)
+	require.NoError(poller.Poll(ctx, f))
+	require.Equal(`"true"`, f.ETag)
+	require.EqualValues(2, countStatuses())
+
+	srv.Close()
+	require.Error(poller.Poll(ctx, f))
+	require.NoError(tx.Take(f, "actor_id = ?", f.ActorID).Error)
+	require.NotEmpty(f.LastResult)
+}
+
+func TestDueFeeds(t *testing.T) {
+	require := require.New(t)
+	db := setupTestDB(t)
+	tx := db.Begin()
+	defer tx.Rollback()
+
+	instance, err := models.NewInstances(tx).Create("example.com", "Example", "Example instance", "admin@example.com")
+	require.NoError(err)
+	account, err := models.NewAccounts(tx).Create(instance, "alice", "alice@example.com", "password")
+	require.NoError(err)
+
+	feeds := models.NewFeeds(tx)
+	followed, err := feeds.Create("https://blog.example/followed.xml", "", "", "", "")
+	require.NoError(err)
+	_, err = models.NewRelationships(tx).Follow(account.Actor, followed.Actor)
+	require.NoError(err)
+	unfollowed, err := feeds.Create("https://blog.example/unfollowed.xml", "", "", "", "")
+	require.NoError(err)
+	_, err = models.NewRelationships(tx).Follow(account.Actor, unfollowed.Actor)
+	require.NoError(err)
+	_, err = models.NewRelationships(tx).Unfollow(account.Actor, unfollowed.Actor)
+	require.NoError(err)
+	_, err = feeds.Create("https://blog.example/never.xml", "", "", "", "")
+	require.NoError(err)
+
+	due, err := dueFeeds(tx, time.Now())
+	require.NoError(err)
+	require.Len(due, 1)
+	require.Equal(followed.URL, due[0].URL)
+
+	due, err = dueFeeds(tx, time.Time{})
+	require.NoError(err)
+	require.Empty(due)
+}
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	require := require.New(t)
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{
+		TranslateError: true,
+		Logger:         logger.Default.LogMode(logger.Warn),
+	})
+	require.NoError(err)
+	require.NoError(db.AutoMigrate(models.AllTables()...))
+	require.NoError(db.Exec("PRAGMA foreign_keys = ON").Error)
+	return db
+}
@@ -0,0 +1,53 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bardic/pub/models"
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+)
+
+// NewInstanceActivityProcessor recounts the weekly activity of each instance every hour.
+func NewInstanceActivityProcessor(db *gorm.DB, logger *slog.Logger) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		fmt.Println("InstanceActivityProcessor started")
+		defer fmt.Println("InstanceActivityProcessor stopped")
+
+		db := db.WithContext(ctx)
+		for {
+			if err := updateInstanceActivity(db); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				logger.Error("error updating instance activity", "error", err)
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(time.Hour):
+				// continue
+			}
+		}
+	}
+}
+
+// updateInstanceActivity recounts the activity of every instance in each of the
+// weeks reported by InstancesActivityShow.
+func updateInstanceActivity(db *gorm.DB) error {
+	var instances []*models.Instance
+	if err := db.Find(&instances).Error; err != nil {
+		return err
+	}
+	week := models.StartOfWeek(time.Now())
+	for _, instance := range instances {
+		for n := 0; n < models.ActivityWeeks; n++ {
+			if err := models.NewInstances(db).UpdateActivity(instance, week.AddDate(0, 0, -7*n)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
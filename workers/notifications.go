@@ -0,0 +1,35 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bardic/pub/models"
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+)
+
+// NewPollNotificationProcessor notifies the authors of polls which have ended, every minute.
+func NewPollNotificationProcessor(db *gorm.DB, logger *slog.Logger) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		fmt.Println("PollNotificationProcessor started")
+		defer fmt.Println("PollNotificationProcessor stopped")
+
+		db := db.WithContext(ctx)
+		for {
+			if err := models.NewNotifications(db).EndedPolls(time.Now()); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				logger.Error("error notifying ended polls", "error", err)
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(time.Minute):
+				// continue
+			}
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bardic/pub/internal/httpx"
+	"github.com/bardic/pub/internal/snowflake"
+	"github.com/bardic/pub/internal/webpush"
+	"github.com/bardic/pub/models"
+	"github.com/go-json-experiment/json"
+	"golang.org/x/exp/slog"
+	"golang.org/x/net/html"
+	"gorm.io/gorm"
+)
+
+// pushTTL is how long a push service should keep an undelivered message.
+const pushTTL = 48 * time.Hour
+
+// NewPushRequestProcessor delivers notifications to their account's push subscriptions.
+func NewPushRequestProcessor(db *gorm.DB, logger *slog.Logger) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		fmt.Println("PushRequestProcessor started")
+		defer fmt.Println("PushRequestProcessor stopped")
+
+		pusher := &pusher{
+			client: httpx.DefaultClient,
+			logger: logger,
+		}
+
+		db := db.WithContext(ctx)
+		for {
+			if err := process(db, pushRequestScope, pusher.processPushRequest); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				logger.Error("error processing push requests", "error", err)
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(10 * time.Second):
+				// continue
+			}
+		}
+	}
+}
+
+func pushRequestScope(db *gorm.DB) *gorm.DB {
+	return db.Preload("Notification").
+		Preload("Notification.FromActor").
+		Preload("Notification.Status").
+		Preload("Notification.Account").Preload("Notification.Account.Actor").Preload("Notification.Account.Instance").
+		Where("attempts < 3")
+}
+
+type pusher struct {
+	// client is the http.Client to deliver pushes with.
+	client *http.Client
+	// logger is the slog.Logger to use for logging.
+	logger *slog.Logger
+}
+
+// processPushRequest pushes the request's notification to each subscription of
+// its account which alerts for it. Subscriptions the push service reports are
+// gone are deleted. Other failures are logged rather than retried, so the
+// subscriptions which were delivered to are not pushed to again.
+func (p *pusher) processPushRequest(db *gorm.DB, request *models.PushRequest) error {
+	n := request.Notification
+	instance := n.Account.Instance
+	var subs []*models.PushSubscription
+	if err := db.Find(&subs, "account_id = ?", n.AccountID).Error; err != nil {
+		return err
+	}
+	payload, err := pushPayload(n)
+	if err != nil {
+		return err
+	}
+	keys := &webpush.VAPIDKeys{
+		PublicKey:  instance.VapidPublicKey,
+		PrivateKey: instance.VapidPrivateKey,
+	}
+	for _, sub := range subs {
+		ok, err := pushAllowed(db, sub, n)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		err = webpush.Send(db.Statement.Context, p.client, &webpush.Subscription{
+			Endpoint: sub.Endpoint,
+			P256DH:   sub.P256DH,
+			Auth:     sub.Auth,
+		}, payload, keys, "https://"+instance.Domain, pushTTL)
+		switch {
+		case errors.Is(err, webpush.ErrGone):
+			if err := db.Delete(sub).Error; err != nil {
+				return err
+			}
+		case err != nil:
+			p.logger.Error("error pushing notification", "subscription", sub.ID, "notification", n.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+// pushAllowed reports whether sub alerts for n, and n's actor is permitted by
+// the subscription's policy.
+func pushAllowed(db *gorm.DB, sub *models.PushSubscription, n *models.Notification) (bool, error) {
+	if !sub.Alerts(n.Type) {
+		return false, nil
+	}
+	var following *gorm.DB
+	switch sub.Policy {
+	case "none":
+		return false, nil
+	case "followed":
+		following = db.Where("actor_id = ? and target_id = ?", n.Account.ActorID, n.FromActorID)
+	case "follower":
+		following = db.Where("actor_id = ? and target_id = ?", n.FromActorID, n.Account.ActorID)
+	default:
+		return true, nil
+	}
+	var count int64
+	err := following.Model(&models.Relationship{}).Where("following = ?", true).Count(&count).Error
+	return count > 0, err
+}
+
+// pushPayload returns the JSON payload pushed for n, in the form the Mastodon
+// web client's service worker expects.
+func pushPayload(n *models.Notification) ([]byte, error) {
+	name := n.FromActor.DisplayName
+	if name == "" {
+		name = n.FromActor.Name
+	}
+	var title string
+	switch n.Type {
+	case "mention":
+		title = name + " mentioned you"
+	case "status":
+		title = name + " just posted"
+	case "reblog":
+		title = name + " boosted your post"
+	case "follow":
+		title = name + " followed you"
+	case "follow_request":
+		title = name + " has requested to follow you"
+	case "favourite":
+		title = name + " favourited your post"
+	case "poll":
+		title = "Your poll has ended"
+	case "update":
+		title = name + " edited a post"
+	default:
+		title = "New notification"
+	}
+	var body string
+	if n.Status != nil {
+		body = n.Status.SpoilerText
+		if body == "" {
+			body = truncate(plainText(n.Status.Note), 140)
+		}
+	}
+	return json.Marshal(struct {
+		NotificationID   snowflake.ID `json:"notification_id"`
+		NotificationType string       `json:"notification_type"`
+		PreferredLocale  string       `json:"preferred_locale"`
+		Icon             string       `json:"icon"`
+		Title            string       `json:"title"`
+		Body             string       `json:"body"`
+	}{
+		NotificationID:   n.ID,
+		NotificationType: string(n.Type),
+		PreferredLocale:  "en",
+		Icon:             n.FromActor.Avatar,
+		Title:            title,
+		Body:             body,
+	})
+}
+
+// plainText returns the text of an HTML fragment.
+func plainText(fragment string) string {
+	var sb strings.Builder
+	z := html.NewTokenizer(strings.NewReader(fragment))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return strings.Join(strings.Fields(sb.String()), " ")
+		case html.TextToken:
+			sb.Write(z.Text())
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if name, _ := z.TagName(); string(name) == "p" || string(name) == "br" {
+				sb.WriteByte(' ')
+			}
+		}
+	}
+}
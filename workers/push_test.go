@@ -0,0 +1,176 @@
+package workers
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bardic/pub/internal/snowflake"
+	"github.com/bardic/pub/models"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+)
+
+func TestPushRequestProcessor(t *testing.T) {
+	db := setupTestDB(t)
+
+	// pushService is a stand-in for a push service which records the pushes it
+	// receives and responds with status.
+	type pushService struct {
+		*httptest.Server
+		pushes []*http.Request
+		status int
+	}
+	newPushService := func(t *testing.T) *pushService {
+		t.Helper()
+		ps := &pushService{status: http.StatusCreated}
+		ps.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ps.pushes = append(ps.pushes, r)
+			w.WriteHeader(ps.status)
+		}))
+		t.Cleanup(ps.Close)
+		return ps
+	}
+
+	// mockSubscription creates alice's account and her push subscription to ps,
+	// which alerts for favourites, and bob, a remote actor.
+	mockSubscription := func(t *testing.T, tx *gorm.DB, ps *pushService) (*models.Account, *models.PushSubscription, *models.Actor) {
+		t.Helper()
+		require := require.New(t)
+		instance, err := models.NewInstances(tx).Create("example.com", "Example", "Example instance", "admin@example.com")
+		require.NoError(err)
+		alice, err := models.NewAccounts(tx).Create(instance, "alice", "alice@example.com", "password")
+		require.NoError(err)
+		ua, err := ecdh.P256().GenerateKey(rand.Reader)
+		require.NoError(err)
+		sub := &models.PushSubscription{
+			AccountID: alice.ID,
+			Endpoint:  ps.URL + "/push/alice",
+			P256DH:    base64.RawURLEncoding.EncodeToString(ua.PublicKey().Bytes()),
+			Auth:      base64.RawURLEncoding.EncodeToString([]byte("0123456789abcdef")),
+			Favourite: true,
+			Policy:    "all",
+		}
+		require.NoError(tx.Create(sub).Error)
+		bob := &models.Actor{
+			ID:          snowflake.Now(),
+			URI:         "https://remote.example/users/bob",
+			Name:        "bob",
+			Domain:      "remote.example",
+			DisplayName: "Bob",
+			PublicKey:   []byte{},
+		}
+		require.NoError(tx.Create(bob).Error)
+		return alice, sub, bob
+	}
+
+	// push processes the pending push requests, delivering them to ps.
+	push := func(tx *gorm.DB, ps *pushService) error {
+		p := &pusher{
+			client: ps.Client(),
+			logger: slog.New(slog.NewTextHandler(io.Discard)),
+		}
+		return process(tx, pushRequestScope, p.processPushRequest)
+	}
+
+	pending := func(t *testing.T, tx *gorm.DB) int64 {
+		t.Helper()
+		var count int64
+		require.NoError(t, tx.Model(&models.PushRequest{}).Count(&count).Error)
+		return count
+	}
+
+	t.Run("notifications are pushed to subscriptions which alert for them", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		ps := newPushService(t)
+		alice, _, bob := mockSubscription(t, tx, ps)
+		status, err := models.NewStatuses(tx).Create(alice.Actor, nil, "public", false, "", "en", "hello")
+		require.NoError(err)
+
+		_, err = models.NewReactions(tx).Favourite(status, bob)
+		require.NoError(err)
+		// the subscription does not alert for follows.
+		_, err = models.NewRelationships(tx).Follow(bob, alice.Actor)
+		require.NoError(err)
+		require.EqualValues(2, pending(t, tx))
+
+		require.NoError(push(tx, ps))
+		require.Zero(pending(t, tx))
+		require.Len(ps.pushes, 1)
+		got := ps.pushes[0]
+		require.Equal("/push/alice", got.URL.Path)
+		require.Equal("aes128gcm", got.Header.Get("Content-Encoding"))
+		require.True(strings.HasPrefix(got.Header.Get("Authorization"), "vapid t="))
+	})
+
+	t.Run("policy limits whose notifications are pushed", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		ps := newPushService(t)
+		alice, sub, bob := mockSubscription(t, tx, ps)
+		require.NoError(tx.Model(sub).UpdateColumn("policy", "followed").Error)
+		status, err := models.NewStatuses(tx).Create(alice.Actor, nil, "public", false, "", "en", "hello")
+		require.NoError(err)
+
+		_, err = models.NewReactions(tx).Favourite(status, bob)
+		require.NoError(err)
+		require.NoError(push(tx, ps))
+		require.Empty(ps.pushes, "alice does not follow bob")
+
+		require.NoError(tx.Create(&models.Relationship{ActorID: alice.ActorID, TargetID: bob.ID, Following: true}).Error)
+		_, err = models.NewReactions(tx).Unfavourite(status, bob)
+		require.NoError(err)
+		_, err = models.NewReactions(tx).Favourite(status, bob)
+		require.NoError(err)
+		require.NoError(push(tx, ps))
+		require.Len(ps.pushes, 1)
+	})
+
+	t.Run("subscriptions which are gone are deleted", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		ps := newPushService(t)
+		ps.status = http.StatusGone
+		alice, sub, bob := mockSubscription(t, tx, ps)
+		status, err := models.NewStatuses(tx).Create(alice.Actor, nil, "public", false, "", "en", "hello")
+		require.NoError(err)
+
+		_, err = models.NewReactions(tx).Favourite(status, bob)
+		require.NoError(err)
+		require.NoError(push(tx, ps))
+		require.Len(ps.pushes, 1)
+		require.Zero(pending(t, tx))
+		require.ErrorIs(tx.Take(&models.PushSubscription{}, sub.ID).Error, gorm.ErrRecordNotFound)
+	})
+	t.Run("failed pushes are not retried", func(t *testing.T) {
+		require := require.New(t)
+		tx := db.Begin()
+		defer tx.Rollback()
+
+		ps := newPushService(t)
+		ps.status = http.StatusInternalServerError
+		alice, sub, bob := mockSubscription(t, tx, ps)
+		status, err := models.NewStatuses(tx).Create(alice.Actor, nil, "public", false, "", "en", "hello")
+		require.NoError(err)
+
+		_, err = models.NewReactions(tx).Favourite(status, bob)
+		require.NoError(err)
+		require.NoError(push(tx, ps))
+		require.Len(ps.pushes, 1)
+		require.Zero(pending(t, tx))
+		require.NoError(tx.Take(&models.PushSubscription{}, sub.ID).Error)
+	})
+}
@@ -38,12 +38,23 @@ func reactionRequestScope(db *gorm.DB) *gorm.DB {
 func processReactionRequest(db *gorm.DB, request *models.ReactionRequest) error {
 	fmt.Println("ReactionRequestProcessor: actor:", request.Actor.URI, "target:", request.Target.URI, "action:", request.Action)
 
+	if request.Actor.IsRemote() {
+		// reactions received from remote actors were delivered by their own server.
+		return nil
+	}
+
 	accounts := models.NewAccounts(db)
 	account, err := accounts.AccountForActor(request.Actor)
 	if err != nil {
 		return err
 	}
 
+	switch request.Action {
+	case "pin", "unpin":
+		// pins are announced to our followers, not the author, who is us.
+		return processPinRequest(db, account, request)
+	}
+
 	inbox := request.Target.Actor.Inbox()
 	if inbox == "" {
 		if err := models.NewActors(db).Refresh(request.Target.Actor); err != nil {
@@ -54,10 +65,24 @@ func processReactionRequest(db *gorm.DB, request *models.ReactionRequest) error
 
 	switch request.Action {
 	case "like":
-		return activitypub.Like(db.Statement.Context, account, request.Target)
+		if err := activitypub.Like(db.Statement.Context, account, request.Target); err != nil {
+			return err
+		}
+		return models.NewPeers(db).Record(request.Target.Actor.Domain)
 	case "unlike":
 		return activitypub.Unlike(db.Statement.Context, account, request.Target)
 	default:
 		return fmt.Errorf("unknown action %q", request.Action)
 	}
 }
+
+func processPinRequest(db *gorm.DB, account *models.Account, request *models.ReactionRequest) error {
+	inboxes, err := models.NewRelationships(db).FollowerInboxes(request.Actor)
+	if err != nil {
+		return err
+	}
+	if request.Action == "pin" {
+		return activitypub.Pin(db.Statement.Context, account, request.Target, inboxes)
+	}
+	return activitypub.Unpin(db.Statement.Context, account, request.Target, inboxes)
+}
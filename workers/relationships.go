@@ -48,7 +48,10 @@ func processRelationshipRequest(log *slog.Logger, db *gorm.DB, request *models.R
 	}
 	switch request.Action {
 	case "follow":
-		return activitypub.Follow(db.Statement.Context, account, request.Target)
+		if err := activitypub.Follow(db.Statement.Context, account, request.Target); err != nil {
+			return err
+		}
+		return models.NewPeers(db).Record(request.Target.Domain)
 	case "unfollow":
 		return activitypub.Unfollow(db.Statement.Context, account, request.Target)
 	default:
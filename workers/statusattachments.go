@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/bardic/pub/internal/algorithms"
+	"github.com/bardic/pub/internal/httpx"
 	"github.com/bardic/pub/models"
 	"gorm.io/gorm"
 )
@@ -39,6 +40,14 @@ func statusAttachementRequestScope(db *gorm.DB) *gorm.DB {
 
 func processStatusAttachmentRequest(tx *gorm.DB, request *models.StatusAttachmentRequest) error {
 	fmt.Println("StatusAttachmentRequestProcessor", request.StatusAttachment.URL)
+	rejected, err := models.NewDomainBlocks(tx).RejectsMedia(request.StatusAttachment.StatusID)
+	if err != nil {
+		return err
+	}
+	if rejected {
+		// the attachment's domain is blocked, drop the request.
+		return nil
+	}
 	ctx, cancel := context.WithTimeout(tx.Statement.Context, 10*time.Second)
 	defer cancel()
 
@@ -47,7 +56,7 @@ func processStatusAttachmentRequest(tx *gorm.DB, request *models.StatusAttachmen
 		return err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httpx.DefaultClient.Do(req)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,66 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bardic/pub/activitypub"
+	"github.com/bardic/pub/models"
+	"golang.org/x/exp/slog"
+	"gorm.io/gorm"
+)
+
+// NewStatusBackfillProcessor fetches the missing ancestors and replies of remote
+// statuses, passing them through policies.
+func NewStatusBackfillProcessor(db *gorm.DB, admin *models.Account, logger *slog.Logger, policies ...activitypub.Policy) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		fmt.Println("StatusBackfillProcessor started")
+		defer fmt.Println("StatusBackfillProcessor stopped")
+
+		backfiller := &statusBackfiller{
+			signAs:   admin,
+			logger:   logger,
+			policies: policies,
+		}
+
+		db := db.WithContext(ctx)
+		for {
+			if err := process(db, statusBackfillScope, backfiller.processStatusBackfill); err != nil {
+				return err
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(30 * time.Second):
+				// continue
+			}
+		}
+	}
+}
+
+func statusBackfillScope(db *gorm.DB) *gorm.DB {
+	return db.Preload("Status").Preload("Status.Actor").Where("attempts < 3")
+}
+
+type statusBackfiller struct {
+	// signAs is the account to sign requests as.
+	signAs *models.Account
+	// logger is the slog.Logger to use for logging.
+	logger *slog.Logger
+	// policies are applied to the statuses fetched.
+	policies []activitypub.Policy
+}
+
+func (s *statusBackfiller) processStatusBackfill(db *gorm.DB, request *models.StatusBackfillRequest) error {
+	if request.Status.Actor.IsLocal() {
+		// replies to local statuses are delivered to us.
+		return nil
+	}
+	s.logger.Info("processStatusBackfill", slog.String("uri", request.Status.URI), slog.Int("attempt", int(request.Attempts)+1))
+	backfiller, err := activitypub.NewBackfiller(s.signAs, db, s.logger, s.policies...)
+	if err != nil {
+		return err
+	}
+	return backfiller.Backfill(db.Statement.Context, request.Status)
+}